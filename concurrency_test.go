@@ -6,7 +6,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
 	"os/exec"
 	"sync"
 	"testing"
@@ -18,6 +20,17 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+// postJSON posts a JSON body, authenticating with the API key from CITYNEXT_API_KEY
+func postJSON(client *http.Client, url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-API-Key", os.Getenv("CITYNEXT_API_KEY"))
+	return client.Do(req)
+}
+
 // cleanupDatabase removes test data from the appointments table
 func cleanupDatabase(t *testing.T) {
 	t.Helper()
@@ -65,16 +78,16 @@ func TestConcurrentRequests(t *testing.T) {
 
 	t.Run("ConcurrentValidRequests", func(t *testing.T) {
 		requests := []models.CreateAppointmentRequest{
-			{"Alice", "Smith", "2075-09-01"},
-			{"Bob", "Johnson", "2075-09-02"},
-			{"Charlie", "Brown", "2075-09-03"},
-			{"Diana", "Wilson", "2075-09-04"},
-			{"Eve", "Davis", "2075-09-05"},
-			{"Frank", "Miller", "2075-09-06"},
-			{"Grace", "Taylor", "2075-09-07"},
-			{"Henry", "Anderson", "2075-09-08"},
-			{"Ivy", "Thomas", "2075-09-09"},
-			{"Jack", "Jackson", "2075-09-10"},
+			{FirstName: "Alice", LastName: "Smith", Email: "alice.smith@example.com", VisitDate: "2075-09-01", ServiceType: "general"},
+			{FirstName: "Bob", LastName: "Johnson", Email: "bob.johnson@example.com", VisitDate: "2075-09-02", ServiceType: "general"},
+			{FirstName: "Charlie", LastName: "Brown", Email: "charlie.brown@example.com", VisitDate: "2075-09-03", ServiceType: "general"},
+			{FirstName: "Diana", LastName: "Wilson", Email: "diana.wilson@example.com", VisitDate: "2075-09-04", ServiceType: "general"},
+			{FirstName: "Eve", LastName: "Davis", Email: "eve.davis@example.com", VisitDate: "2075-09-05", ServiceType: "general"},
+			{FirstName: "Frank", LastName: "Miller", Email: "frank.miller@example.com", VisitDate: "2075-09-06", ServiceType: "general"},
+			{FirstName: "Grace", LastName: "Taylor", Email: "grace.taylor@example.com", VisitDate: "2075-09-07", ServiceType: "general"},
+			{FirstName: "Henry", LastName: "Anderson", Email: "henry.anderson@example.com", VisitDate: "2075-09-08", ServiceType: "general"},
+			{FirstName: "Ivy", LastName: "Thomas", Email: "ivy.thomas@example.com", VisitDate: "2075-09-09", ServiceType: "general"},
+			{FirstName: "Jack", LastName: "Jackson", Email: "jack.jackson@example.com", VisitDate: "2075-09-10", ServiceType: "general"},
 		}
 
 		var wg sync.WaitGroup
@@ -91,7 +104,7 @@ func TestConcurrentRequests(t *testing.T) {
 				jsonBody, err := json.Marshal(request)
 				require.NoError(t, err)
 
-				resp, err := http.Post(
+				resp, err := postJSON(http.DefaultClient,
 					baseURL+"/appointments",
 					"application/json",
 					bytes.NewBuffer(jsonBody),
@@ -134,9 +147,11 @@ func TestConcurrentRequests(t *testing.T) {
 		requests := make([]models.CreateAppointmentRequest, requestCount)
 		for i := 0; i < requestCount; i++ {
 			requests[i] = models.CreateAppointmentRequest{
-				FirstName: fmt.Sprintf("User%d", i),
-				LastName:  "Concurrent",
-				VisitDate: duplicateDate,
+				FirstName:   fmt.Sprintf("User%d", i),
+				Email:       fmt.Sprintf("user%d@example.com", i),
+				LastName:    "Concurrent",
+				VisitDate:   duplicateDate,
+				ServiceType: "general",
 			}
 		}
 
@@ -153,7 +168,7 @@ func TestConcurrentRequests(t *testing.T) {
 				jsonBody, err := json.Marshal(request)
 				require.NoError(t, err)
 
-				resp, err := http.Post(
+				resp, err := postJSON(http.DefaultClient,
 					baseURL+"/appointments",
 					"application/json",
 					bytes.NewBuffer(jsonBody),
@@ -187,12 +202,12 @@ func TestConcurrentRequests(t *testing.T) {
 			req            models.CreateAppointmentRequest
 			expectedStatus int
 		}{
-			{models.CreateAppointmentRequest{"Valid", "User1", "2075-09-20"}, http.StatusCreated},
-			{models.CreateAppointmentRequest{"Valid", "User2", "2075-09-21"}, http.StatusCreated},
-			{models.CreateAppointmentRequest{"Past", "Date", "2075-07-10"}, http.StatusBadRequest},
-			{models.CreateAppointmentRequest{"Invalid", "Format", "25-09-2075"}, http.StatusBadRequest},
-			{models.CreateAppointmentRequest{"", "Empty", "2075-09-22"}, http.StatusBadRequest},
-			{models.CreateAppointmentRequest{"Holiday", "Test", "2075-12-25"}, http.StatusBadRequest},
+			{models.CreateAppointmentRequest{FirstName: "Valid", LastName: "User1", Email: "valid.user1@example.com", VisitDate: "2075-09-20", ServiceType: "general"}, http.StatusCreated},
+			{models.CreateAppointmentRequest{FirstName: "Valid", LastName: "User2", Email: "valid.user2@example.com", VisitDate: "2075-09-21", ServiceType: "general"}, http.StatusCreated},
+			{models.CreateAppointmentRequest{FirstName: "Past", LastName: "Date", Email: "past.date@example.com", VisitDate: "2075-07-10", ServiceType: "general"}, http.StatusBadRequest},
+			{models.CreateAppointmentRequest{FirstName: "Invalid", LastName: "Format", Email: "invalid.format@example.com", VisitDate: "25-09-2075", ServiceType: "general"}, http.StatusBadRequest},
+			{models.CreateAppointmentRequest{FirstName: "", LastName: "Empty", VisitDate: "2075-09-22", ServiceType: "general"}, http.StatusBadRequest},
+			{models.CreateAppointmentRequest{FirstName: "Holiday", LastName: "Test", Email: "holiday.test@example.com", VisitDate: "2075-12-25", ServiceType: "general"}, http.StatusBadRequest},
 		}
 
 		var wg sync.WaitGroup
@@ -214,7 +229,7 @@ func TestConcurrentRequests(t *testing.T) {
 				jsonBody, err := json.Marshal(tc.req)
 				require.NoError(t, err)
 
-				resp, err := http.Post(
+				resp, err := postJSON(http.DefaultClient,
 					baseURL+"/appointments",
 					"application/json",
 					bytes.NewBuffer(jsonBody),
@@ -269,16 +284,18 @@ func TestServerPerformanceUnderLoad(t *testing.T) {
 				defer wg.Done()
 
 				req := models.CreateAppointmentRequest{
-					FirstName: fmt.Sprintf("Load%d", index),
-					LastName:  "Test",
-					VisitDate: fmt.Sprintf("2075-10-%02d", (index%28)+1),
+					FirstName:   fmt.Sprintf("Load%d", index),
+					Email:       fmt.Sprintf("load%d@example.com", index),
+					LastName:    "Test",
+					VisitDate:   fmt.Sprintf("2075-10-%02d", (index%28)+1),
+					ServiceType: "general",
 				}
 
 				jsonBody, err := json.Marshal(req)
 				require.NoError(t, err)
 
 				client := &http.Client{Timeout: timeout}
-				resp, err := client.Post(
+				resp, err := postJSON(client,
 					baseURL+"/appointments",
 					"application/json",
 					bytes.NewBuffer(jsonBody),
@@ -329,13 +346,15 @@ func BenchmarkConcurrentRequests(b *testing.B) {
 
 	for i := 0; i < b.N; i++ {
 		req := models.CreateAppointmentRequest{
-			FirstName: fmt.Sprintf("Bench%d", i),
-			LastName:  "Mark",
-			VisitDate: fmt.Sprintf("2075-11-%02d", (i%28)+1),
+			FirstName:   fmt.Sprintf("Bench%d", i),
+			Email:       fmt.Sprintf("bench%d@example.com", i),
+			LastName:    "Mark",
+			VisitDate:   fmt.Sprintf("2075-11-%02d", (i%28)+1),
+			ServiceType: "general",
 		}
 
 		jsonBody, _ := json.Marshal(req)
-		resp, err := http.Post(
+		resp, err := postJSON(http.DefaultClient,
 			baseURL+"/appointments",
 			"application/json",
 			bytes.NewBuffer(jsonBody),
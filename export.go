@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"citynext-appointments/internal/config"
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/service"
+)
+
+const exportUsage = `usage: citynext-appointments export -out FILE [-format csv|jsonl] [-from YYYY-MM-DD] [-to YYYY-MM-DD] [-tenant SLUG]
+
+Writes every appointment of the tenant, "default" unless set, with a visit date
+in the range, including cancelled ones. The database is taken from CONFIG_FILE and the usual environment variables.`
+
+// runExportCommand implements the "export" subcommand for bulk exports to a file
+func runExportCommand(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(out)
+	fs.Usage = func() { fmt.Fprintln(out, exportUsage) }
+
+	path := fs.String("out", "", "file to write, - for standard output")
+	format := fs.String("format", service.ExportFormatCSV, "csv or jsonl")
+	fromFlag := fs.String("from", "", "first visit date to include")
+	toFlag := fs.String("to", "", "last visit date to include")
+	tenantSlug := fs.String("tenant", "default", "slug of the tenant to export")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *path == "" {
+		return fmt.Errorf("%s", exportUsage)
+	}
+	if _, err := service.ParseExportFormat(*format); err != nil {
+		return err
+	}
+	from, err := parseOptionalDate("-from", *fromFlag)
+	if err != nil {
+		return err
+	}
+	to, err := parseOptionalDate("-to", *toFlag)
+	if err != nil {
+		return err
+	}
+
+	cfg, _, err := config.Load(nil)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if _, err := useEncryption(cfg.Encryption); err != nil {
+		return err
+	}
+
+	database, tenants, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	tenantCtx, err := tenantContext(tenants, *tenantSlug)
+	if err != nil {
+		return err
+	}
+
+	w := os.Stdout
+	if *path != "-" {
+		file, err := os.Create(*path)
+		if err != nil {
+			return fmt.Errorf("failed to create export file: %w", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	count, err := service.NewExportService(database).Export(tenantCtx, w, *format, from, to)
+	if err != nil {
+		return err
+	}
+	if w != os.Stdout {
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("failed to write export file: %w", err)
+		}
+		fmt.Fprintf(out, "Exported %d appointments to %s\n", count, *path)
+	}
+	return nil
+}
+
+func parseOptionalDate(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	date, err := time.Parse(constants.DateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %s", name, constants.ErrInvalidDateFormat)
+	}
+	return date, nil
+}
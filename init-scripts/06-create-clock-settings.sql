@@ -0,0 +1,11 @@
+-- 06-create-clock-settings.sql
+-- Shared simulated clock so every replica and restart agrees on "now"
+-- Depends on: 03-grant-permissions.sql (default privileges)
+
+CREATE TABLE IF NOT EXISTS clock_settings (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    mode VARCHAR(10) NOT NULL CHECK (mode IN ('offset', 'frozen')),
+    simulated_epoch TIMESTAMPTZ NOT NULL,
+    real_epoch TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
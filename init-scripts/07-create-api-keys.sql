@@ -0,0 +1,13 @@
+-- 07-create-api-keys.sql
+-- Hashed API keys with the role granted to each caller
+-- Depends on: 03-grant-permissions.sql (default privileges)
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    role VARCHAR(20) NOT NULL CHECK (role IN ('citizen-portal', 'front-desk', 'admin')),
+    key_prefix VARCHAR(16) NOT NULL,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMP
+);
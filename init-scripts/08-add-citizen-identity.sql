@@ -0,0 +1,13 @@
+-- 08-add-citizen-identity.sql
+-- Link appointments to the citizen portal identity and allow cancellation
+-- Depends on: 02-create-tables.sql
+
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS citizen_subject VARCHAR(255);
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP;
+
+-- A cancelled appointment frees its date, so uniqueness only applies to active bookings
+ALTER TABLE appointments DROP CONSTRAINT IF EXISTS appointments_visit_date_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_appointments_active_visit_date
+    ON appointments(visit_date) WHERE cancelled_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_appointments_citizen_subject ON appointments(citizen_subject);
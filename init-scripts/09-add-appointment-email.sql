@@ -0,0 +1,5 @@
+-- 09-add-appointment-email.sql
+-- Optional contact address used for booking notifications
+-- Depends on: 02-create-tables.sql
+
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS email VARCHAR(254);
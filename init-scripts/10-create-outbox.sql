@@ -0,0 +1,20 @@
+-- 10-create-outbox.sql
+-- Booking events written in the same transaction as the appointment change
+-- and delivered to downstream systems by the outbox dispatcher
+-- Depends on: 03-grant-permissions.sql (default privileges)
+
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id BIGSERIAL PRIMARY KEY,
+    event_type VARCHAR(100) NOT NULL,
+    aggregate_id INTEGER NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT,
+    dispatched_at TIMESTAMP
+);
+
+-- The dispatcher only ever looks at pending events, oldest first
+CREATE INDEX IF NOT EXISTS idx_outbox_events_pending
+    ON outbox_events(next_attempt_at, id) WHERE dispatched_at IS NULL;
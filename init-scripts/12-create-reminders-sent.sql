@@ -0,0 +1,11 @@
+-- 12-create-reminders-sent.sql
+-- One row per reminder sent, so restarts and replicas never remind twice
+-- Depends on: 02-create-tables.sql, 03-grant-permissions.sql (default privileges)
+
+CREATE TABLE IF NOT EXISTS reminders_sent (
+    appointment_id INTEGER NOT NULL REFERENCES appointments(id) ON DELETE CASCADE,
+    -- How long before the visit the reminder is due, e.g. 72h0m0s
+    kind VARCHAR(32) NOT NULL,
+    sent_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (appointment_id, kind)
+);
@@ -0,0 +1,30 @@
+-- 13-create-waitlist.sql
+-- Citizens waiting for a booked date, offered the date in FIFO order when it frees up
+-- Depends on: 02-create-tables.sql, 03-grant-permissions.sql (default privileges)
+
+CREATE TABLE IF NOT EXISTS waitlist_entries (
+    id SERIAL PRIMARY KEY,
+    first_name VARCHAR(100) NOT NULL,
+    last_name VARCHAR(100) NOT NULL,
+    email VARCHAR(254),
+    citizen_subject VARCHAR(255),
+    visit_date DATE NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'waiting' CHECK (status IN ('waiting', 'offered', 'accepted', 'expired')),
+    -- Set while the date is offered; the token is the citizen's proof of the offer
+    offer_token VARCHAR(64) UNIQUE,
+    offer_expires_at TIMESTAMP,
+    appointment_id INTEGER REFERENCES appointments(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- The queue of a date, in join order
+CREATE INDEX IF NOT EXISTS idx_waitlist_entries_queue
+    ON waitlist_entries (visit_date, id) WHERE status = 'waiting';
+
+-- A date is offered to one citizen at a time
+CREATE UNIQUE INDEX IF NOT EXISTS idx_waitlist_entries_open_offer
+    ON waitlist_entries (visit_date) WHERE status = 'offered';
+
+-- Finds lapsed offers for the sweeper
+CREATE INDEX IF NOT EXISTS idx_waitlist_entries_offer_expiry
+    ON waitlist_entries (offer_expires_at) WHERE status = 'offered';
@@ -0,0 +1,18 @@
+-- 14-create-slot-holds.sql
+-- Short-lived reservations of a date while a citizen finishes the booking flow
+-- Depends on: 03-grant-permissions.sql (default privileges)
+
+CREATE TABLE IF NOT EXISTS slot_holds (
+    id SERIAL PRIMARY KEY,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    visit_date DATE NOT NULL,
+    citizen_subject VARCHAR(255),
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One hold per date. Expired holds are deleted by the sweeper, and before a new
+-- hold on the same date is placed, so they never block anyone for long.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_slot_holds_visit_date ON slot_holds (visit_date);
+
+CREATE INDEX IF NOT EXISTS idx_slot_holds_expires_at ON slot_holds (expires_at);
@@ -0,0 +1,8 @@
+-- 15-add-appointment-reference.sql
+-- Booking reference citizens quote instead of the numeric id, e.g. CN-7K4Q-2M9X.
+-- Rows created before this column existed are given one by the application on startup.
+-- Depends on: 02-create-tables.sql
+
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS reference VARCHAR(12);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_appointments_reference ON appointments (reference);
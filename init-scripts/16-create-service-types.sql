@@ -0,0 +1,44 @@
+-- 16-create-service-types.sql
+-- What a visit is for. Each service type has its own length, required documents
+-- and number of visits per day, and bookings, holds and waitlist entries are
+-- counted against the quota of their own type.
+-- Depends on: 08-add-citizen-identity.sql, 13-create-waitlist.sql, 14-create-slot-holds.sql
+
+CREATE TABLE IF NOT EXISTS service_types (
+    code VARCHAR(50) PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    duration_minutes INTEGER NOT NULL CHECK (duration_minutes > 0),
+    required_documents TEXT[] NOT NULL DEFAULT '{}',
+    daily_quota INTEGER NOT NULL CHECK (daily_quota > 0),
+    -- Retired types stay for existing bookings but cannot be booked
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- general keeps the original one visit per day for bookings made before service types existed
+INSERT INTO service_types (code, name, duration_minutes, required_documents, daily_quota) VALUES
+    ('general', 'General enquiry', 30, '{}', 1),
+    ('passport-renewal', 'Passport renewal', 45, '{"Current passport", "Two passport photos"}', 8),
+    ('parking-permit', 'Parking permit', 15, '{"Proof of address", "Vehicle registration document"}', 20)
+ON CONFLICT (code) DO NOTHING;
+
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS service_type VARCHAR(50) NOT NULL DEFAULT 'general' REFERENCES service_types(code);
+ALTER TABLE waitlist_entries ADD COLUMN IF NOT EXISTS service_type VARCHAR(50) NOT NULL DEFAULT 'general' REFERENCES service_types(code);
+ALTER TABLE slot_holds ADD COLUMN IF NOT EXISTS service_type VARCHAR(50) NOT NULL DEFAULT 'general' REFERENCES service_types(code);
+
+-- A date now takes as many visits of a type as its daily quota. The application
+-- serialises bookings of one type and date, so the one-per-date indexes go.
+DROP INDEX IF EXISTS idx_appointments_active_visit_date;
+CREATE INDEX IF NOT EXISTS idx_appointments_active_visit_date_type
+    ON appointments (visit_date, service_type) WHERE cancelled_at IS NULL;
+
+DROP INDEX IF EXISTS idx_slot_holds_visit_date;
+CREATE INDEX IF NOT EXISTS idx_slot_holds_visit_date_type ON slot_holds (visit_date, service_type);
+
+DROP INDEX IF EXISTS idx_waitlist_entries_queue;
+CREATE INDEX IF NOT EXISTS idx_waitlist_entries_queue
+    ON waitlist_entries (visit_date, service_type, id) WHERE status = 'waiting';
+
+DROP INDEX IF EXISTS idx_waitlist_entries_open_offer;
+CREATE INDEX IF NOT EXISTS idx_waitlist_entries_open_offer
+    ON waitlist_entries (visit_date, service_type) WHERE status = 'offered';
@@ -0,0 +1,42 @@
+-- 17-create-staff.sql
+-- Clerks and counters that handle visits, and the minutes each of them works on
+-- every weekday. A booking is assigned to a rostered clerk with enough minutes
+-- left for its service type, so visits overlap freely across different staff.
+-- Depends on: 07-create-api-keys.sql, 16-create-service-types.sql
+
+CREATE TABLE IF NOT EXISTS staff (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    counter VARCHAR(50),
+    -- Inactive staff keep their past bookings but get no new ones
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- weekday follows EXTRACT(DOW): 0 is Sunday
+CREATE TABLE IF NOT EXISTS staff_rosters (
+    staff_id INTEGER NOT NULL REFERENCES staff(id) ON DELETE CASCADE,
+    weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    minutes INTEGER NOT NULL CHECK (minutes > 0 AND minutes <= 1440),
+    PRIMARY KEY (staff_id, weekday)
+);
+
+-- Two counters staffed every day, so existing installations keep booking as before
+INSERT INTO staff (id, name, counter) VALUES
+    (1, 'Front desk clerk A', 'Counter 1'),
+    (2, 'Front desk clerk B', 'Counter 2')
+ON CONFLICT (id) DO NOTHING;
+SELECT setval('staff_id_seq', GREATEST((SELECT MAX(id) FROM staff), 1));
+
+INSERT INTO staff_rosters (staff_id, weekday, minutes)
+SELECT s.id, d.weekday, 480
+FROM (VALUES (1), (2)) AS s(id), generate_series(0, 6) AS d(weekday)
+ON CONFLICT (staff_id, weekday) DO NOTHING;
+
+-- Imported and older bookings stay unassigned
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS staff_id INTEGER REFERENCES staff(id);
+CREATE INDEX IF NOT EXISTS idx_appointments_staff_visit_date
+    ON appointments (staff_id, visit_date) WHERE cancelled_at IS NULL;
+
+-- A front-desk key linked to a clerk only sees that clerk's agenda
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS staff_id INTEGER REFERENCES staff(id);
@@ -0,0 +1,23 @@
+-- 18-add-appointment-status.sql
+-- Where a visit is in its lifecycle:
+--   booked -> checked_in -> completed
+--   booked -> no_show | cancelled
+-- Each step has its own timestamp. cancelled_at stays the marker of an active
+-- booking, so no-shows and completed visits keep using up their slot.
+-- Depends on: 02-create-tables.sql
+
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'booked'
+    CHECK (status IN ('booked', 'checked_in', 'completed', 'no_show', 'cancelled'));
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS checked_in_at TIMESTAMP;
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS completed_at TIMESTAMP;
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS no_show_at TIMESTAMP;
+
+UPDATE appointments SET status = 'cancelled' WHERE cancelled_at IS NOT NULL AND status = 'booked';
+-- Nobody recorded whether past visits happened. They are taken as completed
+-- rather than left booked, where the no-show job would mark them all.
+UPDATE appointments SET status = 'completed', completed_at = visit_date
+WHERE cancelled_at IS NULL AND status = 'booked' AND visit_date < CURRENT_DATE;
+
+-- The no-show job looks for bookings nobody turned up for
+CREATE INDEX IF NOT EXISTS idx_appointments_booked_visit_date
+    ON appointments (visit_date) WHERE status = 'booked';
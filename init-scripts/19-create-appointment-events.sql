@@ -0,0 +1,35 @@
+-- 19-create-appointment-events.sql
+-- Audit trail of every change to an appointment: who made it, in which request,
+-- and which values it changed. Written in the same transaction as the change.
+-- Rows are never updated or deleted.
+-- Depends on: 03-grant-permissions.sql (default privileges)
+
+CREATE TABLE IF NOT EXISTS appointment_events (
+    id BIGSERIAL PRIMARY KEY,
+    appointment_id INTEGER NOT NULL REFERENCES appointments(id),
+    action VARCHAR(100) NOT NULL,
+    -- citizen:<subject>, key:<id> or system
+    actor VARCHAR(300) NOT NULL,
+    api_key_id INTEGER,
+    request_id VARCHAR(64),
+    -- Only the fields the change touched; old_values is NULL for new bookings
+    old_values JSONB,
+    new_values JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_appointment_events_appointment
+    ON appointment_events(appointment_id, id);
+
+CREATE OR REPLACE FUNCTION appointment_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'appointment_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS appointment_events_append_only ON appointment_events;
+CREATE TRIGGER appointment_events_append_only
+    BEFORE UPDATE OR DELETE ON appointment_events
+    FOR EACH ROW EXECUTE FUNCTION appointment_events_append_only();
+
+REVOKE UPDATE, DELETE, TRUNCATE ON appointment_events FROM citynext_user;
@@ -0,0 +1,23 @@
+-- 20-allow-history-redaction.sql
+-- Erasure requests remove a citizen's personal data from the appointment
+-- history as well. The history stays append-only otherwise: only the actor and
+-- the recorded values can be rewritten, only by a transaction that opts in with
+-- SET LOCAL citynext.redact_history = 'on', and rows can never be deleted.
+-- Depends on: 19-create-appointment-events.sql
+
+CREATE OR REPLACE FUNCTION appointment_events_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND current_setting('citynext.redact_history', true) = 'on'
+        AND NEW.id = OLD.id
+        AND NEW.appointment_id = OLD.appointment_id
+        AND NEW.action = OLD.action
+        AND NEW.api_key_id IS NOT DISTINCT FROM OLD.api_key_id
+        AND NEW.request_id IS NOT DISTINCT FROM OLD.request_id
+        AND NEW.created_at = OLD.created_at THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'appointment_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+GRANT UPDATE (actor, old_values, new_values) ON appointment_events TO citynext_user;
@@ -0,0 +1,26 @@
+-- 21-add-retention.sql
+-- Personal data is kept for a limited time after the visit. Anonymised rows
+-- keep their place for statistics and history but carry no names any more;
+-- anonymised_at marks them so the retention job skips them. Every run of the
+-- job is logged with what it anonymised.
+-- Depends on: 02-create-tables.sql, 13-create-waitlist.sql, 03-grant-permissions.sql (default privileges)
+
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS anonymised_at TIMESTAMP;
+ALTER TABLE waitlist_entries ADD COLUMN IF NOT EXISTS anonymised_at TIMESTAMP;
+
+-- The retention job looks for the oldest visits still holding personal data
+CREATE INDEX IF NOT EXISTS idx_appointments_retained_visit_date
+    ON appointments (visit_date, id) WHERE anonymised_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_waitlist_entries_retained_visit_date
+    ON waitlist_entries (visit_date, id) WHERE anonymised_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS retention_runs (
+    id SERIAL PRIMARY KEY,
+    ran_at TIMESTAMP NOT NULL,
+    -- Visits before this date were due
+    cutoff DATE NOT NULL,
+    dry_run BOOLEAN NOT NULL,
+    appointments INTEGER NOT NULL,
+    waitlist_entries INTEGER NOT NULL,
+    history_entries INTEGER NOT NULL
+);
@@ -0,0 +1,19 @@
+-- 22-encrypt-names.sql
+-- With encryption configured, first and last names are stored as
+-- pii:v1:<key id>:<wrapped data key>:<ciphertext>, which is longer than the
+-- names themselves. Exact-match lookups go through blind indexes, HMACs of the
+-- normalised names, since every ciphertext is different. Rows written before
+-- encryption keep their plaintext names until the rotate-keys command seals them.
+-- Depends on: 02-create-tables.sql, 04-create-indexes.sql, 13-create-waitlist.sql
+
+DROP INDEX IF EXISTS idx_appointments_names;
+
+ALTER TABLE appointments ALTER COLUMN first_name TYPE TEXT;
+ALTER TABLE appointments ALTER COLUMN last_name TYPE TEXT;
+ALTER TABLE waitlist_entries ALTER COLUMN first_name TYPE TEXT;
+ALTER TABLE waitlist_entries ALTER COLUMN last_name TYPE TEXT;
+
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS first_name_bidx CHAR(64);
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS last_name_bidx CHAR(64);
+
+CREATE INDEX IF NOT EXISTS idx_appointments_names ON appointments(first_name_bidx, last_name_bidx);
@@ -0,0 +1,31 @@
+-- 23-add-name-search.sql
+-- Front-desk name search. Names stored in plaintext are matched by trigram
+-- similarity (pg_trgm). Every name also gets a phonetic key, its Soundex code,
+-- so "Oneil" finds "O'Neill"; with encryption the keys are blinded like the
+-- exact-match indexes and only those can be searched. Anonymised rows have no
+-- names to find and are left out of every index.
+-- Depends on: 21-add-retention.sql, 22-encrypt-names.sql
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE EXTENSION IF NOT EXISTS fuzzystrmatch;
+
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS first_name_phonetic VARCHAR(64);
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS last_name_phonetic VARCHAR(64);
+
+-- soundex() computes the application's codes for plain ASCII names; the
+-- rotate-keys command recomputes the keys of the others. Encrypted names get
+-- their blinded keys from rotate-keys as well.
+UPDATE appointments
+SET first_name_phonetic = NULLIF(soundex(first_name), ''),
+    last_name_phonetic = NULLIF(soundex(last_name), '')
+WHERE anonymised_at IS NULL AND first_name NOT LIKE 'pii:v1:%';
+
+-- Ciphertexts have no useful trigrams, so only plaintext names are indexed;
+-- idx_appointments_names keeps serving exact matches on the blind indexes
+CREATE INDEX IF NOT EXISTS idx_appointments_names_trgm
+    ON appointments USING GIN ((first_name || ' ' || last_name) gin_trgm_ops)
+    WHERE anonymised_at IS NULL AND first_name NOT LIKE 'pii:v1:%';
+CREATE INDEX IF NOT EXISTS idx_appointments_first_name_bidx ON appointments (first_name_bidx) WHERE anonymised_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_appointments_last_name_bidx ON appointments (last_name_bidx) WHERE anonymised_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_appointments_first_name_phonetic ON appointments (first_name_phonetic) WHERE anonymised_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_appointments_last_name_phonetic ON appointments (last_name_phonetic) WHERE anonymised_at IS NULL;
@@ -0,0 +1,23 @@
+-- 24-create-duplicate-matches.sql
+-- Bookings taken for duplicates of an upcoming booking, under the same or a
+-- similar name, are flagged for review or rejected by policy; only bookings that
+-- also share an email address or citizen token are ever rejected. Either way the
+-- match and its reason are recorded here; rejected bookings were never stored
+-- and have no appointment_id. No names are kept, only the bookings involved.
+-- Depends on: 23-add-name-search.sql, 03-grant-permissions.sql (default privileges)
+
+CREATE TABLE IF NOT EXISTS duplicate_matches (
+    id SERIAL PRIMARY KEY,
+    appointment_id INTEGER REFERENCES appointments(id),
+    matched_appointment_id INTEGER NOT NULL REFERENCES appointments(id),
+    visit_date DATE NOT NULL,
+    -- same_name or similar_name
+    reason VARCHAR(20) NOT NULL,
+    -- flagged or rejected
+    action VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- Duplicate checks look for upcoming bookings by the phonetic keys of both names
+CREATE INDEX IF NOT EXISTS idx_appointments_upcoming_phonetic
+    ON appointments (first_name_phonetic, last_name_phonetic, visit_date) WHERE status = 'booked' AND anonymised_at IS NULL;
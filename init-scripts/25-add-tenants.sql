@@ -0,0 +1,96 @@
+-- 25-add-tenants.sql
+-- Councils sharing one deployment. Every tenant-owned row carries the id of its
+-- tenant, and row-level security keeps each tenant to its own rows. The
+-- application runs a tenant's statements as citynext_tenant with the session
+-- setting citynext.tenant_id set to the tenant's id; a session without it sees
+-- no rows at all and cannot insert any. Existing data becomes the default tenant's.
+-- api_keys are looked up before the tenant of a request is known, so they are
+-- filtered by the application instead. The tenants table and the shared
+-- simulated clock are not tenant scoped.
+-- Depends on: 24-create-duplicate-matches.sql, 01-create-user.sql
+
+CREATE TABLE IF NOT EXISTS tenants (
+    id SERIAL PRIMARY KEY,
+    slug VARCHAR(50) NOT NULL UNIQUE CHECK (slug ~ '^[a-z0-9-]+$'),
+    name VARCHAR(100) NOT NULL,
+    -- Requests for this host are served for the tenant
+    hostname VARCHAR(255) UNIQUE,
+    -- Nager.Date country and subdivision codes, NULL for the service default
+    holiday_country CHAR(2),
+    holiday_region VARCHAR(10),
+    -- Branding of emails, NULL for the service-wide notification settings
+    brand_name VARCHAR(100),
+    email_from VARCHAR(255),
+    cancel_url TEXT,
+    waitlist_url TEXT,
+    -- Policies, NULL for the service-wide defaults
+    max_active_per_citizen INTEGER CHECK (max_active_per_citizen >= 0),
+    duplicate_policy VARCHAR(10) CHECK (duplicate_policy IN ('off', 'flag', 'reject')),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO tenants (id, slug, name) VALUES (1, 'default', 'CityNext')
+ON CONFLICT (id) DO NOTHING;
+SELECT setval('tenants_id_seq', GREATEST((SELECT MAX(id) FROM tenants), 1));
+
+-- The role tenant sessions run as. It must not be a superuser or bypass row-level
+-- security, and the application user has to be a member to switch to it.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT FROM pg_catalog.pg_roles WHERE rolname = 'citynext_tenant') THEN
+        CREATE ROLE citynext_tenant NOLOGIN NOSUPERUSER NOBYPASSRLS;
+    END IF;
+END
+$$;
+GRANT citynext_tenant TO citynext_user;
+GRANT USAGE ON SCHEMA public TO citynext_tenant;
+GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO citynext_tenant;
+GRANT USAGE, SELECT, UPDATE ON ALL SEQUENCES IN SCHEMA public TO citynext_tenant;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO citynext_tenant;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT USAGE, SELECT, UPDATE ON SEQUENCES TO citynext_tenant;
+-- The history stays append-only apart from redaction, as for citynext_user
+REVOKE UPDATE, DELETE, TRUNCATE ON appointment_events FROM citynext_tenant;
+GRANT UPDATE (actor, old_values, new_values) ON appointment_events TO citynext_tenant;
+
+-- Existing rows belong to the default tenant, new ones to the tenant of the session
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS tenant_id INTEGER NOT NULL DEFAULT 1 REFERENCES tenants(id);
+ALTER TABLE api_keys ALTER COLUMN tenant_id DROP DEFAULT;
+
+DO $$
+DECLARE
+    scoped TEXT;
+BEGIN
+    FOREACH scoped IN ARRAY ARRAY[
+        'appointments', 'appointment_events', 'duplicate_matches', 'outbox_events',
+        'reminders_sent', 'retention_runs', 'service_types', 'slot_holds', 'staff',
+        'staff_rosters', 'waitlist_entries', 'webhook_deliveries', 'webhook_subscriptions'
+    ] LOOP
+        EXECUTE format('ALTER TABLE %I ADD COLUMN IF NOT EXISTS tenant_id INTEGER NOT NULL DEFAULT 1 REFERENCES tenants(id)', scoped);
+        EXECUTE format('ALTER TABLE %I ALTER COLUMN tenant_id SET DEFAULT NULLIF(current_setting(''citynext.tenant_id'', true), '''')::int', scoped);
+        EXECUTE format('ALTER TABLE %I ENABLE ROW LEVEL SECURITY', scoped);
+        EXECUTE format('ALTER TABLE %I FORCE ROW LEVEL SECURITY', scoped);
+        EXECUTE format('DROP POLICY IF EXISTS tenant_isolation ON %I', scoped);
+        EXECUTE format('CREATE POLICY tenant_isolation ON %I
+            USING (tenant_id = NULLIF(current_setting(''citynext.tenant_id'', true), '''')::int)
+            WITH CHECK (tenant_id = NULLIF(current_setting(''citynext.tenant_id'', true), '''')::int)', scoped);
+    END LOOP;
+END
+$$;
+
+-- Service type codes are unique per tenant, so every council can have a
+-- "general" type. Bookings, holds and waitlist entries refer to a type of their own tenant.
+ALTER TABLE appointments DROP CONSTRAINT IF EXISTS appointments_service_type_fkey;
+ALTER TABLE waitlist_entries DROP CONSTRAINT IF EXISTS waitlist_entries_service_type_fkey;
+ALTER TABLE slot_holds DROP CONSTRAINT IF EXISTS slot_holds_service_type_fkey;
+ALTER TABLE service_types DROP CONSTRAINT IF EXISTS service_types_pkey;
+ALTER TABLE service_types ADD PRIMARY KEY (tenant_id, code);
+ALTER TABLE appointments ADD CONSTRAINT appointments_service_type_fkey
+    FOREIGN KEY (tenant_id, service_type) REFERENCES service_types (tenant_id, code);
+ALTER TABLE waitlist_entries ADD CONSTRAINT waitlist_entries_service_type_fkey
+    FOREIGN KEY (tenant_id, service_type) REFERENCES service_types (tenant_id, code);
+ALTER TABLE slot_holds ADD CONSTRAINT slot_holds_service_type_fkey
+    FOREIGN KEY (tenant_id, service_type) REFERENCES service_types (tenant_id, code);
+
+-- Every policy check filters on tenant_id first
+CREATE INDEX IF NOT EXISTS idx_appointments_tenant_visit_date ON appointments (tenant_id, visit_date);
+CREATE INDEX IF NOT EXISTS idx_api_keys_tenant ON api_keys (tenant_id);
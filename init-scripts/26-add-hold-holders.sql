@@ -0,0 +1,9 @@
+-- 26-add-hold-holders.sql
+-- Records the API key that placed each hold, so holds placed without a citizen
+-- token can be capped per key the way the others are capped per citizen
+-- Depends on: 25-add-tenants.sql
+
+ALTER TABLE slot_holds ADD COLUMN IF NOT EXISTS api_key_id INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_slot_holds_citizen_subject ON slot_holds (citizen_subject) WHERE citizen_subject IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_slot_holds_api_key_id ON slot_holds (api_key_id) WHERE api_key_id IS NOT NULL;
@@ -0,0 +1,8 @@
+-- 27-add-tokenless-booking-limit.sql
+-- Bookings made without a citizen token count against the booking limit of
+-- their email address; this index serves that count
+-- Depends on: 09-add-appointment-email.sql
+
+CREATE INDEX IF NOT EXISTS idx_appointments_tokenless_email
+    ON appointments (lower(trim(email)), visit_date)
+    WHERE citizen_subject IS NULL AND cancelled_at IS NULL;
@@ -0,0 +1,8 @@
+-- 28-add-waitlist-declined.sql
+-- An offer the booking rules refuse, such as over the citizen's booking limit,
+-- is declined so its date can go to the next citizen in line
+-- Depends on: 13-create-waitlist.sql
+
+ALTER TABLE waitlist_entries DROP CONSTRAINT IF EXISTS waitlist_entries_status_check;
+ALTER TABLE waitlist_entries ADD CONSTRAINT waitlist_entries_status_check
+    CHECK (status IN ('waiting', 'offered', 'accepted', 'expired', 'declined'));
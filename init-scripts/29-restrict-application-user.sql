@@ -0,0 +1,16 @@
+-- 29-restrict-application-user.sql
+-- The application user was created as a superuser, which skips row-level
+-- security, so statements run without a tenant saw and could write every
+-- tenant's rows. It keeps its table rights but not the ones that bypass the
+-- policies: without citynext.tenant_id set it sees no tenant rows and cannot
+-- insert any, like citynext_tenant. The tenants table, api_keys and the
+-- simulated clock stay readable and writable, as they are not tenant scoped.
+-- Depends on: 01-create-user.sql, 20-allow-history-redaction.sql, 25-add-tenants.sql
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO citynext_user;
+GRANT USAGE, SELECT, UPDATE ON ALL SEQUENCES IN SCHEMA public TO citynext_user;
+-- The history stays append-only apart from redaction
+REVOKE UPDATE, DELETE, TRUNCATE ON appointment_events FROM citynext_user;
+GRANT UPDATE (actor, old_values, new_values) ON appointment_events TO citynext_user;
+
+ALTER ROLE citynext_user NOSUPERUSER NOBYPASSRLS;
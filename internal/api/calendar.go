@@ -0,0 +1,143 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/ical"
+	"citynext-appointments/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const icsSuffix = ".ics"
+
+// GetAppointmentCalendar serves GET /appointments/:id.ics, a single VEVENT the
+// citizen can add to their own calendar
+func (h *Handler) GetAppointmentCalendar(c *gin.Context) {
+	appointment, ok := h.loadOwnedAppointment(c, strings.TrimSuffix(c.Param("id"), icsSuffix))
+	if !ok {
+		return
+	}
+
+	revisions, err := h.appointmentService.Revisions(c.Request.Context(), []int{appointment.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   constants.ErrorTypeInternal,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="appointment-%s.ics"`, appointmentReference(appointment)))
+	c.Header("Content-Type", ical.ContentType)
+	c.Status(http.StatusOK)
+
+	w := ical.NewWriter(c.Writer, "")
+	w.WriteEvent(appointmentEvent(appointment, revisions[appointment.ID], time.Now()))
+	if err := w.Close(); err != nil {
+		c.Error(err)
+	}
+}
+
+// CalendarFeed serves GET /calendar.ics?from=&to=, every appointment in the
+// range for staff calendars. Cancelled appointments stay in the feed marked as
+// cancelled, so subscribed calendars remove them instead of keeping a stale copy.
+func (h *Handler) CalendarFeed(c *gin.Context) {
+	from, ok := parseDateQuery(c, "from")
+	if !ok {
+		return
+	}
+	to, ok := parseDateQuery(c, "to")
+	if !ok {
+		return
+	}
+	if !from.IsZero() && !to.IsZero() && (to.Before(from) || to.Sub(from) > constants.MaxCalendarRange) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   constants.ErrorTypeValidation,
+			Message: "to must be on or after from and at most 366 days later",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	appointments, err := h.appointmentService.ListAppointments(ctx, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   constants.ErrorTypeInternal,
+			Message: err.Error(),
+		})
+		return
+	}
+	ids := make([]int, len(appointments))
+	for i := range appointments {
+		ids[i] = appointments[i].ID
+	}
+	revisions, err := h.appointmentService.Revisions(ctx, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   constants.ErrorTypeInternal,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Type", ical.ContentType)
+	c.Status(http.StatusOK)
+
+	now := time.Now()
+	w := ical.NewWriter(c.Writer, "CityNext appointments")
+	for i := range appointments {
+		w.WriteEvent(appointmentEvent(&appointments[i], revisions[appointments[i].ID], now))
+	}
+	if err := w.Close(); err != nil {
+		c.Error(err)
+	}
+}
+
+// appointmentEvent maps an appointment to its calendar event, written out at
+// stamp. The UID only depends on the reference, and every recorded change raises the
+// sequence, so re-importing an updated event replaces the old one.
+func appointmentEvent(appointment *models.Appointment, revision models.Revision, stamp time.Time) ical.Event {
+	return ical.Event{
+		UID:          ical.UID(appointmentReference(appointment), constants.ICalUIDDomain),
+		Summary:      "CityNext appointment - " + appointment.FirstName + " " + appointment.LastName,
+		Description:  "Reference: " + appointmentReference(appointment),
+		Date:         appointment.VisitDate,
+		Stamp:        stamp,
+		Sequence:     revision.Sequence,
+		LastModified: revision.LastModified,
+		Cancelled:    appointment.CancelledAt != nil,
+	}
+}
+
+// appointmentReference is the code citizens quote, falling back to the id for
+// rows created before references were introduced
+func appointmentReference(appointment *models.Appointment) string {
+	if appointment.Reference != "" {
+		return appointment.Reference
+	}
+	return strconv.Itoa(appointment.ID)
+}
+
+// parseDateQuery reads an optional YYYY-MM-DD query parameter, writing the error response itself
+func parseDateQuery(c *gin.Context, name string) (time.Time, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, true
+	}
+
+	date, err := time.Parse(constants.DateLayout, value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   constants.ErrorTypeInvalidDate,
+			Message: name + ": " + constants.ErrInvalidDateFormat,
+		})
+		return time.Time{}, false
+	}
+	return date, true
+}
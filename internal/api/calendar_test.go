@@ -0,0 +1,116 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/auth"
+	"citynext-appointments/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHandler_GetAppointmentCalendar(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	appointment := &models.Appointment{
+		ID:             5,
+		Reference:      "CN-7K4Q-2M9X",
+		FirstName:      "Siobhán",
+		LastName:       "O'Neill, Jr.",
+		VisitDate:      time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC),
+		CreatedAt:      time.Date(2075, 6, 1, 10, 0, 0, 0, time.UTC),
+		CitizenSubject: "citizen-123",
+	}
+
+	testCases := []struct {
+		name     string
+		subject  string
+		expected int
+	}{
+		{"owner", "citizen-123", http.StatusOK},
+		{"other citizen", "citizen-456", http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAppointmentService := new(MockAppointmentService)
+			mockAppointmentService.On("GetAppointment", mock.Anything, 5).Return(appointment, nil)
+			mockAppointmentService.On("Revisions", mock.Anything, []int{5}).Return(map[int]models.Revision{
+				5: {Sequence: 1, LastModified: time.Date(2075, 6, 2, 9, 0, 0, 0, time.UTC)},
+			}, nil)
+			handler := NewHandler(mockAppointmentService, new(MockHolidayService))
+
+			router := gin.New()
+			router.GET("/appointments/:id", withIdentity(auth.RoleCitizenPortal, tc.subject), handler.GetAppointment)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/appointments/5.ics", nil))
+
+			assert.Equal(t, tc.expected, w.Code)
+			if tc.expected == http.StatusOK {
+				assert.Equal(t, "text/calendar; charset=utf-8", w.Header().Get("Content-Type"))
+				body := w.Body.String()
+				assert.Contains(t, body, "UID:appointment-CN-7K4Q-2M9X@appointments.citynext.example\r\n")
+				assert.Contains(t, body, "DTSTART;VALUE=DATE:20750615\r\n")
+				assert.Contains(t, body, "SEQUENCE:1\r\nLAST-MODIFIED:20750602T090000Z\r\n", "a rescheduled booking replaces the imported copy")
+				assert.NotContains(t, body, "DTSTAMP:20750601T100000Z", "the stamp is when the event is written, not when it was booked")
+				assert.Contains(t, body, `SUMMARY:CityNext appointment - Siobhán O'Neill\, Jr.`)
+				assert.Contains(t, body, "DESCRIPTION:Reference: CN-7K4Q-2M9X\r\n")
+				assert.Contains(t, w.Header().Get("Content-Disposition"), "appointment-CN-7K4Q-2M9X.ics")
+			}
+		})
+	}
+}
+
+func TestHandler_CalendarFeed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	from := time.Date(2075, 6, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2075, 6, 30, 0, 0, 0, 0, time.UTC)
+
+	mockAppointmentService := new(MockAppointmentService)
+	cancelledAt := time.Date(2075, 6, 2, 9, 0, 0, 0, time.UTC)
+	mockAppointmentService.On("ListAppointments", mock.Anything, from, to).Return([]models.Appointment{
+		{ID: 1, FirstName: "John", LastName: "Doe", VisitDate: time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC)},
+		{ID: 2, FirstName: "Jane", LastName: "Doe", VisitDate: time.Date(2075, 6, 16, 0, 0, 0, 0, time.UTC), CancelledAt: &cancelledAt},
+	}, nil)
+	mockAppointmentService.On("Revisions", mock.Anything, []int{1, 2}).Return(map[int]models.Revision{
+		2: {Sequence: 1, LastModified: cancelledAt},
+	}, nil)
+	handler := NewHandler(mockAppointmentService, new(MockHolidayService))
+
+	router := gin.New()
+	router.GET("/calendar.ics", handler.CalendarFeed)
+
+	testCases := []struct {
+		name     string
+		query    string
+		expected int
+	}{
+		{"range", "?from=2075-06-01&to=2075-06-30", http.StatusOK},
+		{"bad date", "?from=01-06-2075", http.StatusBadRequest},
+		{"reversed", "?from=2075-06-30&to=2075-06-01", http.StatusBadRequest},
+		{"too long", "?from=2075-01-01&to=2077-01-01", http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/calendar.ics"+tc.query, nil))
+
+			assert.Equal(t, tc.expected, w.Code)
+			if tc.expected == http.StatusOK {
+				assert.Equal(t, 2, strings.Count(w.Body.String(), "BEGIN:VEVENT"))
+				assert.Contains(t, w.Body.String(), "SEQUENCE:1\r\nLAST-MODIFIED:20750602T090000Z\r\n")
+				assert.Contains(t, w.Body.String(), "STATUS:CANCELLED\r\n", "cancelled bookings stay in the feed so calendars drop them")
+				assert.True(t, strings.HasSuffix(w.Body.String(), "END:VCALENDAR\r\n"))
+			}
+		})
+	}
+}
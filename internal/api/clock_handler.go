@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"citynext-appointments/internal/clock"
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TimeTraveler is the subset of the shared clock used by the admin endpoints
+type TimeTraveler interface {
+	Now() time.Time
+	State() clock.State
+	Advance(ctx context.Context, d time.Duration) (clock.State, error)
+	Freeze(ctx context.Context, at time.Time) (clock.State, error)
+	Set(ctx context.Context, at time.Time) (clock.State, error)
+	Resume(ctx context.Context) (clock.State, error)
+}
+
+type ClockHandler struct {
+	clock TimeTraveler
+}
+
+func NewClockHandler(clk TimeTraveler) *ClockHandler {
+	return &ClockHandler{clock: clk}
+}
+
+func (h *ClockHandler) GetClock(c *gin.Context) {
+	c.JSON(http.StatusOK, h.response(h.clock.State()))
+}
+
+func (h *ClockHandler) UpdateClock(c *gin.Context) {
+	var req models.ClockUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   constants.ErrorTypeValidation,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	var at time.Time
+	if req.At != "" {
+		parsed, err := time.Parse(time.RFC3339, req.At)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   constants.ErrorTypeValidation,
+				Message: "Invalid at, expected RFC 3339 timestamp",
+			})
+			return
+		}
+		at = parsed
+	}
+
+	ctx := c.Request.Context()
+	var state clock.State
+	var err error
+
+	switch req.Action {
+	case "advance":
+		d, parseErr := time.ParseDuration(req.Duration)
+		if parseErr != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   constants.ErrorTypeValidation,
+				Message: "Invalid duration, expected a value such as 48h",
+			})
+			return
+		}
+		state, err = h.clock.Advance(ctx, d)
+	case "freeze":
+		state, err = h.clock.Freeze(ctx, at)
+	case "set":
+		if at.IsZero() {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   constants.ErrorTypeValidation,
+				Message: "at is required for set",
+			})
+			return
+		}
+		state, err = h.clock.Set(ctx, at)
+	case "resume":
+		state, err = h.clock.Resume(ctx)
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   constants.ErrorTypeClock,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.response(state))
+}
+
+func (h *ClockHandler) response(state clock.State) models.ClockResponse {
+	return models.ClockResponse{
+		Now:            h.clock.Now(),
+		Mode:           string(state.Mode),
+		SimulatedEpoch: state.SimulatedEpoch,
+		RealEpoch:      state.RealEpoch,
+	}
+}
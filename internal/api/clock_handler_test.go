@@ -0,0 +1,165 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/auth"
+	"citynext-appointments/internal/clock"
+	"citynext-appointments/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockClock struct {
+	mock.Mock
+	now time.Time
+}
+
+func (m *MockClock) Now() time.Time {
+	return m.now
+}
+
+func (m *MockClock) State() clock.State {
+	return clock.State{Mode: clock.ModeOffset, SimulatedEpoch: m.now}
+}
+
+func (m *MockClock) Advance(ctx context.Context, d time.Duration) (clock.State, error) {
+	args := m.Called(ctx, d)
+	return args.Get(0).(clock.State), args.Error(1)
+}
+
+func (m *MockClock) Freeze(ctx context.Context, at time.Time) (clock.State, error) {
+	args := m.Called(ctx, at)
+	return args.Get(0).(clock.State), args.Error(1)
+}
+
+func (m *MockClock) Set(ctx context.Context, at time.Time) (clock.State, error) {
+	args := m.Called(ctx, at)
+	return args.Get(0).(clock.State), args.Error(1)
+}
+
+func (m *MockClock) Resume(ctx context.Context) (clock.State, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(clock.State), args.Error(1)
+}
+
+func newClockRouter(clk TimeTraveler) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	handler := NewClockHandler(clk)
+
+	router := gin.New()
+	router.Use(Authenticate(staticKeys{"secret": auth.RoleAdmin, "desk": auth.RoleFrontDesk}))
+	admin := router.Group("/admin", RequireRole(auth.RoleAdmin))
+	admin.GET("/clock", handler.GetClock)
+	admin.POST("/clock", handler.UpdateClock)
+	return router
+}
+
+func TestClockHandler_RequiresAdminRole(t *testing.T) {
+	router := newClockRouter(&MockClock{})
+
+	request := httptest.NewRequest(http.MethodGet, "/admin/clock", nil)
+	request.Header.Set("X-API-Key", "desk")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	var response models.ErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "forbidden", response.Error)
+}
+
+func TestClockHandler_GetClock(t *testing.T) {
+	now := time.Date(2075, 6, 15, 12, 0, 0, 0, time.UTC)
+	router := newClockRouter(&MockClock{now: now})
+
+	request := httptest.NewRequest(http.MethodGet, "/admin/clock", nil)
+	request.Header.Set("X-API-Key", "secret")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.ClockResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, now, response.Now)
+	assert.Equal(t, "offset", response.Mode)
+}
+
+func TestClockHandler_Advance(t *testing.T) {
+	now := time.Date(2075, 6, 15, 12, 0, 0, 0, time.UTC)
+	mockClock := &MockClock{now: now}
+	mockClock.On("Advance", mock.Anything, 48*time.Hour).
+		Return(clock.State{Mode: clock.ModeOffset, SimulatedEpoch: now.Add(48 * time.Hour)}, nil)
+
+	router := newClockRouter(mockClock)
+
+	body, _ := json.Marshal(models.ClockUpdateRequest{Action: "advance", Duration: "48h"})
+	request := httptest.NewRequest(http.MethodPost, "/admin/clock", bytes.NewBuffer(body))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-API-Key", "secret")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockClock.AssertExpectations(t)
+}
+
+func TestClockHandler_Freeze(t *testing.T) {
+	at := time.Date(2075, 12, 24, 9, 0, 0, 0, time.UTC)
+	mockClock := &MockClock{now: at}
+	mockClock.On("Freeze", mock.Anything, at).
+		Return(clock.State{Mode: clock.ModeFrozen, SimulatedEpoch: at}, nil)
+
+	router := newClockRouter(mockClock)
+
+	body, _ := json.Marshal(models.ClockUpdateRequest{Action: "freeze", At: "2075-12-24T09:00:00Z"})
+	request := httptest.NewRequest(http.MethodPost, "/admin/clock", bytes.NewBuffer(body))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-API-Key", "secret")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.ClockResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "frozen", response.Mode)
+	mockClock.AssertExpectations(t)
+}
+
+func TestClockHandler_InvalidRequests(t *testing.T) {
+	router := newClockRouter(&MockClock{})
+
+	testCases := []struct {
+		name string
+		body models.ClockUpdateRequest
+	}{
+		{"unknown action", models.ClockUpdateRequest{Action: "rewind"}},
+		{"invalid duration", models.ClockUpdateRequest{Action: "advance", Duration: "two days"}},
+		{"invalid timestamp", models.ClockUpdateRequest{Action: "freeze", At: "2075-12-24"}},
+		{"set without time", models.ClockUpdateRequest{Action: "set"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, _ := json.Marshal(tc.body)
+			request := httptest.NewRequest(http.MethodPost, "/admin/clock", bytes.NewBuffer(body))
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("X-API-Key", "secret")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, request)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
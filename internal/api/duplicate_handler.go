@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultDuplicateLimit = 50
+	maxDuplicateLimit     = 500
+)
+
+// DuplicateReview lists the bookings taken for duplicates
+type DuplicateReview interface {
+	Matches(ctx context.Context, action string, limit int) ([]models.DuplicateMatch, error)
+}
+
+type DuplicateHandler struct {
+	duplicates DuplicateReview
+}
+
+func NewDuplicateHandler(duplicates DuplicateReview) *DuplicateHandler {
+	return &DuplicateHandler{duplicates: duplicates}
+}
+
+// ListDuplicates serves GET /admin/duplicates, the latest bookings flagged or
+// rejected as duplicates with the booking each one matched and why, newest
+// first. action narrows the list to flagged or rejected bookings.
+func (h *DuplicateHandler) ListDuplicates(c *gin.Context) {
+	action := c.Query("action")
+	switch action {
+	case "", service.DuplicateActionFlagged, service.DuplicateActionRejected:
+	default:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   constants.ErrorTypeValidation,
+			Message: "action must be flagged or rejected",
+		})
+		return
+	}
+
+	limit := defaultDuplicateLimit
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxDuplicateLimit {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   constants.ErrorTypeValidation,
+				Message: "limit must be between 1 and " + strconv.Itoa(maxDuplicateLimit),
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	matches, err := h.duplicates.Matches(c.Request.Context(), action, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   constants.ErrorTypeInternal,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, matches)
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"citynext-appointments/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubDuplicates struct {
+	matches []models.DuplicateMatch
+	err     error
+
+	action string
+	limit  int
+}
+
+func (s *stubDuplicates) Matches(ctx context.Context, action string, limit int) ([]models.DuplicateMatch, error) {
+	s.action, s.limit = action, limit
+	return s.matches, s.err
+}
+
+func TestDuplicateHandler_ListDuplicates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	matches := []models.DuplicateMatch{{ID: 1, MatchedAppointmentID: 5, Reason: "similar_name", Action: "rejected"}}
+
+	testCases := []struct {
+		name       string
+		path       string
+		duplicates *stubDuplicates
+		expected   int
+		action     string
+		limit      int
+	}{
+		{"all", "/admin/duplicates", &stubDuplicates{matches: matches}, http.StatusOK, "", defaultDuplicateLimit},
+		{"rejected only", "/admin/duplicates?action=rejected&limit=10", &stubDuplicates{matches: matches}, http.StatusOK, "rejected", 10},
+		{"unknown action", "/admin/duplicates?action=ignored", &stubDuplicates{}, http.StatusBadRequest, "", 0},
+		{"limit too large", "/admin/duplicates?limit=501", &stubDuplicates{}, http.StatusBadRequest, "", 0},
+		{"database error", "/admin/duplicates", &stubDuplicates{err: errors.New("db down")}, http.StatusInternalServerError, "", defaultDuplicateLimit},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/admin/duplicates", NewDuplicateHandler(tc.duplicates).ListDuplicates)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			assert.Equal(t, tc.expected, w.Code)
+			assert.Equal(t, tc.action, tc.duplicates.action)
+			assert.Equal(t, tc.limit, tc.duplicates.limit)
+			if tc.expected == http.StatusOK {
+				var got []models.DuplicateMatch
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+				assert.Equal(t, "similar_name", got[0].Reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AppointmentExporter streams appointments in a bulk format
+type AppointmentExporter interface {
+	Export(ctx context.Context, w io.Writer, format string, from, to time.Time) (int, error)
+}
+
+type ExportHandler struct {
+	exporter AppointmentExporter
+}
+
+func NewExportHandler(exporter AppointmentExporter) *ExportHandler {
+	return &ExportHandler{exporter: exporter}
+}
+
+// ExportAppointments serves GET /admin/appointments/export?format=csv|jsonl&from=&to=
+func (h *ExportHandler) ExportAppointments(c *gin.Context) {
+	format, err := service.ParseExportFormat(c.DefaultQuery("format", service.ExportFormatCSV))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   constants.ErrorTypeValidation,
+			Message: err.Error(),
+		})
+		return
+	}
+	from, ok := parseDateQuery(c, "from")
+	if !ok {
+		return
+	}
+	to, ok := parseDateQuery(c, "to")
+	if !ok {
+		return
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   constants.ErrorTypeValidation,
+			Message: "to must be on or after from",
+		})
+		return
+	}
+
+	// Large exports outlive the server write timeout, which is meant for regular requests
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Export cannot lift the write deadline: %v", err)
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if format == service.ExportFormatJSONL {
+		contentType = "application/x-ndjson"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="appointments.%s"`, format))
+	c.Status(http.StatusOK)
+
+	count, err := h.exporter.Export(c.Request.Context(), c.Writer, format, from, to)
+	if err == nil {
+		return
+	}
+
+	// Before the first byte went out the failure can still be reported properly
+	if !c.Writer.Written() {
+		c.Writer.Header().Del("Content-Disposition")
+		c.Writer.Header().Del("Content-Type")
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   constants.ErrorTypeInternal,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// Rows are already on their way, so a failure can only cut the stream short
+	log.Printf("Export failed after %d appointments: %v", count, err)
+	c.Error(err)
+	c.Abort()
+}
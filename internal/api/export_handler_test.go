@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubExporter struct {
+	format   string
+	from, to time.Time
+	body     string
+	err      error
+}
+
+func (s *stubExporter) Export(ctx context.Context, w io.Writer, format string, from, to time.Time) (int, error) {
+	s.format, s.from, s.to = format, from, to
+	if s.body != "" {
+		io.WriteString(w, s.body)
+	}
+	return 1, s.err
+}
+
+func TestExportHandler_ExportAppointments(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	testCases := []struct {
+		name        string
+		query       string
+		exporter    *stubExporter
+		expected    int
+		contentType string
+	}{
+		{"csv by default", "", &stubExporter{body: "id\n"}, http.StatusOK, "text/csv; charset=utf-8"},
+		{"jsonl with range", "?format=jsonl&from=2075-06-01&to=2075-06-30", &stubExporter{body: "{}\n"}, http.StatusOK, "application/x-ndjson"},
+		{"unknown format", "?format=xml", &stubExporter{}, http.StatusBadRequest, "application/json; charset=utf-8"},
+		{"bad date", "?from=June", &stubExporter{}, http.StatusBadRequest, "application/json; charset=utf-8"},
+		{"reversed range", "?from=2075-06-30&to=2075-06-01", &stubExporter{}, http.StatusBadRequest, "application/json; charset=utf-8"},
+		{"fails before streaming", "", &stubExporter{err: errors.New("db down")}, http.StatusInternalServerError, "application/json; charset=utf-8"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/admin/appointments/export", NewExportHandler(tc.exporter).ExportAppointments)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/appointments/export"+tc.query, nil))
+
+			assert.Equal(t, tc.expected, w.Code)
+			assert.Equal(t, tc.contentType, w.Header().Get("Content-Type"))
+		})
+	}
+}
+
+func TestExportHandler_PassesRange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	exporter := &stubExporter{body: "{}\n"}
+	router := gin.New()
+	router.GET("/admin/appointments/export", NewExportHandler(exporter).ExportAppointments)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/appointments/export?format=jsonl&from=2075-06-01", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "jsonl", exporter.format)
+	assert.Equal(t, time.Date(2075, 6, 1, 0, 0, 0, 0, time.UTC), exporter.from)
+	assert.True(t, exporter.to.IsZero())
+}
@@ -1,9 +1,13 @@
 package api
 
 import (
+	"context"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"citynext-appointments/internal/auth"
 	"citynext-appointments/internal/constants"
 	"citynext-appointments/internal/models"
 	"citynext-appointments/internal/service"
@@ -33,48 +37,198 @@ func (h *Handler) CreateAppointment(c *gin.Context) {
 		return
 	}
 
-	visitDate, err := time.Parse(constants.DateLayout, req.VisitDate)
+	if !checkVisitDate(c, h.holidayService, req.VisitDate) {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// Bookings made with a citizen token belong to that citizen
+	if citizen, ok := auth.CitizenFrom(ctx); ok {
+		req.CitizenSubject = citizen.Subject
+	}
+
+	appointment, err := h.appointmentService.CreateAppointment(ctx, &req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   constants.ErrorTypeInvalidDate,
-			Message: constants.ErrInvalidDateFormat,
+		status := http.StatusInternalServerError
+		errorType := constants.ErrorTypeInternal
+
+		// Map errors to appropriate HTTP responses
+		switch {
+		case err.Error() == constants.ErrPastDate:
+			status = http.StatusBadRequest
+			errorType = constants.ErrorTypePastDate
+		case len(err.Error()) > len(constants.ErrDuplicateAppointment) &&
+			err.Error()[:len(constants.ErrDuplicateAppointment)] == constants.ErrDuplicateAppointment:
+			status = http.StatusConflict
+			errorType = constants.ErrorTypeDuplicateAppt
+		case err.Error() == constants.ErrUnknownServiceType:
+			status = http.StatusBadRequest
+			errorType = constants.ErrorTypeUnknownServiceType
+		case err.Error() == constants.ErrBookingLimitReached:
+			status = http.StatusConflict
+			errorType = constants.ErrorTypeBookingLimit
+		case err.Error() == constants.ErrIdentityRequired:
+			status = http.StatusBadRequest
+			errorType = constants.ErrorTypeIdentityRequired
+		case err.Error() == constants.ErrPossibleDuplicate:
+			status = http.StatusConflict
+			errorType = constants.ErrorTypePossibleDuplicate
+		case err.Error() == constants.ErrHoldNotFound:
+			status = http.StatusConflict
+			errorType = constants.ErrorTypeHoldNotFound
+		case strings.HasPrefix(err.Error(), constants.ErrNoStaffAvailable):
+			status = http.StatusConflict
+			errorType = constants.ErrorTypeNoStaffAvailable
+		}
+
+		c.JSON(status, models.ErrorResponse{
+			Error:   errorType,
+			Message: err.Error(),
 		})
 		return
 	}
 
-	// Prevent appointments on UK public holidays
-	ctx := c.Request.Context()
-	isHoliday, err := h.holidayService.IsPublicHoliday(ctx, visitDate)
+	c.JSON(http.StatusCreated, citizenView(ctx, appointment))
+}
+
+func (h *Handler) GetAppointment(c *gin.Context) {
+	// Gin cannot route /appointments/:id.ics separately, so the suffix is handled here
+	if strings.HasSuffix(c.Param("id"), icsSuffix) {
+		h.GetAppointmentCalendar(c)
+		return
+	}
+
+	appointment, ok := h.loadOwnedAppointment(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, citizenView(c.Request.Context(), appointment))
+}
+
+func (h *Handler) CancelAppointment(c *gin.Context) {
+	owned, ok := h.loadOwnedAppointment(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	appointment, err := h.appointmentService.CancelAppointment(c.Request.Context(), owned.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   constants.ErrorTypeHolidayCheck,
-			Message: "Failed to check public holidays: " + err.Error(),
+		status := http.StatusInternalServerError
+		errorType := constants.ErrorTypeInternal
+
+		switch {
+		case err.Error() == constants.ErrAppointmentNotFound:
+			status = http.StatusNotFound
+			errorType = constants.ErrorTypeNotFound
+		case err.Error() == constants.ErrAlreadyCancelled:
+			status = http.StatusConflict
+			errorType = constants.ErrorTypeCancelled
+		case err.Error() == constants.ErrCancelPastVisit:
+			status = http.StatusBadRequest
+			errorType = constants.ErrorTypePastDate
+		case strings.HasPrefix(err.Error(), constants.ErrInvalidTransition):
+			status = http.StatusConflict
+			errorType = constants.ErrorTypeInvalidTransition
+		}
+
+		c.JSON(status, models.ErrorResponse{
+			Error:   errorType,
+			Message: err.Error(),
 		})
 		return
 	}
 
-	if isHoliday {
+	c.JSON(http.StatusOK, citizenView(c.Request.Context(), appointment))
+}
+
+func (h *Handler) RescheduleAppointment(c *gin.Context) {
+	var req models.RescheduleAppointmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   constants.ErrorTypePublicHoliday,
-			Message: constants.ErrPublicHoliday,
+			Error:   constants.ErrorTypeValidation,
+			Message: "Invalid request body: " + err.Error(),
 		})
 		return
 	}
 
-	appointment, err := h.appointmentService.CreateAppointment(ctx, &req)
+	owned, ok := h.loadOwnedAppointment(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if !checkVisitDate(c, h.holidayService, req.VisitDate) {
+		return
+	}
+
+	appointment, err := h.appointmentService.RescheduleAppointment(c.Request.Context(), owned.ID, req.VisitDate)
 	if err != nil {
 		status := http.StatusInternalServerError
 		errorType := constants.ErrorTypeInternal
 
-		// Map errors to appropriate HTTP responses
 		switch {
-		case err.Error() == constants.ErrPastDate:
+		case err.Error() == constants.ErrAppointmentNotFound:
+			status = http.StatusNotFound
+			errorType = constants.ErrorTypeNotFound
+		case err.Error() == constants.ErrAlreadyCancelled:
+			status = http.StatusConflict
+			errorType = constants.ErrorTypeCancelled
+		case err.Error() == constants.ErrPastDate, err.Error() == constants.ErrReschedulePastVisit:
 			status = http.StatusBadRequest
 			errorType = constants.ErrorTypePastDate
-		case len(err.Error()) > len(constants.ErrDuplicateAppointment) &&
-			err.Error()[:len(constants.ErrDuplicateAppointment)] == constants.ErrDuplicateAppointment:
+		case strings.HasPrefix(err.Error(), constants.ErrDuplicateAppointment):
 			status = http.StatusConflict
 			errorType = constants.ErrorTypeDuplicateAppt
+		case strings.HasPrefix(err.Error(), constants.ErrNoStaffAvailable):
+			status = http.StatusConflict
+			errorType = constants.ErrorTypeNoStaffAvailable
+		case strings.HasPrefix(err.Error(), constants.ErrInvalidTransition):
+			status = http.StatusConflict
+			errorType = constants.ErrorTypeInvalidTransition
+		}
+
+		c.JSON(status, models.ErrorResponse{
+			Error:   errorType,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, citizenView(c.Request.Context(), appointment))
+}
+
+// CheckIn serves POST /appointments/:id/check-in, recording that the citizen has arrived
+func (h *Handler) CheckIn(c *gin.Context) {
+	h.changeStatus(c, h.appointmentService.CheckIn)
+}
+
+// CompleteVisit serves POST /appointments/:id/complete, closing a visit once the citizen has been served
+func (h *Handler) CompleteVisit(c *gin.Context) {
+	h.changeStatus(c, h.appointmentService.CompleteVisit)
+}
+
+// changeStatus loads the appointment by id or reference and applies one status change to it
+func (h *Handler) changeStatus(c *gin.Context, change func(ctx context.Context, id int) (*models.Appointment, error)) {
+	owned, ok := h.loadOwnedAppointment(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	appointment, err := change(c.Request.Context(), owned.ID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		errorType := constants.ErrorTypeInternal
+
+		switch {
+		case err.Error() == constants.ErrAppointmentNotFound:
+			status = http.StatusNotFound
+			errorType = constants.ErrorTypeNotFound
+		case err.Error() == constants.ErrNotVisitDay:
+			status = http.StatusConflict
+			errorType = constants.ErrorTypeNotVisitDay
+		case strings.HasPrefix(err.Error(), constants.ErrInvalidTransition):
+			status = http.StatusConflict
+			errorType = constants.ErrorTypeInvalidTransition
 		}
 
 		c.JSON(status, models.ErrorResponse{
@@ -84,5 +238,129 @@ func (h *Handler) CreateAppointment(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, appointment)
+	c.JSON(http.StatusOK, citizenView(c.Request.Context(), appointment))
+}
+
+// checkVisitDate validates the requested visit date and rejects public holidays,
+// writing the error response itself when the date cannot be booked
+func checkVisitDate(c *gin.Context, holidays service.HolidayServiceInterface, value string) bool {
+	visitDate, err := time.Parse(constants.DateLayout, value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   constants.ErrorTypeInvalidDate,
+			Message: constants.ErrInvalidDateFormat,
+		})
+		return false
+	}
+
+	// Prevent appointments on UK public holidays
+	isHoliday, err := holidays.IsPublicHoliday(c.Request.Context(), visitDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   constants.ErrorTypeHolidayCheck,
+			Message: "Failed to check public holidays: " + err.Error(),
+		})
+		return false
+	}
+
+	if isHoliday {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   constants.ErrorTypePublicHoliday,
+			Message: constants.ErrPublicHoliday,
+		})
+		return false
+	}
+
+	return true
+}
+
+// loadOwnedAppointment fetches the appointment with the given numeric id or
+// booking reference and writes the error response itself when it is missing or
+// belongs to another citizen
+func (h *Handler) loadOwnedAppointment(c *gin.Context, key string) (*models.Appointment, bool) {
+	ctx := c.Request.Context()
+
+	var appointment *models.Appointment
+	var err error
+	if id, convErr := strconv.Atoi(key); convErr == nil {
+		if id <= 0 {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   constants.ErrorTypeValidation,
+				Message: "Invalid appointment id",
+			})
+			return nil, false
+		}
+		if isCitizenPortal(ctx) {
+			// Citizens should quote the booking reference; numeric ids are on their way out
+			c.Header(constants.HeaderDeprecation, "true")
+		}
+		appointment, err = h.appointmentService.GetAppointment(ctx, id)
+	} else {
+		// Malformed references come back as not found, the same as unknown ones
+		appointment, err = h.appointmentService.GetAppointmentByReference(ctx, key)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   constants.ErrorTypeInternal,
+			Message: err.Error(),
+		})
+		return nil, false
+	}
+
+	// Other citizens' bookings are reported as missing so ids cannot be probed
+	if appointment == nil || !canAccessAppointment(ctx, appointment) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   constants.ErrorTypeNotFound,
+			Message: constants.ErrAppointmentNotFound,
+		})
+		return nil, false
+	}
+
+	return appointment, true
+}
+
+// canAccessAppointment lets staff see every booking, while the citizen portal
+// only sees bookings owned by the citizen in the verified token
+func canAccessAppointment(ctx context.Context, appointment *models.Appointment) bool {
+	return canAccessSubject(ctx, appointment.CitizenSubject)
+}
+
+// canAccessSubject applies the same rule to anything else owned by a citizen subject
+func canAccessSubject(ctx context.Context, subject string) bool {
+	if isStaff(ctx) {
+		return true
+	}
+	citizen, ok := auth.CitizenFrom(ctx)
+	return ok && subject != "" && subject == citizen.Subject
+}
+
+// isStaff reports whether the caller holds a front desk or admin key
+func isStaff(ctx context.Context) bool {
+	principal, ok := auth.PrincipalFrom(ctx)
+	return ok && principal.Role.Allows(auth.RoleFrontDesk)
+}
+
+// isCitizenPortal reports whether the caller holds a citizen portal key
+func isCitizenPortal(ctx context.Context) bool {
+	principal, ok := auth.PrincipalFrom(ctx)
+	return ok && !principal.Role.Allows(auth.RoleFrontDesk)
+}
+
+// citizenView hides the internal id from the citizen portal, which identifies
+// bookings by their reference
+func citizenView(ctx context.Context, appointment *models.Appointment) *models.Appointment {
+	if appointment == nil || !isCitizenPortal(ctx) {
+		return appointment
+	}
+	view := *appointment
+	view.ID = 0
+	return &view
+}
+
+func parseID(c *gin.Context) int {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return 0
+	}
+	return id
 }
@@ -4,16 +4,20 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"citynext-appointments/internal/auth"
+	"citynext-appointments/internal/constants"
 	"citynext-appointments/internal/models"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 type MockAppointmentService struct {
@@ -28,6 +32,70 @@ func (m *MockAppointmentService) CreateAppointment(ctx context.Context, req *mod
 	return args.Get(0).(*models.Appointment), args.Error(1)
 }
 
+func (m *MockAppointmentService) GetAppointment(ctx context.Context, id int) (*models.Appointment, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Appointment), args.Error(1)
+}
+
+func (m *MockAppointmentService) GetAppointmentByReference(ctx context.Context, reference string) (*models.Appointment, error) {
+	args := m.Called(ctx, reference)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Appointment), args.Error(1)
+}
+
+func (m *MockAppointmentService) CancelAppointment(ctx context.Context, id int) (*models.Appointment, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Appointment), args.Error(1)
+}
+
+func (m *MockAppointmentService) RescheduleAppointment(ctx context.Context, id int, visitDate string) (*models.Appointment, error) {
+	args := m.Called(ctx, id, visitDate)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Appointment), args.Error(1)
+}
+
+func (m *MockAppointmentService) CheckIn(ctx context.Context, id int) (*models.Appointment, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Appointment), args.Error(1)
+}
+
+func (m *MockAppointmentService) CompleteVisit(ctx context.Context, id int) (*models.Appointment, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Appointment), args.Error(1)
+}
+
+func (m *MockAppointmentService) ListAppointments(ctx context.Context, from, to time.Time) ([]models.Appointment, error) {
+	args := m.Called(ctx, from, to)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Appointment), args.Error(1)
+}
+
+func (m *MockAppointmentService) Revisions(ctx context.Context, ids []int) (map[int]models.Revision, error) {
+	args := m.Called(ctx, ids)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[int]models.Revision), args.Error(1)
+}
+
 type MockHolidayService struct {
 	mock.Mock
 }
@@ -57,9 +125,10 @@ func TestHandler_CreateAppointment_Success(t *testing.T) {
 	}
 
 	req := &models.CreateAppointmentRequest{
-		FirstName: "John",
-		LastName:  "Doe",
-		VisitDate: "2075-06-15",
+		FirstName:   "John",
+		LastName:    "Doe",
+		VisitDate:   "2075-06-15",
+		ServiceType: "general",
 	}
 
 	mockAppointmentService.On("CreateAppointment", mock.Anything, req).Return(expectedAppointment, nil)
@@ -100,9 +169,10 @@ func TestHandler_CreateAppointment_PublicHoliday(t *testing.T) {
 	mockHolidayService.On("IsPublicHoliday", mock.Anything, visitDate).Return(true, nil)
 
 	req := &models.CreateAppointmentRequest{
-		FirstName: "John",
-		LastName:  "Doe",
-		VisitDate: "2075-12-25",
+		FirstName:   "John",
+		LastName:    "Doe",
+		VisitDate:   "2075-12-25",
+		ServiceType: "general",
 	}
 
 	requestBody, _ := json.Marshal(req)
@@ -126,6 +196,84 @@ func TestHandler_CreateAppointment_PublicHoliday(t *testing.T) {
 	mockHolidayService.AssertExpectations(t)
 }
 
+func TestHandler_CreateAppointment_PossibleDuplicate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockAppointmentService := new(MockAppointmentService)
+	mockHolidayService := new(MockHolidayService)
+
+	handler := NewHandler(mockAppointmentService, mockHolidayService)
+
+	visitDate := time.Date(2075, 6, 17, 0, 0, 0, 0, time.UTC)
+	mockHolidayService.On("IsPublicHoliday", mock.Anything, visitDate).Return(false, nil)
+
+	req := &models.CreateAppointmentRequest{
+		FirstName:   "Jon",
+		LastName:    "Doe",
+		VisitDate:   "2075-06-17",
+		ServiceType: "general",
+	}
+	mockAppointmentService.On("CreateAppointment", mock.Anything, req).Return(nil, errors.New(constants.ErrPossibleDuplicate))
+
+	requestBody, _ := json.Marshal(req)
+	request := httptest.NewRequest(http.MethodPost, "/appointments", bytes.NewBuffer(requestBody))
+	request.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+
+	router := gin.New()
+	router.POST("/appointments", handler.CreateAppointment)
+	router.ServeHTTP(w, request)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	var response models.ErrorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "possible_duplicate", response.Error)
+
+	mockAppointmentService.AssertExpectations(t)
+}
+
+func TestHandler_CreateAppointment_IdentityRequired(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockAppointmentService := new(MockAppointmentService)
+	mockHolidayService := new(MockHolidayService)
+
+	handler := NewHandler(mockAppointmentService, mockHolidayService)
+
+	visitDate := time.Date(2075, 6, 17, 0, 0, 0, 0, time.UTC)
+	mockHolidayService.On("IsPublicHoliday", mock.Anything, visitDate).Return(false, nil)
+
+	req := &models.CreateAppointmentRequest{
+		FirstName:   "Jon",
+		LastName:    "Doe",
+		VisitDate:   "2075-06-17",
+		ServiceType: "general",
+	}
+	mockAppointmentService.On("CreateAppointment", mock.Anything, req).Return(nil, errors.New(constants.ErrIdentityRequired))
+
+	requestBody, _ := json.Marshal(req)
+	request := httptest.NewRequest(http.MethodPost, "/appointments", bytes.NewBuffer(requestBody))
+	request.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+
+	router := gin.New()
+	router.POST("/appointments", handler.CreateAppointment)
+	router.ServeHTTP(w, request)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response models.ErrorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "identity_required", response.Error)
+
+	mockAppointmentService.AssertExpectations(t)
+}
+
 func TestHandler_CreateAppointment_InvalidRequest(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -155,3 +303,354 @@ func TestHandler_CreateAppointment_InvalidRequest(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "validation_error", response.Error)
 }
+
+// withIdentity injects the caller identity the auth middleware would normally attach
+func withIdentity(role auth.Role, subject string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := auth.WithPrincipal(c.Request.Context(), &auth.Principal{KeyID: 1, Role: role})
+		if subject != "" {
+			ctx = auth.WithCitizen(ctx, &auth.Citizen{Subject: subject})
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+func TestHandler_CreateAppointment_RecordsCitizenSubject(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockAppointmentService := new(MockAppointmentService)
+	mockHolidayService := new(MockHolidayService)
+	handler := NewHandler(mockAppointmentService, mockHolidayService)
+
+	mockHolidayService.On("IsPublicHoliday", mock.Anything, mock.Anything).Return(false, nil)
+	mockAppointmentService.On("CreateAppointment", mock.Anything, mock.MatchedBy(func(req *models.CreateAppointmentRequest) bool {
+		return req.CitizenSubject == "citizen-123"
+	})).Return(&models.Appointment{ID: 1, CitizenSubject: "citizen-123"}, nil)
+
+	// A subject smuggled into the body must be ignored
+	body := []byte(`{"first_name":"John","last_name":"Doe","visit_date":"2075-06-15","service_type":"general","citizen_subject":"someone-else"}`)
+	request := httptest.NewRequest(http.MethodPost, "/appointments", bytes.NewBuffer(body))
+	request.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router := gin.New()
+	router.POST("/appointments", withIdentity(auth.RoleCitizenPortal, "citizen-123"), handler.CreateAppointment)
+	router.ServeHTTP(w, request)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockAppointmentService.AssertExpectations(t)
+}
+
+func TestHandler_GetAppointment_Ownership(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	owned := &models.Appointment{ID: 5, FirstName: "John", LastName: "Doe", CitizenSubject: "citizen-123"}
+
+	testCases := []struct {
+		name     string
+		role     auth.Role
+		subject  string
+		expected int
+	}{
+		{"owner", auth.RoleCitizenPortal, "citizen-123", http.StatusOK},
+		{"other citizen", auth.RoleCitizenPortal, "citizen-456", http.StatusNotFound},
+		{"portal without token", auth.RoleCitizenPortal, "", http.StatusNotFound},
+		{"front desk", auth.RoleFrontDesk, "", http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAppointmentService := new(MockAppointmentService)
+			mockAppointmentService.On("GetAppointment", mock.Anything, 5).Return(owned, nil)
+			handler := NewHandler(mockAppointmentService, new(MockHolidayService))
+
+			router := gin.New()
+			router.GET("/appointments/:id", withIdentity(tc.role, tc.subject), handler.GetAppointment)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/appointments/5", nil))
+
+			assert.Equal(t, tc.expected, w.Code)
+		})
+	}
+}
+
+func TestHandler_GetAppointment_ByReference(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	owned := &models.Appointment{ID: 5, Reference: "CN-7K4Q-2M9X", CitizenSubject: "citizen-123"}
+
+	testCases := []struct {
+		name     string
+		key      string
+		found    *models.Appointment
+		expected int
+	}{
+		{"known reference", "CN-7K4Q-2M9X", owned, http.StatusOK},
+		{"unknown reference", "CN-0000-0000", nil, http.StatusNotFound},
+		{"non-positive id", "0", nil, http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAppointmentService := new(MockAppointmentService)
+			mockAppointmentService.On("GetAppointmentByReference", mock.Anything, tc.key).Return(tc.found, nil)
+			handler := NewHandler(mockAppointmentService, new(MockHolidayService))
+
+			router := gin.New()
+			router.GET("/appointments/:id", withIdentity(auth.RoleCitizenPortal, "citizen-123"), handler.GetAppointment)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/appointments/"+tc.key, nil))
+
+			assert.Equal(t, tc.expected, w.Code)
+			mockAppointmentService.AssertNotCalled(t, "GetAppointment", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestHandler_GetAppointment_HidesIDFromPortal(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	owned := &models.Appointment{ID: 5, Reference: "CN-7K4Q-2M9X", CitizenSubject: "citizen-123"}
+
+	testCases := []struct {
+		name       string
+		role       auth.Role
+		key        string
+		showsID    bool
+		deprecated bool
+	}{
+		{"portal by reference", auth.RoleCitizenPortal, "CN-7K4Q-2M9X", false, false},
+		{"portal by id", auth.RoleCitizenPortal, "5", false, true},
+		{"front desk by id", auth.RoleFrontDesk, "5", true, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAppointmentService := new(MockAppointmentService)
+			mockAppointmentService.On("GetAppointment", mock.Anything, 5).Return(owned, nil)
+			mockAppointmentService.On("GetAppointmentByReference", mock.Anything, "CN-7K4Q-2M9X").Return(owned, nil)
+			handler := NewHandler(mockAppointmentService, new(MockHolidayService))
+
+			router := gin.New()
+			router.GET("/appointments/:id", withIdentity(tc.role, "citizen-123"), handler.GetAppointment)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/appointments/"+tc.key, nil))
+
+			require.Equal(t, http.StatusOK, w.Code)
+			var body map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			_, hasID := body["id"]
+			assert.Equal(t, tc.showsID, hasID)
+			assert.Equal(t, "CN-7K4Q-2M9X", body["reference"])
+			assert.Equal(t, tc.deprecated, w.Header().Get(constants.HeaderDeprecation) == "true")
+			assert.Equal(t, 5, owned.ID, "the service's appointment must not be changed")
+		})
+	}
+}
+
+func TestHandler_CancelAppointment_ByReference(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	owned := &models.Appointment{ID: 5, Reference: "CN-7K4Q-2M9X", CitizenSubject: "citizen-123"}
+	mockAppointmentService := new(MockAppointmentService)
+	mockAppointmentService.On("GetAppointmentByReference", mock.Anything, "CN-7K4Q-2M9X").Return(owned, nil)
+	mockAppointmentService.On("CancelAppointment", mock.Anything, 5).Return(owned, nil)
+	handler := NewHandler(mockAppointmentService, new(MockHolidayService))
+
+	router := gin.New()
+	router.DELETE("/appointments/:id", withIdentity(auth.RoleCitizenPortal, "citizen-123"), handler.CancelAppointment)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/appointments/CN-7K4Q-2M9X", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockAppointmentService.AssertExpectations(t)
+}
+
+func TestHandler_CancelAppointment(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	owned := &models.Appointment{ID: 5, CitizenSubject: "citizen-123"}
+	cancelledAt := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name       string
+		subject    string
+		cancelErr  error
+		expected   int
+		errorType  string
+		callCancel bool
+	}{
+		{"owner cancels", "citizen-123", nil, http.StatusOK, "", true},
+		{"other citizen", "citizen-456", nil, http.StatusNotFound, "not_found", false},
+		{"already cancelled", "citizen-123", errors.New("Appointment is already cancelled"), http.StatusConflict, "already_cancelled", true},
+		{"visit in the past", "citizen-123", errors.New("Cannot cancel an appointment in the past"), http.StatusBadRequest, "past_date", true},
+		{"visit under way", "citizen-123", errors.New("Appointment status cannot change from checked_in to cancelled"), http.StatusConflict, "invalid_status_transition", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAppointmentService := new(MockAppointmentService)
+			mockAppointmentService.On("GetAppointment", mock.Anything, 5).Return(owned, nil)
+			if tc.cancelErr != nil {
+				mockAppointmentService.On("CancelAppointment", mock.Anything, 5).Return(nil, tc.cancelErr)
+			} else {
+				mockAppointmentService.On("CancelAppointment", mock.Anything, 5).
+					Return(&models.Appointment{ID: 5, CitizenSubject: "citizen-123", CancelledAt: &cancelledAt}, nil)
+			}
+			handler := NewHandler(mockAppointmentService, new(MockHolidayService))
+
+			router := gin.New()
+			router.DELETE("/appointments/:id", withIdentity(auth.RoleCitizenPortal, tc.subject), handler.CancelAppointment)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/appointments/5", nil))
+
+			assert.Equal(t, tc.expected, w.Code)
+			if tc.errorType != "" {
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tc.errorType, response.Error)
+			}
+			if !tc.callCancel {
+				mockAppointmentService.AssertNotCalled(t, "CancelAppointment", mock.Anything, 5)
+			}
+		})
+	}
+}
+
+func TestHandler_RescheduleAppointment(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	owned := &models.Appointment{ID: 5, CitizenSubject: "citizen-123"}
+	newDate := time.Date(2075, 6, 20, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name           string
+		subject        string
+		body           string
+		holiday        bool
+		rescheduleErr  error
+		expected       int
+		errorType      string
+		callReschedule bool
+	}{
+		{"owner reschedules", "citizen-123", `{"visit_date":"2075-06-20"}`, false, nil, http.StatusOK, "", true},
+		{"other citizen", "citizen-456", `{"visit_date":"2075-06-20"}`, false, nil, http.StatusNotFound, "not_found", false},
+		{"missing date", "citizen-123", `{}`, false, nil, http.StatusBadRequest, "validation_error", false},
+		{"public holiday", "citizen-123", `{"visit_date":"2075-06-20"}`, true, nil, http.StatusBadRequest, "public_holiday", false},
+		{"date taken", "citizen-123", `{"visit_date":"2075-06-20"}`, false, errors.New("No appointments left for date 2075-06-20"), http.StatusConflict, "duplicate_appointment", true},
+		{"no staff on new date", "citizen-123", `{"visit_date":"2075-06-20"}`, false, errors.New("No staff available for date 2075-06-20"), http.StatusConflict, "no_staff_available", true},
+		{"visit in the past", "citizen-123", `{"visit_date":"2075-06-20"}`, false, errors.New("Cannot reschedule an appointment in the past"), http.StatusBadRequest, "past_date", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAppointmentService := new(MockAppointmentService)
+			mockAppointmentService.On("GetAppointment", mock.Anything, 5).Return(owned, nil)
+			if tc.rescheduleErr != nil {
+				mockAppointmentService.On("RescheduleAppointment", mock.Anything, 5, "2075-06-20").Return(nil, tc.rescheduleErr)
+			} else {
+				mockAppointmentService.On("RescheduleAppointment", mock.Anything, 5, "2075-06-20").
+					Return(&models.Appointment{ID: 5, CitizenSubject: "citizen-123", VisitDate: newDate}, nil)
+			}
+			mockHolidayService := new(MockHolidayService)
+			mockHolidayService.On("IsPublicHoliday", mock.Anything, newDate).Return(tc.holiday, nil)
+			handler := NewHandler(mockAppointmentService, mockHolidayService)
+
+			router := gin.New()
+			router.PATCH("/appointments/:id", withIdentity(auth.RoleCitizenPortal, tc.subject), handler.RescheduleAppointment)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPatch, "/appointments/5", bytes.NewBufferString(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expected, w.Code)
+			if tc.errorType != "" {
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tc.errorType, response.Error)
+			}
+			if !tc.callReschedule {
+				mockAppointmentService.AssertNotCalled(t, "RescheduleAppointment", mock.Anything, 5, "2075-06-20")
+			}
+		})
+	}
+}
+
+func TestHandler_CheckIn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	booked := &models.Appointment{ID: 5, Status: "booked"}
+
+	testCases := []struct {
+		name       string
+		checkInErr error
+		expected   int
+		errorType  string
+	}{
+		{"checked in", nil, http.StatusOK, ""},
+		{"not the visit day", errors.New("Check-in is only possible on the day of the visit"), http.StatusConflict, "not_visit_day"},
+		{"already checked in", errors.New("Appointment status cannot change from checked_in to checked_in"), http.StatusConflict, "invalid_status_transition"},
+		{"database error", errors.New("db down"), http.StatusInternalServerError, "internal_error"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAppointmentService := new(MockAppointmentService)
+			mockAppointmentService.On("GetAppointmentByReference", mock.Anything, "CN-7K4Q-2M9X").Return(booked, nil)
+			if tc.checkInErr != nil {
+				mockAppointmentService.On("CheckIn", mock.Anything, 5).Return(nil, tc.checkInErr)
+			} else {
+				mockAppointmentService.On("CheckIn", mock.Anything, 5).Return(&models.Appointment{ID: 5, Status: "checked_in"}, nil)
+			}
+			handler := NewHandler(mockAppointmentService, new(MockHolidayService))
+
+			router := gin.New()
+			router.POST("/appointments/:id/check-in", withIdentity(auth.RoleFrontDesk, ""), handler.CheckIn)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/appointments/CN-7K4Q-2M9X/check-in", nil))
+
+			assert.Equal(t, tc.expected, w.Code)
+			var response models.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tc.errorType, response.Error)
+			mockAppointmentService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandler_CompleteVisit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockAppointmentService := new(MockAppointmentService)
+	mockAppointmentService.On("GetAppointment", mock.Anything, 5).Return(&models.Appointment{ID: 5, Status: "checked_in"}, nil)
+	mockAppointmentService.On("CompleteVisit", mock.Anything, 5).Return(&models.Appointment{ID: 5, Status: "completed"}, nil)
+	mockAppointmentService.On("GetAppointment", mock.Anything, 6).Return(&models.Appointment{ID: 6, Status: "booked"}, nil)
+	mockAppointmentService.On("CompleteVisit", mock.Anything, 6).
+		Return(nil, errors.New("Appointment status cannot change from booked to completed"))
+	handler := NewHandler(mockAppointmentService, new(MockHolidayService))
+
+	router := gin.New()
+	router.POST("/appointments/:id/complete", withIdentity(auth.RoleFrontDesk, ""), handler.CompleteVisit)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/appointments/5/complete", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/appointments/6/complete", nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/appointments/0/complete", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	mockAppointmentService.AssertExpectations(t)
+}
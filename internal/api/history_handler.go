@@ -0,0 +1,49 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"citynext-appointments/internal/audit"
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AppointmentHistory reads the audit trail of an appointment
+type AppointmentHistory interface {
+	History(ctx context.Context, appointmentID int) ([]audit.Event, error)
+}
+
+type HistoryHandler struct {
+	history AppointmentHistory
+}
+
+func NewHistoryHandler(history AppointmentHistory) *HistoryHandler {
+	return &HistoryHandler{history: history}
+}
+
+// GetHistory serves GET /admin/appointments/:id/history, every recorded change of
+// an appointment oldest first. Bookings made before the trail existed have none.
+func (h *HistoryHandler) GetHistory(c *gin.Context) {
+	id := parseID(c)
+	if id <= 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   constants.ErrorTypeValidation,
+			Message: "Invalid appointment id",
+		})
+		return
+	}
+
+	events, err := h.history.History(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   constants.ErrorTypeInternal,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"citynext-appointments/internal/audit"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubHistory struct {
+	events []audit.Event
+	err    error
+}
+
+func (s stubHistory) History(ctx context.Context, appointmentID int) ([]audit.Event, error) {
+	return s.events, s.err
+}
+
+func TestHistoryHandler_GetHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	testCases := []struct {
+		name     string
+		path     string
+		history  stubHistory
+		expected int
+	}{
+		{"history", "/admin/appointments/5/history", stubHistory{events: []audit.Event{{ID: 1, AppointmentID: 5, Action: "appointment.created"}}}, http.StatusOK},
+		{"invalid id", "/admin/appointments/abc/history", stubHistory{}, http.StatusBadRequest},
+		{"database error", "/admin/appointments/5/history", stubHistory{err: errors.New("db down")}, http.StatusInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/admin/appointments/:id/history", NewHistoryHandler(tc.history).GetHistory)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			assert.Equal(t, tc.expected, w.Code)
+			if tc.expected == http.StatusOK {
+				var events []audit.Event
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &events))
+				assert.Equal(t, "appointment.created", events[0].Action)
+			}
+		})
+	}
+}
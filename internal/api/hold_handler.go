@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"citynext-appointments/internal/auth"
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HoldManager reserves dates during multi-step booking
+type HoldManager interface {
+	CreateHold(ctx context.Context, req *models.CreateHoldRequest) (*models.SlotHold, error)
+	ReleaseHold(ctx context.Context, token, citizenSubject string) error
+}
+
+type HoldHandler struct {
+	holds          HoldManager
+	holidayService service.HolidayServiceInterface
+}
+
+func NewHoldHandler(holds HoldManager, holidayService service.HolidayServiceInterface) *HoldHandler {
+	return &HoldHandler{holds: holds, holidayService: holidayService}
+}
+
+// CreateHold serves POST /holds. The returned token is passed as hold_token to POST /appointments.
+func (h *HoldHandler) CreateHold(c *gin.Context) {
+	var req models.CreateHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   constants.ErrorTypeValidation,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	if !checkVisitDate(c, h.holidayService, req.VisitDate) {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// A hold placed with a citizen token can only be used by that citizen
+	if citizen, ok := auth.CitizenFrom(ctx); ok {
+		req.CitizenSubject = citizen.Subject
+	}
+	if principal, ok := auth.PrincipalFrom(ctx); ok {
+		req.APIKeyID = principal.KeyID
+	}
+
+	hold, err := h.holds.CreateHold(ctx, &req)
+	if err != nil {
+		status := http.StatusInternalServerError
+		errorType := constants.ErrorTypeInternal
+
+		switch {
+		case err.Error() == constants.ErrPastDate:
+			status = http.StatusBadRequest
+			errorType = constants.ErrorTypePastDate
+		case err.Error() == constants.ErrHoldTooLong:
+			status = http.StatusBadRequest
+			errorType = constants.ErrorTypeValidation
+		case err.Error() == constants.ErrUnknownServiceType:
+			status = http.StatusBadRequest
+			errorType = constants.ErrorTypeUnknownServiceType
+		case err.Error() == constants.ErrDateHeld:
+			status = http.StatusConflict
+			errorType = constants.ErrorTypeDateHeld
+		case err.Error() == constants.ErrTooManyHolds:
+			status = http.StatusConflict
+			errorType = constants.ErrorTypeTooManyHolds
+		case strings.HasPrefix(err.Error(), constants.ErrDuplicateAppointment):
+			status = http.StatusConflict
+			errorType = constants.ErrorTypeDuplicateAppt
+		}
+
+		c.JSON(status, models.ErrorResponse{
+			Error:   errorType,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, hold)
+}
+
+// ReleaseHold serves DELETE /holds/:token for citizens who abandon the booking
+func (h *HoldHandler) ReleaseHold(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var subject string
+	if citizen, ok := auth.CitizenFrom(ctx); ok {
+		subject = citizen.Subject
+	}
+
+	if err := h.holds.ReleaseHold(ctx, c.Param("token"), subject); err != nil {
+		status := http.StatusInternalServerError
+		errorType := constants.ErrorTypeInternal
+
+		if err.Error() == constants.ErrHoldNotFound {
+			status = http.StatusNotFound
+			errorType = constants.ErrorTypeNotFound
+		}
+
+		c.JSON(status, models.ErrorResponse{
+			Error:   errorType,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
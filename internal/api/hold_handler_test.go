@@ -0,0 +1,135 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/auth"
+	"citynext-appointments/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockHolds struct {
+	mock.Mock
+}
+
+func (m *MockHolds) CreateHold(ctx context.Context, req *models.CreateHoldRequest) (*models.SlotHold, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.SlotHold), args.Error(1)
+}
+
+func (m *MockHolds) ReleaseHold(ctx context.Context, token, citizenSubject string) error {
+	return m.Called(ctx, token, citizenSubject).Error(0)
+}
+
+func TestHoldHandler_CreateHold(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	visitDate := time.Date(2075, 6, 10, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name      string
+		holdErr   error
+		expected  int
+		errorType string
+	}{
+		{"held", nil, http.StatusCreated, ""},
+		{"already booked", errors.New("No appointments left for date 2075-06-10"), http.StatusConflict, "duplicate_appointment"},
+		{"held by someone else", errors.New("Date is held for another booking in progress"), http.StatusConflict, "date_held"},
+		{"too long", errors.New("Requested hold is longer than allowed"), http.StatusBadRequest, "validation_error"},
+		{"past date", errors.New("Visit date cannot be in the past"), http.StatusBadRequest, "past_date"},
+		{"too many holds", errors.New("Too many dates are held at once"), http.StatusConflict, "too_many_holds"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			holds := new(MockHolds)
+			holidays := new(MockHolidayService)
+			holidays.On("IsPublicHoliday", mock.Anything, visitDate).Return(false, nil)
+
+			matchReq := mock.MatchedBy(func(req *models.CreateHoldRequest) bool {
+				return req.VisitDate == "2075-06-10" && req.Minutes == 15 && req.CitizenSubject == "citizen-123" && req.APIKeyID == 1
+			})
+			if tc.holdErr != nil {
+				holds.On("CreateHold", mock.Anything, matchReq).Return(nil, tc.holdErr)
+			} else {
+				holds.On("CreateHold", mock.Anything, matchReq).
+					Return(&models.SlotHold{Token: "abc", VisitDate: visitDate, ExpiresAt: visitDate}, nil)
+			}
+
+			router := gin.New()
+			router.POST("/holds", withIdentity(auth.RoleCitizenPortal, "citizen-123"), NewHoldHandler(holds, holidays).CreateHold)
+
+			body, _ := json.Marshal(map[string]interface{}{"visit_date": "2075-06-10", "service_type": "general", "minutes": 15})
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/holds", bytes.NewReader(body)))
+
+			assert.Equal(t, tc.expected, w.Code)
+			if tc.errorType != "" {
+				var response models.ErrorResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tc.errorType, response.Error)
+			} else {
+				var hold models.SlotHold
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &hold))
+				assert.Equal(t, "abc", hold.Token)
+			}
+			holds.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHoldHandler_ReleaseHold(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	holds := new(MockHolds)
+	holds.On("ReleaseHold", mock.Anything, "abc", "citizen-123").Return(nil)
+	holds.On("ReleaseHold", mock.Anything, "gone", "citizen-123").Return(errors.New("Hold not found or expired"))
+
+	router := gin.New()
+	router.DELETE("/holds/:token", withIdentity(auth.RoleCitizenPortal, "citizen-123"), NewHoldHandler(holds, new(MockHolidayService)).ReleaseHold)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/holds/abc", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/holds/gone", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandler_CreateAppointment_HoldExpired(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockAppointmentService := new(MockAppointmentService)
+	mockHolidayService := new(MockHolidayService)
+	mockHolidayService.On("IsPublicHoliday", mock.Anything, mock.Anything).Return(false, nil)
+	mockAppointmentService.On("CreateAppointment", mock.Anything, mock.MatchedBy(func(req *models.CreateAppointmentRequest) bool {
+		return req.HoldToken == "stale"
+	})).Return(nil, errors.New("Hold not found or expired"))
+
+	router := gin.New()
+	router.POST("/appointments", NewHandler(mockAppointmentService, mockHolidayService).CreateAppointment)
+
+	body, _ := json.Marshal(map[string]string{"first_name": "John", "last_name": "Doe", "visit_date": "2075-06-15", "service_type": "general", "hold_token": "stale"})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/appointments", bytes.NewReader(body)))
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	var response models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "hold_not_found", response.Error)
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaxImportSize bounds the CSV body accepted by the import endpoint
+const MaxImportSize = 10 << 20
+
+// AppointmentImporter loads appointments from a CSV file
+type AppointmentImporter interface {
+	Import(ctx context.Context, r io.Reader, dryRun bool) (*models.ImportResult, error)
+}
+
+type ImportHandler struct {
+	importer AppointmentImporter
+}
+
+func NewImportHandler(importer AppointmentImporter) *ImportHandler {
+	return &ImportHandler{importer: importer}
+}
+
+// ImportAppointments serves POST /admin/appointments/import?dry_run=true with a CSV body.
+// Rejected rows are listed in the result; the other rows are imported unless dry_run is set.
+func (h *ImportHandler) ImportAppointments(c *gin.Context) {
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   constants.ErrorTypeValidation,
+			Message: "dry_run must be true or false",
+		})
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, MaxImportSize)
+	result, err := h.importer.Import(c.Request.Context(), body, dryRun)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, models.ErrorResponse{
+				Error:   constants.ErrorTypeValidation,
+				Message: "import file is too large",
+			})
+		case errors.Is(err, service.ErrImportHeader):
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   constants.ErrorTypeValidation,
+				Message: err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   constants.ErrorTypeInternal,
+				Message: err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubImporter struct {
+	dryRun bool
+	body   string
+	err    error
+}
+
+func (s *stubImporter) Import(ctx context.Context, r io.Reader, dryRun bool) (*models.ImportResult, error) {
+	s.dryRun = dryRun
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read import file: %w", err)
+	}
+	s.body = string(data)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &models.ImportResult{DryRun: dryRun, Rows: 1, Valid: 1, Errors: []models.ImportRowError{}}, nil
+}
+
+func TestImportHandler_ImportAppointments(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	testCases := []struct {
+		name     string
+		query    string
+		body     string
+		importer *stubImporter
+		expected int
+	}{
+		{"import", "", "first_name,last_name,visit_date\n", &stubImporter{}, http.StatusOK},
+		{"dry run", "?dry_run=true", "first_name,last_name,visit_date\n", &stubImporter{}, http.StatusOK},
+		{"bad dry run flag", "?dry_run=maybe", "", &stubImporter{}, http.StatusBadRequest},
+		{"missing header", "", "", &stubImporter{err: service.ErrImportHeader}, http.StatusBadRequest},
+		{"too large", "", strings.Repeat("x", MaxImportSize+1), &stubImporter{}, http.StatusRequestEntityTooLarge},
+		{"database error", "", "first_name,last_name,visit_date\n", &stubImporter{err: errors.New("db down")}, http.StatusInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			router := gin.New()
+			router.POST("/admin/appointments/import", NewImportHandler(tc.importer).ImportAppointments)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/admin/appointments/import"+tc.query, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "text/csv")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expected, w.Code)
+		})
+	}
+}
+
+func TestImportHandler_PassesBodyAndDryRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	importer := &stubImporter{}
+	router := gin.New()
+	router.POST("/admin/appointments/import", NewImportHandler(importer).ImportAppointments)
+
+	w := httptest.NewRecorder()
+	body := "first_name,last_name,visit_date\nJohn,Doe,2075-06-10\n"
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/appointments/import?dry_run=1", strings.NewReader(body)))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, importer.dryRun)
+	assert.Equal(t, body, importer.body)
+
+	var result models.ImportResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.True(t, result.DryRun)
+}
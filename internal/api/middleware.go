@@ -0,0 +1,289 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"citynext-appointments/internal/audit"
+	"citynext-appointments/internal/auth"
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxRequestIDLength caps request ids supplied by clients
+const maxRequestIDLength = 64
+
+// RequestID tags every request with an id, taken from the X-Request-ID header
+// when the client or a proxy sent a usable one and generated otherwise. The id
+// is echoed in the response and recorded in the appointment history.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(constants.HeaderRequestID)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Header(constants.HeaderRequestID, id)
+		c.Request = c.Request.WithContext(audit.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// validRequestID accepts short ids of letters, digits and - _ . : so a client
+// cannot smuggle arbitrary text into the history
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.:", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// KeyAuthenticator resolves an API key to the calling principal
+type KeyAuthenticator interface {
+	Authenticate(ctx context.Context, key string) (*auth.Principal, error)
+}
+
+// Authenticate attaches the principal for the X-API-Key header to the request context.
+// Requests without a key pass through unauthenticated; RequireRole decides whether that is allowed.
+func Authenticate(keys KeyAuthenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(constants.HeaderAPIKey)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		principal, err := keys.Authenticate(c.Request.Context(), key)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   constants.ErrorTypeInternal,
+				Message: "Failed to authenticate request",
+			})
+			return
+		}
+		if principal == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error:   constants.ErrorTypeUnauthorized,
+				Message: constants.ErrUnauthorized,
+			})
+			return
+		}
+
+		c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), principal))
+		c.Next()
+	}
+}
+
+// TenantResolver finds the tenant a request is for
+type TenantResolver interface {
+	ByID(id int) (*tenant.Tenant, bool)
+	BySlug(slug string) (*tenant.Tenant, bool)
+	ByHost(host string) (*tenant.Tenant, bool)
+}
+
+// ResolveTenant attaches the tenant a request is for to its context, so the
+// handlers and the database only see that tenant's data. An X-Tenant header
+// naming the tenant's slug wins over the hostname the request was sent to; a
+// request naming neither is for the tenant of its API key, or for fallback
+// when that is set. Keys only work for their own tenant, so it must run after
+// Authenticate.
+func ResolveTenant(tenants TenantResolver, fallback string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var resolved *tenant.Tenant
+		var found bool
+		if slug := c.GetHeader(constants.HeaderTenant); slug != "" {
+			resolved, found = tenants.BySlug(slug)
+			if !found {
+				abortUnknownTenant(c)
+				return
+			}
+		} else {
+			resolved, found = tenants.ByHost(c.Request.Host)
+		}
+
+		principal, authenticated := auth.PrincipalFrom(c.Request.Context())
+		switch {
+		case authenticated && found && principal.TenantID != resolved.ID:
+			c.AbortWithStatusJSON(http.StatusForbidden, models.ErrorResponse{
+				Error:   constants.ErrorTypeForbidden,
+				Message: constants.ErrTenantMismatch,
+			})
+			return
+		case authenticated && !found:
+			resolved, found = tenants.ByID(principal.TenantID)
+		case !found && fallback != "":
+			resolved, found = tenants.BySlug(fallback)
+		}
+		if !found {
+			abortUnknownTenant(c)
+			return
+		}
+
+		c.Request = c.Request.WithContext(tenant.WithTenant(c.Request.Context(), resolved))
+		c.Next()
+	}
+}
+
+func abortUnknownTenant(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusNotFound, models.ErrorResponse{
+		Error:   constants.ErrorTypeUnknownTenant,
+		Message: constants.ErrUnknownTenant,
+	})
+}
+
+// RequireRole rejects requests whose principal does not hold at least the given role
+func RequireRole(role auth.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := auth.PrincipalFrom(c.Request.Context())
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error:   constants.ErrorTypeUnauthorized,
+				Message: constants.ErrUnauthorized,
+			})
+			return
+		}
+		if !principal.Role.Allows(role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, models.ErrorResponse{
+				Error:   constants.ErrorTypeForbidden,
+				Message: constants.ErrForbidden,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireKeyTenant rejects requests whose API key does not belong to the given
+// tenant, for routes that act on every tenant at once
+func RequireKeyTenant(tenantID int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := auth.PrincipalFrom(c.Request.Context())
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error:   constants.ErrorTypeUnauthorized,
+				Message: constants.ErrUnauthorized,
+			})
+			return
+		}
+		if principal.TenantID != tenantID {
+			c.AbortWithStatusJSON(http.StatusForbidden, models.ErrorResponse{
+				Error:   constants.ErrorTypeForbidden,
+				Message: constants.ErrForbidden,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// TokenVerifier validates citizen bearer tokens
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (*auth.Claims, error)
+}
+
+// AuthenticateCitizen attaches the citizen from a valid "Authorization: Bearer" token to the
+// request context. Requests without a token pass through; invalid tokens are rejected.
+func AuthenticateCitizen(verifier TokenVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader(constants.HeaderAuthorization)
+		if !strings.HasPrefix(header, constants.BearerPrefix) {
+			c.Next()
+			return
+		}
+
+		claims, err := verifier.Verify(c.Request.Context(), strings.TrimPrefix(header, constants.BearerPrefix))
+		if err != nil {
+			// Why a token failed can name the expected issuer or a key fetch error,
+			// so the reason stays in the log
+			log.Printf("Rejected bearer token: %v", err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error:   constants.ErrorTypeUnauthorized,
+				Message: constants.ErrInvalidBearerToken,
+			})
+			return
+		}
+
+		citizen := &auth.Citizen{Subject: claims.Subject}
+		c.Request = c.Request.WithContext(auth.WithCitizen(c.Request.Context(), citizen))
+		c.Next()
+	}
+}
+
+// RequireCitizen rejects requests that do not carry a verified citizen token
+func RequireCitizen() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := auth.CitizenFrom(c.Request.Context()); !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error:   constants.ErrorTypeUnauthorized,
+				Message: "A citizen bearer token is required",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RateLimiter decides whether a client may make another request
+type RateLimiter interface {
+	Allow(key string) (bool, time.Duration)
+}
+
+// RateLimit throttles requests per client IP and answers 429 with Retry-After
+// when a client is over its limit. Register it ahead of Authenticate, so
+// guessing API keys is throttled like any other request.
+func RateLimit(limiter RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		throttle(c, limiter, "ip:"+c.ClientIP())
+	}
+}
+
+// RateLimitKeys throttles requests per API key. Register it after
+// Authenticate; requests without a key are left to RateLimit.
+func RateLimitKeys(limiter RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := auth.PrincipalFrom(c.Request.Context())
+		if !ok {
+			c.Next()
+			return
+		}
+		throttle(c, limiter, "key:"+strconv.Itoa(principal.KeyID))
+	}
+}
+
+// throttle lets the request through if the client under key is within its limit
+func throttle(c *gin.Context, limiter RateLimiter, key string) {
+	allowed, retryAfter := limiter.Allow(key)
+	if !allowed {
+		// Retry-After is in whole seconds, rounded up so clients never retry too early
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, models.ErrorResponse{
+			Error:   constants.ErrorTypeRateLimited,
+			Message: constants.ErrRateLimited,
+		})
+		return
+	}
+	c.Next()
+}
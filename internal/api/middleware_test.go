@@ -0,0 +1,358 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/audit"
+	"citynext-appointments/internal/auth"
+	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// staticKeys authenticates a fixed set of plaintext keys
+type staticKeys map[string]auth.Role
+
+func (k staticKeys) Authenticate(ctx context.Context, key string) (*auth.Principal, error) {
+	if key == "boom" {
+		return nil, errors.New("database unavailable")
+	}
+	role, ok := k[key]
+	if !ok {
+		return nil, nil
+	}
+	return &auth.Principal{KeyID: 1, KeyName: key, Role: role}, nil
+}
+
+func newRoleRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(Authenticate(staticKeys{
+		"portal": auth.RoleCitizenPortal,
+		"desk":   auth.RoleFrontDesk,
+		"admin":  auth.RoleAdmin,
+	}))
+	router.GET("/public", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/desk", RequireRole(auth.RoleFrontDesk), func(c *gin.Context) {
+		principal, _ := auth.PrincipalFrom(c.Request.Context())
+		c.String(http.StatusOK, principal.KeyName)
+	})
+	return router
+}
+
+func TestRequireRole(t *testing.T) {
+	router := newRoleRouter()
+
+	testCases := []struct {
+		name     string
+		path     string
+		key      string
+		expected int
+	}{
+		{"public route without key", "/public", "", http.StatusOK},
+		{"missing key", "/desk", "", http.StatusUnauthorized},
+		{"unknown key", "/desk", "nope", http.StatusUnauthorized},
+		{"lookup failure", "/desk", "boom", http.StatusInternalServerError},
+		{"insufficient role", "/desk", "portal", http.StatusForbidden},
+		{"exact role", "/desk", "desk", http.StatusOK},
+		{"higher role", "/desk", "admin", http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.key != "" {
+				request.Header.Set("X-API-Key", tc.key)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, request)
+
+			assert.Equal(t, tc.expected, w.Code)
+		})
+	}
+}
+
+func TestRequireKeyTenant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	principals := map[string]*auth.Principal{
+		"operator": {KeyID: 1, Role: auth.RoleAdmin, TenantID: 1},
+		"other":    {KeyID: 2, Role: auth.RoleAdmin, TenantID: 2},
+	}
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if principal, ok := principals[c.GetHeader("X-API-Key")]; ok {
+			c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), principal))
+		}
+		c.Next()
+	})
+	router.GET("/clock", RequireKeyTenant(1), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	testCases := []struct {
+		name     string
+		key      string
+		expected int
+	}{
+		{"missing key", "", http.StatusUnauthorized},
+		{"other tenant", "other", http.StatusForbidden},
+		{"operating tenant", "operator", http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/clock", nil)
+			request.Header.Set("X-API-Key", tc.key)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, request)
+
+			assert.Equal(t, tc.expected, w.Code)
+		})
+	}
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limiter := &fixedLimiter{remaining: map[string]int{"key:1": 1}}
+
+	router := gin.New()
+	router.Use(Authenticate(staticKeys{"portal": auth.RoleCitizenPortal}), RateLimitKeys(limiter))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	send := func(remoteAddr, key string) int {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.RemoteAddr = remoteAddr
+		if key != "" {
+			request.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send("192.0.2.1:1234", "portal"))
+	assert.Equal(t, http.StatusTooManyRequests, send("192.0.2.2:1234", "portal"), "a key has one limit whatever IP it comes from")
+	assert.Equal(t, http.StatusOK, send("192.0.2.2:1234", ""), "requests without a key are left to the IP limit")
+}
+
+// stubVerifier accepts "good-token" for citizen-123 and rejects everything else
+type stubVerifier struct{}
+
+func (stubVerifier) Verify(ctx context.Context, token string) (*auth.Claims, error) {
+	if token != "good-token" {
+		return nil, errors.New("invalid token signature")
+	}
+	return &auth.Claims{Subject: "citizen-123"}, nil
+}
+
+func TestAuthenticateCitizen(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(AuthenticateCitizen(stubVerifier{}))
+	router.GET("/optional", func(c *gin.Context) {
+		citizen, ok := auth.CitizenFrom(c.Request.Context())
+		if !ok {
+			c.String(http.StatusOK, "anonymous")
+			return
+		}
+		c.String(http.StatusOK, citizen.Subject)
+	})
+	router.GET("/required", RequireCitizen(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	testCases := []struct {
+		name     string
+		path     string
+		header   string
+		expected int
+		body     string
+	}{
+		{"no token", "/optional", "", http.StatusOK, "anonymous"},
+		{"valid token", "/optional", "Bearer good-token", http.StatusOK, "citizen-123"},
+		{"invalid token", "/optional", "Bearer forged", http.StatusUnauthorized, `{"error":"unauthorized","message":"Invalid bearer token"}`},
+		{"required without token", "/required", "", http.StatusUnauthorized, ""},
+		{"required with token", "/required", "Bearer good-token", http.StatusOK, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.header != "" {
+				request.Header.Set("Authorization", tc.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, request)
+
+			assert.Equal(t, tc.expected, w.Code)
+			if tc.body != "" {
+				assert.Equal(t, tc.body, w.Body.String())
+			}
+		})
+	}
+}
+
+// fixedLimiter allows the first n requests per key, then asks clients to wait 1.2s
+type fixedLimiter struct {
+	remaining map[string]int
+}
+
+func (l *fixedLimiter) Allow(key string) (bool, time.Duration) {
+	if l.remaining[key] > 0 {
+		l.remaining[key]--
+		return true, 0
+	}
+	return false, 1200 * time.Millisecond
+}
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limiter := &fixedLimiter{remaining: map[string]int{"ip:192.0.2.1": 2, "ip:192.0.2.2": 1}}
+
+	router := gin.New()
+	router.Use(RateLimit(limiter), Authenticate(staticKeys{"portal": auth.RoleCitizenPortal}))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	send := func(remoteAddr, key string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.RemoteAddr = remoteAddr
+		if key != "" {
+			request.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send("192.0.2.1:1234", "portal").Code)
+	assert.Equal(t, http.StatusUnauthorized, send("192.0.2.1:1234", "guess-1").Code)
+
+	w := send("192.0.2.1:1234", "guess-2")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "failed keys count against the limit before they are checked")
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+
+	var response models.ErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "rate_limited", response.Error)
+
+	assert.Equal(t, http.StatusOK, send("192.0.2.2:1234", "portal").Code, "every client IP has a limit of its own")
+	assert.Equal(t, http.StatusTooManyRequests, send("192.0.2.2:1234", "portal").Code)
+}
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var seen string
+	router := gin.New()
+	router.Use(RequestID())
+	router.GET("/", func(c *gin.Context) {
+		seen = audit.RequestIDFrom(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	send := func(id string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		if id != "" {
+			request.Header.Set("X-Request-ID", id)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w
+	}
+
+	w := send("req-42")
+	assert.Equal(t, "req-42", seen)
+	assert.Equal(t, "req-42", w.Header().Get("X-Request-ID"))
+
+	w = send("")
+	assert.Len(t, seen, 32)
+	assert.Equal(t, seen, w.Header().Get("X-Request-ID"))
+
+	send("evil\nid")
+	assert.Len(t, seen, 32, "unusable ids are replaced")
+	send(strings.Repeat("a", 65))
+	assert.Len(t, seen, 32, "overlong ids are replaced")
+}
+
+// tenantKeys authenticates admin keys belonging to the given tenants
+type tenantKeys map[string]int
+
+func (k tenantKeys) Authenticate(ctx context.Context, key string) (*auth.Principal, error) {
+	tenantID, ok := k[key]
+	if !ok {
+		return nil, nil
+	}
+	return &auth.Principal{KeyID: tenantID, KeyName: key, Role: auth.RoleAdmin, TenantID: tenantID}, nil
+}
+
+func TestResolveTenant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tenants := tenant.NewRegistry([]*tenant.Tenant{
+		{ID: 1, Slug: "default", Name: "CityNext"},
+		{ID: 2, Slug: "glasgow", Name: "Glasgow", Hostname: "appointments.glasgow.example"},
+		{ID: 3, Slug: "leeds", Name: "Leeds", Hostname: "appointments.leeds.example"},
+	})
+
+	newRouter := func(fallback string) *gin.Engine {
+		router := gin.New()
+		router.Use(Authenticate(tenantKeys{"glasgow-admin": 2, "leeds-admin": 3}), ResolveTenant(tenants, fallback))
+		router.GET("/", func(c *gin.Context) {
+			resolved, _ := tenant.From(c.Request.Context())
+			c.String(http.StatusOK, resolved.Slug)
+		})
+		return router
+	}
+
+	testCases := []struct {
+		name     string
+		fallback string
+		host     string
+		header   string
+		key      string
+		expected int
+		slug     string
+	}{
+		{"hostname", "", "appointments.glasgow.example", "", "", http.StatusOK, "glasgow"},
+		{"hostname with port", "", "appointments.leeds.example:8080", "", "", http.StatusOK, "leeds"},
+		{"header wins over hostname", "", "appointments.glasgow.example", "leeds", "", http.StatusOK, "leeds"},
+		{"api key", "", "localhost", "", "leeds-admin", http.StatusOK, "leeds"},
+		{"api key on its own host", "", "appointments.glasgow.example", "", "glasgow-admin", http.StatusOK, "glasgow"},
+		{"fallback", "default", "localhost", "", "", http.StatusOK, "default"},
+		{"api key wins over fallback", "default", "localhost", "", "glasgow-admin", http.StatusOK, "glasgow"},
+		{"unknown host", "", "localhost", "", "", http.StatusNotFound, ""},
+		{"unknown header", "default", "localhost", "paris", "", http.StatusNotFound, ""},
+		{"api key on another tenant's host", "", "appointments.glasgow.example", "", "leeds-admin", http.StatusForbidden, ""},
+		{"api key for another tenant's header", "", "localhost", "glasgow", "leeds-admin", http.StatusForbidden, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.Host = tc.host
+			if tc.header != "" {
+				request.Header.Set("X-Tenant", tc.header)
+			}
+			if tc.key != "" {
+				request.Header.Set("X-API-Key", tc.key)
+			}
+			w := httptest.NewRecorder()
+			newRouter(tc.fallback).ServeHTTP(w, request)
+
+			assert.Equal(t, tc.expected, w.Code)
+			if tc.expected == http.StatusOK {
+				assert.Equal(t, tc.slug, w.Body.String())
+			}
+		})
+	}
+}
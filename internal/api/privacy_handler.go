@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CitizenPrivacy answers subject access and erasure requests of citizens
+type CitizenPrivacy interface {
+	CitizenData(ctx context.Context, subject, email string) (*service.CitizenData, error)
+	Erase(ctx context.Context, subject, email string) (*service.ErasureReport, error)
+}
+
+type PrivacyHandler struct {
+	privacy CitizenPrivacy
+}
+
+func NewPrivacyHandler(privacy CitizenPrivacy) *PrivacyHandler {
+	return &PrivacyHandler{privacy: privacy}
+}
+
+// ExportCitizenData serves GET /admin/citizens/data?subject=&email=, every
+// appointment, waitlist entry and history entry stored about the citizen
+func (h *PrivacyHandler) ExportCitizenData(c *gin.Context) {
+	data, err := h.privacy.CitizenData(c.Request.Context(), c.Query("subject"), c.Query("email"))
+	if err != nil {
+		respondPrivacyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, data)
+}
+
+// EraseCitizenData serves DELETE /admin/citizens/data?subject=&email=. The
+// citizen's records are anonymised rather than deleted; the response counts them.
+func (h *PrivacyHandler) EraseCitizenData(c *gin.Context) {
+	report, err := h.privacy.Erase(c.Request.Context(), c.Query("subject"), c.Query("email"))
+	if err != nil {
+		respondPrivacyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+func respondPrivacyError(c *gin.Context, err error) {
+	if err.Error() == constants.ErrCitizenRequired {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   constants.ErrorTypeValidation,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+		Error:   constants.ErrorTypeInternal,
+		Message: err.Error(),
+	})
+}
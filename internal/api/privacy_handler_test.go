@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubPrivacy struct {
+	subject, email string
+	err            error
+}
+
+func (s *stubPrivacy) CitizenData(ctx context.Context, subject, email string) (*service.CitizenData, error) {
+	s.subject, s.email = subject, email
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &service.CitizenData{Appointments: []models.Appointment{{ID: 5}}}, nil
+}
+
+func (s *stubPrivacy) Erase(ctx context.Context, subject, email string) (*service.ErasureReport, error) {
+	s.subject, s.email = subject, email
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &service.ErasureReport{Appointments: 1, HistoryEntries: 3}, nil
+}
+
+func newPrivacyRouter(privacy CitizenPrivacy) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	handler := NewPrivacyHandler(privacy)
+	router.GET("/admin/citizens/data", handler.ExportCitizenData)
+	router.DELETE("/admin/citizens/data", handler.EraseCitizenData)
+	return router
+}
+
+func TestPrivacyHandler_ExportCitizenData(t *testing.T) {
+	privacy := &stubPrivacy{}
+	w := httptest.NewRecorder()
+	newPrivacyRouter(privacy).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/citizens/data?subject=citizen-123&email=john@example.com", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "citizen-123", privacy.subject)
+	assert.Equal(t, "john@example.com", privacy.email)
+	var data service.CitizenData
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &data))
+	require.Len(t, data.Appointments, 1)
+	assert.Equal(t, 5, data.Appointments[0].ID)
+}
+
+func TestPrivacyHandler_EraseCitizenData(t *testing.T) {
+	privacy := &stubPrivacy{}
+	w := httptest.NewRecorder()
+	newPrivacyRouter(privacy).ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/admin/citizens/data?subject=citizen-123", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "citizen-123", privacy.subject)
+	assert.JSONEq(t, `{"appointments":1,"waitlist_entries":0,"history_entries":3}`, w.Body.String())
+}
+
+func TestPrivacyHandler_Errors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"no citizen given", fmt.Errorf("%s", constants.ErrCitizenRequired), http.StatusBadRequest},
+		{"database error", errors.New("db down"), http.StatusInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		for _, method := range []string{http.MethodGet, http.MethodDelete} {
+			t.Run(tc.name+" "+method, func(t *testing.T) {
+				w := httptest.NewRecorder()
+				newPrivacyRouter(&stubPrivacy{err: tc.err}).ServeHTTP(w, httptest.NewRequest(method, "/admin/citizens/data", nil))
+
+				assert.Equal(t, tc.expected, w.Code)
+			})
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// AppointmentSearch finds appointments by a name that may be misspelt
+type AppointmentSearch interface {
+	Search(ctx context.Context, query string, limit, offset int) (*models.AppointmentSearchPage, error)
+}
+
+type SearchHandler struct {
+	search AppointmentSearch
+}
+
+func NewSearchHandler(search AppointmentSearch) *SearchHandler {
+	return &SearchHandler{search: search}
+}
+
+// SearchAppointments serves GET /admin/appointments/search?q=, the appointments
+// whose names match or sound like q, best match first. limit (default 20, at
+// most 100) and offset page through the results.
+func (h *SearchHandler) SearchAppointments(c *gin.Context) {
+	limit, ok := h.intParam(c, "limit", defaultSearchLimit, 1, maxSearchLimit)
+	if !ok {
+		return
+	}
+	offset, ok := h.intParam(c, "offset", 0, 0, -1)
+	if !ok {
+		return
+	}
+
+	page, err := h.search.Search(c.Request.Context(), c.Query("q"), limit, offset)
+	if err != nil {
+		if err.Error() == constants.ErrInvalidSearchQuery {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   constants.ErrorTypeValidation,
+				Message: err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   constants.ErrorTypeInternal,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// intParam reads an optional integer query parameter of at least min and, if
+// max is not negative, at most max. It answers 400 and returns false otherwise.
+func (h *SearchHandler) intParam(c *gin.Context, name string, fallback, min, max int) (int, bool) {
+	raw := c.Query(name)
+	if raw == "" {
+		return fallback, true
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < min || (max >= 0 && value > max) {
+		message := name + " must be at least " + strconv.Itoa(min)
+		if max >= 0 {
+			message = name + " must be between " + strconv.Itoa(min) + " and " + strconv.Itoa(max)
+		}
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   constants.ErrorTypeValidation,
+			Message: message,
+		})
+		return 0, false
+	}
+	return value, true
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubSearch struct {
+	page *models.AppointmentSearchPage
+	err  error
+
+	query         string
+	limit, offset int
+}
+
+func (s *stubSearch) Search(ctx context.Context, query string, limit, offset int) (*models.AppointmentSearchPage, error) {
+	s.query, s.limit, s.offset = query, limit, offset
+	return s.page, s.err
+}
+
+func TestSearchHandler_SearchAppointments(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	page := &models.AppointmentSearchPage{Appointments: []models.Appointment{{ID: 5, LastName: "O'Neill"}}, Limit: 20}
+
+	testCases := []struct {
+		name     string
+		path     string
+		search   *stubSearch
+		expected int
+	}{
+		{"found", "/admin/appointments/search?q=Oneil", &stubSearch{page: page}, http.StatusOK},
+		{"invalid query", "/admin/appointments/search?q=J", &stubSearch{err: fmt.Errorf("%s", constants.ErrInvalidSearchQuery)}, http.StatusBadRequest},
+		{"limit too large", "/admin/appointments/search?q=Oneil&limit=101", &stubSearch{}, http.StatusBadRequest},
+		{"negative offset", "/admin/appointments/search?q=Oneil&offset=-1", &stubSearch{}, http.StatusBadRequest},
+		{"database error", "/admin/appointments/search?q=Oneil", &stubSearch{err: errors.New("db down")}, http.StatusInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/admin/appointments/search", NewSearchHandler(tc.search).SearchAppointments)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			assert.Equal(t, tc.expected, w.Code)
+			if tc.expected == http.StatusOK {
+				var got models.AppointmentSearchPage
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+				assert.Equal(t, "O'Neill", got.Appointments[0].LastName)
+				assert.Equal(t, "Oneil", tc.search.query)
+			}
+		})
+	}
+}
+
+func TestSearchHandler_SearchAppointments_Paging(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	search := &stubSearch{page: &models.AppointmentSearchPage{}}
+	router := gin.New()
+	router.GET("/admin/appointments/search", NewSearchHandler(search).SearchAppointments)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/admin/appointments/search?q=Oneil", nil))
+	assert.Equal(t, defaultSearchLimit, search.limit)
+	assert.Equal(t, 0, search.offset)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/admin/appointments/search?q=Oneil&limit=5&offset=10", nil))
+	assert.Equal(t, 5, search.limit)
+	assert.Equal(t, 10, search.offset)
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServiceCatalogue lists the bookable service types and their free slots
+type ServiceCatalogue interface {
+	ListServiceTypes(ctx context.Context) ([]models.ServiceType, error)
+	Availability(ctx context.Context, code string, from, to time.Time) ([]models.ServiceAvailability, error)
+}
+
+type ServiceTypeHandler struct {
+	catalogue ServiceCatalogue
+}
+
+func NewServiceTypeHandler(catalogue ServiceCatalogue) *ServiceTypeHandler {
+	return &ServiceTypeHandler{catalogue: catalogue}
+}
+
+// ListServiceTypes serves GET /services
+func (h *ServiceTypeHandler) ListServiceTypes(c *gin.Context) {
+	serviceTypes, err := h.catalogue.ListServiceTypes(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   constants.ErrorTypeInternal,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, serviceTypes)
+}
+
+// GetAvailability serves GET /services/:code/availability?from=&to=, the number
+// of visits left per date
+func (h *ServiceTypeHandler) GetAvailability(c *gin.Context) {
+	from, ok := parseDateQuery(c, "from")
+	if !ok {
+		return
+	}
+	to, ok := parseDateQuery(c, "to")
+	if !ok {
+		return
+	}
+	if !to.IsZero() && (from.IsZero() || to.Before(from) || to.Sub(from) >= service.MaxAvailabilityDays*24*time.Hour) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   constants.ErrorTypeValidation,
+			Message: fmt.Sprintf("to must come with from, on or after it and at most %d days later", service.MaxAvailabilityDays-1),
+		})
+		return
+	}
+
+	availability, err := h.catalogue.Availability(c.Request.Context(), c.Param("code"), from, to)
+	if err != nil {
+		status := http.StatusInternalServerError
+		errorType := constants.ErrorTypeInternal
+		if err.Error() == constants.ErrUnknownServiceType {
+			status = http.StatusNotFound
+			errorType = constants.ErrorTypeNotFound
+		}
+
+		c.JSON(status, models.ErrorResponse{
+			Error:   errorType,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, availability)
+}
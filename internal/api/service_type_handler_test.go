@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubCatalogue struct {
+	from, to time.Time
+	err      error
+}
+
+func (s *stubCatalogue) ListServiceTypes(ctx context.Context) ([]models.ServiceType, error) {
+	return []models.ServiceType{{Code: "general", Name: "General enquiry", DurationMinutes: 30, RequiredDocuments: []string{}, DailyQuota: 1}}, s.err
+}
+
+func (s *stubCatalogue) Availability(ctx context.Context, code string, from, to time.Time) ([]models.ServiceAvailability, error) {
+	s.from, s.to = from, to
+	if s.err != nil {
+		return nil, s.err
+	}
+	if code != "general" {
+		return nil, errors.New(constants.ErrUnknownServiceType)
+	}
+	return []models.ServiceAvailability{{Date: "2075-06-10", Remaining: 1}}, nil
+}
+
+func newServiceTypeRouter(catalogue ServiceCatalogue) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	handler := NewServiceTypeHandler(catalogue)
+	router.GET("/services", handler.ListServiceTypes)
+	router.GET("/services/:code/availability", handler.GetAvailability)
+	return router
+}
+
+func TestServiceTypeHandler_ListServiceTypes(t *testing.T) {
+	w := httptest.NewRecorder()
+	newServiceTypeRouter(&stubCatalogue{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/services", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var serviceTypes []models.ServiceType
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &serviceTypes))
+	require.Len(t, serviceTypes, 1)
+	assert.Equal(t, "general", serviceTypes[0].Code)
+}
+
+func TestServiceTypeHandler_GetAvailability(t *testing.T) {
+	testCases := []struct {
+		name      string
+		path      string
+		catalogue *stubCatalogue
+		expected  int
+	}{
+		{"default range", "/services/general/availability", &stubCatalogue{}, http.StatusOK},
+		{"explicit range", "/services/general/availability?from=2075-06-10&to=2075-06-20", &stubCatalogue{}, http.StatusOK},
+		{"unknown type", "/services/dog-licence/availability", &stubCatalogue{}, http.StatusNotFound},
+		{"bad date", "/services/general/availability?from=June", &stubCatalogue{}, http.StatusBadRequest},
+		{"to without from", "/services/general/availability?to=2075-06-20", &stubCatalogue{}, http.StatusBadRequest},
+		{"reversed range", "/services/general/availability?from=2075-06-20&to=2075-06-10", &stubCatalogue{}, http.StatusBadRequest},
+		{"range too long", "/services/general/availability?from=2075-06-01&to=2075-09-01", &stubCatalogue{}, http.StatusBadRequest},
+		{"database error", "/services/general/availability", &stubCatalogue{err: errors.New("db down")}, http.StatusInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			newServiceTypeRouter(tc.catalogue).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.expected, w.Code)
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"citynext-appointments/internal/auth"
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StaffManager is the subset of the staff service used by the staff endpoints
+type StaffManager interface {
+	CreateStaff(ctx context.Context, req *models.CreateStaffRequest) (*models.Staff, error)
+	ListStaff(ctx context.Context) ([]models.Staff, error)
+	UpdateRoster(ctx context.Context, staffID int, roster []models.RosterShift) (*models.Staff, error)
+	Agenda(ctx context.Context, staffID int, date time.Time) (*models.StaffAgenda, error)
+}
+
+type StaffHandler struct {
+	staff StaffManager
+}
+
+func NewStaffHandler(staff StaffManager) *StaffHandler {
+	return &StaffHandler{staff: staff}
+}
+
+// GetAgenda serves GET /staff/:id/agenda?date=, the bookings of one staff member
+// on a date, today by default. Keys tied to a staff member only see their own
+// agenda unless they are admin keys.
+func (h *StaffHandler) GetAgenda(c *gin.Context) {
+	id := parseID(c)
+	if id <= 0 {
+		h.invalidID(c)
+		return
+	}
+
+	principal, ok := auth.PrincipalFrom(c.Request.Context())
+	if ok && principal.StaffID != 0 && principal.StaffID != id && !principal.Role.Allows(auth.RoleAdmin) {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   constants.ErrorTypeForbidden,
+			Message: constants.ErrForbidden,
+		})
+		return
+	}
+
+	date, ok := parseDateQuery(c, "date")
+	if !ok {
+		return
+	}
+
+	agenda, err := h.staff.Agenda(c.Request.Context(), id, date)
+	if err != nil {
+		h.storeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, agenda)
+}
+
+// CreateStaff serves POST /admin/staff
+func (h *StaffHandler) CreateStaff(c *gin.Context) {
+	var req models.CreateStaffRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   constants.ErrorTypeValidation,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	staff, err := h.staff.CreateStaff(c.Request.Context(), &req)
+	if err != nil {
+		h.storeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, staff)
+}
+
+// ListStaff serves GET /admin/staff
+func (h *StaffHandler) ListStaff(c *gin.Context) {
+	staff, err := h.staff.ListStaff(c.Request.Context())
+	if err != nil {
+		h.storeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, staff)
+}
+
+// UpdateRoster serves PUT /admin/staff/:id/roster, replacing the weekly roster
+func (h *StaffHandler) UpdateRoster(c *gin.Context) {
+	id := parseID(c)
+	if id <= 0 {
+		h.invalidID(c)
+		return
+	}
+
+	var req models.UpdateRosterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   constants.ErrorTypeValidation,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	staff, err := h.staff.UpdateRoster(c.Request.Context(), id, req.Roster)
+	if err != nil {
+		h.storeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, staff)
+}
+
+func (h *StaffHandler) storeError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	errorType := constants.ErrorTypeInternal
+
+	switch err.Error() {
+	case constants.ErrStaffNotFound:
+		status = http.StatusNotFound
+		errorType = constants.ErrorTypeNotFound
+	case constants.ErrInvalidRoster:
+		status = http.StatusBadRequest
+		errorType = constants.ErrorTypeValidation
+	}
+
+	c.JSON(status, models.ErrorResponse{
+		Error:   errorType,
+		Message: err.Error(),
+	})
+}
+
+func (h *StaffHandler) invalidID(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, models.ErrorResponse{
+		Error:   constants.ErrorTypeValidation,
+		Message: "Invalid staff id",
+	})
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/auth"
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubStaff struct {
+	date time.Time
+	err  error
+}
+
+func (s *stubStaff) CreateStaff(ctx context.Context, req *models.CreateStaffRequest) (*models.Staff, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &models.Staff{ID: 3, Name: req.Name, Active: true, Roster: req.Roster}, nil
+}
+
+func (s *stubStaff) ListStaff(ctx context.Context) ([]models.Staff, error) {
+	return []models.Staff{}, s.err
+}
+
+func (s *stubStaff) UpdateRoster(ctx context.Context, staffID int, roster []models.RosterShift) (*models.Staff, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &models.Staff{ID: staffID, Roster: roster}, nil
+}
+
+func (s *stubStaff) Agenda(ctx context.Context, staffID int, date time.Time) (*models.StaffAgenda, error) {
+	s.date = date
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &models.StaffAgenda{Staff: models.Staff{ID: staffID}, Appointments: []models.Appointment{}}, nil
+}
+
+func newStaffRouter(staff StaffManager, principal *auth.Principal) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), principal))
+		c.Next()
+	})
+	handler := NewStaffHandler(staff)
+	router.GET("/staff/:id/agenda", handler.GetAgenda)
+	router.POST("/admin/staff", handler.CreateStaff)
+	router.PUT("/admin/staff/:id/roster", handler.UpdateRoster)
+	return router
+}
+
+func TestStaffHandler_GetAgenda(t *testing.T) {
+	frontDesk := &auth.Principal{KeyID: 1, Role: auth.RoleFrontDesk}
+	clerk := &auth.Principal{KeyID: 2, Role: auth.RoleFrontDesk, StaffID: 1}
+	admin := &auth.Principal{KeyID: 3, Role: auth.RoleAdmin, StaffID: 1}
+
+	testCases := []struct {
+		name      string
+		path      string
+		principal *auth.Principal
+		staff     *stubStaff
+		expected  int
+	}{
+		{"own agenda", "/staff/1/agenda?date=2075-06-10", clerk, &stubStaff{}, http.StatusOK},
+		{"someone else's agenda", "/staff/2/agenda", clerk, &stubStaff{}, http.StatusForbidden},
+		{"shared front desk key", "/staff/2/agenda", frontDesk, &stubStaff{}, http.StatusOK},
+		{"admin tied to staff", "/staff/2/agenda", admin, &stubStaff{}, http.StatusOK},
+		{"invalid id", "/staff/abc/agenda", frontDesk, &stubStaff{}, http.StatusBadRequest},
+		{"bad date", "/staff/1/agenda?date=June", clerk, &stubStaff{}, http.StatusBadRequest},
+		{"unknown staff", "/staff/9/agenda", frontDesk, &stubStaff{err: errors.New(constants.ErrStaffNotFound)}, http.StatusNotFound},
+		{"database error", "/staff/1/agenda", frontDesk, &stubStaff{err: errors.New("db down")}, http.StatusInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			newStaffRouter(tc.staff, tc.principal).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.expected, w.Code)
+		})
+	}
+}
+
+func TestStaffHandler_GetAgenda_PassesDate(t *testing.T) {
+	staff := &stubStaff{}
+	w := httptest.NewRecorder()
+	newStaffRouter(staff, &auth.Principal{Role: auth.RoleFrontDesk}).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/staff/1/agenda?date=2075-06-10", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, time.Date(2075, 6, 10, 0, 0, 0, 0, time.UTC), staff.date)
+}
+
+func TestStaffHandler_CreateStaff(t *testing.T) {
+	testCases := []struct {
+		name     string
+		body     string
+		staff    *stubStaff
+		expected int
+	}{
+		{"created", `{"name": "Clerk C", "roster": [{"weekday": 1, "minutes": 480}]}`, &stubStaff{}, http.StatusCreated},
+		{"missing name", `{"roster": []}`, &stubStaff{}, http.StatusBadRequest},
+		{"weekday out of range", `{"name": "Clerk C", "roster": [{"weekday": 7, "minutes": 480}]}`, &stubStaff{}, http.StatusBadRequest},
+		{"shift too long", `{"name": "Clerk C", "roster": [{"weekday": 1, "minutes": 2000}]}`, &stubStaff{}, http.StatusBadRequest},
+		{"duplicate weekday", `{"name": "Clerk C", "roster": []}`, &stubStaff{err: errors.New(constants.ErrInvalidRoster)}, http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, "/admin/staff", bytes.NewBufferString(tc.body))
+			request.Header.Set("Content-Type", "application/json")
+			newStaffRouter(tc.staff, &auth.Principal{Role: auth.RoleAdmin}).ServeHTTP(w, request)
+			assert.Equal(t, tc.expected, w.Code)
+		})
+	}
+}
+
+func TestStaffHandler_UpdateRoster(t *testing.T) {
+	testCases := []struct {
+		name     string
+		path     string
+		staff    *stubStaff
+		expected int
+	}{
+		{"updated", "/admin/staff/1/roster", &stubStaff{}, http.StatusOK},
+		{"unknown staff", "/admin/staff/9/roster", &stubStaff{err: errors.New(constants.ErrStaffNotFound)}, http.StatusNotFound},
+		{"invalid id", "/admin/staff/0/roster", &stubStaff{}, http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPut, tc.path, bytes.NewBufferString(`{"roster": [{"weekday": 2, "minutes": 240}]}`))
+			request.Header.Set("Content-Type", "application/json")
+			newStaffRouter(tc.staff, &auth.Principal{Role: auth.RoleAdmin}).ServeHTTP(w, request)
+			assert.Equal(t, tc.expected, w.Code)
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"citynext-appointments/internal/auth"
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WaitlistManager queues citizens for booked dates and books offered ones
+type WaitlistManager interface {
+	Join(ctx context.Context, req *models.JoinWaitlistRequest) (*models.WaitlistEntry, error)
+	GetEntry(ctx context.Context, id int) (*models.WaitlistEntry, error)
+	AcceptOffer(ctx context.Context, token string) (*models.Appointment, error)
+}
+
+type WaitlistHandler struct {
+	waitlist       WaitlistManager
+	holidayService service.HolidayServiceInterface
+}
+
+func NewWaitlistHandler(waitlist WaitlistManager, holidayService service.HolidayServiceInterface) *WaitlistHandler {
+	return &WaitlistHandler{waitlist: waitlist, holidayService: holidayService}
+}
+
+// JoinWaitlist serves POST /waitlist
+func (h *WaitlistHandler) JoinWaitlist(c *gin.Context) {
+	var req models.JoinWaitlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   constants.ErrorTypeValidation,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	if !checkVisitDate(c, h.holidayService, req.VisitDate) {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// Entries made with a citizen token belong to that citizen
+	if citizen, ok := auth.CitizenFrom(ctx); ok {
+		req.CitizenSubject = citizen.Subject
+	}
+
+	entry, err := h.waitlist.Join(ctx, &req)
+	if err != nil {
+		status := http.StatusInternalServerError
+		errorType := constants.ErrorTypeInternal
+
+		switch err.Error() {
+		case constants.ErrPastDate:
+			status = http.StatusBadRequest
+			errorType = constants.ErrorTypePastDate
+		case constants.ErrUnknownServiceType:
+			status = http.StatusBadRequest
+			errorType = constants.ErrorTypeUnknownServiceType
+		case constants.ErrDateAvailable:
+			status = http.StatusConflict
+			errorType = constants.ErrorTypeDateAvailable
+		case constants.ErrAlreadyWaitlisted:
+			status = http.StatusConflict
+			errorType = constants.ErrorTypeWaitlisted
+		}
+
+		c.JSON(status, models.ErrorResponse{
+			Error:   errorType,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+// GetWaitlistEntry serves GET /waitlist/:id, including the offer token once the date is offered
+func (h *WaitlistHandler) GetWaitlistEntry(c *gin.Context) {
+	id := parseID(c)
+	if id <= 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   constants.ErrorTypeValidation,
+			Message: "Invalid waitlist entry id",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	entry, err := h.waitlist.GetEntry(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   constants.ErrorTypeInternal,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// Entries of other citizens are reported as missing, like appointments
+	if entry == nil || !canAccessSubject(ctx, entry.CitizenSubject) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   constants.ErrorTypeNotFound,
+			Message: constants.ErrWaitlistNotFound,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+// AcceptOffer serves POST /waitlist/offers/:token/accept and books the offered date
+func (h *WaitlistHandler) AcceptOffer(c *gin.Context) {
+	appointment, err := h.waitlist.AcceptOffer(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		errorType := constants.ErrorTypeInternal
+
+		switch {
+		case err.Error() == constants.ErrOfferNotFound:
+			status = http.StatusNotFound
+			errorType = constants.ErrorTypeNotFound
+		case err.Error() == constants.ErrBookingLimitReached:
+			status = http.StatusConflict
+			errorType = constants.ErrorTypeBookingLimit
+		case err.Error() == constants.ErrIdentityRequired:
+			status = http.StatusBadRequest
+			errorType = constants.ErrorTypeIdentityRequired
+		case err.Error() == constants.ErrPossibleDuplicate:
+			status = http.StatusConflict
+			errorType = constants.ErrorTypePossibleDuplicate
+		case strings.HasPrefix(err.Error(), constants.ErrNoStaffAvailable):
+			status = http.StatusConflict
+			errorType = constants.ErrorTypeNoStaffAvailable
+		}
+
+		c.JSON(status, models.ErrorResponse{
+			Error:   errorType,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, citizenView(c.Request.Context(), appointment))
+}
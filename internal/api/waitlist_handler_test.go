@@ -0,0 +1,176 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/auth"
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockWaitlist struct {
+	mock.Mock
+}
+
+func (m *MockWaitlist) Join(ctx context.Context, req *models.JoinWaitlistRequest) (*models.WaitlistEntry, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.WaitlistEntry), args.Error(1)
+}
+
+func (m *MockWaitlist) GetEntry(ctx context.Context, id int) (*models.WaitlistEntry, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.WaitlistEntry), args.Error(1)
+}
+
+func (m *MockWaitlist) AcceptOffer(ctx context.Context, token string) (*models.Appointment, error) {
+	args := m.Called(ctx, token)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Appointment), args.Error(1)
+}
+
+func TestWaitlistHandler_JoinWaitlist(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	testCases := []struct {
+		name      string
+		joinErr   error
+		expected  int
+		errorType string
+	}{
+		{"joined", nil, http.StatusCreated, ""},
+		{"date is free", errors.New("Date is available, book it directly"), http.StatusConflict, "date_available"},
+		{"already waiting", errors.New("Already on the waitlist for this date"), http.StatusConflict, "already_waitlisted"},
+		{"database error", errors.New("db down"), http.StatusInternalServerError, "internal_error"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			waitlist := new(MockWaitlist)
+			holidays := new(MockHolidayService)
+			holidays.On("IsPublicHoliday", mock.Anything, time.Date(2075, 6, 10, 0, 0, 0, 0, time.UTC)).Return(false, nil)
+
+			matchReq := mock.MatchedBy(func(req *models.JoinWaitlistRequest) bool {
+				return req.VisitDate == "2075-06-10" && req.CitizenSubject == "citizen-123"
+			})
+			if tc.joinErr != nil {
+				waitlist.On("Join", mock.Anything, matchReq).Return(nil, tc.joinErr)
+			} else {
+				waitlist.On("Join", mock.Anything, matchReq).
+					Return(&models.WaitlistEntry{ID: 3, Status: "waiting", Position: 2}, nil)
+			}
+
+			router := gin.New()
+			router.POST("/waitlist", withIdentity(auth.RoleCitizenPortal, "citizen-123"), NewWaitlistHandler(waitlist, holidays).JoinWaitlist)
+
+			body, _ := json.Marshal(map[string]string{"first_name": "Jane", "last_name": "Doe", "visit_date": "2075-06-10", "service_type": "general"})
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/waitlist", bytes.NewReader(body)))
+
+			assert.Equal(t, tc.expected, w.Code)
+			if tc.errorType != "" {
+				var response models.ErrorResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tc.errorType, response.Error)
+			} else {
+				var entry models.WaitlistEntry
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entry))
+				assert.Equal(t, 2, entry.Position)
+			}
+			waitlist.AssertExpectations(t)
+		})
+	}
+}
+
+func TestWaitlistHandler_JoinWaitlist_Holiday(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	waitlist := new(MockWaitlist)
+	holidays := new(MockHolidayService)
+	holidays.On("IsPublicHoliday", mock.Anything, mock.Anything).Return(true, nil)
+
+	router := gin.New()
+	router.POST("/waitlist", NewWaitlistHandler(waitlist, holidays).JoinWaitlist)
+
+	body, _ := json.Marshal(map[string]string{"first_name": "Jane", "last_name": "Doe", "visit_date": "2075-12-25", "service_type": "general"})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/waitlist", bytes.NewReader(body)))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	waitlist.AssertNotCalled(t, "Join", mock.Anything, mock.Anything)
+}
+
+func TestWaitlistHandler_GetWaitlistEntry_Ownership(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	entry := &models.WaitlistEntry{ID: 3, CitizenSubject: "citizen-123", Status: "offered", OfferToken: "abc"}
+
+	testCases := []struct {
+		name     string
+		role     auth.Role
+		subject  string
+		expected int
+	}{
+		{"owner", auth.RoleCitizenPortal, "citizen-123", http.StatusOK},
+		{"other citizen", auth.RoleCitizenPortal, "citizen-456", http.StatusNotFound},
+		{"front desk", auth.RoleFrontDesk, "", http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			waitlist := new(MockWaitlist)
+			waitlist.On("GetEntry", mock.Anything, 3).Return(entry, nil)
+
+			router := gin.New()
+			router.GET("/waitlist/:id", withIdentity(tc.role, tc.subject), NewWaitlistHandler(waitlist, new(MockHolidayService)).GetWaitlistEntry)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/waitlist/3", nil))
+
+			assert.Equal(t, tc.expected, w.Code)
+		})
+	}
+}
+
+func TestWaitlistHandler_AcceptOffer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	waitlist := new(MockWaitlist)
+	waitlist.On("AcceptOffer", mock.Anything, "good").Return(&models.Appointment{ID: 9}, nil)
+	waitlist.On("AcceptOffer", mock.Anything, "stale").Return(nil, errors.New("Waitlist offer not found or expired"))
+	waitlist.On("AcceptOffer", mock.Anything, "capped").Return(nil, errors.New(constants.ErrBookingLimitReached))
+
+	router := gin.New()
+	router.POST("/waitlist/offers/:token/accept", NewWaitlistHandler(waitlist, new(MockHolidayService)).AcceptOffer)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/waitlist/offers/good/accept", nil))
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/waitlist/offers/stale/accept", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/waitlist/offers/capped/accept", nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
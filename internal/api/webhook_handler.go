@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/webhook"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 500
+)
+
+// WebhookManager is the subset of the webhook store used by the admin endpoints
+type WebhookManager interface {
+	Create(ctx context.Context, url string, events []string, secret string) (*webhook.Subscription, error)
+	List(ctx context.Context) ([]webhook.Subscription, error)
+	Delete(ctx context.Context, id int) error
+	Deliveries(ctx context.Context, subscriptionID int, status string, limit int) ([]webhook.Delivery, error)
+}
+
+type WebhookHandler struct {
+	webhooks WebhookManager
+}
+
+func NewWebhookHandler(webhooks WebhookManager) *WebhookHandler {
+	return &WebhookHandler{webhooks: webhooks}
+}
+
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req models.CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   constants.ErrorTypeValidation,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   constants.ErrorTypeValidation,
+			Message: "Webhook url must be an absolute http or https url",
+		})
+		return
+	}
+
+	sub, err := h.webhooks.Create(c.Request.Context(), req.URL, req.Events, req.Secret)
+	if err != nil {
+		h.internalError(c, err)
+		return
+	}
+
+	// The secret is only ever shown here
+	c.JSON(http.StatusCreated, sub)
+}
+
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	subs, err := h.webhooks.List(c.Request.Context())
+	if err != nil {
+		h.internalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, subs)
+}
+
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	id := parseID(c)
+	if id <= 0 {
+		h.invalidID(c)
+		return
+	}
+
+	if err := h.webhooks.Delete(c.Request.Context(), id); err != nil {
+		h.storeError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	id := parseID(c)
+	if id <= 0 {
+		h.invalidID(c)
+		return
+	}
+
+	status := c.Query("status")
+	switch status {
+	case "", webhook.StatusPending, webhook.StatusDelivered, webhook.StatusDead:
+	default:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   constants.ErrorTypeValidation,
+			Message: "status must be pending, delivered or dead",
+		})
+		return
+	}
+
+	limit := defaultDeliveryLimit
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxDeliveryLimit {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   constants.ErrorTypeValidation,
+				Message: "limit must be between 1 and " + strconv.Itoa(maxDeliveryLimit),
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	deliveries, err := h.webhooks.Deliveries(c.Request.Context(), id, status, limit)
+	if err != nil {
+		h.storeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+func (h *WebhookHandler) storeError(c *gin.Context, err error) {
+	if err.Error() == constants.ErrWebhookNotFound {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   constants.ErrorTypeNotFound,
+			Message: err.Error(),
+		})
+		return
+	}
+	h.internalError(c, err)
+}
+
+func (h *WebhookHandler) invalidID(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, models.ErrorResponse{
+		Error:   constants.ErrorTypeValidation,
+		Message: "Invalid webhook id",
+	})
+}
+
+func (h *WebhookHandler) internalError(c *gin.Context, err error) {
+	c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+		Error:   constants.ErrorTypeInternal,
+		Message: err.Error(),
+	})
+}
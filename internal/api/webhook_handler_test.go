@@ -0,0 +1,136 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/webhook"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockWebhooks struct {
+	mock.Mock
+}
+
+func (m *MockWebhooks) Create(ctx context.Context, url string, events []string, secret string) (*webhook.Subscription, error) {
+	args := m.Called(ctx, url, events, secret)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*webhook.Subscription), args.Error(1)
+}
+
+func (m *MockWebhooks) List(ctx context.Context) ([]webhook.Subscription, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]webhook.Subscription), args.Error(1)
+}
+
+func (m *MockWebhooks) Delete(ctx context.Context, id int) error {
+	return m.Called(ctx, id).Error(0)
+}
+
+func (m *MockWebhooks) Deliveries(ctx context.Context, subscriptionID int, status string, limit int) ([]webhook.Delivery, error) {
+	args := m.Called(ctx, subscriptionID, status, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]webhook.Delivery), args.Error(1)
+}
+
+func newWebhookRouter(webhooks WebhookManager) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	handler := NewWebhookHandler(webhooks)
+
+	router := gin.New()
+	router.POST("/admin/webhooks", handler.CreateWebhook)
+	router.GET("/admin/webhooks", handler.ListWebhooks)
+	router.DELETE("/admin/webhooks/:id", handler.DeleteWebhook)
+	router.GET("/admin/webhooks/:id/deliveries", handler.ListDeliveries)
+	return router
+}
+
+func TestWebhookHandler_CreateWebhook(t *testing.T) {
+	testCases := []struct {
+		name     string
+		body     string
+		expected int
+	}{
+		{"valid", `{"url":"https://partner.example/hooks","events":["appointment.created","appointment.rescheduled"]}`, http.StatusCreated},
+		{"unknown event", `{"url":"https://partner.example/hooks","events":["appointment.deleted"]}`, http.StatusBadRequest},
+		{"no events", `{"url":"https://partner.example/hooks","events":[]}`, http.StatusBadRequest},
+		{"not http", `{"url":"ftp://partner.example/hooks","events":["appointment.created"]}`, http.StatusBadRequest},
+		{"short secret", `{"url":"https://partner.example/hooks","events":["appointment.created"],"secret":"abc"}`, http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			webhooks := new(MockWebhooks)
+			webhooks.On("Create", mock.Anything, "https://partner.example/hooks",
+				[]string{"appointment.created", "appointment.rescheduled"}, "").
+				Return(&webhook.Subscription{ID: 1, Secret: "whsec_generated"}, nil)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/admin/webhooks", bytes.NewBufferString(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			newWebhookRouter(webhooks).ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expected, w.Code)
+			if tc.expected == http.StatusCreated {
+				var sub webhook.Subscription
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &sub))
+				assert.Equal(t, "whsec_generated", sub.Secret)
+			} else {
+				webhooks.AssertNotCalled(t, "Create", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestWebhookHandler_DeleteWebhook_NotFound(t *testing.T) {
+	webhooks := new(MockWebhooks)
+	webhooks.On("Delete", mock.Anything, 7).Return(errors.New("Webhook subscription not found"))
+
+	w := httptest.NewRecorder()
+	newWebhookRouter(webhooks).ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/admin/webhooks/7", nil))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestWebhookHandler_ListDeliveries(t *testing.T) {
+	testCases := []struct {
+		name     string
+		query    string
+		expected int
+	}{
+		{"dead letters", "?status=dead&limit=10", http.StatusOK},
+		{"unknown status", "?status=lost", http.StatusBadRequest},
+		{"limit too high", "?limit=100000", http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			webhooks := new(MockWebhooks)
+			webhooks.On("Deliveries", mock.Anything, 3, "dead", 10).
+				Return([]webhook.Delivery{{ID: 11, Status: webhook.StatusDead}}, nil)
+
+			w := httptest.NewRecorder()
+			newWebhookRouter(webhooks).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/webhooks/3/deliveries"+tc.query, nil))
+
+			assert.Equal(t, tc.expected, w.Code)
+			if tc.expected != http.StatusOK {
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, "validation_error", response.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"citynext-appointments/internal/auth"
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/pii"
+
+	"github.com/lib/pq"
+)
+
+// ActorSystem is recorded for changes made by background jobs
+const ActorSystem = "system"
+
+// ActionErased is recorded when a citizen's personal data is erased from an appointment
+const ActionErased = "appointment.erased"
+
+// citizenActorPrefix starts the actor of changes made with a citizen token
+const citizenActorPrefix = "citizen:"
+
+// ActorErasedCitizen replaces the actor of changes made by a citizen whose data was erased
+const ActorErasedCitizen = citizenActorPrefix + "erased"
+
+// Event is one entry in the history of an appointment
+type Event struct {
+	ID            int64  `json:"id"`
+	AppointmentID int    `json:"appointment_id"`
+	Action        string `json:"action"`
+	Actor         string `json:"actor"`
+	// APIKeyID is the key the request was made with, unset for background jobs
+	APIKeyID  *int            `json:"api_key_id,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	OldValues json.RawMessage `json:"old_values,omitempty"`
+	NewValues json.RawMessage `json:"new_values"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type requestIDKey struct{}
+
+// WithRequestID attaches the id of the current request to the context
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns the id of the current request, or "" outside a request
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Actor names whoever made the change in ctx: the citizen of a verified token,
+// otherwise the API key, otherwise the system
+func Actor(ctx context.Context) string {
+	if citizen, ok := auth.CitizenFrom(ctx); ok {
+		return citizenActorPrefix + citizen.Subject
+	}
+	if principal, ok := auth.PrincipalFrom(ctx); ok {
+		return fmt.Sprintf("key:%d", principal.KeyID)
+	}
+	return ActorSystem
+}
+
+// Execer is satisfied by *sql.Tx, so the history is written alongside the change it describes
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Record appends a change of an appointment to its history. before is the
+// appointment as it was, nil for a new booking, and after as it is now; only
+// the fields that differ are stored. Call it with the transaction that makes
+// the change so the history holds exactly the committed changes.
+func Record(ctx context.Context, exec Execer, action string, before, after *models.Appointment, at time.Time) error {
+	oldValues, newValues, err := diff(before, after)
+	if err != nil {
+		return fmt.Errorf("failed to record %s in history: %w", action, err)
+	}
+	if oldValues, err = pii.MapNames(oldValues, pii.Seal); err != nil {
+		return fmt.Errorf("failed to record %s in history: %w", action, err)
+	}
+	if newValues, err = pii.MapNames(newValues, pii.Seal); err != nil {
+		return fmt.Errorf("failed to record %s in history: %w", action, err)
+	}
+
+	var keyID sql.NullInt64
+	if principal, ok := auth.PrincipalFrom(ctx); ok {
+		keyID = sql.NullInt64{Int64: int64(principal.KeyID), Valid: true}
+	}
+	requestID := RequestIDFrom(ctx)
+	var old interface{}
+	if oldValues != nil {
+		old = oldValues
+	}
+
+	query := `
+		INSERT INTO appointment_events (appointment_id, action, actor, api_key_id, request_id, old_values, new_values, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err = exec.ExecContext(ctx, query, after.ID, action, Actor(ctx), keyID,
+		sql.NullString{String: requestID, Valid: requestID != ""}, old, newValues, at)
+	if err != nil {
+		return fmt.Errorf("failed to record %s in history: %w", action, err)
+	}
+	return nil
+}
+
+// diff returns the JSON fields that differ between before and after, as they
+// were and as they are. Fields missing on one side are null there.
+func diff(before, after *models.Appointment) ([]byte, []byte, error) {
+	newFields, err := fields(after)
+	if err != nil {
+		return nil, nil, err
+	}
+	if before == nil {
+		newValues, err := json.Marshal(newFields)
+		return nil, newValues, err
+	}
+
+	oldFields, err := fields(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	changedOld := map[string]json.RawMessage{}
+	changedNew := map[string]json.RawMessage{}
+	for name, value := range newFields {
+		if old, ok := oldFields[name]; !ok || !bytes.Equal(old, value) {
+			changedOld[name] = orNull(oldFields[name])
+			changedNew[name] = value
+		}
+	}
+	for name, old := range oldFields {
+		if _, ok := newFields[name]; !ok {
+			changedOld[name] = old
+			changedNew[name] = orNull(nil)
+		}
+	}
+
+	oldValues, err := json.Marshal(changedOld)
+	if err != nil {
+		return nil, nil, err
+	}
+	newValues, err := json.Marshal(changedNew)
+	return oldValues, newValues, err
+}
+
+func fields(appointment *models.Appointment) (map[string]json.RawMessage, error) {
+	encoded, err := json.Marshal(appointment)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]json.RawMessage
+	err = json.Unmarshal(encoded, &out)
+	return out, err
+}
+
+func orNull(value json.RawMessage) json.RawMessage {
+	if value == nil {
+		return json.RawMessage("null")
+	}
+	return value
+}
+
+// Redact rewrites the history of the given appointments for an erasure request.
+// Recorded fields named in replacements get the replacement value, or are
+// dropped when it is nil, and changes made by the citizen no longer name them.
+// Which change happened when stays untouched. It returns the number of entries
+// rewritten.
+func Redact(ctx context.Context, tx *sql.Tx, appointmentIDs []int, replacements map[string]interface{}) (int, error) {
+	query := `
+		SELECT id, actor, old_values, new_values FROM appointment_events
+		WHERE appointment_id = ANY($1)
+		ORDER BY id
+		FOR UPDATE
+	`
+	redacted, _, err := rewrite(ctx, tx, query, []interface{}{pq.Array(appointmentIDs)}, func(e *historyEntry) (bool, error) {
+		if strings.HasPrefix(e.actor, citizenActorPrefix) {
+			e.actor = ActorErasedCitizen
+		}
+		var err error
+		if e.oldValues, err = redactFields(e.oldValues, replacements); err != nil {
+			return false, err
+		}
+		if e.newValues, err = redactFields(e.newValues, replacements); err != nil {
+			return false, err
+		}
+		return true, nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to redact history: %w", err)
+	}
+	return redacted, nil
+}
+
+// RewrapNames seals the names in up to limit history entries after afterID
+// with the primary key of keyring, for key rotation. Names sealed with an older
+// key are rewrapped and names recorded before encryption was turned on are
+// sealed. It returns the number of entries rewritten and the last id looked
+// at, which is afterID once the history is done.
+func RewrapNames(ctx context.Context, tx *sql.Tx, keyring *pii.Keyring, afterID int64, limit int) (int, int64, error) {
+	query := `
+		SELECT id, actor, old_values, new_values FROM appointment_events
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2
+		FOR UPDATE
+	`
+	rewritten, lastID, err := rewrite(ctx, tx, query, []interface{}{afterID, limit}, func(e *historyEntry) (bool, error) {
+		oldValues, err := pii.MapNames(e.oldValues, keyring.Refresh)
+		if err != nil {
+			return false, err
+		}
+		newValues, err := pii.MapNames(e.newValues, keyring.Refresh)
+		if err != nil {
+			return false, err
+		}
+		changed := !bytes.Equal(oldValues, e.oldValues) || !bytes.Equal(newValues, e.newValues)
+		e.oldValues, e.newValues = oldValues, newValues
+		return changed, nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to rewrap names in history: %w", err)
+	}
+	if lastID == 0 {
+		lastID = afterID
+	}
+	return rewritten, lastID, nil
+}
+
+// historyEntry is the part of a history entry that may be rewritten
+type historyEntry struct {
+	id                   int64
+	actor                string
+	oldValues, newValues []byte
+}
+
+// rewrite locks the history entries query selects, lets change edit each of
+// them and writes back the ones it reports as changed. The append-only trigger
+// lets this transaction, and only this one, rewrite actor and values. It
+// returns the number of entries written and the id of the last one selected.
+func rewrite(ctx context.Context, tx *sql.Tx, query string, args []interface{}, change func(e *historyEntry) (bool, error)) (int, int64, error) {
+	if _, err := tx.ExecContext(ctx, `SET LOCAL citynext.redact_history = 'on'`); err != nil {
+		return 0, 0, err
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, 0, err
+	}
+	var entries []historyEntry
+	for rows.Next() {
+		var e historyEntry
+		if err := rows.Scan(&e.id, &e.actor, &e.oldValues, &e.newValues); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	written := 0
+	var lastID int64
+	for _, e := range entries {
+		lastID = e.id
+		changed, err := change(&e)
+		if err != nil {
+			return 0, 0, fmt.Errorf("entry %d: %w", e.id, err)
+		}
+		if !changed {
+			continue
+		}
+
+		var old interface{}
+		if e.oldValues != nil {
+			old = e.oldValues
+		}
+		query := `UPDATE appointment_events SET actor = $2, old_values = $3, new_values = $4 WHERE id = $1`
+		if _, err := tx.ExecContext(ctx, query, e.id, e.actor, old, e.newValues); err != nil {
+			return 0, 0, err
+		}
+		written++
+	}
+
+	if _, err := tx.ExecContext(ctx, `SET LOCAL citynext.redact_history = 'off'`); err != nil {
+		return 0, 0, err
+	}
+	return written, lastID, nil
+}
+
+func redactFields(values []byte, replacements map[string]interface{}) ([]byte, error) {
+	if values == nil {
+		return nil, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(values, &fields); err != nil {
+		return nil, err
+	}
+	for name, replacement := range replacements {
+		if _, ok := fields[name]; !ok {
+			continue
+		}
+		if replacement == nil {
+			delete(fields, name)
+			continue
+		}
+		encoded, err := json.Marshal(replacement)
+		if err != nil {
+			return nil, err
+		}
+		fields[name] = encoded
+	}
+	return json.Marshal(fields)
+}
+
+// Store reads appointment histories
+type Store struct {
+	db *db.DB
+}
+
+func NewStore(database *db.DB) *Store {
+	return &Store{db: database}
+}
+
+// History returns every recorded change of an appointment, oldest first
+func (s *Store) History(ctx context.Context, appointmentID int) ([]Event, error) {
+	return s.HistoryOf(ctx, []int{appointmentID})
+}
+
+// HistoryOf returns every recorded change of the given appointments, oldest first
+func (s *Store) HistoryOf(ctx context.Context, appointmentIDs []int) ([]Event, error) {
+	query := `
+		SELECT id, appointment_id, action, actor, api_key_id, request_id, old_values, new_values, created_at
+		FROM appointment_events
+		WHERE appointment_id = ANY($1)
+		ORDER BY id
+	`
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(appointmentIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read appointment history: %w", err)
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var event Event
+		var keyID sql.NullInt64
+		var requestID sql.NullString
+		var oldValues, newValues []byte
+		if err := rows.Scan(&event.ID, &event.AppointmentID, &event.Action, &event.Actor, &keyID, &requestID,
+			&oldValues, &newValues, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to read appointment history: %w", err)
+		}
+		if keyID.Valid {
+			id := int(keyID.Int64)
+			event.APIKeyID = &id
+		}
+		event.RequestID = requestID.String
+		if event.OldValues, err = pii.MapNames(oldValues, pii.Open); err != nil {
+			return nil, fmt.Errorf("failed to read appointment history: %w", err)
+		}
+		if event.NewValues, err = pii.MapNames(newValues, pii.Open); err != nil {
+			return nil, fmt.Errorf("failed to read appointment history: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read appointment history: %w", err)
+	}
+	return events, nil
+}
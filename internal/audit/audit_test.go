@@ -0,0 +1,177 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/auth"
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/pii"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActor(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, ActorSystem, Actor(ctx))
+
+	ctx = auth.WithPrincipal(ctx, &auth.Principal{KeyID: 3, Role: auth.RoleFrontDesk})
+	assert.Equal(t, "key:3", Actor(ctx))
+
+	ctx = auth.WithCitizen(ctx, &auth.Citizen{Subject: "citizen-123"})
+	assert.Equal(t, "citizen:citizen-123", Actor(ctx), "the citizen acts through the portal key")
+}
+
+func TestRecord_StoresOnlyChangedFields(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	before := &models.Appointment{ID: 5, FirstName: "John", VisitDate: time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC), Status: "booked"}
+	after := *before
+	after.Status = "cancelled"
+	after.CancelledAt = &now
+
+	ctx := WithRequestID(auth.WithPrincipal(context.Background(), &auth.Principal{KeyID: 3}), "req-1")
+	mock.ExpectExec(`INSERT INTO appointment_events`).
+		WithArgs(5, "appointment.cancelled", "key:3", int64(3), "req-1",
+			[]byte(`{"cancelled_at":null,"status":"booked"}`),
+			[]byte(`{"cancelled_at":"2075-06-01T12:00:00Z","status":"cancelled"}`), now).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	require.NoError(t, Record(ctx, sqlDB, "appointment.cancelled", before, &after, now))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRecord_NewBooking(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	appointment := &models.Appointment{ID: 5, Reference: "CN-7K4Q-2M9X", FirstName: "John", LastName: "Doe", ServiceType: "general",
+		VisitDate: time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC), CreatedAt: now, Status: "booked"}
+
+	mock.ExpectExec(`INSERT INTO appointment_events`).
+		WithArgs(5, "appointment.created", ActorSystem, nil, nil, nil,
+			[]byte(`{"created_at":"2075-06-01T12:00:00Z","first_name":"John","id":5,"last_name":"Doe","reference":"CN-7K4Q-2M9X","service_type":"general","status":"booked","visit_date":"2075-06-15T00:00:00Z"}`), now).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	require.NoError(t, Record(context.Background(), sqlDB, "appointment.created", nil, appointment, now))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_History(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT id, appointment_id, action, actor, api_key_id, request_id, old_values, new_values, created_at FROM appointment_events WHERE appointment_id = ANY\(\$1\) ORDER BY id`).
+		WithArgs("{5}").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "appointment_id", "action", "actor", "api_key_id", "request_id", "old_values", "new_values", "created_at"}).
+			AddRow(1, 5, "appointment.created", "citizen:citizen-123", 2, "req-1", nil, []byte(`{"id":5}`), now).
+			AddRow(2, 5, "appointment.no_show", ActorSystem, nil, nil, []byte(`{"status":"booked"}`), []byte(`{"status":"no_show"}`), now))
+
+	events, err := NewStore(&db.DB{DB: sqlDB}).History(context.Background(), 5)
+
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "citizen:citizen-123", events[0].Actor)
+	require.NotNil(t, events[0].APIKeyID)
+	assert.Equal(t, 2, *events[0].APIKeyID)
+	assert.Equal(t, "req-1", events[0].RequestID)
+	assert.Nil(t, events[0].OldValues)
+	assert.Nil(t, events[1].APIKeyID)
+	assert.JSONEq(t, `{"status":"booked"}`, string(events[1].OldValues))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRedact(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SET LOCAL citynext.redact_history = 'on'`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT id, actor, old_values, new_values FROM appointment_events WHERE appointment_id = ANY\(\$1\) ORDER BY id FOR UPDATE`).
+		WithArgs("{5}").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "actor", "old_values", "new_values"}).
+			AddRow(1, "citizen:citizen-123", nil, []byte(`{"citizen_subject":"citizen-123","first_name":"John","id":5}`)).
+			AddRow(2, "key:3", []byte(`{"status":"booked"}`), []byte(`{"status":"cancelled"}`)))
+	mock.ExpectExec(`UPDATE appointment_events SET actor = \$2, old_values = \$3, new_values = \$4 WHERE id = \$1`).
+		WithArgs(int64(1), ActorErasedCitizen, nil, []byte(`{"first_name":"Erased","id":5}`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE appointment_events SET actor = \$2, old_values = \$3, new_values = \$4 WHERE id = \$1`).
+		WithArgs(int64(2), "key:3", []byte(`{"status":"booked"}`), []byte(`{"status":"cancelled"}`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`SET LOCAL citynext.redact_history = 'off'`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	tx, err := sqlDB.Begin()
+	require.NoError(t, err)
+	redacted, err := Redact(context.Background(), tx, []int{5}, map[string]interface{}{
+		"first_name":      "Erased",
+		"citizen_subject": nil,
+	})
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	assert.Equal(t, 2, redacted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// captured stores the value of the argument it is matched against
+type captured struct{ value *[]byte }
+
+func (c captured) Match(v driver.Value) bool {
+	b, ok := v.([]byte)
+	*c.value = b
+	return ok
+}
+
+func TestRecord_SealsNames(t *testing.T) {
+	keyring, err := pii.NewKeyring(map[string][]byte{
+		"2075-06": bytes.Repeat([]byte{2}, pii.KeySize),
+		"index":   bytes.Repeat([]byte{3}, pii.KeySize),
+	}, "2075-06", "index")
+	require.NoError(t, err)
+	pii.Use(keyring)
+	defer pii.Use(nil)
+
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	before := &models.Appointment{ID: 5, FirstName: "John", LastName: "Doe", Status: "booked"}
+	after := *before
+	after.LastName = "Roe"
+
+	var oldValues, newValues []byte
+	mock.ExpectExec(`INSERT INTO appointment_events`).
+		WithArgs(5, "appointment.updated", ActorSystem, nil, nil, captured{&oldValues}, captured{&newValues}, now).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	require.NoError(t, Record(context.Background(), sqlDB, "appointment.updated", before, &after, now))
+	assert.NotContains(t, string(oldValues), "Doe")
+	assert.NotContains(t, string(newValues), "Roe")
+
+	mock.ExpectQuery(`FROM appointment_events`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "appointment_id", "action", "actor", "api_key_id", "request_id", "old_values", "new_values", "created_at"}).
+			AddRow(1, 5, "appointment.updated", ActorSystem, nil, nil, oldValues, newValues, now))
+
+	events, err := NewStore(&db.DB{DB: sqlDB}).History(context.Background(), 5)
+
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.JSONEq(t, `{"last_name":"Doe"}`, string(events[0].OldValues))
+	assert.JSONEq(t, `{"last_name":"Roe"}`, string(events[0].NewValues))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+)
+
+// Role is the coarse permission level attached to a caller
+type Role string
+
+const (
+	RoleCitizenPortal Role = "citizen-portal"
+	RoleFrontDesk     Role = "front-desk"
+	RoleAdmin         Role = "admin"
+)
+
+// roleRank orders roles so that higher roles inherit the permissions of lower ones
+var roleRank = map[Role]int{
+	RoleCitizenPortal: 1,
+	RoleFrontDesk:     2,
+	RoleAdmin:         3,
+}
+
+// ParseRole validates a role name
+func ParseRole(s string) (Role, error) {
+	if _, ok := roleRank[Role(s)]; !ok {
+		return "", fmt.Errorf("unknown role %q", s)
+	}
+	return Role(s), nil
+}
+
+// Allows reports whether a caller with role r may use a route that requires role required
+func (r Role) Allows(required Role) bool {
+	rank, ok := roleRank[r]
+	return ok && rank >= roleRank[required]
+}
+
+// Principal identifies the authenticated caller of a request
+type Principal struct {
+	KeyID   int    `json:"key_id"`
+	KeyName string `json:"key_name"`
+	Role    Role   `json:"role"`
+	// StaffID is the staff member the key belongs to, 0 for keys not tied to one
+	StaffID int `json:"staff_id,omitempty"`
+	// TenantID is the tenant the key belongs to and may be used for
+	TenantID int `json:"tenant_id"`
+}
+
+type principalKey struct{}
+
+// WithPrincipal attaches the caller to the context
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the caller attached to the context, if any
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// Citizen is the end user identified by a verified citizen portal token
+type Citizen struct {
+	Subject string `json:"subject"`
+}
+
+type citizenKey struct{}
+
+// WithCitizen attaches the verified citizen to the context
+func WithCitizen(ctx context.Context, c *Citizen) context.Context {
+	return context.WithValue(ctx, citizenKey{}, c)
+}
+
+// CitizenFrom returns the verified citizen attached to the context, if any
+func CitizenFrom(ctx context.Context) (*Citizen, bool) {
+	c, ok := ctx.Value(citizenKey{}).(*Citizen)
+	return c, ok && c != nil
+}
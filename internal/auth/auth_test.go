@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRole(t *testing.T) {
+	role, err := ParseRole("front-desk")
+	assert.NoError(t, err)
+	assert.Equal(t, RoleFrontDesk, role)
+
+	_, err = ParseRole("superuser")
+	assert.Error(t, err)
+}
+
+func TestRole_Allows(t *testing.T) {
+	assert.True(t, RoleAdmin.Allows(RoleFrontDesk))
+	assert.True(t, RoleFrontDesk.Allows(RoleFrontDesk))
+	assert.True(t, RoleFrontDesk.Allows(RoleCitizenPortal))
+	assert.False(t, RoleCitizenPortal.Allows(RoleFrontDesk))
+	assert.False(t, RoleFrontDesk.Allows(RoleAdmin))
+	assert.False(t, Role("unknown").Allows(RoleCitizenPortal))
+}
+
+func TestPrincipalContext(t *testing.T) {
+	_, ok := PrincipalFrom(context.Background())
+	assert.False(t, ok)
+
+	p := &Principal{KeyID: 1, Role: RoleAdmin}
+	got, ok := PrincipalFrom(WithPrincipal(context.Background(), p))
+	assert.True(t, ok)
+	assert.Equal(t, p, got)
+}
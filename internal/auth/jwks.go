@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwk is a single JSON Web Key as published by the identity provider
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// KeySet holds the identity provider's public signing keys, loaded from a
+// local JWKS file or fetched from a JWKS URL
+type KeySet struct {
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	source      string
+	client      *http.Client
+	lastRefresh time.Time
+}
+
+// minRefreshGap stops unknown key ids from triggering a JWKS fetch on every request
+const minRefreshGap = time.Minute
+
+// NewKeySet loads a JWKS from source, which is either an http(s) URL or a file path
+func NewKeySet(ctx context.Context, source string) (*KeySet, error) {
+	ks := &KeySet{
+		source: source,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	if err := ks.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Refresh reloads the keys from the source
+func (ks *KeySet) Refresh(ctx context.Context) error {
+	data, err := ks.read(ctx)
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.lastRefresh = time.Now()
+	ks.mu.Unlock()
+	return nil
+}
+
+// Run refreshes the keys every interval until ctx is cancelled, so rotated keys are picked up
+func (ks *KeySet) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ks.Refresh(ctx); err != nil {
+				log.Printf("JWKS refresh failed: %v", err)
+			}
+		}
+	}
+}
+
+// Key returns the public key with the given id, refreshing once if it is unknown
+func (ks *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	ks.mu.RLock()
+	key, ok := ks.keys[kid]
+	stale := time.Since(ks.lastRefresh) > minRefreshGap
+	ks.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	if stale {
+		if err := ks.Refresh(ctx); err != nil {
+			return nil, err
+		}
+		ks.mu.RLock()
+		key, ok = ks.keys[kid]
+		ks.mu.RUnlock()
+		if ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (ks *KeySet) read(ctx context.Context) ([]byte, error) {
+	if strings.HasPrefix(ks.source, "http://") || strings.HasPrefix(ks.source, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.source, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create JWKS request: %w", err)
+		}
+		resp, err := ks.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected JWKS status code: %d", resp.StatusCode)
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	}
+
+	data, err := os.ReadFile(ks.source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+	return data, nil
+}
+
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set jwkSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		// A key of a type added at the identity provider must not lock out
+		// tokens signed with the keys still understood
+		key, err := k.publicKey()
+		if err != nil {
+			log.Printf("Skipping JWKS key %q: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS contains no usable signing keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64url value: %w", err)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// clockSkew tolerates small differences between our clock and the identity provider's
+const clockSkew = time.Minute
+
+// Claims are the registered JWT claims checked by the verifier
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	IssuedAt  int64    `json:"iat"`
+}
+
+// audience accepts both the single string and the array form of "aud"
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("invalid aud claim: %w", err)
+	}
+	*a = many
+	return nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// KeySource resolves a signing key id to its public key
+type KeySource interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// Verifier validates RS256 and ES256 signed bearer tokens issued by the citizen portal
+type Verifier struct {
+	keys     KeySource
+	issuer   string
+	audience string
+	now      func() time.Time
+}
+
+// NewVerifier creates a verifier. Empty issuer or audience skip the respective check.
+func NewVerifier(keys KeySource, issuer, audience string) *Verifier {
+	return &Verifier{
+		keys:     keys,
+		issuer:   issuer,
+		audience: audience,
+		// Token lifetimes are real-world times, never the simulated clock
+		now: time.Now,
+	}
+}
+
+// Verify checks the token signature and claims and returns the claims on success
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid token header: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token signature encoding: %w", err)
+	}
+
+	key, err := v.keys.Key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := verifySignature(header.Alg, key, digest[:], signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+	if err := v.validateClaims(&claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, digest, signature []byte) error {
+	// The algorithm must match the key type so an RSA key can never verify an HMAC or "none" token
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type does not match algorithm %s", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, signature); err != nil {
+			return fmt.Errorf("invalid token signature")
+		}
+		return nil
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type does not match algorithm %s", alg)
+		}
+		if len(signature) != 64 {
+			return fmt.Errorf("invalid token signature")
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return fmt.Errorf("invalid token signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported signing algorithm %q", alg)
+}
+
+func (v *Verifier) validateClaims(c *Claims) error {
+	now := v.now()
+
+	if c.Subject == "" {
+		return fmt.Errorf("token has no subject")
+	}
+	if c.ExpiresAt == 0 || now.After(time.Unix(c.ExpiresAt, 0).Add(clockSkew)) {
+		return fmt.Errorf("token has expired")
+	}
+	if c.NotBefore != 0 && now.Add(clockSkew).Before(time.Unix(c.NotBefore, 0)) {
+		return fmt.Errorf("token is not valid yet")
+	}
+	if v.issuer != "" && c.Issuer != v.issuer {
+		return fmt.Errorf("unexpected token issuer")
+	}
+	if v.audience != "" {
+		for _, aud := range c.Audience {
+			if aud == v.audience {
+				return nil
+			}
+		}
+		return fmt.Errorf("unexpected token audience")
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
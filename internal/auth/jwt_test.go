@@ -0,0 +1,223 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubIssuer is a local stand-in for the citizen portal's identity provider
+type stubIssuer struct {
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+}
+
+func newStubIssuer(t *testing.T) *stubIssuer {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return &stubIssuer{rsaKey: rsaKey, ecKey: ecKey}
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (s *stubIssuer) jwks() []byte {
+	set := jwkSet{Keys: []jwk{
+		{
+			Kty: "RSA", Kid: "rsa-1", Alg: "RS256", Use: "sig",
+			N: b64(s.rsaKey.N.Bytes()),
+			E: b64(big.NewInt(int64(s.rsaKey.E)).Bytes()),
+		},
+		{
+			Kty: "EC", Kid: "ec-1", Alg: "ES256", Use: "sig", Crv: "P-256",
+			X: b64(s.ecKey.X.FillBytes(make([]byte, 32))),
+			Y: b64(s.ecKey.Y.FillBytes(make([]byte, 32))),
+		},
+	}}
+	data, _ := json.Marshal(set)
+	return data
+}
+
+func (s *stubIssuer) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(jwtHeader{Alg: alg, Kid: kid, Typ: "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var sig []byte
+	switch alg {
+	case "RS256":
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, s.rsaKey, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case "ES256":
+		r, sVal, err := ecdsa.Sign(rand.Reader, s.ecKey, digest[:])
+		require.NoError(t, err)
+		sig = append(r.FillBytes(make([]byte, 32)), sVal.FillBytes(make([]byte, 32))...)
+	}
+	return signingInput + "." + b64(sig)
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub": "citizen-123",
+		"iss": "https://id.citynext.example",
+		"aud": []string{"appointments"},
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Unix(),
+	}
+}
+
+func newFileVerifier(t *testing.T, issuer *stubIssuer) *Verifier {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, issuer.jwks(), 0o600))
+
+	keys, err := NewKeySet(context.Background(), path)
+	require.NoError(t, err)
+	return NewVerifier(keys, "https://id.citynext.example", "appointments")
+}
+
+func TestVerifier_ValidTokens(t *testing.T) {
+	issuer := newStubIssuer(t)
+	verifier := newFileVerifier(t, issuer)
+
+	for _, tc := range []struct{ alg, kid string }{{"RS256", "rsa-1"}, {"ES256", "ec-1"}} {
+		t.Run(tc.alg, func(t *testing.T) {
+			token := issuer.sign(t, tc.alg, tc.kid, validClaims())
+
+			claims, err := verifier.Verify(context.Background(), token)
+
+			require.NoError(t, err)
+			assert.Equal(t, "citizen-123", claims.Subject)
+		})
+	}
+}
+
+func TestVerifier_RejectsInvalidTokens(t *testing.T) {
+	issuer := newStubIssuer(t)
+	verifier := newFileVerifier(t, issuer)
+
+	withClaim := func(key string, value interface{}) map[string]interface{} {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	testCases := []struct {
+		name  string
+		token string
+	}{
+		{"malformed", "not-a-jwt"},
+		{"expired", issuer.sign(t, "RS256", "rsa-1", withClaim("exp", time.Now().Add(-time.Hour).Unix()))},
+		{"missing expiry", issuer.sign(t, "RS256", "rsa-1", withClaim("exp", nil))},
+		{"not yet valid", issuer.sign(t, "RS256", "rsa-1", withClaim("nbf", time.Now().Add(time.Hour).Unix()))},
+		{"wrong issuer", issuer.sign(t, "RS256", "rsa-1", withClaim("iss", "https://evil.example"))},
+		{"wrong audience", issuer.sign(t, "RS256", "rsa-1", withClaim("aud", "payments"))},
+		{"missing subject", issuer.sign(t, "RS256", "rsa-1", withClaim("sub", nil))},
+		{"unknown key", issuer.sign(t, "RS256", "rsa-2", validClaims())},
+		{"algorithm mismatch", issuer.sign(t, "ES256", "rsa-1", validClaims())},
+		{"unsupported algorithm", issuer.sign(t, "HS256", "rsa-1", validClaims())},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := verifier.Verify(context.Background(), tc.token)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestVerifier_RejectsTamperedPayload(t *testing.T) {
+	issuer := newStubIssuer(t)
+	verifier := newFileVerifier(t, issuer)
+
+	token := issuer.sign(t, "RS256", "rsa-1", validClaims())
+	parts := strings.Split(token, ".")
+	forged, _ := json.Marshal(map[string]interface{}{"sub": "someone-else", "exp": time.Now().Add(time.Hour).Unix()})
+	parts[1] = b64(forged)
+
+	_, err := verifier.Verify(context.Background(), strings.Join(parts, "."))
+	assert.Error(t, err)
+}
+
+func TestKeySet_FromURL(t *testing.T) {
+	issuer := newStubIssuer(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(issuer.jwks())
+	}))
+	defer server.Close()
+
+	keys, err := NewKeySet(context.Background(), server.URL)
+	require.NoError(t, err)
+
+	verifier := NewVerifier(keys, "", "")
+	claims, err := verifier.Verify(context.Background(), issuer.sign(t, "ES256", "ec-1", validClaims()))
+
+	require.NoError(t, err)
+	assert.Equal(t, "citizen-123", claims.Subject)
+}
+
+func TestKeySet_InvalidSource(t *testing.T) {
+	_, err := NewKeySet(context.Background(), filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "empty.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"keys":[]}`), 0o600))
+	_, err = NewKeySet(context.Background(), path)
+	assert.Error(t, err)
+}
+
+func TestKeySet_SkipsUnusableKeys(t *testing.T) {
+	issuer := newStubIssuer(t)
+	var set jwkSet
+	require.NoError(t, json.Unmarshal(issuer.jwks(), &set))
+	set.Keys = append([]jwk{
+		{Kty: "OKP", Kid: "ed-1", Use: "sig", Crv: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+		{Kty: "EC", Kid: "ec-broken", Use: "sig", Crv: "P-256", X: "AA", Y: "AA"},
+	}, set.Keys...)
+	data, err := json.Marshal(set)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	keys, err := NewKeySet(context.Background(), path)
+	require.NoError(t, err, "keys that cannot be used are skipped")
+
+	claims, err := NewVerifier(keys, "", "").Verify(context.Background(), issuer.sign(t, "RS256", "rsa-1", validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, "citizen-123", claims.Subject)
+
+	unusable, err := json.Marshal(jwkSet{Keys: set.Keys[:2]})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, unusable, 0o600))
+	_, err = NewKeySet(context.Background(), path)
+	assert.Error(t, err, "a key set without any usable key is still rejected")
+}
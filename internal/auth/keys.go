@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/tenant"
+)
+
+const (
+	keyPrefix      = "cnk_"
+	keySecretBytes = 32
+	// displayPrefixLen is how much of the key is stored in clear to identify it
+	displayPrefixLen = 12
+)
+
+// APIKey is a stored API key. The plaintext key is never persisted.
+type APIKey struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Role      Role       `json:"role"`
+	Prefix    string     `json:"prefix"`
+	StaffID   int        `json:"staff_id,omitempty"`
+	TenantID  int        `json:"tenant_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// GenerateKey returns a new random plaintext API key
+func GenerateKey() (string, error) {
+	secret := make([]byte, keySecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	return keyPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// HashKey returns the value stored for a key. Keys carry 256 bits of entropy,
+// so a fast hash is sufficient and keeps per-request lookups cheap.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// KeyStore manages API keys in the api_keys table. Keys belong to the tenant
+// in the context they are created, revoked and listed with; api_keys is not
+// under row-level security, so the queries filter by tenant themselves.
+type KeyStore struct {
+	db *db.DB
+}
+
+func NewKeyStore(database *db.DB) *KeyStore {
+	return &KeyStore{db: database}
+}
+
+// Create stores a new key and returns it together with its plaintext value,
+// which is only available at this point. A non-zero staffID ties the key to
+// that staff member.
+func (s *KeyStore) Create(ctx context.Context, name string, role Role, staffID int) (*APIKey, string, error) {
+	tenantID := tenant.IDFrom(ctx)
+	if tenantID == 0 {
+		return nil, "", fmt.Errorf("an api key has to belong to a tenant")
+	}
+	plaintext, err := GenerateKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := &APIKey{
+		Name:     name,
+		Role:     role,
+		Prefix:   plaintext[:displayPrefixLen],
+		StaffID:  staffID,
+		TenantID: tenantID,
+	}
+
+	query := `
+		INSERT INTO api_keys (name, role, key_prefix, key_hash, staff_id, tenant_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+	err = s.db.QueryRowContext(ctx, query, key.Name, key.Role, key.Prefix, HashKey(plaintext), sql.NullInt64{Int64: int64(staffID), Valid: staffID != 0}, tenantID).
+		Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	return key, plaintext, nil
+}
+
+// Revoke disables a key. Revoking an unknown or already revoked key is an error.
+func (s *KeyStore) Revoke(ctx context.Context, id int) error {
+	query := `UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND tenant_id = $2 AND revoked_at IS NULL`
+	result, err := s.db.ExecContext(ctx, query, id, tenant.IDFrom(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("no active api key with id %d", id)
+	}
+	return nil
+}
+
+// List returns every key, newest first
+func (s *KeyStore) List(ctx context.Context) ([]APIKey, error) {
+	query := `
+		SELECT id, name, role, key_prefix, COALESCE(staff_id, 0), tenant_id, created_at, revoked_at
+		FROM api_keys
+		WHERE tenant_id = $1
+		ORDER BY id DESC
+	`
+	rows, err := s.db.QueryContext(ctx, query, tenant.IDFrom(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		var key APIKey
+		var revokedAt sql.NullTime
+		if err := rows.Scan(&key.ID, &key.Name, &key.Role, &key.Prefix, &key.StaffID, &key.TenantID, &key.CreatedAt, &revokedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan api key: %w", err)
+		}
+		if revokedAt.Valid {
+			key.RevokedAt = &revokedAt.Time
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Authenticate resolves a plaintext key to its principal, returning nil for unknown or revoked keys.
+// It runs before the tenant of a request is known and finds keys of every tenant.
+func (s *KeyStore) Authenticate(ctx context.Context, plaintext string) (*Principal, error) {
+	// Uses the unique key_hash index, the plaintext never reaches the database
+	query := `SELECT id, name, role, COALESCE(staff_id, 0), tenant_id FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL`
+
+	p := &Principal{}
+	err := s.db.QueryRowContext(ctx, query, HashKey(plaintext)).Scan(&p.KeyID, &p.KeyName, &p.Role, &p.StaffID, &p.TenantID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to look up api key: %w", err)
+	}
+	return p, nil
+}
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/tenant"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateKey(t *testing.T) {
+	first, err := GenerateKey()
+	require.NoError(t, err)
+	second, err := GenerateKey()
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(first, "cnk_"))
+	assert.NotEqual(t, first, second)
+	assert.Len(t, HashKey(first), 64)
+	assert.Equal(t, HashKey(first), HashKey(first))
+	assert.NotEqual(t, HashKey(first), HashKey(second))
+}
+
+func TestKeyStore_Create(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	store := NewKeyStore(&db.DB{DB: sqlDB})
+	createdAt := time.Now()
+
+	mock.ExpectQuery(`INSERT INTO api_keys \(name, role, key_prefix, key_hash, staff_id, tenant_id\) VALUES \(\$1, \$2, \$3, \$4, \$5, \$6\) RETURNING id, created_at`).
+		WithArgs("portal", RoleCitizenPortal, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(7, createdAt))
+
+	key, plaintext, err := store.Create(tenant.WithTenant(context.Background(), &tenant.Tenant{ID: 2}), "portal", RoleCitizenPortal, 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, 7, key.ID)
+	assert.Equal(t, 2, key.TenantID)
+	assert.Equal(t, RoleCitizenPortal, key.Role)
+	assert.True(t, strings.HasPrefix(plaintext, key.Prefix))
+
+	_, _, err = store.Create(context.Background(), "portal", RoleCitizenPortal, 0)
+	assert.Error(t, err, "a key without a tenant could not be used anywhere")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestKeyStore_Authenticate(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	store := NewKeyStore(&db.DB{DB: sqlDB})
+
+	mock.ExpectQuery(`SELECT id, name, role, COALESCE\(staff_id, 0\), tenant_id FROM api_keys WHERE key_hash = \$1 AND revoked_at IS NULL`).
+		WithArgs(HashKey("cnk_valid")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "role", "staff_id", "tenant_id"}).AddRow(3, "front desk", "front-desk", 2, 4))
+	mock.ExpectQuery(`SELECT id, name, role, COALESCE\(staff_id, 0\), tenant_id FROM api_keys WHERE key_hash = \$1 AND revoked_at IS NULL`).
+		WithArgs(HashKey("cnk_revoked")).
+		WillReturnError(sql.ErrNoRows)
+
+	principal, err := store.Authenticate(context.Background(), "cnk_valid")
+	require.NoError(t, err)
+	assert.Equal(t, &Principal{KeyID: 3, KeyName: "front desk", Role: RoleFrontDesk, StaffID: 2, TenantID: 4}, principal)
+
+	principal, err = store.Authenticate(context.Background(), "cnk_revoked")
+	assert.NoError(t, err)
+	assert.Nil(t, principal)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestKeyStore_Revoke(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	store := NewKeyStore(&db.DB{DB: sqlDB})
+
+	mock.ExpectExec(`UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = \$1 AND tenant_id = \$2 AND revoked_at IS NULL`).
+		WithArgs(3, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = \$1 AND tenant_id = \$2 AND revoked_at IS NULL`).
+		WithArgs(3, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ctx := tenant.WithTenant(context.Background(), &tenant.Tenant{ID: 1})
+	assert.NoError(t, store.Revoke(ctx, 3))
+	other := tenant.WithTenant(context.Background(), &tenant.Tenant{ID: 2})
+	assert.Error(t, store.Revoke(other, 3), "another tenant's key cannot be revoked")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,214 @@
+package clock
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Mode selects how the clock derives "now"
+type Mode string
+
+const (
+	// ModeReal reports the wall clock
+	ModeReal Mode = "real"
+	// ModeOffset reports the shared simulated epoch plus the real time elapsed since it was set
+	ModeOffset Mode = "offset"
+	// ModeFrozen always reports the shared simulated epoch
+	ModeFrozen Mode = "frozen"
+)
+
+// ParseMode validates a mode name from configuration
+func ParseMode(s string) (Mode, error) {
+	switch Mode(s) {
+	case ModeReal, ModeOffset, ModeFrozen:
+		return Mode(s), nil
+	}
+	return "", fmt.Errorf("unknown clock mode %q", s)
+}
+
+// State is the shared clock setting, stored in the database so every replica
+// and every restart agrees on the simulated time
+type State struct {
+	Mode           Mode      `json:"mode"`
+	SimulatedEpoch time.Time `json:"simulated_epoch"`
+	RealEpoch      time.Time `json:"real_epoch"`
+}
+
+// Store persists the shared clock state
+type Store interface {
+	// Load returns the stored state, or nil when none has been saved yet
+	Load(ctx context.Context) (*State, error)
+	// Init saves the state only if none exists and returns whichever state won
+	Init(ctx context.Context, state State) (*State, error)
+	Save(ctx context.Context, state State) error
+}
+
+// Clock provides the application's notion of "now"
+type Clock struct {
+	mu    sync.RWMutex
+	state State
+	store Store
+	real  func() time.Time
+}
+
+// NewReal returns a clock that always reports the wall clock
+func NewReal() *Clock {
+	return &Clock{
+		state: State{Mode: ModeReal},
+		real:  time.Now,
+	}
+}
+
+// NewFixed returns an in-memory frozen clock, useful in tests
+func NewFixed(at time.Time) *Clock {
+	return &Clock{
+		state: State{Mode: ModeFrozen, SimulatedEpoch: at},
+		real:  time.Now,
+	}
+}
+
+// New creates a clock backed by the shared store. The initial state is only
+// used if the store has not been initialised by another replica yet.
+func New(ctx context.Context, store Store, initial State) (*Clock, error) {
+	c := &Clock{store: store, real: time.Now}
+	if initial.Mode == ModeReal {
+		c.state = initial
+		return c, nil
+	}
+	if initial.RealEpoch.IsZero() {
+		initial.RealEpoch = c.real()
+	}
+
+	state, err := store.Init(ctx, initial)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialise clock: %w", err)
+	}
+	c.state = *state
+	return c, nil
+}
+
+// Now returns the current time according to the clock mode
+func (c *Clock) Now() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.nowLocked()
+}
+
+func (c *Clock) nowLocked() time.Time {
+	switch c.state.Mode {
+	case ModeFrozen:
+		return c.state.SimulatedEpoch
+	case ModeOffset:
+		return c.state.SimulatedEpoch.Add(c.real().Sub(c.state.RealEpoch))
+	default:
+		return c.real()
+	}
+}
+
+// State returns a copy of the current clock state
+func (c *Clock) State() State {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.state
+}
+
+// Shared reports whether the clock state lives in the store and can be changed at runtime
+func (c *Clock) Shared() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.store != nil && c.state.Mode != ModeReal
+}
+
+// Refresh reloads the shared state so changes made by other replicas are picked up
+func (c *Clock) Refresh(ctx context.Context) error {
+	if !c.Shared() {
+		return nil
+	}
+	state, err := c.store.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load clock state: %w", err)
+	}
+	if state == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	c.state = *state
+	c.mu.Unlock()
+	return nil
+}
+
+// Run refreshes the shared state every interval until ctx is cancelled
+func (c *Clock) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Refresh(ctx); err != nil {
+				log.Printf("Clock refresh failed: %v", err)
+			}
+		}
+	}
+}
+
+// Advance moves the simulated time forward (or backward for negative durations)
+func (c *Clock) Advance(ctx context.Context, d time.Duration) (State, error) {
+	return c.update(ctx, func(s *State, now, real time.Time) {
+		s.SimulatedEpoch = now.Add(d)
+		s.RealEpoch = real
+	})
+}
+
+// Freeze stops the clock at the given time, or at the current time when at is zero
+func (c *Clock) Freeze(ctx context.Context, at time.Time) (State, error) {
+	return c.update(ctx, func(s *State, now, real time.Time) {
+		if at.IsZero() {
+			at = now
+		}
+		s.Mode = ModeFrozen
+		s.SimulatedEpoch = at
+		s.RealEpoch = real
+	})
+}
+
+// Set jumps to the given time while keeping the current mode
+func (c *Clock) Set(ctx context.Context, at time.Time) (State, error) {
+	return c.update(ctx, func(s *State, now, real time.Time) {
+		s.SimulatedEpoch = at
+		s.RealEpoch = real
+	})
+}
+
+// Resume lets a frozen clock run again from the time it was frozen at
+func (c *Clock) Resume(ctx context.Context) (State, error) {
+	return c.update(ctx, func(s *State, now, real time.Time) {
+		s.Mode = ModeOffset
+		s.SimulatedEpoch = now
+		s.RealEpoch = real
+	})
+}
+
+func (c *Clock) update(ctx context.Context, change func(s *State, now, real time.Time)) (State, error) {
+	if !c.Shared() {
+		return State{}, fmt.Errorf("clock is not adjustable in %s mode", ModeReal)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	next := c.state
+	change(&next, c.nowLocked(), c.real())
+
+	if err := c.store.Save(ctx, next); err != nil {
+		return State{}, fmt.Errorf("failed to save clock state: %w", err)
+	}
+	c.state = next
+	return next, nil
+}
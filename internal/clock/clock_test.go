@@ -0,0 +1,151 @@
+package clock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryStore struct {
+	state *State
+	saves int
+}
+
+func (m *memoryStore) Load(ctx context.Context) (*State, error) {
+	if m.state == nil {
+		return nil, nil
+	}
+	copied := *m.state
+	return &copied, nil
+}
+
+func (m *memoryStore) Init(ctx context.Context, state State) (*State, error) {
+	if m.state == nil {
+		m.state = &state
+	}
+	return m.Load(ctx)
+}
+
+func (m *memoryStore) Save(ctx context.Context, state State) error {
+	m.state = &state
+	m.saves++
+	return nil
+}
+
+// fakeReal returns a controllable wall clock
+func fakeReal(start time.Time) (func() time.Time, func(d time.Duration)) {
+	now := start
+	return func() time.Time { return now }, func(d time.Duration) { now = now.Add(d) }
+}
+
+var (
+	realStart = time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	simStart  = time.Date(2075, 3, 10, 12, 0, 0, 0, time.UTC)
+)
+
+func newTestClock(t *testing.T, store *memoryStore, mode Mode) (*Clock, func(d time.Duration)) {
+	t.Helper()
+	clk, err := New(context.Background(), store, State{Mode: mode, SimulatedEpoch: simStart, RealEpoch: realStart})
+	require.NoError(t, err)
+
+	real, tick := fakeReal(realStart)
+	clk.real = real
+	return clk, tick
+}
+
+func TestParseMode(t *testing.T) {
+	for _, m := range []string{"real", "offset", "frozen"} {
+		mode, err := ParseMode(m)
+		assert.NoError(t, err)
+		assert.Equal(t, Mode(m), mode)
+	}
+
+	_, err := ParseMode("warp")
+	assert.Error(t, err)
+}
+
+func TestClock_OffsetModeFollowsRealTime(t *testing.T) {
+	clk, tick := newTestClock(t, &memoryStore{}, ModeOffset)
+
+	assert.Equal(t, simStart, clk.Now())
+
+	tick(90 * time.Minute)
+	assert.Equal(t, simStart.Add(90*time.Minute), clk.Now())
+}
+
+func TestClock_FrozenModeStandsStill(t *testing.T) {
+	clk, tick := newTestClock(t, &memoryStore{}, ModeFrozen)
+
+	tick(time.Hour)
+	assert.Equal(t, simStart, clk.Now())
+}
+
+func TestClock_InitKeepsExistingSharedState(t *testing.T) {
+	existing := State{Mode: ModeFrozen, SimulatedEpoch: simStart.AddDate(0, 1, 0), RealEpoch: realStart}
+	store := &memoryStore{state: &existing}
+
+	clk, _ := newTestClock(t, store, ModeOffset)
+
+	assert.Equal(t, existing, clk.State())
+	assert.Equal(t, existing.SimulatedEpoch, clk.Now())
+}
+
+func TestClock_AdvanceFreezeResume(t *testing.T) {
+	store := &memoryStore{}
+	clk, tick := newTestClock(t, store, ModeOffset)
+	ctx := context.Background()
+
+	_, err := clk.Advance(ctx, 48*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, simStart.Add(48*time.Hour), clk.Now())
+
+	state, err := clk.Freeze(ctx, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, ModeFrozen, state.Mode)
+	tick(time.Hour)
+	assert.Equal(t, simStart.Add(48*time.Hour), clk.Now())
+
+	_, err = clk.Resume(ctx)
+	require.NoError(t, err)
+	tick(time.Hour)
+	assert.Equal(t, simStart.Add(49*time.Hour), clk.Now())
+
+	target := time.Date(2076, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err = clk.Set(ctx, target)
+	require.NoError(t, err)
+	assert.Equal(t, target, clk.Now())
+
+	assert.Equal(t, 4, store.saves)
+	assert.Equal(t, clk.State(), *store.state)
+}
+
+func TestClock_RefreshPicksUpOtherReplicas(t *testing.T) {
+	store := &memoryStore{}
+	clk, _ := newTestClock(t, store, ModeOffset)
+
+	other := simStart.AddDate(0, 0, 7)
+	store.state = &State{Mode: ModeFrozen, SimulatedEpoch: other, RealEpoch: realStart}
+
+	require.NoError(t, clk.Refresh(context.Background()))
+	assert.Equal(t, other, clk.Now())
+}
+
+func TestClock_RealModeIsNotAdjustable(t *testing.T) {
+	clk := NewReal()
+
+	assert.False(t, clk.Shared())
+	assert.WithinDuration(t, time.Now(), clk.Now(), time.Second)
+
+	_, err := clk.Advance(context.Background(), time.Hour)
+	assert.Error(t, err)
+}
+
+func TestNewFixed(t *testing.T) {
+	clk := NewFixed(simStart)
+
+	assert.Equal(t, simStart, clk.Now())
+	assert.False(t, clk.Shared())
+}
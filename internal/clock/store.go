@@ -0,0 +1,65 @@
+package clock
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"citynext-appointments/internal/db"
+)
+
+// DBStore keeps the clock state in the single-row clock_settings table
+type DBStore struct {
+	db *db.DB
+}
+
+func NewDBStore(database *db.DB) *DBStore {
+	return &DBStore{db: database}
+}
+
+func (s *DBStore) Load(ctx context.Context) (*State, error) {
+	query := `SELECT mode, simulated_epoch, real_epoch FROM clock_settings WHERE id = 1`
+
+	state := &State{}
+	err := s.db.QueryRowContext(ctx, query).Scan(&state.Mode, &state.SimulatedEpoch, &state.RealEpoch)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load clock settings: %w", err)
+	}
+	return state, nil
+}
+
+func (s *DBStore) Init(ctx context.Context, state State) (*State, error) {
+	// ON CONFLICT keeps the first replica's epoch so all replicas share it
+	query := `
+		INSERT INTO clock_settings (id, mode, simulated_epoch, real_epoch)
+		VALUES (1, $1, $2, $3)
+		ON CONFLICT (id) DO NOTHING
+	`
+	if _, err := s.db.ExecContext(ctx, query, state.Mode, state.SimulatedEpoch, state.RealEpoch); err != nil {
+		return nil, fmt.Errorf("failed to initialise clock settings: %w", err)
+	}
+
+	stored, err := s.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, fmt.Errorf("clock settings missing after initialisation")
+	}
+	return stored, nil
+}
+
+func (s *DBStore) Save(ctx context.Context, state State) error {
+	query := `
+		UPDATE clock_settings
+		SET mode = $1, simulated_epoch = $2, real_epoch = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = 1
+	`
+	if _, err := s.db.ExecContext(ctx, query, state.Mode, state.SimulatedEpoch, state.RealEpoch); err != nil {
+		return fmt.Errorf("failed to save clock settings: %w", err)
+	}
+	return nil
+}
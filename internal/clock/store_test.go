@@ -0,0 +1,74 @@
+package clock
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/db"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDBStore_Load_NotFound(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	store := NewDBStore(&db.DB{DB: sqlDB})
+
+	mock.ExpectQuery(`SELECT mode, simulated_epoch, real_epoch FROM clock_settings WHERE id = 1`).
+		WillReturnError(sql.ErrNoRows)
+
+	state, err := store.Load(context.Background())
+
+	assert.NoError(t, err)
+	assert.Nil(t, state)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDBStore_Init_ReturnsStoredState(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	store := NewDBStore(&db.DB{DB: sqlDB})
+
+	proposed := State{Mode: ModeOffset, SimulatedEpoch: simStart, RealEpoch: realStart}
+	existingEpoch := simStart.AddDate(0, 0, -3)
+
+	mock.ExpectExec(`INSERT INTO clock_settings \(id, mode, simulated_epoch, real_epoch\) VALUES \(1, \$1, \$2, \$3\) ON CONFLICT \(id\) DO NOTHING`).
+		WithArgs(ModeOffset, simStart, realStart).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT mode, simulated_epoch, real_epoch FROM clock_settings WHERE id = 1`).
+		WillReturnRows(sqlmock.NewRows([]string{"mode", "simulated_epoch", "real_epoch"}).
+			AddRow("frozen", existingEpoch, realStart))
+
+	state, err := store.Init(context.Background(), proposed)
+
+	require.NoError(t, err)
+	assert.Equal(t, ModeFrozen, state.Mode)
+	assert.Equal(t, existingEpoch, state.SimulatedEpoch)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDBStore_Save(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	store := NewDBStore(&db.DB{DB: sqlDB})
+	state := State{Mode: ModeFrozen, SimulatedEpoch: simStart, RealEpoch: realStart.Add(time.Minute)}
+
+	mock.ExpectExec(`UPDATE clock_settings SET mode = \$1, simulated_epoch = \$2, real_epoch = \$3`).
+		WithArgs(ModeFrozen, state.SimulatedEpoch, state.RealEpoch).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = store.Save(context.Background(), state)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, opts, err := Load(nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, Default(), cfg)
+	assert.False(t, opts.PrintConfig)
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeConfigFile(t, `
+server:
+  port: "9000"
+  read_timeout: 5s
+holidays:
+  country_code: IE
+time:
+  simulated_year: 2080
+`)
+
+	t.Setenv("PORT", "9100")
+	t.Setenv("HOLIDAY_COUNTRY", "FR")
+
+	cfg, _, err := Load([]string{"-config", path, "-holiday-country", "DE"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "9100", cfg.Server.Port, "env should override file")
+	assert.Equal(t, 5*time.Second, cfg.Server.ReadTimeout, "file should override default")
+	assert.Equal(t, "DE", cfg.Holidays.CountryCode, "flag should override env")
+	assert.Equal(t, 2080, cfg.Time.SimulatedYear)
+	assert.Equal(t, 30*time.Second, cfg.Server.WriteTimeout, "default should remain")
+}
+
+func TestLoad_UnknownFileField(t *testing.T) {
+	path := writeConfigFile(t, "server:\n  prot: \"9000\"\n")
+
+	_, _, err := Load([]string{"-config", path})
+	assert.Error(t, err)
+}
+
+func TestLoad_InvalidEnvValue(t *testing.T) {
+	t.Setenv("DB_MAX_OPEN_CONNS", "lots")
+
+	_, _, err := Load(nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "DB_MAX_OPEN_CONNS")
+}
+
+func TestLoad_ReminderTimes(t *testing.T) {
+	path := writeConfigFile(t, `
+reminders:
+  before: [48h, 90m]
+`)
+
+	cfg, _, err := Load([]string{"-config", path})
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{48 * time.Hour, 90 * time.Minute}, cfg.Reminders.Before)
+
+	t.Setenv("REMINDERS_BEFORE", "24h, 3h")
+	cfg, _, err = Load([]string{"-config", path})
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{24 * time.Hour, 3 * time.Hour}, cfg.Reminders.Before, "env should override file")
+}
+
+func TestConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		mutate func(c *Config)
+	}{
+		{"invalid port", func(c *Config) { c.Server.Port = "http" }},
+		{"zero timeout", func(c *Config) { c.Server.ReadTimeout = 0 }},
+		{"missing database url", func(c *Config) { c.Database.URL = "" }},
+		{"negative pool size", func(c *Config) { c.Database.MaxOpenConns = -1 }},
+		{"invalid holiday url", func(c *Config) { c.Holidays.APIURL = "not a url" }},
+		{"invalid country", func(c *Config) { c.Holidays.CountryCode = "GBR" }},
+		{"negative year", func(c *Config) { c.Time.SimulatedYear = -1 }},
+		{"unknown clock mode", func(c *Config) { c.Time.Mode = "warp" }},
+		{"zero rate limit", func(c *Config) { c.RateLimit.RequestsPerMinute = 0 }},
+		{"negative booking cap", func(c *Config) { c.Booking.MaxActivePerCitizen = -1 }},
+		{"unknown duplicate policy", func(c *Config) { c.Booking.DuplicatePolicy = "warn" }},
+		{"notifications without smtp host", func(c *Config) {
+			c.Notifications.Enabled = true
+			c.Notifications.SMTPHost = ""
+		}},
+		{"zero outbox batch size", func(c *Config) { c.Outbox.BatchSize = 0 }},
+		{"webhooks without attempts", func(c *Config) {
+			c.Webhooks.Enabled = true
+			c.Webhooks.MaxAttempts = 0
+		}},
+		{"reminders without notifications", func(c *Config) { c.Reminders.Enabled = true }},
+		{"negative reminder time", func(c *Config) {
+			c.Notifications.Enabled = true
+			c.Reminders.Enabled = true
+			c.Reminders.Before = []time.Duration{-time.Hour}
+		}},
+		{"waitlist without offer ttl", func(c *Config) {
+			c.Waitlist.Enabled = true
+			c.Waitlist.OfferTTL = 0
+		}},
+		{"hold max below default", func(c *Config) {
+			c.Holds.Enabled = true
+			c.Holds.MaxTTL = time.Minute
+		}},
+		{"negative holds per holder", func(c *Config) {
+			c.Holds.Enabled = true
+			c.Holds.MaxPerHolder = -1
+		}},
+		{"no-show day end past midnight", func(c *Config) {
+			c.NoShows.Enabled = true
+			c.NoShows.DayEnd = 25 * time.Hour
+		}},
+		{"encryption without keys", func(c *Config) {
+			c.Encryption.Enabled = true
+			c.Encryption.PrimaryKey = "2075-01"
+		}},
+		{"encryption without primary key", func(c *Config) {
+			c.Encryption.Enabled = true
+			c.Encryption.Keys = "2075-01:AQ=="
+		}},
+		{"retention without period", func(c *Config) { c.Retention.Days = 0 }},
+		{"retention without interval", func(c *Config) {
+			c.Retention.Enabled = true
+			c.Retention.Interval = 0
+		}},
+		{"citizen token without jwks", func(c *Config) { c.Auth.RequireCitizenToken = true }},
+		{"trusted proxy that is not an address", func(c *Config) { c.Server.TrustedProxies = []string{"proxy.internal"} }},
+		{"time travel without tenant", func(c *Config) {
+			c.Time.AllowTimeTravel = true
+			c.Time.TimeTravelTenant = ""
+		}},
+		{"no tenant database role", func(c *Config) { c.Tenancy.DatabaseRole = "" }},
+		{"tenant database role with options", func(c *Config) { c.Tenancy.DatabaseRole = "app -c role=postgres" }},
+	}
+
+	assert.NoError(t, Default().Validate())
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := Default()
+			tc.mutate(cfg)
+			assert.Error(t, cfg.Validate())
+		})
+	}
+}
+
+func TestConfig_StringRedactsSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Notifications.SMTPPassword = "smtp-secret"
+	cfg.Encryption.Keys = "2075-01:c2VjcmV0LWtleQ=="
+
+	out := cfg.String()
+
+	assert.NotContains(t, out, "citynext_password")
+	assert.NotContains(t, out, "smtp-secret")
+	assert.NotContains(t, out, "c2VjcmV0LWtleQ==")
+	assert.Contains(t, out, "citynext_user")
+	assert.Contains(t, out, "read_timeout: 10s")
+	assert.Contains(t, cfg.Database.URL, "citynext_password", "original config must not be modified")
+}
@@ -1,5 +1,7 @@
 package constants
 
+import "time"
+
 const (
 	DateLayout = "2006-01-02"
 )
@@ -7,20 +9,105 @@ const (
 const (
 	ErrInvalidDateFormat    = "Invalid date format, expected YYYY-MM-DD"
 	ErrPastDate             = "Visit date cannot be in the past"
-	ErrDuplicateAppointment = "Appointment already exists for date"
+	ErrDuplicateAppointment = "No appointments left for date"
 	ErrPublicHoliday        = "Cannot book appointment on a public holiday"
+	ErrAppointmentNotFound  = "Appointment not found"
+	ErrAlreadyCancelled     = "Appointment is already cancelled"
+	ErrCancelPastVisit      = "Cannot cancel an appointment in the past"
+	ErrReschedulePastVisit  = "Cannot reschedule an appointment in the past"
+	ErrBookingLimitReached  = "Maximum number of active bookings reached"
+	ErrIdentityRequired     = "A citizen token or an email address is required to book"
+	ErrRateLimited          = "Too many requests, please retry later"
+	ErrUnauthorized         = "Missing or invalid credentials"
+	ErrInvalidBearerToken   = "Invalid bearer token"
+	ErrForbidden            = "Insufficient permissions for this operation"
+	ErrWebhookNotFound      = "Webhook subscription not found"
+	ErrDateAvailable        = "Date is available, book it directly"
+	ErrAlreadyWaitlisted    = "Already on the waitlist for this date"
+	ErrWaitlistNotFound     = "Waitlist entry not found"
+	ErrOfferNotFound        = "Waitlist offer not found or expired"
+	ErrDateHeld             = "Date is held for another booking in progress"
+	ErrHoldNotFound         = "Hold not found or expired"
+	ErrHoldTooLong          = "Requested hold is longer than allowed"
+	ErrTooManyHolds         = "Too many dates are held at once"
+	ErrUnknownServiceType   = "Unknown service type"
+	ErrNoStaffAvailable     = "No staff available for date"
+	ErrStaffNotFound        = "Staff member not found"
+	ErrInvalidRoster        = "Roster lists a weekday more than once"
+	ErrInvalidTransition    = "Appointment status cannot change"
+	ErrNotVisitDay          = "Check-in is only possible on the day of the visit"
+	ErrCitizenRequired      = "Citizen subject or email is required"
+	ErrInvalidSearchQuery   = "Search query must be a name of 2 to 100 characters"
+	ErrPossibleDuplicate    = "Booking looks like a duplicate of an existing booking"
+	ErrUnknownTenant        = "No tenant is served at this address"
+	ErrTenantMismatch       = "API key belongs to another tenant"
+)
+
+const (
+	ErrorTypeValidation         = "validation_error"
+	ErrorTypeInvalidDate        = "invalid_date"
+	ErrorTypePastDate           = "past_date"
+	ErrorTypeDuplicateAppt      = "duplicate_appointment"
+	ErrorTypePublicHoliday      = "public_holiday"
+	ErrorTypeHolidayCheck       = "holiday_check_failed"
+	ErrorTypeInternal           = "internal_error"
+	ErrorTypeNotFound           = "not_found"
+	ErrorTypeCancelled          = "already_cancelled"
+	ErrorTypeBookingLimit       = "booking_limit_reached"
+	ErrorTypeIdentityRequired   = "identity_required"
+	ErrorTypeRateLimited        = "rate_limited"
+	ErrorTypeUnauthorized       = "unauthorized"
+	ErrorTypeForbidden          = "forbidden"
+	ErrorTypeClock              = "clock_error"
+	ErrorTypeDateAvailable      = "date_available"
+	ErrorTypeWaitlisted         = "already_waitlisted"
+	ErrorTypeDateHeld           = "date_held"
+	ErrorTypeHoldNotFound       = "hold_not_found"
+	ErrorTypeTooManyHolds       = "too_many_holds"
+	ErrorTypeUnknownServiceType = "unknown_service_type"
+	ErrorTypeNoStaffAvailable   = "no_staff_available"
+	ErrorTypeInvalidTransition  = "invalid_status_transition"
+	ErrorTypeNotVisitDay        = "not_visit_day"
+	ErrorTypePossibleDuplicate  = "possible_duplicate"
+	ErrorTypeUnknownTenant      = "unknown_tenant"
 )
 
 const (
-	ErrorTypeValidation    = "validation_error"
-	ErrorTypeInvalidDate   = "invalid_date"
-	ErrorTypePastDate      = "past_date"
-	ErrorTypeDuplicateAppt = "duplicate_appointment"
-	ErrorTypePublicHoliday = "public_holiday"
-	ErrorTypeHolidayCheck  = "holiday_check_failed"
-	ErrorTypeInternal      = "internal_error"
+	HeaderAPIKey        = "X-API-Key"
+	HeaderAuthorization = "Authorization"
+	BearerPrefix        = "Bearer "
+	HeaderRequestID     = "X-Request-ID"
+	HeaderTenant        = "X-Tenant"
+	HeaderDeprecation   = "Deprecation"
+
+	HeaderWebhookEvent     = "X-CityNext-Event"
+	HeaderWebhookDelivery  = "X-CityNext-Delivery"
+	HeaderWebhookTimestamp = "X-CityNext-Timestamp"
+	HeaderWebhookSignature = "X-CityNext-Signature"
+)
+
+// ICalUIDDomain makes appointment event UIDs globally unique
+const ICalUIDDomain = "appointments.citynext.example"
+
+// MaxCalendarRange bounds the date range of one calendar feed request
+const MaxCalendarRange = 366 * 24 * time.Hour
+
+// DefaultServiceType is the type of bookings made before service types existed
+// and of imported rows without a service_type column
+const DefaultServiceType = "general"
+
+const (
+	NagerDateAPIURL     = "https://date.nager.at/api/v3"
+	DefaultCountryCode  = "GB"
+	NagerDateHolidayURL = "%s/PublicHolidays/%d/%s"
 )
 
+// Appointment lifecycle events written to the outbox
 const (
-	NagerDateAPIURL = "https://date.nager.at/api/v3/PublicHolidays/%d/GB"
+	EventAppointmentCreated     = "appointment.created"
+	EventAppointmentCancelled   = "appointment.cancelled"
+	EventAppointmentRescheduled = "appointment.rescheduled"
+	EventAppointmentCheckedIn   = "appointment.checked_in"
+	EventAppointmentCompleted   = "appointment.completed"
+	EventAppointmentNoShow      = "appointment.no_show"
 )
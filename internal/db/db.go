@@ -1,15 +1,40 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"citynext-appointments/internal/tenant"
 
 	_ "github.com/lib/pq"
 )
 
+// TenantSetting is the Postgres setting row-level security policies compare
+// tenant_id columns with
+const TenantSetting = "citynext.tenant_id"
+
 // DB wraps sql.DB to provide additional functionality
 type DB struct {
 	*sql.DB
+
+	// With tenant pools enabled, statements whose context carries a tenant run
+	// on a pool of that tenant's own, whose sessions have TenantSetting set
+	// and run as tenantRole, which row-level security applies to
+	databaseURL string
+	tenantRole  string
+	open        func(dsn string) (*sql.DB, error)
+
+	mu              sync.Mutex
+	pools           map[int]*sql.DB
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration
 }
 
 // NewDB creates a new database connection and verifies connectivity
@@ -23,5 +48,200 @@ func NewDB(databaseURL string) (*DB, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return &DB{db}, nil
+	return &DB{DB: db, databaseURL: databaseURL}, nil
+}
+
+// WithTenantPools routes statements run for a tenant to a connection pool of
+// that tenant, opened on first use. Its sessions take on role, which must not
+// bypass row-level security, so they only see the tenant's rows however a
+// query is written. Statements without a tenant keep using the main pool,
+// whose user must not bypass row-level security either (see CheckRowSecurity),
+// so they see no tenant rows and cannot write any.
+// The connection limits are shared out between the main pool and the tenant
+// pools, so adding tenants does not add connections to the database.
+func (d *DB) WithTenantPools(role string) *DB {
+	d.tenantRole = role
+	d.open = func(dsn string) (*sql.DB, error) { return sql.Open("postgres", dsn) }
+	d.pools = make(map[int]*sql.DB)
+	return d
+}
+
+// CheckRowSecurity fails when the user of the main pool is a superuser or has
+// BYPASSRLS. Row-level security would not apply to statements without a
+// tenant, which could then read and write the rows of every tenant.
+func (d *DB) CheckRowSecurity(ctx context.Context) error {
+	var user string
+	var bypasses bool
+	err := d.DB.QueryRowContext(ctx,
+		`SELECT rolname, rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = current_user`).Scan(&user, &bypasses)
+	if err != nil {
+		return fmt.Errorf("failed to check database user: %w", err)
+	}
+	if bypasses {
+		return fmt.Errorf("database user %s bypasses row-level security; it must not be a superuser or have BYPASSRLS", user)
+	}
+	return nil
+}
+
+// SetMaxOpenConns limits the open connections of the main pool and the
+// tenant pools together
+func (d *DB) SetMaxOpenConns(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.maxOpenConns = n
+	d.balance()
+}
+
+// SetMaxIdleConns limits the idle connections of the main pool and the tenant
+// pools together
+func (d *DB) SetMaxIdleConns(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.maxIdleConns = n
+	d.balance()
+}
+
+// balance splits the connection limits evenly between the main pool and the
+// tenant pools opened so far. Every pool keeps at least one connection, so
+// with more pools than the limit allows the limit is exceeded rather than a
+// tenant starved. Callers hold mu.
+func (d *DB) balance() {
+	pools := len(d.pools) + 1
+	share := func(limit int) int {
+		if limit/pools < 1 {
+			return 1
+		}
+		return limit / pools
+	}
+
+	if d.maxOpenConns != 0 {
+		d.DB.SetMaxOpenConns(share(d.maxOpenConns))
+		for _, pool := range d.pools {
+			pool.SetMaxOpenConns(share(d.maxOpenConns))
+		}
+	}
+	if d.maxIdleConns != 0 {
+		d.DB.SetMaxIdleConns(share(d.maxIdleConns))
+		for _, pool := range d.pools {
+			pool.SetMaxIdleConns(share(d.maxIdleConns))
+		}
+	}
+}
+
+// SetConnMaxLifetime applies to the main pool and every tenant pool
+func (d *DB) SetConnMaxLifetime(lifetime time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.connMaxLifetime = lifetime
+	d.DB.SetConnMaxLifetime(lifetime)
+	for _, pool := range d.pools {
+		pool.SetConnMaxLifetime(lifetime)
+	}
+}
+
+// pool returns the pool statements run with ctx go to
+func (d *DB) pool(ctx context.Context) (*sql.DB, error) {
+	id := tenant.IDFrom(ctx)
+	if id == 0 || d.open == nil {
+		return d.DB, nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if pool, ok := d.pools[id]; ok {
+		return pool, nil
+	}
+	dsn, err := tenantDSN(d.databaseURL, d.tenantRole, id)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := d.open(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database for tenant %d: %w", id, err)
+	}
+	if d.connMaxLifetime != 0 {
+		pool.SetConnMaxLifetime(d.connMaxLifetime)
+	}
+	d.pools[id] = pool
+	d.balance()
+	return pool, nil
+}
+
+// tenantDSN adds the startup options of a tenant session to a connection
+// string in either URL or keyword form
+func tenantDSN(databaseURL, role string, tenantID int) (string, error) {
+	options := fmt.Sprintf("-c %s=%d", TenantSetting, tenantID)
+	if role != "" {
+		options = fmt.Sprintf("-c role=%s %s", role, options)
+	}
+
+	if strings.HasPrefix(databaseURL, "postgres://") || strings.HasPrefix(databaseURL, "postgresql://") {
+		u, err := url.Parse(databaseURL)
+		if err != nil {
+			return "", fmt.Errorf("invalid database url: %w", err)
+		}
+		query := u.Query()
+		if existing := query.Get("options"); existing != "" {
+			options = existing + " " + options
+		}
+		query.Set("options", options)
+		u.RawQuery = query.Encode()
+		return u.String(), nil
+	}
+	if strings.Contains(databaseURL, "options=") {
+		return "", fmt.Errorf("database connection strings with options are only supported in URL form")
+	}
+	return strings.TrimSpace(databaseURL + " options='" + options + "'"), nil
+}
+
+// ExecContext runs on the pool of the tenant in ctx
+func (d *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	pool, err := d.pool(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pool.ExecContext(ctx, query, args...)
+}
+
+// QueryContext runs on the pool of the tenant in ctx
+func (d *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	pool, err := d.pool(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pool.QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext runs on the pool of the tenant in ctx
+func (d *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	pool, err := d.pool(ctx)
+	if err != nil {
+		// sql.Row cannot carry an error of our own. With a cancelled context the
+		// main pool returns one on Scan without running the statement anywhere.
+		log.Printf("Failed to route query: %v", err)
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		return d.DB.QueryRowContext(cancelled, query, args...)
+	}
+	return pool.QueryRowContext(ctx, query, args...)
+}
+
+// BeginTx starts a transaction on the pool of the tenant in ctx
+func (d *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	pool, err := d.pool(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pool.BeginTx(ctx, opts)
+}
+
+// Close closes the main pool and every tenant pool
+func (d *DB) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, pool := range d.pools {
+		pool.Close()
+		delete(d.pools, id)
+	}
+	return d.DB.Close()
 }
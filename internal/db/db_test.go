@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"testing"
 
+	"citynext-appointments/internal/tenant"
+
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -18,7 +20,7 @@ func TestNewDB_Success(t *testing.T) {
 
 	mock.ExpectPing()
 
-	dbInstance := &DB{sqlDB}
+	dbInstance := &DB{DB: sqlDB}
 
 	assert.NotNil(t, dbInstance.DB)
 	assert.IsType(t, &sql.DB{}, dbInstance.DB)
@@ -58,7 +60,7 @@ func TestNewDB_PingFailure(t *testing.T) {
 
 	mock.ExpectPing().WillReturnError(sql.ErrConnDone)
 
-	dbInstance := &DB{sqlDB}
+	dbInstance := &DB{DB: sqlDB}
 
 	err = dbInstance.Ping()
 	assert.Error(t, err)
@@ -72,7 +74,7 @@ func TestDB_EmbeddedMethods(t *testing.T) {
 	require.NoError(t, err)
 	defer sqlDB.Close()
 
-	dbInstance := &DB{sqlDB}
+	dbInstance := &DB{DB: sqlDB}
 
 	t.Run("Close", func(t *testing.T) {
 		assert.NotNil(t, dbInstance.Close)
@@ -119,7 +121,7 @@ func TestDB_ContextMethods(t *testing.T) {
 	require.NoError(t, err)
 	defer sqlDB.Close()
 
-	dbInstance := &DB{sqlDB}
+	dbInstance := &DB{DB: sqlDB}
 	ctx := context.Background()
 
 	t.Run("QueryContext", func(t *testing.T) {
@@ -160,7 +162,7 @@ func TestDB_TransactionMethods(t *testing.T) {
 	require.NoError(t, err)
 	defer sqlDB.Close()
 
-	dbInstance := &DB{sqlDB}
+	dbInstance := &DB{DB: sqlDB}
 	ctx := context.Background()
 
 	t.Run("Begin", func(t *testing.T) {
@@ -187,7 +189,7 @@ func TestDB_PreparedStatements(t *testing.T) {
 	require.NoError(t, err)
 	defer sqlDB.Close()
 
-	dbInstance := &DB{sqlDB}
+	dbInstance := &DB{DB: sqlDB}
 	ctx := context.Background()
 
 	t.Run("Prepare", func(t *testing.T) {
@@ -239,7 +241,7 @@ func BenchmarkDB_QueryRow(b *testing.B) {
 	require.NoError(b, err)
 	defer sqlDB.Close()
 
-	dbInstance := &DB{sqlDB}
+	dbInstance := &DB{DB: sqlDB}
 
 	for i := 0; i < b.N; i++ {
 		mock.ExpectQuery("SELECT 1").
@@ -253,3 +255,109 @@ func BenchmarkDB_QueryRow(b *testing.B) {
 		_ = dbInstance.QueryRow("SELECT 1").Scan(&result)
 	}
 }
+
+func TestDB_TenantPools(t *testing.T) {
+	mainDB, mainMock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mainDB.Close()
+
+	tenantDBs := map[string]*sql.DB{}
+	tenantMocks := map[string]sqlmock.Sqlmock{}
+	for _, id := range []string{"1", "2"} {
+		sqlDB, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer sqlDB.Close()
+		tenantDBs["postgres://app@db/citynext?options=-c+role%3Dcitynext_tenant+-c+citynext.tenant_id%3D"+id] = sqlDB
+		tenantMocks[id] = mock
+	}
+
+	dbInstance := (&DB{DB: mainDB, databaseURL: "postgres://app@db/citynext"}).WithTenantPools("citynext_tenant")
+	dbInstance.open = func(dsn string) (*sql.DB, error) {
+		pool, ok := tenantDBs[dsn]
+		require.True(t, ok, "unexpected tenant dsn %s", dsn)
+		return pool, nil
+	}
+	dbInstance.SetMaxOpenConns(9)
+	dbInstance.SetMaxIdleConns(2)
+	assert.Equal(t, 9, mainDB.Stats().MaxOpenConnections, "the main pool has the budget to itself before any tenant")
+
+	first := tenant.WithTenant(context.Background(), &tenant.Tenant{ID: 1})
+	second := tenant.WithTenant(context.Background(), &tenant.Tenant{ID: 2})
+
+	tenantMocks["1"].ExpectQuery("SELECT id FROM appointments").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+	tenantMocks["2"].ExpectBegin()
+	tenantMocks["2"].ExpectExec("INSERT INTO appointments").WillReturnResult(sqlmock.NewResult(20, 1))
+	tenantMocks["2"].ExpectCommit()
+	tenantMocks["1"].ExpectQuery("SELECT COUNT").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mainMock.ExpectQuery("SELECT id, slug FROM tenants").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "slug"}).AddRow(1, "default"))
+
+	var id int
+	require.NoError(t, dbInstance.QueryRowContext(first, "SELECT id FROM appointments").Scan(&id))
+	assert.Equal(t, 10, id)
+
+	tx, err := dbInstance.BeginTx(second, nil)
+	require.NoError(t, err)
+	_, err = tx.ExecContext(second, "INSERT INTO appointments DEFAULT VALUES")
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	rows, err := dbInstance.QueryContext(first, "SELECT COUNT(*) FROM appointments")
+	require.NoError(t, err)
+	rows.Close()
+
+	rows, err = dbInstance.QueryContext(context.Background(), "SELECT id, slug FROM tenants")
+	require.NoError(t, err)
+	rows.Close()
+
+	assert.Len(t, dbInstance.pools, 2, "each tenant pool is opened once")
+	assert.Equal(t, 3, mainDB.Stats().MaxOpenConnections, "the connection budget is split between the pools")
+	for _, pool := range tenantDBs {
+		assert.Equal(t, 3, pool.Stats().MaxOpenConnections, "the connection budget is split between the pools")
+	}
+	assert.NoError(t, mainMock.ExpectationsWereMet(), "only statements without a tenant reach the main pool")
+	for id, mock := range tenantMocks {
+		assert.NoError(t, mock.ExpectationsWereMet(), "tenant %s", id)
+	}
+}
+
+func TestDB_CheckRowSecurity(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	dbInstance := &DB{DB: sqlDB}
+	check := `SELECT rolname, rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = current_user`
+
+	mock.ExpectQuery(check).WillReturnRows(sqlmock.NewRows([]string{"rolname", "bypasses"}).AddRow("citynext_user", false))
+	assert.NoError(t, dbInstance.CheckRowSecurity(context.Background()))
+
+	// Statements without a tenant would see every tenant's rows
+	mock.ExpectQuery(check).WillReturnRows(sqlmock.NewRows([]string{"rolname", "bypasses"}).AddRow("postgres", true))
+	assert.EqualError(t, dbInstance.CheckRowSecurity(context.Background()),
+		"database user postgres bypasses row-level security; it must not be a superuser or have BYPASSRLS")
+
+	mock.ExpectQuery(check).WillReturnError(sql.ErrConnDone)
+	assert.Error(t, dbInstance.CheckRowSecurity(context.Background()))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTenantDSN(t *testing.T) {
+	dsn, err := tenantDSN("postgres://app:secret@db:5432/citynext?sslmode=disable", "citynext_tenant", 3)
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://app:secret@db:5432/citynext?options=-c+role%3Dcitynext_tenant+-c+citynext.tenant_id%3D3&sslmode=disable", dsn)
+
+	dsn, err = tenantDSN("postgres://db/citynext?options=-c+statement_timeout%3D5000", "", 3)
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://db/citynext?options=-c+statement_timeout%3D5000+-c+citynext.tenant_id%3D3", dsn)
+
+	dsn, err = tenantDSN("host=db dbname=citynext", "citynext_tenant", 3)
+	require.NoError(t, err)
+	assert.Equal(t, "host=db dbname=citynext options='-c role=citynext_tenant -c citynext.tenant_id=3'", dsn)
+
+	_, err = tenantDSN("host=db options='-c statement_timeout=5000'", "citynext_tenant", 3)
+	assert.Error(t, err)
+}
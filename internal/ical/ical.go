@@ -0,0 +1,154 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType is the media type of iCalendar documents
+const ContentType = "text/calendar; charset=utf-8"
+
+// maxLineOctets is the longest content line RFC 5545 allows before folding
+const maxLineOctets = 75
+
+const (
+	dateLayout     = "20060102"
+	dateTimeLayout = "20060102T150405Z"
+)
+
+// Event is an all-day VEVENT
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Date        time.Time
+	// Stamp is when the event was written out
+	Stamp time.Time
+	// Sequence counts the changes since the event was first published and
+	// LastModified is when the latest happened, zero if it never changed
+	Sequence     int
+	LastModified time.Time
+	Cancelled    bool
+}
+
+// Writer writes an iCalendar stream. Errors are sticky and reported by Close.
+type Writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+// NewWriter starts a VCALENDAR named name on w
+func NewWriter(w io.Writer, name string) *Writer {
+	cw := &Writer{w: bufio.NewWriter(w)}
+	cw.line("BEGIN:VCALENDAR")
+	cw.line("VERSION:2.0")
+	cw.line("PRODID:-//CityNext//Appointments//EN")
+	cw.line("CALSCALE:GREGORIAN")
+	cw.line("METHOD:PUBLISH")
+	if name != "" {
+		cw.line("X-WR-CALNAME:" + EscapeText(name))
+	}
+	return cw
+}
+
+// WriteEvent appends one VEVENT
+func (cw *Writer) WriteEvent(e Event) {
+	cw.line("BEGIN:VEVENT")
+	cw.line("UID:" + EscapeText(e.UID))
+	cw.line("DTSTAMP:" + e.Stamp.UTC().Format(dateTimeLayout))
+	cw.line("SEQUENCE:" + strconv.Itoa(e.Sequence))
+	if !e.LastModified.IsZero() {
+		cw.line("LAST-MODIFIED:" + e.LastModified.UTC().Format(dateTimeLayout))
+	}
+	cw.line("DTSTART;VALUE=DATE:" + e.Date.Format(dateLayout))
+	cw.line("DTEND;VALUE=DATE:" + e.Date.AddDate(0, 0, 1).Format(dateLayout))
+	cw.line("SUMMARY:" + EscapeText(e.Summary))
+	if e.Description != "" {
+		cw.line("DESCRIPTION:" + EscapeText(e.Description))
+	}
+	if e.Cancelled {
+		cw.line("STATUS:CANCELLED")
+	} else {
+		cw.line("STATUS:CONFIRMED")
+	}
+	cw.line("TRANSP:OPAQUE")
+	cw.line("END:VEVENT")
+}
+
+// Close ends the VCALENDAR and flushes the output
+func (cw *Writer) Close() error {
+	cw.line("END:VCALENDAR")
+	if cw.err != nil {
+		return cw.err
+	}
+	return cw.w.Flush()
+}
+
+func (cw *Writer) line(content string) {
+	if cw.err != nil {
+		return
+	}
+	_, cw.err = cw.w.WriteString(Fold(content))
+}
+
+// EscapeText escapes a TEXT property value as required by RFC 5545 section 3.3.11
+func EscapeText(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case ';':
+			b.WriteString(`\;`)
+		case ',':
+			b.WriteString(`\,`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			// CRLF and lone CR both become a single escaped newline; the LF
+			// of a CRLF writes it
+			if i+1 == len(s) || s[i+1] != '\n' {
+				b.WriteString(`\n`)
+			}
+		default:
+			if r < 0x20 || r == 0x7f {
+				// Other control characters are not allowed in TEXT values
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Fold splits a content line into CRLF-terminated lines of at most 75 octets,
+// continuing each with a single space and never splitting a UTF-8 sequence
+func Fold(content string) string {
+	var b strings.Builder
+	limit := maxLineOctets
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		b.WriteString(content[:cut])
+		b.WriteString("\r\n ")
+		content = content[cut:]
+		// The leading space of a continuation line counts towards its length
+		limit = maxLineOctets - 1
+	}
+	b.WriteString(content)
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// UID returns the stable identifier of an appointment event, built from the
+// booking reference so the internal id never reaches the citizen's calendar
+func UID(reference, domain string) string {
+	return fmt.Sprintf("appointment-%s@%s", reference, domain)
+}
@@ -0,0 +1,92 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEscapeText(t *testing.T) {
+	assert.Equal(t, `O'Neill\, Siobhán\; a\\b\nnext`, EscapeText("O'Neill, Siobhán; a\\b\r\nnext"))
+	assert.Equal(t, "tab", EscapeText("t\tab"))
+	assert.Equal(t, `a\nb\n`, EscapeText("a\rb\r"), "a lone CR is a line break too")
+}
+
+func TestFold(t *testing.T) {
+	short := "SUMMARY:short"
+	assert.Equal(t, short+"\r\n", Fold(short))
+
+	long := "DESCRIPTION:" + strings.Repeat("é", 60)
+	folded := Fold(long)
+
+	lines := strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n")
+	require.Greater(t, len(lines), 1)
+	for i, line := range lines {
+		assert.LessOrEqual(t, len(line), 75, "line %d is %d octets", i, len(line))
+		assert.True(t, strings.ToValidUTF8(line, "?") == line, "line %d splits a character", i)
+		if i > 0 {
+			assert.True(t, strings.HasPrefix(line, " "))
+		}
+	}
+
+	// Unfolding restores the original line
+	assert.Equal(t, long, strings.ReplaceAll(strings.TrimSuffix(folded, "\r\n"), "\r\n ", ""))
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, "CityNext")
+	w.WriteEvent(Event{
+		UID:         UID("CN-7K4Q-2M9X", "appointments.citynext.example"),
+		Summary:     "CityNext appointment",
+		Description: "Reference: 5",
+		Date:        time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC),
+		Stamp:       time.Date(2075, 6, 1, 10, 30, 0, 0, time.UTC),
+	})
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//CityNext//Appointments//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:CityNext",
+		"BEGIN:VEVENT",
+		"UID:appointment-CN-7K4Q-2M9X@appointments.citynext.example",
+		"DTSTAMP:20750601T103000Z",
+		"SEQUENCE:0",
+		"DTSTART;VALUE=DATE:20750615",
+		"DTEND;VALUE=DATE:20750616",
+		"SUMMARY:CityNext appointment",
+		"DESCRIPTION:Reference: 5",
+		"STATUS:CONFIRMED",
+		"TRANSP:OPAQUE",
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n"), buf.String())
+}
+
+func TestWriter_ChangedEvent(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, "")
+	w.WriteEvent(Event{
+		UID:          UID("CN-7K4Q-2M9X", "appointments.citynext.example"),
+		Summary:      "CityNext appointment",
+		Date:         time.Date(2075, 6, 20, 0, 0, 0, 0, time.UTC),
+		Stamp:        time.Date(2075, 6, 3, 8, 0, 0, 0, time.UTC),
+		Sequence:     2,
+		LastModified: time.Date(2075, 6, 2, 9, 15, 0, 0, time.UTC),
+		Cancelled:    true,
+	})
+	require.NoError(t, w.Close())
+
+	body := buf.String()
+	assert.Contains(t, body, "\r\nSEQUENCE:2\r\nLAST-MODIFIED:20750602T091500Z\r\n")
+	assert.Contains(t, body, "\r\nSTATUS:CANCELLED\r\n")
+}
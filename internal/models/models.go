@@ -4,18 +4,120 @@ import "time"
 
 // Appointment represents a citizen's appointment booking
 type Appointment struct {
-	ID        int       `json:"id" db:"id"`
-	FirstName string    `json:"first_name" db:"first_name"`
-	LastName  string    `json:"last_name" db:"last_name"`
-	VisitDate time.Time `json:"visit_date" db:"visit_date"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	// ID is only shown to staff; the citizen portal identifies bookings by Reference
+	ID int `json:"id,omitempty" db:"id"`
+	// Reference is the code citizens quote, such as CN-7K4Q-2M9X
+	Reference      string     `json:"reference" db:"reference"`
+	FirstName      string     `json:"first_name" db:"first_name"`
+	LastName       string     `json:"last_name" db:"last_name"`
+	Email          string     `json:"email,omitempty" db:"email"`
+	ServiceType    string     `json:"service_type" db:"service_type"`
+	VisitDate      time.Time  `json:"visit_date" db:"visit_date"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	CitizenSubject string     `json:"citizen_subject,omitempty" db:"citizen_subject"`
+	CancelledAt    *time.Time `json:"cancelled_at,omitempty" db:"cancelled_at"`
+	// StaffID is the clerk handling the visit, unset for imported bookings
+	StaffID *int `json:"staff_id,omitempty" db:"staff_id"`
+	// Status is booked, checked_in, completed, no_show or cancelled
+	Status      string     `json:"status" db:"status"`
+	CheckedInAt *time.Time `json:"checked_in_at,omitempty" db:"checked_in_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+	NoShowAt    *time.Time `json:"no_show_at,omitempty" db:"no_show_at"`
+}
+
+// Revision tells calendars how often an appointment changed after it was
+// booked and when it last did, so they replace stale copies of its event
+type Revision struct {
+	Sequence     int
+	LastModified time.Time
 }
 
 // CreateAppointmentRequest is the payload for booking a new appointment
 type CreateAppointmentRequest struct {
-	FirstName string `json:"first_name" binding:"required"`
-	LastName  string `json:"last_name" binding:"required"`
+	FirstName string `json:"first_name" binding:"required,max=100"`
+	LastName  string `json:"last_name" binding:"required,max=100"`
 	VisitDate string `json:"visit_date" binding:"required"`
+	// ServiceType is the code of an active entry in GET /services
+	ServiceType string `json:"service_type" binding:"required,max=50"`
+	// Email is optional and only used for booking notifications
+	Email string `json:"email,omitempty" binding:"omitempty,email,max=254"`
+	// HoldToken books a date previously reserved with POST /holds
+	HoldToken string `json:"hold_token,omitempty" binding:"omitempty,max=64"`
+	// CitizenSubject is taken from the verified bearer token, never from the body
+	CitizenSubject string `json:"-"`
+}
+
+// AppointmentSearchPage is one page of appointments matching a name search,
+// best match first. HasMore tells whether a next page exists at Offset+Limit.
+type AppointmentSearchPage struct {
+	Appointments []Appointment `json:"appointments"`
+	Limit        int           `json:"limit"`
+	Offset       int           `json:"offset"`
+	HasMore      bool          `json:"has_more"`
+}
+
+// DuplicateMatch records a booking taken for a duplicate of an upcoming one and
+// why. AppointmentID is the flagged booking, nil when it was rejected.
+type DuplicateMatch struct {
+	ID                   int       `json:"id"`
+	AppointmentID        *int      `json:"appointment_id"`
+	MatchedAppointmentID int       `json:"matched_appointment_id"`
+	VisitDate            time.Time `json:"visit_date"`
+	Reason               string    `json:"reason"`
+	Action               string    `json:"action"`
+	CreatedAt            time.Time `json:"created_at"`
+}
+
+// ServiceType is a kind of visit in the catalogue, such as a passport renewal.
+// DailyQuota is how many visits of the type fit on one date.
+type ServiceType struct {
+	Code              string   `json:"code" db:"code"`
+	Name              string   `json:"name" db:"name"`
+	DurationMinutes   int      `json:"duration_minutes" db:"duration_minutes"`
+	RequiredDocuments []string `json:"required_documents" db:"required_documents"`
+	DailyQuota        int      `json:"daily_quota" db:"daily_quota"`
+}
+
+// ServiceAvailability is how many visits of a service type can still be booked on a date
+type ServiceAvailability struct {
+	Date      string `json:"date"`
+	Remaining int    `json:"remaining"`
+}
+
+// Staff is a clerk or counter that handles visits
+type Staff struct {
+	ID      int           `json:"id" db:"id"`
+	Name    string        `json:"name" db:"name"`
+	Counter string        `json:"counter,omitempty" db:"counter"`
+	Active  bool          `json:"active" db:"active"`
+	Roster  []RosterShift `json:"roster"`
+}
+
+// RosterShift is how many minutes a staff member works on a weekday, 0 being Sunday
+type RosterShift struct {
+	Weekday int `json:"weekday" db:"weekday" binding:"min=0,max=6"`
+	Minutes int `json:"minutes" db:"minutes" binding:"min=1,max=1440"`
+}
+
+// CreateStaffRequest adds a staff member with their weekly roster
+type CreateStaffRequest struct {
+	Name    string        `json:"name" binding:"required,max=100"`
+	Counter string        `json:"counter" binding:"max=50"`
+	Roster  []RosterShift `json:"roster" binding:"dive"`
+}
+
+// UpdateRosterRequest replaces the weekly roster of a staff member
+type UpdateRosterRequest struct {
+	Roster []RosterShift `json:"roster" binding:"dive"`
+}
+
+// StaffAgenda is one staff member's bookings on a date
+type StaffAgenda struct {
+	Staff           Staff         `json:"staff"`
+	Date            string        `json:"date"`
+	RosteredMinutes int           `json:"rostered_minutes"`
+	BookedMinutes   int           `json:"booked_minutes"`
+	Appointments    []Appointment `json:"appointments"`
 }
 
 // PublicHoliday represents UK public holiday data from the Nager.Date API
@@ -31,6 +133,102 @@ type PublicHoliday struct {
 	Types       []string `json:"types"`
 }
 
+// RescheduleAppointmentRequest moves an existing booking to another date
+type RescheduleAppointmentRequest struct {
+	VisitDate string `json:"visit_date" binding:"required"`
+}
+
+// CreateWebhookRequest registers a partner endpoint for appointment events
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" binding:"required,url,max=2048"`
+	Events []string `json:"events" binding:"required,min=1,dive,oneof=appointment.created appointment.cancelled appointment.rescheduled appointment.checked_in appointment.completed appointment.no_show"`
+	// Secret is generated when omitted
+	Secret string `json:"secret" binding:"omitempty,min=16,max=128"`
+}
+
+// ImportRowError explains why one CSV row was rejected. Row is the line number in the file.
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
+
+// ImportResult summarises a bulk import or dry run
+type ImportResult struct {
+	DryRun   bool             `json:"dry_run"`
+	Rows     int              `json:"rows"`
+	Valid    int              `json:"valid"`
+	Imported int              `json:"imported"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+// WaitlistEntry is a citizen waiting for a booked date to become free.
+// Status moves from waiting to offered, then to accepted or expired.
+type WaitlistEntry struct {
+	ID             int        `json:"id" db:"id"`
+	FirstName      string     `json:"first_name" db:"first_name"`
+	LastName       string     `json:"last_name" db:"last_name"`
+	Email          string     `json:"email,omitempty" db:"email"`
+	ServiceType    string     `json:"service_type" db:"service_type"`
+	VisitDate      time.Time  `json:"visit_date" db:"visit_date"`
+	CitizenSubject string     `json:"citizen_subject,omitempty" db:"citizen_subject"`
+	Status         string     `json:"status" db:"status"`
+	OfferToken     string     `json:"offer_token,omitempty" db:"offer_token"`
+	OfferExpiresAt *time.Time `json:"offer_expires_at,omitempty" db:"offer_expires_at"`
+	AppointmentID  *int       `json:"appointment_id,omitempty" db:"appointment_id"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	// Position is the place in the queue for the date while the entry is waiting
+	Position int `json:"position,omitempty" db:"-"`
+}
+
+// JoinWaitlistRequest is the payload for joining the waitlist of a booked date
+type JoinWaitlistRequest struct {
+	FirstName   string `json:"first_name" binding:"required,max=100"`
+	LastName    string `json:"last_name" binding:"required,max=100"`
+	VisitDate   string `json:"visit_date" binding:"required"`
+	ServiceType string `json:"service_type" binding:"required,max=50"`
+	// Email is optional but without it the citizen is only told about an offer by polling
+	Email string `json:"email,omitempty" binding:"omitempty,email,max=254"`
+	// CitizenSubject is taken from the verified bearer token, never from the body
+	CitizenSubject string `json:"-"`
+}
+
+// SlotHold reserves a date for a short time while the citizen completes a booking
+type SlotHold struct {
+	Token          string    `json:"token" db:"token"`
+	ServiceType    string    `json:"service_type" db:"service_type"`
+	VisitDate      time.Time `json:"visit_date" db:"visit_date"`
+	ExpiresAt      time.Time `json:"expires_at" db:"expires_at"`
+	CitizenSubject string    `json:"-" db:"citizen_subject"`
+}
+
+// CreateHoldRequest is the payload for reserving a date
+type CreateHoldRequest struct {
+	VisitDate   string `json:"visit_date" binding:"required"`
+	ServiceType string `json:"service_type" binding:"required,max=50"`
+	// Minutes defaults to the configured hold time and is capped by the configured maximum
+	Minutes int `json:"minutes,omitempty" binding:"omitempty,min=1"`
+	// CitizenSubject is taken from the verified bearer token, never from the body
+	CitizenSubject string `json:"-"`
+	// APIKeyID is the key the hold was placed with, taken from the request
+	APIKeyID int `json:"-"`
+}
+
+// ClockUpdateRequest is the payload for the admin time-travel endpoint.
+// Action is one of advance, freeze, set or resume.
+type ClockUpdateRequest struct {
+	Action   string `json:"action" binding:"required,oneof=advance freeze set resume"`
+	Duration string `json:"duration,omitempty"`
+	At       string `json:"at,omitempty"`
+}
+
+// ClockResponse reports the simulated time and the shared clock setting
+type ClockResponse struct {
+	Now            time.Time `json:"now"`
+	Mode           string    `json:"mode"`
+	SimulatedEpoch time.Time `json:"simulated_epoch"`
+	RealEpoch      time.Time `json:"real_epoch"`
+}
+
 type ErrorResponse struct {
 	Error   string `json:"error"`
 	Message string `json:"message"`
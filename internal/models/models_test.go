@@ -14,17 +14,20 @@ func TestAppointment_JSONSerialization(t *testing.T) {
 	visitDate := time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC)
 
 	appointment := Appointment{
-		ID:        1,
-		FirstName: "John",
-		LastName:  "Doe",
-		VisitDate: visitDate,
-		CreatedAt: createdAt,
+		ID:          1,
+		Reference:   "CN-7K4Q-2M9X",
+		FirstName:   "John",
+		LastName:    "Doe",
+		ServiceType: "general",
+		VisitDate:   visitDate,
+		CreatedAt:   createdAt,
+		Status:      "booked",
 	}
 
 	jsonData, err := json.Marshal(appointment)
 	require.NoError(t, err)
 
-	expectedJSON := `{"id":1,"first_name":"John","last_name":"Doe","visit_date":"2025-08-15T00:00:00Z","created_at":"2025-07-20T14:30:00Z"}`
+	expectedJSON := `{"id":1,"reference":"CN-7K4Q-2M9X","first_name":"John","last_name":"Doe","service_type":"general","visit_date":"2025-08-15T00:00:00Z","created_at":"2025-07-20T14:30:00Z","status":"booked"}`
 	assert.JSONEq(t, expectedJSON, string(jsonData))
 
 	var unmarshaled Appointment
@@ -32,6 +35,7 @@ func TestAppointment_JSONSerialization(t *testing.T) {
 	require.NoError(t, err)
 
 	assert.Equal(t, appointment.ID, unmarshaled.ID)
+	assert.Equal(t, appointment.Reference, unmarshaled.Reference)
 	assert.Equal(t, appointment.FirstName, unmarshaled.FirstName)
 	assert.Equal(t, appointment.LastName, unmarshaled.LastName)
 	assert.Equal(t, appointment.VisitDate, unmarshaled.VisitDate)
@@ -40,15 +44,16 @@ func TestAppointment_JSONSerialization(t *testing.T) {
 
 func TestCreateAppointmentRequest_JSONSerialization(t *testing.T) {
 	request := CreateAppointmentRequest{
-		FirstName: "Jane",
-		LastName:  "Smith",
-		VisitDate: "2025-08-20",
+		FirstName:   "Jane",
+		LastName:    "Smith",
+		VisitDate:   "2025-08-20",
+		ServiceType: "parking-permit",
 	}
 
 	jsonData, err := json.Marshal(request)
 	require.NoError(t, err)
 
-	expectedJSON := `{"first_name":"Jane","last_name":"Smith","visit_date":"2025-08-20"}`
+	expectedJSON := `{"first_name":"Jane","last_name":"Smith","visit_date":"2025-08-20","service_type":"parking-permit"}`
 	assert.JSONEq(t, expectedJSON, string(jsonData))
 
 	var unmarshaled CreateAppointmentRequest
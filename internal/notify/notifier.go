@@ -0,0 +1,122 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Message is a rendered email with plain text and HTML bodies
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	// From overrides the sender the notifier is configured with when set
+	From string
+}
+
+// Notifier delivers a message to a citizen
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// ErrQueueFull is passed to failure handlers of messages dropped because the queue was full
+var ErrQueueFull = errors.New("notification queue full")
+
+type failureKey struct{}
+
+// OnFailure attaches a handler to ctx that is called when a message sent with
+// it turns out to be undelivered after Send has already returned, such as a
+// queued message the mail server then refused. Errors Send returns itself are
+// not passed to it. The handler runs on the delivering goroutine.
+func OnFailure(ctx context.Context, handle func(err error)) context.Context {
+	return context.WithValue(ctx, failureKey{}, handle)
+}
+
+func failureHandler(ctx context.Context) func(err error) {
+	handle, _ := ctx.Value(failureKey{}).(func(err error))
+	return handle
+}
+
+// queued is a message waiting for delivery with the failure handler of its sender
+type queued struct {
+	msg       Message
+	onFailure func(err error)
+}
+
+// Async queues messages and delivers them on a background worker so that
+// slow or failing mail servers never hold up or fail the request that triggered them
+type Async struct {
+	next    Notifier
+	queue   chan queued
+	timeout time.Duration
+	wg      sync.WaitGroup
+}
+
+// NewAsync wraps next with a queue of the given size
+func NewAsync(next Notifier, queueSize int, timeout time.Duration) *Async {
+	return &Async{
+		next:    next,
+		queue:   make(chan queued, queueSize),
+		timeout: timeout,
+	}
+}
+
+// Send enqueues the message and returns immediately. A full queue drops the
+// message, since a booking must never wait on email. Messages that are dropped
+// or fail later are reported to the handler attached with OnFailure.
+func (a *Async) Send(ctx context.Context, msg Message) error {
+	handle := failureHandler(ctx)
+	select {
+	case a.queue <- queued{msg: msg, onFailure: handle}:
+	default:
+		log.Printf("Notification queue full, dropping message to %s", msg.To)
+		if handle != nil {
+			handle(ErrQueueFull)
+		}
+	}
+	return nil
+}
+
+// Run delivers queued messages until ctx is cancelled, then drains what is left
+func (a *Async) Run(ctx context.Context) {
+	a.wg.Add(1)
+	defer a.wg.Done()
+
+	for {
+		select {
+		case q := <-a.queue:
+			a.deliver(q)
+		case <-ctx.Done():
+			for {
+				select {
+				case q := <-a.queue:
+					a.deliver(q)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// Wait blocks until Run has returned
+func (a *Async) Wait() {
+	a.wg.Wait()
+}
+
+func (a *Async) deliver(q queued) {
+	// Each delivery gets its own deadline; the triggering request has long finished
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+
+	if err := a.next.Send(ctx, q.msg); err != nil {
+		log.Printf("Failed to send %q to %s: %v", q.msg.Subject, q.msg.To, err)
+		if q.onFailure != nil {
+			q.onFailure(err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingNotifier struct {
+	mu   sync.Mutex
+	sent []Message
+	err  error
+}
+
+func (r *recordingNotifier) Send(ctx context.Context, msg Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, msg)
+	return r.err
+}
+
+func (r *recordingNotifier) messages() []Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Message(nil), r.sent...)
+}
+
+func TestAsync_DeliversInBackground(t *testing.T) {
+	next := &recordingNotifier{err: errors.New("smtp down")}
+	async := NewAsync(next, 10, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go async.Run(ctx)
+
+	assert.NoError(t, async.Send(context.Background(), Message{To: "a@example.com"}), "delivery errors are never returned to the caller")
+	assert.NoError(t, async.Send(context.Background(), Message{To: "b@example.com"}))
+
+	assert.Eventually(t, func() bool { return len(next.messages()) == 2 }, time.Second, 10*time.Millisecond)
+
+	cancel()
+	async.Wait()
+}
+
+func TestAsync_DropsWhenFullAndDrainsOnShutdown(t *testing.T) {
+	next := &recordingNotifier{}
+	async := NewAsync(next, 1, time.Second)
+
+	// Not running yet, so the second message does not fit in the queue
+	assert.NoError(t, async.Send(context.Background(), Message{To: "a@example.com"}))
+	assert.NoError(t, async.Send(context.Background(), Message{To: "b@example.com"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	async.Run(ctx)
+
+	assert.Equal(t, []Message{{To: "a@example.com"}}, next.messages())
+}
+
+func TestAsync_ReportsFailures(t *testing.T) {
+	next := &recordingNotifier{err: errors.New("smtp down")}
+	async := NewAsync(next, 1, time.Second)
+
+	var mu sync.Mutex
+	var failed []string
+	reportTo := func(to string) context.Context {
+		return OnFailure(context.Background(), func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, to+": "+err.Error())
+		})
+	}
+
+	assert.NoError(t, async.Send(reportTo("a@example.com"), Message{To: "a@example.com"}))
+	assert.NoError(t, async.Send(reportTo("b@example.com"), Message{To: "b@example.com"}))
+	assert.NoError(t, async.Send(context.Background(), Message{To: "c@example.com"}), "messages without a handler still fail quietly")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	async.Run(ctx)
+
+	assert.Equal(t, []string{"b@example.com: notification queue full", "a@example.com: smtp down"}, failed)
+}
@@ -0,0 +1,157 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// smtpSink is a minimal local SMTP server that records the messages it receives
+type smtpSink struct {
+	listener net.Listener
+	messages chan string
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	sink := &smtpSink{listener: listener, messages: make(chan string, 10)}
+	go sink.serve()
+	t.Cleanup(func() { listener.Close() })
+	return sink
+}
+
+func (s *smtpSink) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpSink) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpSink) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 sink ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 sink")
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.messages <- data.String()
+			reply("250 queued")
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestSMTPNotifier_Send(t *testing.T) {
+	sink := newSMTPSink(t)
+	notifier := NewSMTPNotifier(SMTPConfig{Host: "127.0.0.1", Port: sink.port(), From: "appointments@citynext.example"})
+
+	msg := Message{
+		To:      "john@example.com",
+		Subject: "Your CityNext appointment",
+		Text:    "Plain body",
+		HTML:    "<p>HTML body</p>",
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, notifier.Send(ctx, msg))
+
+	var raw string
+	select {
+	case raw = <-sink.messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sink did not receive a message")
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(raw))
+	require.NoError(t, err)
+	assert.Equal(t, "john@example.com", parsed.Header.Get("To"))
+	assert.Equal(t, "Your CityNext appointment", decodeHeader(t, parsed.Header.Get("Subject")))
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	var bodies []string
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		body, _ := io.ReadAll(part)
+		bodies = append(bodies, part.Header.Get("Content-Type")+"|"+string(body))
+	}
+
+	assert.Equal(t, []string{
+		"text/plain; charset=utf-8|Plain body",
+		"text/html; charset=utf-8|<p>HTML body</p>",
+	}, bodies)
+}
+
+func TestSMTPNotifier_ServerUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	notifier := NewSMTPNotifier(SMTPConfig{Host: "127.0.0.1", Port: port, From: "appointments@citynext.example"})
+
+	err = notifier.Send(context.Background(), Message{To: "john@example.com"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), strconv.Itoa(port))
+}
+
+func decodeHeader(t *testing.T, value string) string {
+	t.Helper()
+	decoded, err := new(mime.WordDecoder).DecodeHeader(value)
+	require.NoError(t, err)
+	return decoded
+}
@@ -0,0 +1,289 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"net/url"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/tenant"
+)
+
+// ReferencePlaceholder is replaced with the booking reference in link templates
+const ReferencePlaceholder = "{reference}"
+
+// TokenPlaceholder is replaced with the offer token in waitlist link templates
+const TokenPlaceholder = "{token}"
+
+// defaultBrand signs emails of tenants without a brand name of their own
+const defaultBrand = "CityNext"
+
+// visitDateFormat is how visit dates are written in emails
+const visitDateFormat = "Monday 2 January 2006"
+
+const confirmationSubject = "Your {{.Brand}} appointment on {{.VisitDate}}"
+
+const confirmationText = `Dear {{.FirstName}} {{.LastName}},
+
+Your appointment at the {{.Brand}} office is confirmed.
+
+Date:      {{.VisitDate}}
+Reference: {{.Reference}}
+
+Please quote your reference when you arrive.
+
+If you can no longer attend, cancel your appointment here so someone else can take the slot:
+{{.CancelURL}}
+
+{{.Brand}} Citizen Services
+`
+
+const confirmationHTML = `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif;">
+<p>Dear {{.FirstName}} {{.LastName}},</p>
+<p>Your appointment at the {{.Brand}} office is confirmed.</p>
+<table>
+<tr><td><strong>Date</strong></td><td>{{.VisitDate}}</td></tr>
+<tr><td><strong>Reference</strong></td><td>{{.Reference}}</td></tr>
+</table>
+<p>Please quote your reference when you arrive.</p>
+<p>If you can no longer attend, <a href="{{.CancelURL}}">cancel your appointment</a> so someone else can take the slot.</p>
+<p>{{.Brand}} Citizen Services</p>
+</body>
+</html>
+`
+
+const reminderSubject = "Reminder: your {{.Brand}} appointment on {{.VisitDate}}"
+
+const reminderText = `Dear {{.FirstName}} {{.LastName}},
+
+This is a reminder of your appointment at the {{.Brand}} office.
+
+Date:      {{.VisitDate}}
+Reference: {{.Reference}}
+
+Please quote your reference when you arrive.
+
+If you can no longer attend, cancel your appointment here so someone else can take the slot:
+{{.CancelURL}}
+
+{{.Brand}} Citizen Services
+`
+
+const reminderHTML = `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif;">
+<p>Dear {{.FirstName}} {{.LastName}},</p>
+<p>This is a reminder of your appointment at the {{.Brand}} office.</p>
+<table>
+<tr><td><strong>Date</strong></td><td>{{.VisitDate}}</td></tr>
+<tr><td><strong>Reference</strong></td><td>{{.Reference}}</td></tr>
+</table>
+<p>Please quote your reference when you arrive.</p>
+<p>If you can no longer attend, <a href="{{.CancelURL}}">cancel your appointment</a> so someone else can take the slot.</p>
+<p>{{.Brand}} Citizen Services</p>
+</body>
+</html>
+`
+
+const waitlistOfferSubject = "A {{.Brand}} appointment on {{.VisitDate}} is available"
+
+const waitlistOfferText = `Dear {{.FirstName}} {{.LastName}},
+
+An appointment on the date you were waiting for has become available and is held for you.
+
+Date:  {{.VisitDate}}
+Until: {{.ExpiresAt}}
+
+To book it, accept the offer here before it expires:
+{{.AcceptURL}}
+
+If you do not accept in time, the date is offered to the next person on the waitlist.
+
+{{.Brand}} Citizen Services
+`
+
+const waitlistOfferHTML = `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif;">
+<p>Dear {{.FirstName}} {{.LastName}},</p>
+<p>An appointment on the date you were waiting for has become available and is held for you.</p>
+<table>
+<tr><td><strong>Date</strong></td><td>{{.VisitDate}}</td></tr>
+<tr><td><strong>Until</strong></td><td>{{.ExpiresAt}}</td></tr>
+</table>
+<p><a href="{{.AcceptURL}}">Accept the offer</a> before it expires to book it.</p>
+<p>If you do not accept in time, the date is offered to the next person on the waitlist.</p>
+<p>{{.Brand}} Citizen Services</p>
+</body>
+</html>
+`
+
+var (
+	confirmationSubjectTmpl = texttemplate.Must(texttemplate.New("subject").Parse(confirmationSubject))
+	confirmationTextTmpl    = texttemplate.Must(texttemplate.New("text").Parse(confirmationText))
+	confirmationHTMLTmpl    = htmltemplate.Must(htmltemplate.New("html").Parse(confirmationHTML))
+
+	reminderSubjectTmpl = texttemplate.Must(texttemplate.New("subject").Parse(reminderSubject))
+	reminderTextTmpl    = texttemplate.Must(texttemplate.New("text").Parse(reminderText))
+	reminderHTMLTmpl    = htmltemplate.Must(htmltemplate.New("html").Parse(reminderHTML))
+
+	waitlistOfferSubjectTmpl = texttemplate.Must(texttemplate.New("subject").Parse(waitlistOfferSubject))
+	waitlistOfferTextTmpl    = texttemplate.Must(texttemplate.New("text").Parse(waitlistOfferText))
+	waitlistOfferHTMLTmpl    = htmltemplate.Must(htmltemplate.New("html").Parse(waitlistOfferHTML))
+)
+
+// appointmentView is the data passed to appointment email templates
+type appointmentView struct {
+	Brand     string
+	FirstName string
+	LastName  string
+	VisitDate string
+	Reference string
+	CancelURL string
+}
+
+// waitlistOfferView is the data passed to waitlist offer templates
+type waitlistOfferView struct {
+	Brand     string
+	FirstName string
+	LastName  string
+	VisitDate string
+	ExpiresAt string
+	AcceptURL string
+}
+
+// Mailer renders appointment emails and hands them to a Notifier
+type Mailer struct {
+	notifier    Notifier
+	cancelURL   string
+	waitlistURL string
+}
+
+// NewMailer creates a mailer. cancelURL is the citizen-facing cancellation page
+// and may contain ReferencePlaceholder.
+func NewMailer(notifier Notifier, cancelURL string) *Mailer {
+	return &Mailer{notifier: notifier, cancelURL: cancelURL}
+}
+
+// SendConfirmation emails the booking confirmation, skipping bookings without an email address
+func (m *Mailer) SendConfirmation(ctx context.Context, appointment *models.Appointment) error {
+	if appointment.Email == "" {
+		return nil
+	}
+
+	msg, err := m.render(ctx, appointment, confirmationSubjectTmpl, confirmationTextTmpl, confirmationHTMLTmpl)
+	if err != nil {
+		return err
+	}
+	return m.notifier.Send(ctx, msg)
+}
+
+// SendReminder emails a reminder of an upcoming visit, skipping bookings without an email address
+func (m *Mailer) SendReminder(ctx context.Context, appointment *models.Appointment, before time.Duration) error {
+	if appointment.Email == "" {
+		return nil
+	}
+
+	msg, err := m.render(ctx, appointment, reminderSubjectTmpl, reminderTextTmpl, reminderHTMLTmpl)
+	if err != nil {
+		return err
+	}
+	return m.notifier.Send(ctx, msg)
+}
+
+// WithWaitlistURL sets the page where waitlist offers are accepted. It may contain TokenPlaceholder.
+func (m *Mailer) WithWaitlistURL(waitlistURL string) *Mailer {
+	m.waitlistURL = waitlistURL
+	return m
+}
+
+// SendWaitlistOffer emails a waitlist offer, skipping entries without an email address
+func (m *Mailer) SendWaitlistOffer(ctx context.Context, entry *models.WaitlistEntry) error {
+	if entry.Email == "" {
+		return nil
+	}
+
+	brand := m.branding(ctx)
+	view := waitlistOfferView{
+		Brand:     brand.Name,
+		FirstName: entry.FirstName,
+		LastName:  entry.LastName,
+		VisitDate: entry.VisitDate.Format(visitDateFormat),
+		AcceptURL: strings.ReplaceAll(brand.WaitlistURL, TokenPlaceholder, url.PathEscape(entry.OfferToken)),
+	}
+	if entry.OfferExpiresAt != nil {
+		view.ExpiresAt = entry.OfferExpiresAt.Format("Monday 2 January 2006 15:04 MST")
+	}
+
+	msg, err := renderMessage(entry.Email, brand.EmailFrom, view, waitlistOfferSubjectTmpl, waitlistOfferTextTmpl, waitlistOfferHTMLTmpl)
+	if err != nil {
+		return err
+	}
+	return m.notifier.Send(ctx, msg)
+}
+
+// branding is how the tenant in ctx signs its emails, falling back to the
+// mailer's own links and the default brand name for anything it leaves unset
+func (m *Mailer) branding(ctx context.Context) tenant.Branding {
+	brand := tenant.Branding{Name: defaultBrand, CancelURL: m.cancelURL, WaitlistURL: m.waitlistURL}
+	if t, ok := tenant.From(ctx); ok {
+		if t.Branding.Name != "" {
+			brand.Name = t.Branding.Name
+		}
+		if t.Branding.CancelURL != "" {
+			brand.CancelURL = t.Branding.CancelURL
+		}
+		if t.Branding.WaitlistURL != "" {
+			brand.WaitlistURL = t.Branding.WaitlistURL
+		}
+		brand.EmailFrom = t.Branding.EmailFrom
+	}
+	return brand
+}
+
+func (m *Mailer) render(ctx context.Context, appointment *models.Appointment, subject, text *texttemplate.Template, html *htmltemplate.Template) (Message, error) {
+	// Rows created before booking references existed fall back to the id
+	reference := appointment.Reference
+	if reference == "" {
+		reference = strconv.Itoa(appointment.ID)
+	}
+	brand := m.branding(ctx)
+	view := appointmentView{
+		Brand:     brand.Name,
+		FirstName: appointment.FirstName,
+		LastName:  appointment.LastName,
+		VisitDate: appointment.VisitDate.Format(visitDateFormat),
+		Reference: reference,
+		CancelURL: strings.ReplaceAll(brand.CancelURL, ReferencePlaceholder, url.PathEscape(reference)),
+	}
+	return renderMessage(appointment.Email, brand.EmailFrom, view, subject, text, html)
+}
+
+func renderMessage(to, from string, view interface{}, subject, text *texttemplate.Template, html *htmltemplate.Template) (Message, error) {
+	var subjectBuf, textBuf, htmlBuf bytes.Buffer
+	if err := subject.Execute(&subjectBuf, view); err != nil {
+		return Message{}, fmt.Errorf("failed to render subject: %w", err)
+	}
+	if err := text.Execute(&textBuf, view); err != nil {
+		return Message{}, fmt.Errorf("failed to render text body: %w", err)
+	}
+	if err := html.Execute(&htmlBuf, view); err != nil {
+		return Message{}, fmt.Errorf("failed to render html body: %w", err)
+	}
+
+	return Message{
+		To:      to,
+		From:    from,
+		Subject: subjectBuf.String(),
+		Text:    textBuf.String(),
+		HTML:    htmlBuf.String(),
+	}, nil
+}
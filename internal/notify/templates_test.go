@@ -0,0 +1,123 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/tenant"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMailer_SendConfirmation(t *testing.T) {
+	next := &recordingNotifier{}
+	mailer := NewMailer(next, "https://portal.citynext.example/appointments/{reference}/cancel")
+
+	appointment := &models.Appointment{
+		ID:        42,
+		FirstName: "Siobhán",
+		LastName:  "O'Neill <script>",
+		Email:     "siobhan@example.com",
+		VisitDate: time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC),
+	}
+
+	require.NoError(t, mailer.SendConfirmation(context.Background(), appointment))
+
+	sent := next.messages()
+	require.Len(t, sent, 1)
+	msg := sent[0]
+
+	assert.Equal(t, "siobhan@example.com", msg.To)
+	assert.Equal(t, "Your CityNext appointment on Saturday 15 June 2075", msg.Subject)
+
+	assert.Contains(t, msg.Text, "Dear Siobhán O'Neill <script>,")
+	assert.Contains(t, msg.Text, "Reference: 42")
+	assert.Contains(t, msg.Text, "https://portal.citynext.example/appointments/42/cancel")
+
+	assert.Contains(t, msg.HTML, "O&#39;Neill &lt;script&gt;", "names must be escaped in HTML")
+	assert.Contains(t, msg.HTML, `href="https://portal.citynext.example/appointments/42/cancel"`)
+}
+
+func TestMailer_SendConfirmation_TenantBranding(t *testing.T) {
+	next := &recordingNotifier{}
+	mailer := NewMailer(next, "https://portal.citynext.example/appointments/{reference}/cancel")
+	ctx := tenant.WithTenant(context.Background(), &tenant.Tenant{ID: 2, Branding: tenant.Branding{
+		Name:      "Glasgow City Council",
+		EmailFrom: "bookings@glasgow.example",
+		CancelURL: "https://glasgow.example/cancel/{reference}",
+	}})
+
+	require.NoError(t, mailer.SendConfirmation(ctx, &models.Appointment{
+		ID: 42, Reference: "CN-7K4Q-2M9X", Email: "siobhan@example.com",
+		VisitDate: time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC),
+	}))
+
+	sent := next.messages()
+	require.Len(t, sent, 1)
+	assert.Equal(t, "bookings@glasgow.example", sent[0].From)
+	assert.Equal(t, "Your Glasgow City Council appointment on Saturday 15 June 2075", sent[0].Subject)
+	assert.Contains(t, sent[0].Text, "https://glasgow.example/cancel/CN-7K4Q-2M9X")
+	assert.NotContains(t, sent[0].Text, "CityNext")
+}
+
+func TestMailer_SkipsAppointmentsWithoutEmail(t *testing.T) {
+	next := &recordingNotifier{}
+	mailer := NewMailer(next, "https://portal.citynext.example/appointments/{reference}/cancel")
+
+	require.NoError(t, mailer.SendConfirmation(context.Background(), &models.Appointment{ID: 1}))
+	assert.Empty(t, next.messages())
+}
+
+func TestMailer_SendReminder(t *testing.T) {
+	next := &recordingNotifier{}
+	mailer := NewMailer(next, "https://portal.citynext.example/appointments/{reference}/cancel")
+
+	appointment := &models.Appointment{
+		ID:        42,
+		Reference: "CN-7K4Q-2M9X",
+		FirstName: "John",
+		LastName:  "Doe",
+		Email:     "john@example.com",
+		VisitDate: time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC),
+	}
+
+	require.NoError(t, mailer.SendReminder(context.Background(), appointment, 72*time.Hour))
+
+	sent := next.messages()
+	require.Len(t, sent, 1)
+	assert.Equal(t, "Reminder: your CityNext appointment on Saturday 15 June 2075", sent[0].Subject)
+	assert.Contains(t, sent[0].Text, "This is a reminder of your appointment")
+	assert.Contains(t, sent[0].Text, "Reference: CN-7K4Q-2M9X")
+	assert.Contains(t, sent[0].HTML, "https://portal.citynext.example/appointments/CN-7K4Q-2M9X/cancel")
+}
+
+func TestMailer_SendWaitlistOffer(t *testing.T) {
+	next := &recordingNotifier{}
+	mailer := NewMailer(next, "https://portal.citynext.example/appointments/{reference}/cancel").
+		WithWaitlistURL("https://portal.citynext.example/waitlist/offers/{token}")
+
+	expiresAt := time.Date(2075, 6, 10, 14, 30, 0, 0, time.UTC)
+	entry := &models.WaitlistEntry{
+		ID:             7,
+		FirstName:      "Jane",
+		LastName:       "Doe",
+		Email:          "jane@example.com",
+		VisitDate:      time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC),
+		OfferToken:     "abc123",
+		OfferExpiresAt: &expiresAt,
+	}
+
+	require.NoError(t, mailer.SendWaitlistOffer(context.Background(), entry))
+	require.NoError(t, mailer.SendWaitlistOffer(context.Background(), &models.WaitlistEntry{ID: 8}))
+
+	sent := next.messages()
+	require.Len(t, sent, 1)
+	assert.Equal(t, "jane@example.com", sent[0].To)
+	assert.Equal(t, "A CityNext appointment on Saturday 15 June 2075 is available", sent[0].Subject)
+	assert.Contains(t, sent[0].Text, "Until: Monday 10 June 2075 14:30 UTC")
+	assert.Contains(t, sent[0].Text, "https://portal.citynext.example/waitlist/offers/abc123")
+	assert.Contains(t, sent[0].HTML, `href="https://portal.citynext.example/waitlist/offers/abc123"`)
+}
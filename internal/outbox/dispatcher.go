@@ -0,0 +1,143 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"citynext-appointments/internal/db"
+)
+
+// minBackoff is the delay before the first retry, doubled on every further failure
+const minBackoff = time.Second
+
+// Dispatcher delivers pending outbox events to its sinks. Events stay pending
+// until every sink accepted them, failed events are retried with exponential
+// backoff, so nothing committed to the outbox is ever lost.
+type Dispatcher struct {
+	db         *db.DB
+	sinks      []Sink
+	batchSize  int
+	maxBackoff time.Duration
+	// Retry timing is about real delivery attempts, never the simulated clock
+	now func() time.Time
+}
+
+func NewDispatcher(database *db.DB, sinks []Sink, batchSize int, maxBackoff time.Duration) *Dispatcher {
+	return &Dispatcher{
+		db:         database,
+		sinks:      sinks,
+		batchSize:  batchSize,
+		maxBackoff: maxBackoff,
+		now:        time.Now,
+	}
+}
+
+// Run dispatches pending events every interval until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := d.DispatchOnce(ctx); err != nil {
+				log.Printf("Outbox dispatch failed: %v", err)
+			}
+		}
+	}
+}
+
+// DispatchOnce delivers one batch of due events and returns how many were delivered.
+// Rows are locked with SKIP LOCKED so several instances can dispatch side by side.
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin dispatch: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := d.now()
+	query := `
+		SELECT id, event_type, aggregate_id, payload, created_at, attempts
+		FROM outbox_events
+		WHERE dispatched_at IS NULL AND next_attempt_at <= $1
+		ORDER BY id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	`
+	rows, err := tx.QueryContext(ctx, query, now, d.batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load pending events: %w", err)
+	}
+
+	var events []Event
+	for rows.Next() {
+		var event Event
+		if err := rows.Scan(&event.ID, &event.Type, &event.AggregateID, &event.Payload, &event.CreatedAt, &event.Attempts); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to read pending event: %w", err)
+		}
+		events = append(events, event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to load pending events: %w", err)
+	}
+
+	delivered := 0
+	for _, event := range events {
+		if deliveryErr := d.deliver(ctx, event); deliveryErr != nil {
+			attempts := event.Attempts + 1
+			retryAt := now.Add(d.backoff(attempts))
+			_, err = tx.ExecContext(ctx,
+				`UPDATE outbox_events SET attempts = $2, next_attempt_at = $3, last_error = $4 WHERE id = $1`,
+				event.ID, attempts, retryAt, deliveryErr.Error())
+			log.Printf("Outbox event %d (%s) failed, attempt %d, retrying at %s: %v",
+				event.ID, event.Type, attempts, retryAt.Format(time.RFC3339), deliveryErr)
+		} else {
+			_, err = tx.ExecContext(ctx,
+				`UPDATE outbox_events SET attempts = attempts + 1, dispatched_at = $2, last_error = NULL WHERE id = $1`,
+				event.ID, now)
+			delivered++
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to record delivery of event %d: %w", event.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit dispatch: %w", err)
+	}
+	return delivered, nil
+}
+
+// deliver hands the event to every sink and reports the sinks that failed
+func (d *Dispatcher) deliver(ctx context.Context, event Event) error {
+	var failures []string
+	for _, sink := range d.sinks {
+		if err := sink.Deliver(ctx, event); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", sink.Name(), err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// backoff returns the delay before the given attempt is retried
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := minBackoff
+	for i := 1; i < attempts && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.maxBackoff {
+		delay = d.maxBackoff
+	}
+	return delay
+}
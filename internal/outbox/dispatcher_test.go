@@ -0,0 +1,109 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/db"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSink struct {
+	mu       sync.Mutex
+	name     string
+	received []Event
+	failFor  map[int64]bool
+}
+
+func (s *recordingSink) Name() string { return s.name }
+
+func (s *recordingSink) Deliver(ctx context.Context, event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.received = append(s.received, event)
+	if s.failFor[event.ID] {
+		return errors.New("unavailable")
+	}
+	return nil
+}
+
+var eventColumns = []string{"id", "event_type", "aggregate_id", "payload", "created_at", "attempts"}
+
+func TestDispatcher_DispatchOnce(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	good := &recordingSink{name: "good"}
+	flaky := &recordingSink{name: "flaky", failFor: map[int64]bool{2: true}}
+
+	dispatcher := NewDispatcher(&db.DB{DB: sqlDB}, []Sink{good, flaky}, 10, time.Minute)
+	dispatcher.now = func() time.Time { return now }
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, event_type, aggregate_id, payload, created_at, attempts FROM outbox_events WHERE dispatched_at IS NULL AND next_attempt_at <= \$1 ORDER BY id LIMIT \$2 FOR UPDATE SKIP LOCKED`).
+		WithArgs(now, 10).
+		WillReturnRows(sqlmock.NewRows(eventColumns).
+			AddRow(1, "appointment.created", 10, []byte(`{"id":10}`), now, 0).
+			AddRow(2, "appointment.cancelled", 11, []byte(`{"id":11}`), now, 2))
+	mock.ExpectExec(`UPDATE outbox_events SET attempts = attempts \+ 1, dispatched_at = \$2, last_error = NULL WHERE id = \$1`).
+		WithArgs(int64(1), now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// Third failed attempt waits 1s * 2^2
+	mock.ExpectExec(`UPDATE outbox_events SET attempts = \$2, next_attempt_at = \$3, last_error = \$4 WHERE id = \$1`).
+		WithArgs(int64(2), 3, now.Add(4*time.Second), "flaky: unavailable").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	delivered, err := dispatcher.DispatchOnce(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	require.Len(t, good.received, 2, "healthy sinks still see every event")
+	assert.Equal(t, "appointment.created", good.received[0].Type)
+	assert.JSONEq(t, `{"id":10}`, string(good.received[0].Payload))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDispatcher_DispatchOnce_QueryError(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	dispatcher := NewDispatcher(&db.DB{DB: sqlDB}, []Sink{LogSink{}}, 10, time.Minute)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT .* FROM outbox_events`).WillReturnError(errors.New("boom"))
+	mock.ExpectRollback()
+
+	_, err = dispatcher.DispatchOnce(context.Background())
+
+	assert.EqualError(t, err, "failed to load pending events: boom")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDispatcher_Backoff(t *testing.T) {
+	dispatcher := NewDispatcher(nil, nil, 10, 30*time.Second)
+
+	testCases := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{5, 16 * time.Second},
+		{6, 30 * time.Second},
+		{50, 30 * time.Second},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, dispatcher.backoff(tc.attempts), "attempt %d", tc.attempts)
+	}
+}
@@ -0,0 +1,112 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"citynext-appointments/internal/pii"
+)
+
+// Event is a domain event recorded in the outbox
+type Event struct {
+	ID          int64           `json:"id"`
+	Type        string          `json:"type"`
+	AggregateID int             `json:"aggregate_id"`
+	Payload     json.RawMessage `json:"payload"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Attempts    int             `json:"-"`
+}
+
+// Execer is satisfied by *sql.Tx, so events can be written alongside the change they describe
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Enqueue records an event. Call it with the transaction that makes the change so
+// the event is stored if and only if the change is committed. Names in the
+// payload are sealed like everywhere else they are stored, and opened again
+// only when they leave the service.
+func Enqueue(ctx context.Context, exec Execer, eventType string, aggregateID int, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+	if body, err = pii.MapNames(body, pii.Seal); err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	query := `INSERT INTO outbox_events (event_type, aggregate_id, payload) VALUES ($1, $2, $3)`
+	if _, err := exec.ExecContext(ctx, query, eventType, aggregateID, body); err != nil {
+		return fmt.Errorf("failed to enqueue %s event: %w", eventType, err)
+	}
+	return nil
+}
+
+// RewrapNames seals the names in up to limit event payloads after afterID with
+// the primary key of keyring, for key rotation. It returns the number of events
+// rewritten and the last id looked at, which is afterID once the outbox is done.
+func RewrapNames(ctx context.Context, tx *sql.Tx, keyring *pii.Keyring, afterID int64, limit int) (int, int64, error) {
+	query := `SELECT id, payload FROM outbox_events WHERE id > $1 ORDER BY id LIMIT $2 FOR UPDATE`
+	rows, err := tx.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to rewrap names in events: %w", err)
+	}
+	type stored struct {
+		id      int64
+		payload []byte
+	}
+	var events []stored
+	for rows.Next() {
+		var e stored
+		if err := rows.Scan(&e.id, &e.payload); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("failed to rewrap names in events: %w", err)
+		}
+		events = append(events, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("failed to rewrap names in events: %w", err)
+	}
+
+	rewritten := 0
+	lastID := afterID
+	for _, e := range events {
+		lastID = e.id
+		payload, err := pii.MapNames(e.payload, keyring.Refresh)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to rewrap names in event %d: %w", e.id, err)
+		}
+		if bytes.Equal(payload, e.payload) {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE outbox_events SET payload = $2 WHERE id = $1`, e.id, payload); err != nil {
+			return 0, 0, fmt.Errorf("failed to rewrap names in event %d: %w", e.id, err)
+		}
+		rewritten++
+	}
+	return rewritten, lastID, nil
+}
+
+// Sink receives dispatched events. Delivery is at-least-once: an event may be
+// delivered again after a crash or when another sink failed, so sinks should
+// de-duplicate on Event.ID.
+type Sink interface {
+	Name() string
+	Deliver(ctx context.Context, event Event) error
+}
+
+// LogSink writes every event to the application log, names sealed as stored
+type LogSink struct{}
+
+func (LogSink) Name() string { return "log" }
+
+func (LogSink) Deliver(ctx context.Context, event Event) error {
+	log.Printf("Outbox event %d: %s appointment=%d %s", event.ID, event.Type, event.AggregateID, event.Payload)
+	return nil
+}
@@ -0,0 +1,87 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"citynext-appointments/internal/pii"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnqueue(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	mock.ExpectExec(`INSERT INTO outbox_events \(event_type, aggregate_id, payload\) VALUES \(\$1, \$2, \$3\)`).
+		WithArgs("appointment.created", 7, []byte(`{"id":7}`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err = Enqueue(context.Background(), sqlDB, "appointment.created", 7, map[string]int{"id": 7})
+
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// sealedPayload matches a payload whose first name is sealed and opens to want
+type sealedPayload struct {
+	keyring *pii.Keyring
+	want    string
+}
+
+func (m sealedPayload) Match(v driver.Value) bool {
+	body, ok := v.([]byte)
+	if !ok {
+		return false
+	}
+	var fields struct {
+		FirstName string `json:"first_name"`
+	}
+	if json.Unmarshal(body, &fields) != nil || !pii.IsSealed(fields.FirstName) {
+		return false
+	}
+	opened, err := m.keyring.Open(fields.FirstName)
+	return err == nil && opened == m.want
+}
+
+func TestEnqueue_SealsNames(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	keyring, err := pii.NewKeyring(map[string][]byte{
+		"2075-06": bytes.Repeat([]byte{2}, pii.KeySize),
+		"index":   bytes.Repeat([]byte{3}, pii.KeySize),
+	}, "2075-06", "index")
+	require.NoError(t, err)
+	pii.Use(keyring)
+	defer pii.Use(nil)
+
+	mock.ExpectExec(`INSERT INTO outbox_events`).
+		WithArgs("appointment.created", 7, sealedPayload{keyring, "John"}).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err = Enqueue(context.Background(), sqlDB, "appointment.created", 7, map[string]interface{}{"id": 7, "first_name": "John"})
+
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEnqueue_Error(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	mock.ExpectExec(`INSERT INTO outbox_events`).WillReturnError(errors.New("boom"))
+
+	err = Enqueue(context.Background(), sqlDB, "appointment.cancelled", 7, nil)
+
+	assert.EqualError(t, err, "failed to enqueue appointment.cancelled event: boom")
+}
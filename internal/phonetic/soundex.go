@@ -0,0 +1,89 @@
+// Package phonetic compares names the way people misspell them: Normalise
+// ignores case, accents, punctuation and spacing, and Soundex computes the key
+// names are found by when they sound alike, so "Oneil" finds "O'Neill". Because
+// of the normalisation the codes differ from PostgreSQL's soundex() for names
+// with accents or apostrophes, so stored keys must come from this package.
+package phonetic
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// letters spells out letters that have no accent to drop
+var letters = strings.NewReplacer("ß", "ss", "æ", "ae", "œ", "oe", "ø", "o", "ł", "l", "đ", "d", "ð", "d", "þ", "th")
+
+// separators are read as spaces, apostrophes are dropped
+var separators = strings.NewReplacer("-", " ", "'", "", "’", "")
+
+// Normalise returns name in lower case without accents, apostrophes or extra
+// spaces, so "  José  O’Brien-Smith" becomes "jose obrien smith"
+func Normalise(name string) string {
+	// A transformer keeps state, so every call needs its own
+	fold := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(fold, strings.ToLower(name))
+	if err != nil {
+		folded = strings.ToLower(name)
+	}
+	return strings.Join(strings.Fields(separators.Replace(letters.Replace(folded))), " ")
+}
+
+// codes holds the Soundex digit of every letter from A to Z. Vowels and H, W
+// and Y are 0: they separate letters but are not coded themselves.
+const codes = "01230120022455012623010202"
+
+// length is the length of every Soundex code
+const length = 4
+
+// Soundex returns the four character Soundex code of name, such as O540 for
+// both O'Neill and Oneil, or "" when name has no letters. The name is
+// normalised first, so accented letters count as the letters they carry and an
+// apostrophe no longer separates two letters with the same digit.
+func Soundex(name string) string {
+	name = Normalise(name)
+	start := 0
+	for start < len(name) && !isLetter(name[start]) {
+		start++
+	}
+	if start == len(name) {
+		return ""
+	}
+
+	code := []byte{upper(name[start])}
+	for i := start + 1; i < len(name) && len(code) < length; i++ {
+		if !isLetter(name[i]) || digit(name[i]) == digit(name[i-1]) {
+			continue
+		}
+		if d := digit(name[i]); d != '0' {
+			code = append(code, d)
+		}
+	}
+	for len(code) < length {
+		code = append(code, '0')
+	}
+	return string(code)
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
+
+func upper(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
+
+// digit returns the Soundex digit of a letter and any other byte unchanged, so
+// a letter after a skipped character is always coded
+func digit(c byte) byte {
+	if !isLetter(c) {
+		return c
+	}
+	return codes[upper(c)-'A']
+}
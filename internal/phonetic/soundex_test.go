@@ -0,0 +1,54 @@
+package phonetic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSoundex(t *testing.T) {
+	testCases := []struct {
+		name string
+		want string
+	}{
+		{"O'Neill", "O540"},
+		{"Oneil", "O540"},
+		{"Robert", "R163"},
+		{"Rupert", "R163"},
+		{"Smith", "S530"},
+		{"Smyth", "S530"},
+		{"Pfister", "P236"},
+		{"Lee", "L000"},
+		{"  müller", "M460"},
+		{"Émile", "E540"},
+		{"Pat'Tee", "P300"},
+		{"", ""},
+		{"123", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, Soundex(tc.name))
+		})
+	}
+}
+
+func TestNormalise(t *testing.T) {
+	testCases := []struct {
+		name string
+		want string
+	}{
+		{"John", "john"},
+		{"  José  O’Brien-Smith ", "jose obrien smith"},
+		{"MÜLLER", "muller"},
+		{"Strauß", "strauss"},
+		{"Søren\tKierkegaard", "soren kierkegaard"},
+		{"Zoë", "zoe"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, Normalise(tc.name))
+		})
+	}
+}
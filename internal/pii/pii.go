@@ -0,0 +1,345 @@
+// Package pii encrypts citizen names before they are stored. Every value gets
+// its own random data key, which encrypts the value with AES-256-GCM and is
+// itself encrypted ("wrapped") with a key encryption key from the keyring. A
+// stored value looks like
+//
+//	pii:v1:<key id>:<wrapped data key>:<encrypted value>
+//
+// Rotating the key encryption key only rewraps the small data key; values
+// sealed with older keys stay readable as long as those keys are in the
+// keyring. Exact-match lookups use a blind index, an HMAC of the normalised
+// value under a separate index key, as the ciphertext differs every time.
+//
+// Until a keyring is installed with Use, values are stored as they are, and
+// values written before encryption was turned on are read back unchanged.
+package pii
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// sealedPrefix starts every encrypted value
+const sealedPrefix = "pii:v1:"
+
+// KeySize is the length of every key, AES-256 and HMAC-SHA256 alike
+const KeySize = 32
+
+// ErrNoKeys is returned when an encrypted value is read without a keyring
+var ErrNoKeys = errors.New("value is encrypted but no encryption keys are configured")
+
+var encoding = base64.RawStdEncoding
+
+// active is the keyring installed with Use, nil while names are stored in plaintext
+var active *Keyring
+
+// Use installs the keyring every name is sealed and opened with. Call it once
+// at startup, before the first query; nil turns encryption off.
+func Use(k *Keyring) {
+	active = k
+}
+
+// Active returns the installed keyring, or nil
+func Active() *Keyring {
+	return active
+}
+
+// Seal encrypts value with the installed keyring, or returns it unchanged without one
+func Seal(value string) (string, error) {
+	if active == nil {
+		return value, nil
+	}
+	return active.Seal(value)
+}
+
+// Open decrypts a value read from the database. Values that were never sealed
+// are returned unchanged.
+func Open(stored string) (string, error) {
+	if !IsSealed(stored) {
+		return stored, nil
+	}
+	if active == nil {
+		return "", ErrNoKeys
+	}
+	return active.Open(stored)
+}
+
+// BlindIndex returns the blind index of value with the installed keyring, or
+// NULL without one
+func BlindIndex(value string) sql.NullString {
+	if active == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: active.BlindIndex(value), Valid: true}
+}
+
+// nameFields are the fields of appointment JSON that hold citizen names
+var nameFields = []string{"first_name", "last_name"}
+
+// MapNames applies fn to the names in a JSON object of appointment fields, such
+// as Seal before it is stored or Open after it is read, and returns values
+// unchanged when it holds no names
+func MapNames(values []byte, fn func(string) (string, error)) ([]byte, error) {
+	if values == nil {
+		return nil, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(values, &fields); err != nil {
+		return nil, err
+	}
+	changed := false
+	for _, name := range nameFields {
+		var value string
+		if raw, ok := fields[name]; !ok || json.Unmarshal(raw, &value) != nil {
+			continue
+		}
+		mapped, err := fn(value)
+		if err != nil {
+			return nil, err
+		}
+		if mapped == value {
+			continue
+		}
+		if fields[name], err = json.Marshal(mapped); err != nil {
+			return nil, err
+		}
+		changed = true
+	}
+	if !changed {
+		return values, nil
+	}
+	return json.Marshal(fields)
+}
+
+// Keyring holds the key encryption keys by id, the id of the one new values
+// are sealed with, and the blind index key
+type Keyring struct {
+	keys     map[string]cipher.AEAD
+	primary  string
+	indexKey []byte
+}
+
+// NewKeyring builds a keyring from keys by id. primary names the key new
+// values are sealed with and index the key blind indexes are computed with.
+// The index key cannot be rotated without recomputing every index, so it
+// should not be used for sealing.
+func NewKeyring(keys map[string][]byte, primary, index string) (*Keyring, error) {
+	k := &Keyring{keys: map[string]cipher.AEAD{}, primary: primary}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid key id %q", id)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("key %q must be %d bytes", id, KeySize)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[id] = aead
+	}
+	if _, ok := k.keys[primary]; !ok {
+		return nil, fmt.Errorf("primary key %q is not in the keyring", primary)
+	}
+	indexKey, ok := keys[index]
+	if !ok {
+		return nil, fmt.Errorf("index key %q is not in the keyring", index)
+	}
+	if index == primary {
+		return nil, fmt.Errorf("the index key must differ from the primary key")
+	}
+	k.indexKey = indexKey
+	return k, nil
+}
+
+// ParseKeys reads keys written as "id:base64-key", one per line or separated
+// by commas. Blank lines and lines starting with # are ignored.
+func ParseKeys(r io.Reader) (map[string][]byte, error) {
+	keys := map[string][]byte{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, entry := range strings.Split(line, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			id, encoded, ok := strings.Cut(entry, ":")
+			if !ok {
+				return nil, fmt.Errorf("key entry must be id:base64-key")
+			}
+			id = strings.TrimSpace(id)
+			key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+			if err != nil {
+				return nil, fmt.Errorf("key %q is not valid base64", id)
+			}
+			if _, dup := keys[id]; dup {
+				return nil, fmt.Errorf("key %q is listed twice", id)
+			}
+			keys[id] = key
+		}
+	}
+	return keys, scanner.Err()
+}
+
+// Seal encrypts value under a new data key wrapped with the primary key
+func (k *Keyring) Seal(value string) (string, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+	wrapped, err := seal(k.keys[k.primary], dataKey)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(aead, []byte(value))
+	if err != nil {
+		return "", err
+	}
+	return sealedPrefix + k.primary + ":" + encoding.EncodeToString(wrapped) + ":" + encoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a stored value. Values that were never sealed are returned unchanged.
+func (k *Keyring) Open(stored string) (string, error) {
+	if !IsSealed(stored) {
+		return stored, nil
+	}
+	id, wrapped, sealed, err := split(stored)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := k.unwrap(id, wrapped)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	value, err := open(aead, sealed)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return string(value), nil
+}
+
+// Current reports whether stored is sealed with the primary key
+func (k *Keyring) Current(stored string) bool {
+	return strings.HasPrefix(stored, sealedPrefix+k.primary+":")
+}
+
+// Rewrap returns stored sealed with the primary key. Values sealed with an
+// older key keep their data key and ciphertext, only the data key is wrapped
+// again; values that were never sealed are sealed now.
+func (k *Keyring) Rewrap(stored string) (string, error) {
+	if !IsSealed(stored) {
+		return k.Seal(stored)
+	}
+	id, wrapped, sealed, err := split(stored)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := k.unwrap(id, wrapped)
+	if err != nil {
+		return "", err
+	}
+	rewrapped, err := seal(k.keys[k.primary], dataKey)
+	if err != nil {
+		return "", err
+	}
+	return sealedPrefix + k.primary + ":" + encoding.EncodeToString(rewrapped) + ":" + encoding.EncodeToString(sealed), nil
+}
+
+// Refresh returns stored sealed with the primary key, for key rotation: values
+// already sealed with it are returned unchanged, others are rewrapped or sealed
+func (k *Keyring) Refresh(stored string) (string, error) {
+	if k.Current(stored) {
+		return stored, nil
+	}
+	return k.Rewrap(stored)
+}
+
+// BlindIndex returns the HMAC of value for exact-match lookups. Case and
+// surrounding whitespace are ignored, so "Doe" and " doe" match.
+func (k *Keyring) BlindIndex(value string) string {
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(value))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IsSealed reports whether stored is an encrypted value
+func IsSealed(stored string) bool {
+	return strings.HasPrefix(stored, sealedPrefix)
+}
+
+func (k *Keyring) unwrap(id string, wrapped []byte) ([]byte, error) {
+	kek, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("value is encrypted with unknown key %q", id)
+	}
+	dataKey, err := open(kek, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+func split(stored string) (string, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(stored, sealedPrefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value")
+	}
+	wrapped, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value")
+	}
+	sealed, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value")
+	}
+	return parts[0], wrapped, sealed, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with a random nonce and returns nonce and ciphertext
+func seal(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(aead cipher.AEAD, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
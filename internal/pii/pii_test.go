@@ -0,0 +1,163 @@
+package pii
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKeyring(t *testing.T, primary string) *Keyring {
+	t.Helper()
+	keyring, err := NewKeyring(map[string][]byte{
+		"2075-01": bytes.Repeat([]byte{1}, KeySize),
+		"2075-06": bytes.Repeat([]byte{2}, KeySize),
+		"index":   bytes.Repeat([]byte{3}, KeySize),
+	}, primary, "index")
+	require.NoError(t, err)
+	return keyring
+}
+
+func TestKeyring_SealOpen(t *testing.T) {
+	keyring := testKeyring(t, "2075-06")
+
+	sealed, err := keyring.Seal("Jürgen")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(sealed, "pii:v1:2075-06:"))
+	assert.NotContains(t, sealed, "Jürgen")
+
+	again, err := keyring.Seal("Jürgen")
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, again, "every value gets its own data key and nonce")
+
+	opened, err := keyring.Open(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "Jürgen", opened)
+
+	plain, err := keyring.Open("Erased")
+	require.NoError(t, err)
+	assert.Equal(t, "Erased", plain, "values stored before encryption are read as they are")
+}
+
+func TestKeyring_OpenRejectsTampering(t *testing.T) {
+	keyring := testKeyring(t, "2075-06")
+	sealed, err := keyring.Seal("John")
+	require.NoError(t, err)
+
+	tampered := sealed[:len(sealed)-2] + "AA"
+	if tampered == sealed {
+		tampered = sealed[:len(sealed)-2] + "BB"
+	}
+	_, err = keyring.Open(tampered)
+	assert.Error(t, err)
+
+	_, err = keyring.Open("pii:v1:2075-06:broken")
+	assert.Error(t, err)
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	old := testKeyring(t, "2075-01")
+	sealed, err := old.Seal("John")
+	require.NoError(t, err)
+
+	current := testKeyring(t, "2075-06")
+	assert.False(t, current.Current(sealed))
+
+	rewrapped, err := current.Rewrap(sealed)
+	require.NoError(t, err)
+	assert.True(t, current.Current(rewrapped))
+	assert.Equal(t, sealed[strings.LastIndex(sealed, ":"):], rewrapped[strings.LastIndex(rewrapped, ":"):],
+		"only the data key is rewrapped")
+
+	opened, err := current.Open(rewrapped)
+	require.NoError(t, err)
+	assert.Equal(t, "John", opened)
+
+	sealedPlain, err := current.Rewrap("Jane")
+	require.NoError(t, err)
+	assert.True(t, current.Current(sealedPlain), "plaintext values are sealed")
+
+	retired, err := NewKeyring(map[string][]byte{
+		"2075-06": bytes.Repeat([]byte{2}, KeySize),
+		"index":   bytes.Repeat([]byte{3}, KeySize),
+	}, "2075-06", "index")
+	require.NoError(t, err)
+	_, err = retired.Open(sealed)
+	assert.ErrorContains(t, err, `unknown key "2075-01"`)
+}
+
+func TestKeyring_BlindIndex(t *testing.T) {
+	keyring := testKeyring(t, "2075-06")
+
+	assert.Equal(t, keyring.BlindIndex("Doe"), keyring.BlindIndex(" doe "))
+	assert.NotEqual(t, keyring.BlindIndex("Doe"), keyring.BlindIndex("Roe"))
+	assert.Len(t, keyring.BlindIndex("Doe"), 64)
+	assert.Equal(t, keyring.BlindIndex("Doe"), testKeyring(t, "2075-01").BlindIndex("Doe"),
+		"rotating the primary key leaves the index alone")
+}
+
+func TestNewKeyring_Invalid(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, KeySize)
+	index := bytes.Repeat([]byte{3}, KeySize)
+
+	testCases := []struct {
+		name    string
+		keys    map[string][]byte
+		primary string
+		index   string
+	}{
+		{"short key", map[string][]byte{"a": key[:16], "index": index}, "a", "index"},
+		{"missing primary", map[string][]byte{"a": key, "index": index}, "b", "index"},
+		{"missing index", map[string][]byte{"a": key}, "a", "index"},
+		{"index used for sealing", map[string][]byte{"a": key}, "a", "a"},
+		{"colon in id", map[string][]byte{"a:b": key, "index": index}, "a:b", "index"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewKeyring(tc.keys, tc.primary, tc.index)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys(strings.NewReader(`
+# retired in 2075-06, keep until rotated
+2075-01: AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=
+2075-06:AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI=,index:AwMDAwMDAwMDAwMDAwMDAwMDAwMDAwMDAwMDAwMDAwM=
+`))
+	require.NoError(t, err)
+	assert.Len(t, keys, 3)
+	assert.Equal(t, bytes.Repeat([]byte{2}, KeySize), keys["2075-06"])
+
+	_, err = ParseKeys(strings.NewReader("a:not base64!"))
+	assert.Error(t, err)
+	_, err = ParseKeys(strings.NewReader("a:AQ==,a:AQ=="))
+	assert.Error(t, err)
+}
+
+func TestPackageFunctions_WithoutKeyring(t *testing.T) {
+	Use(nil)
+
+	stored, err := Seal("John")
+	require.NoError(t, err)
+	assert.Equal(t, "John", stored)
+	assert.False(t, BlindIndex("John").Valid)
+
+	_, err = Open("pii:v1:2075-06:x:y")
+	assert.ErrorIs(t, err, ErrNoKeys)
+
+	keyring := testKeyring(t, "2075-06")
+	Use(keyring)
+	defer Use(nil)
+
+	stored, err = Seal("John")
+	require.NoError(t, err)
+	opened, err := Open(stored)
+	require.NoError(t, err)
+	assert.Equal(t, "John", opened)
+	assert.Equal(t, keyring.BlindIndex("John"), BlindIndex("John").String)
+}
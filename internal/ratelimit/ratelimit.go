@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// bucket is a single client's token bucket
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// Limiter is an in-memory token bucket limiter keyed by client. Each client may
+// make burst requests at once and then rate requests per second on average.
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	rate    float64
+	burst   float64
+	now     func() time.Time
+}
+
+// New creates a limiter allowing rate requests per second with the given burst
+func New(rate float64, burst int) *Limiter {
+	return &Limiter{
+		buckets: make(map[string]*bucket),
+		rate:    rate,
+		burst:   float64(burst),
+		// Rate limits are about real request volume, never the simulated clock
+		now: time.Now,
+	}
+}
+
+// Allow takes a token for key. When none is left it returns false and how long
+// the client has to wait before the next request will be accepted.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, lastSeen: now}
+		l.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.lastSeen).Seconds()
+	b.tokens = math.Min(l.burst, b.tokens+elapsed*l.rate)
+	b.lastSeen = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// Cleanup forgets clients that have been idle long enough to have a full bucket again
+func (l *Limiter) Cleanup() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	cutoff := l.now().Add(-full)
+	for key, b := range l.buckets {
+		if b.lastSeen.Before(cutoff) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Run cleans up idle clients every interval until ctx is cancelled
+func (l *Limiter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.Cleanup()
+		}
+	}
+}
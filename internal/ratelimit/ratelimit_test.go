@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLimiter(rate float64, burst int) (*Limiter, func(d time.Duration)) {
+	l := New(rate, burst)
+	now := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	return l, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestLimiter_BurstThenRefill(t *testing.T) {
+	l, tick := newTestLimiter(1, 3)
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("client")
+		assert.True(t, ok, "request %d should fit in the burst", i+1)
+	}
+
+	ok, wait := l.Allow("client")
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, wait)
+
+	tick(500 * time.Millisecond)
+	ok, wait = l.Allow("client")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	tick(500 * time.Millisecond)
+	ok, _ = l.Allow("client")
+	assert.True(t, ok)
+}
+
+func TestLimiter_ClientsAreIndependent(t *testing.T) {
+	l, _ := newTestLimiter(1, 1)
+
+	ok, _ := l.Allow("a")
+	assert.True(t, ok)
+	ok, _ = l.Allow("a")
+	assert.False(t, ok)
+
+	ok, _ = l.Allow("b")
+	assert.True(t, ok)
+}
+
+func TestLimiter_Cleanup(t *testing.T) {
+	l, tick := newTestLimiter(1, 2)
+
+	l.Allow("idle")
+	tick(time.Second)
+	l.Allow("active")
+	tick(1500 * time.Millisecond)
+
+	l.Cleanup()
+
+	assert.NotContains(t, l.buckets, "idle")
+	assert.Contains(t, l.buckets, "active")
+}
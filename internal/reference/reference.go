@@ -0,0 +1,90 @@
+// Package reference generates and checks the booking references citizens quote,
+// such as CN-7K4Q-2M9X. References use Crockford's base32 alphabet, which has
+// no I, L, O or U, so they are easy to read out over the phone. Seven random
+// symbols are followed by a Luhn mod 32 check symbol that catches any single
+// mistyped symbol and most swapped neighbours.
+package reference
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Prefix starts every reference
+const Prefix = "CN"
+
+// alphabet is Crockford's base32 alphabet
+const alphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+const (
+	randomSymbols = 7
+	codeSymbols   = randomSymbols + 1
+)
+
+// ErrInvalid is returned for text that is not a well-formed reference
+var ErrInvalid = errors.New("invalid booking reference")
+
+// Generate returns a new random reference. Uniqueness is enforced by the
+// database, callers retry on the rare collision.
+func Generate() (string, error) {
+	random := make([]byte, randomSymbols)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to generate reference: %w", err)
+	}
+
+	symbols := make([]byte, codeSymbols)
+	for i, b := range random {
+		// 256 is a multiple of 32, so every symbol is equally likely
+		symbols[i] = alphabet[b&31]
+	}
+	symbols[randomSymbols] = alphabet[checkValue(symbols[:randomSymbols])]
+	return format(symbols), nil
+}
+
+// Parse normalises what a citizen typed into the canonical form. Case,
+// spaces, hyphens and the CN prefix are optional, and the letters O, I and L
+// are read as the digits they are mistaken for.
+func Parse(input string) (string, error) {
+	s := strings.ToUpper(input)
+	s = strings.NewReplacer("-", "", " ", "").Replace(s)
+	if len(s) == len(Prefix)+codeSymbols && strings.HasPrefix(s, Prefix) {
+		s = s[len(Prefix):]
+	}
+	if len(s) != codeSymbols {
+		return "", ErrInvalid
+	}
+
+	symbols := []byte(strings.NewReplacer("O", "0", "I", "1", "L", "1").Replace(s))
+	for _, c := range symbols {
+		if strings.IndexByte(alphabet, c) < 0 {
+			return "", ErrInvalid
+		}
+	}
+	if alphabet[checkValue(symbols[:randomSymbols])] != symbols[randomSymbols] {
+		return "", ErrInvalid
+	}
+	return format(symbols), nil
+}
+
+// checkValue computes the Luhn mod 32 check value of the payload symbols
+func checkValue(payload []byte) int {
+	const n = len(alphabet)
+	factor := 2
+	sum := 0
+	for i := len(payload) - 1; i >= 0; i-- {
+		addend := factor * strings.IndexByte(alphabet, payload[i])
+		sum += addend/n + addend%n
+		if factor == 2 {
+			factor = 1
+		} else {
+			factor = 2
+		}
+	}
+	return (n - sum%n) % n
+}
+
+func format(symbols []byte) string {
+	return Prefix + "-" + string(symbols[:4]) + "-" + string(symbols[4:])
+}
@@ -0,0 +1,76 @@
+package reference
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var referencePattern = regexp.MustCompile(`^CN-[0-9A-HJKMNP-TV-Z]{4}-[0-9A-HJKMNP-TV-Z]{4}$`)
+
+func TestGenerate(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		ref, err := Generate()
+		require.NoError(t, err)
+		assert.Regexp(t, referencePattern, ref)
+
+		parsed, err := Parse(ref)
+		require.NoError(t, err)
+		assert.Equal(t, ref, parsed)
+
+		assert.False(t, seen[ref], "duplicate reference %s", ref)
+		seen[ref] = true
+	}
+}
+
+func TestParse_Normalises(t *testing.T) {
+	ref, err := Generate()
+	require.NoError(t, err)
+	bare := ref[3:7] + ref[8:]
+
+	for _, input := range []string{
+		ref,
+		" " + ref + " ",
+		"cn-" + bare[:4] + "-" + bare[4:],
+		bare,
+		bare[:4] + " " + bare[4:],
+	} {
+		parsed, err := Parse(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, ref, parsed)
+	}
+}
+
+func TestParse_ReadsLookalikeLetters(t *testing.T) {
+	// Payload 0110000 has check symbol X
+	parsed, err := Parse("CN-OIL0-000X")
+	require.NoError(t, err)
+	assert.Equal(t, "CN-0110-000X", parsed)
+}
+
+func TestParse_DetectsTypos(t *testing.T) {
+	ref, err := Generate()
+	require.NoError(t, err)
+	symbols := []byte(ref[3:7] + ref[8:])
+
+	// Every single substituted symbol is caught
+	for i := range symbols {
+		for j := 0; j < len(alphabet); j++ {
+			if alphabet[j] == symbols[i] {
+				continue
+			}
+			typo := append([]byte(nil), symbols...)
+			typo[i] = alphabet[j]
+			_, err := Parse(string(typo))
+			assert.ErrorIs(t, err, ErrInvalid, "substitution %s", typo)
+		}
+	}
+
+	for _, input := range []string{"", "CN-", "CN-1234-567", "CN-1234-56789", "CN-UUUU-UUUU", "123"} {
+		_, err := Parse(input)
+		assert.ErrorIs(t, err, ErrInvalid, input)
+	}
+}
@@ -4,16 +4,63 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"log"
+	"strings"
 	"time"
 
+	"citynext-appointments/internal/audit"
 	"citynext-appointments/internal/constants"
 	"citynext-appointments/internal/db"
 	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/outbox"
+	"citynext-appointments/internal/phonetic"
+	"citynext-appointments/internal/pii"
+	"citynext-appointments/internal/reference"
+	"citynext-appointments/internal/tenant"
+
+	"github.com/lib/pq"
+)
+
+// Appointment states. A booking starts out booked and either ends up completed
+// through checked_in, or is closed as no_show or cancelled.
+const (
+	StatusBooked    = "booked"
+	StatusCheckedIn = "checked_in"
+	StatusCompleted = "completed"
+	StatusNoShow    = "no_show"
+	StatusCancelled = "cancelled"
 )
 
+// statusTransitions lists the states each state may move to
+var statusTransitions = map[string][]string{
+	StatusBooked:    {StatusCheckedIn, StatusNoShow, StatusCancelled},
+	StatusCheckedIn: {StatusCompleted},
+}
+
+// canTransition reports whether an appointment in state from may move to state to
+func canTransition(from, to string) bool {
+	for _, next := range statusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// transitionError describes a status change the state machine does not allow
+func transitionError(from, to string) error {
+	return fmt.Errorf("%s from %s to %s", constants.ErrInvalidTransition, from, to)
+}
+
 type AppointmentService struct {
 	db           *db.DB
 	timeProvider func() time.Time
+	// maxActiveBookings caps upcoming bookings per citizen subject, 0 means unlimited
+	maxActiveBookings int
+	confirmations     ConfirmationSender
+	waitlist          *WaitlistService
+	// duplicatePolicy is one of the DuplicatePolicy values, empty meaning off
+	duplicatePolicy string
 }
 
 func NewAppointmentService(database *db.DB) *AppointmentService {
@@ -31,6 +78,52 @@ func NewAppointmentServiceWithTime(database *db.DB, timeProvider func() time.Tim
 	}
 }
 
+// WithBookingLimit caps how many active future bookings one citizen may hold
+func (s *AppointmentService) WithBookingLimit(maxActive int) *AppointmentService {
+	s.maxActiveBookings = maxActive
+	return s
+}
+
+// WithConfirmations sends a confirmation to the citizen after every successful booking
+func (s *AppointmentService) WithConfirmations(sender ConfirmationSender) *AppointmentService {
+	s.confirmations = sender
+	return s
+}
+
+// WithWaitlist offers slots freed by cancellations and reschedules to the waitlist.
+// A slot offered to a waiting citizen cannot be booked by anyone else until the
+// offer expires. Accepted offers are held to this service's booking limit and
+// duplicate policy.
+func (s *AppointmentService) WithWaitlist(waitlist *WaitlistService) *AppointmentService {
+	s.waitlist = waitlist
+	waitlist.bookings = s
+	return s
+}
+
+// WithDuplicatePolicy checks every new booking against the citizen's other
+// upcoming bookings under the same or a similar name, and flags or rejects it
+// as the policy says
+func (s *AppointmentService) WithDuplicatePolicy(policy string) *AppointmentService {
+	s.duplicatePolicy = policy
+	return s
+}
+
+// bookingLimit is the booking limit of the tenant in ctx, or the service-wide one
+func (s *AppointmentService) bookingLimit(ctx context.Context) int {
+	if t, ok := tenant.From(ctx); ok && t.MaxActivePerCitizen != nil {
+		return *t.MaxActivePerCitizen
+	}
+	return s.maxActiveBookings
+}
+
+// duplicatePolicyFor is the duplicate policy of the tenant in ctx, or the service-wide one
+func (s *AppointmentService) duplicatePolicyFor(ctx context.Context) string {
+	if t, ok := tenant.From(ctx); ok && t.DuplicatePolicy != "" {
+		return t.DuplicatePolicy
+	}
+	return s.duplicatePolicy
+}
+
 func (s *AppointmentService) CreateAppointment(ctx context.Context, req *models.CreateAppointmentRequest) (*models.Appointment, error) {
 	visitDate, err := time.Parse(constants.DateLayout, req.VisitDate)
 	if err != nil {
@@ -43,71 +136,827 @@ func (s *AppointmentService) CreateAppointment(ctx context.Context, req *models.
 		return nil, fmt.Errorf("%s", constants.ErrPastDate)
 	}
 
-	// Prevent duplicate appointments on the same date
-	exists, err := s.appointmentExistsForDate(ctx, visitDate)
+	appointment := &models.Appointment{
+		FirstName:      req.FirstName,
+		LastName:       req.LastName,
+		Email:          req.Email,
+		ServiceType:    req.ServiceType,
+		VisitDate:      visitDate,
+		CitizenSubject: req.CitizenSubject,
+	}
+
+	// The checks, the insert and the outbox event commit or roll back together
+	var duplicate *duplicateMatch
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		duplicate, err = s.book(ctx, tx, appointment, req.HoldToken, now)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to check existing appointments: %w", err)
+		if err.Error() == constants.ErrPossibleDuplicate {
+			s.recordRejected(ctx, duplicate, visitDate, now)
+		}
+		return nil, err
 	}
-	if exists {
-		return nil, fmt.Errorf("%s %s", constants.ErrDuplicateAppointment, req.VisitDate)
+	if duplicate != nil {
+		log.Printf("Flagged appointment %d as a duplicate of appointment %d: %s",
+			appointment.ID, duplicate.appointmentID, duplicate.reason)
 	}
 
-	appointment := &models.Appointment{
-		FirstName: req.FirstName,
-		LastName:  req.LastName,
-		VisitDate: visitDate,
+	// The booking is already committed, so a notification failure must not fail the request
+	if s.confirmations != nil {
+		if err := s.confirmations.SendConfirmation(ctx, appointment); err != nil {
+			log.Printf("Failed to queue confirmation for appointment %d: %v", appointment.ID, err)
+		}
+	}
+
+	return appointment, nil
+}
+
+// book runs the checks every new booking goes through and inserts appointment
+// in tx: it locks the slot, uses up the citizen's hold and checks the quota,
+// then books the slot with bookReserved. A possible duplicate is returned both
+// when it was flagged and when it rejected the booking.
+func (s *AppointmentService) book(ctx context.Context, tx *sql.Tx, appointment *models.Appointment, holdToken string, now time.Time) (*duplicateMatch, error) {
+	serviceType, err := findServiceType(ctx, tx, appointment.ServiceType)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockSlot(ctx, tx, serviceType.Code, appointment.VisitDate); err != nil {
+		return nil, err
 	}
 
-	// Parameterized query ($1, $2, $3) prevents SQL injection
+	// Using up the citizen's own hold first frees its slot for them
+	if holdToken != "" {
+		if err := claimHold(ctx, tx, holdToken, serviceType.Code, appointment.VisitDate, appointment.CitizenSubject, now); err != nil {
+			return nil, err
+		}
+	}
+
+	// Stop the date taking more visits of this type than its daily quota
+	if err := checkQuota(ctx, tx, serviceType, appointment.VisitDate, now); err != nil {
+		return nil, err
+	}
+
+	return s.bookReserved(ctx, tx, appointment, now)
+}
+
+// bookReserved books appointment on a slot the caller has already secured, such
+// as one held by a waitlist offer. It still checks the citizen's booking limit
+// and the duplicate policy before it inserts the booking.
+func (s *AppointmentService) bookReserved(ctx context.Context, tx *sql.Tx, appointment *models.Appointment, now time.Time) (*duplicateMatch, error) {
+	// Stop one citizen from holding every free date
+	if err := s.checkBookingLimit(ctx, tx, appointment, now); err != nil {
+		return nil, err
+	}
+
+	// Catch one citizen taking date after date under different spellings
+	var duplicate *duplicateMatch
+	var err error
+	policy := s.duplicatePolicyFor(ctx)
+	if policy == DuplicatePolicyFlag || policy == DuplicatePolicyReject {
+		if duplicate, err = findDuplicate(ctx, tx, appointment, now); err != nil {
+			return nil, err
+		}
+		if duplicate != nil && duplicate.rejects(policy) {
+			return duplicate, fmt.Errorf("%s", constants.ErrPossibleDuplicate)
+		}
+	}
+
+	if err := insertAppointment(ctx, tx, appointment, now); err != nil {
+		return nil, err
+	}
+	if duplicate != nil {
+		if err := recordDuplicate(ctx, tx, duplicate, appointment.ID, appointment.VisitDate, DuplicateActionFlagged, now); err != nil {
+			return nil, err
+		}
+	}
+	return duplicate, nil
+}
+
+// recordRejected records a booking the duplicate policy rejected. The booking
+// was rolled back, so the rejection is recorded on its own.
+func (s *AppointmentService) recordRejected(ctx context.Context, duplicate *duplicateMatch, visitDate, now time.Time) {
+	log.Printf("Rejected booking for %s as a duplicate of appointment %d: %s",
+		visitDate.Format(constants.DateLayout), duplicate.appointmentID, duplicate.reason)
+	if err := recordDuplicate(ctx, s.db, duplicate, 0, visitDate, DuplicateActionRejected, now); err != nil {
+		log.Printf("Failed to record rejected duplicate: %v", err)
+	}
+}
+
+// maxReferenceAttempts bounds retries after a generated reference collides with an existing one
+const maxReferenceAttempts = 3
+
+// insertAppointment assigns a clerk to a new booking and stores it with a fresh
+// reference, its created event and its first history entry in tx
+func insertAppointment(ctx context.Context, tx *sql.Tx, appointment *models.Appointment, now time.Time) error {
+	staffID, err := assignStaff(ctx, tx, appointment.ServiceType, appointment.VisitDate)
+	if err != nil {
+		return err
+	}
+	appointment.StaffID = &staffID
+	appointment.Status = StatusBooked
+
+	firstName, lastName, err := sealNames(appointment.FirstName, appointment.LastName)
+	if err != nil {
+		return err
+	}
+
+	// Parameterized query ($1 ... $12) prevents SQL injection. A reference collision
+	// inserts nothing and is retried with another reference.
 	query := `
-		INSERT INTO appointments (first_name, last_name, visit_date)
-		VALUES ($1, $2, $3)
+		INSERT INTO appointments (first_name, last_name, visit_date, citizen_subject, email, reference, service_type, staff_id,
+			first_name_bidx, last_name_bidx, first_name_phonetic, last_name_phonetic)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (reference) DO NOTHING
 		RETURNING id, created_at
 	`
 
-	err = s.db.QueryRowContext(ctx, query, appointment.FirstName, appointment.LastName, appointment.VisitDate).
-		Scan(&appointment.ID, &appointment.CreatedAt)
+	for attempt := 1; ; attempt++ {
+		ref, err := reference.Generate()
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, query, firstName, lastName, appointment.VisitDate,
+			nullString(appointment.CitizenSubject), nullString(appointment.Email), ref, appointment.ServiceType, staffID,
+			pii.BlindIndex(appointment.FirstName), pii.BlindIndex(appointment.LastName),
+			phoneticKey(pii.Active(), appointment.FirstName), phoneticKey(pii.Active(), appointment.LastName)).
+			Scan(&appointment.ID, &appointment.CreatedAt)
+		if err == sql.ErrNoRows && attempt < maxReferenceAttempts {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create appointment: %w", err)
+		}
+		appointment.Reference = ref
+		break
+	}
+
+	if err := outbox.Enqueue(ctx, tx, constants.EventAppointmentCreated, appointment.ID, appointment); err != nil {
+		return err
+	}
+	return audit.Record(ctx, tx, constants.EventAppointmentCreated, nil, appointment, now)
+}
+
+// checkQuota fails when the date has no visits of the service type left. Active
+// bookings, open waitlist offers and unexpired holds all count. Call it after
+// lockSlot so nothing else can take the last slot before tx commits.
+func checkQuota(ctx context.Context, tx *sql.Tx, serviceType *models.ServiceType, date, now time.Time) error {
+	usage, err := countSlotUsage(ctx, tx, serviceType.Code, date, now)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create appointment: %w", err)
+		return fmt.Errorf("failed to check existing appointments: %w", err)
 	}
+	if usage.total() >= serviceType.DailyQuota {
+		return fmt.Errorf("%s %s", constants.ErrDuplicateAppointment, date.Format(constants.DateLayout))
+	}
+	return nil
+}
 
-	return appointment, nil
+// checkBookingLimit fails when the citizen already holds as many upcoming
+// bookings as the tenant allows. Citizens are told apart by their token subject,
+// or by their email address when they book without a token; while the limit is
+// on, a booking with neither is refused. Bookings of one citizen on different
+// dates take different slot locks, so the citizen is locked as well until tx
+// ends; callers hold their lockSlot lock first and assign staff afterwards, so
+// the locks are always taken in the same order.
+func (s *AppointmentService) checkBookingLimit(ctx context.Context, tx *sql.Tx, appointment *models.Appointment, now time.Time) error {
+	maxActive := s.bookingLimit(ctx)
+	if maxActive <= 0 {
+		return nil
+	}
+
+	var active int
+	var err error
+	switch email := normaliseEmail(appointment.Email); {
+	case appointment.CitizenSubject != "":
+		if err := lockCitizen(ctx, tx, appointment.CitizenSubject); err != nil {
+			return err
+		}
+		active, err = s.countActiveBookings(ctx, tx, appointment.CitizenSubject, now)
+	case email != "":
+		if err := lockCitizen(ctx, tx, "email:"+email); err != nil {
+			return err
+		}
+		active, err = s.countTokenlessBookings(ctx, tx, email, now)
+	default:
+		return fmt.Errorf("%s", constants.ErrIdentityRequired)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check active bookings: %w", err)
+	}
+	if active >= maxActive {
+		return fmt.Errorf("%s", constants.ErrBookingLimitReached)
+	}
+	return nil
+}
+
+// lockCitizen serialises the transactions that count and add to one citizen's bookings until tx ends
+func lockCitizen(ctx context.Context, tx *sql.Tx, citizenSubject string) error {
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(`+tenantLockKey+`)`, citizenSubject); err != nil {
+		return fmt.Errorf("failed to lock citizen: %w", err)
+	}
+	return nil
 }
 
-func (s *AppointmentService) appointmentExistsForDate(ctx context.Context, date time.Time) (bool, error) {
-	// Uses indexed visit_date column for fast lookup, parameterized query prevents SQL injection
-	query := `SELECT COUNT(*) FROM appointments WHERE visit_date = $1`
+func (s *AppointmentService) countActiveBookings(ctx context.Context, q queryer, citizenSubject string, now time.Time) (int, error) {
+	// Uses idx_appointments_citizen_subject; only upcoming, non-cancelled bookings count
+	query := `
+		SELECT COUNT(*) FROM appointments
+		WHERE citizen_subject = $1 AND cancelled_at IS NULL AND visit_date >= $2
+	`
+	var count int
+	err := q.QueryRowContext(ctx, query, citizenSubject, now.Truncate(24*time.Hour)).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// countTokenlessBookings counts the upcoming bookings made without a citizen
+// token under the normalised email address
+func (s *AppointmentService) countTokenlessBookings(ctx context.Context, q queryer, email string, now time.Time) (int, error) {
+	// Uses idx_appointments_tokenless_email
+	query := `
+		SELECT COUNT(*) FROM appointments
+		WHERE citizen_subject IS NULL AND lower(trim(email)) = $1 AND cancelled_at IS NULL AND visit_date >= $2
+	`
 	var count int
-	err := s.db.QueryRowContext(ctx, query, date).Scan(&count)
+	err := q.QueryRowContext(ctx, query, email, now.Truncate(24*time.Hour)).Scan(&count)
 	if err != nil {
-		return false, err
+		return 0, err
 	}
-	return count > 0, nil
+	return count, nil
+}
+
+// normaliseEmail is how email addresses are compared: trimmed and lower case
+func normaliseEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
 
 func (s *AppointmentService) GetAppointmentByDate(ctx context.Context, date time.Time) (*models.Appointment, error) {
 	// Uses indexed visit_date column, $1 parameter safely handles user input
 	query := `
-		SELECT id, first_name, last_name, visit_date, created_at
+		SELECT ` + appointmentColumns + `
+		FROM appointments
+		WHERE visit_date = $1 AND cancelled_at IS NULL
+	`
+
+	appointment, err := scanAppointment(s.db.QueryRowContext(ctx, query, date))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get appointment: %w", err)
+	}
+
+	return appointment, nil
+}
+
+// GetAppointment returns the appointment with the given id, including cancelled ones
+func (s *AppointmentService) GetAppointment(ctx context.Context, id int) (*models.Appointment, error) {
+	query := `
+		SELECT ` + appointmentColumns + `
+		FROM appointments
+		WHERE id = $1
+	`
+
+	appointment, err := scanAppointment(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get appointment: %w", err)
+	}
+
+	return appointment, nil
+}
+
+// GetAppointmentByReference returns the appointment with the given booking reference,
+// including cancelled ones. Text that is not a valid reference is simply not found.
+func (s *AppointmentService) GetAppointmentByReference(ctx context.Context, ref string) (*models.Appointment, error) {
+	ref, err := reference.Parse(ref)
+	if err != nil {
+		return nil, nil
+	}
+
+	// Uses idx_appointments_reference
+	query := `
+		SELECT ` + appointmentColumns + `
+		FROM appointments
+		WHERE reference = $1
+	`
+
+	appointment, err := scanAppointment(s.db.QueryRowContext(ctx, query, ref))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get appointment: %w", err)
+	}
+
+	return appointment, nil
+}
+
+// BackfillReferences gives a reference to every appointment created before
+// references existed and returns how many were updated
+func (s *AppointmentService) BackfillReferences(ctx context.Context) (int, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id FROM appointments WHERE reference IS NULL ORDER BY id`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find appointments without reference: %w", err)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to find appointments without reference: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to find appointments without reference: %w", err)
+	}
+
+	// Only rows that are still empty are touched, so concurrent replicas can run this safely
+	query := `
+		UPDATE appointments SET reference = $2
+		WHERE id = $1 AND reference IS NULL
+			AND NOT EXISTS (SELECT 1 FROM appointments WHERE reference = $2)
+	`
+	updated := 0
+	for _, id := range ids {
+		for attempt := 1; attempt <= maxReferenceAttempts; attempt++ {
+			ref, err := reference.Generate()
+			if err != nil {
+				return updated, err
+			}
+			result, err := s.db.ExecContext(ctx, query, id, ref)
+			if err != nil {
+				return updated, fmt.Errorf("failed to set reference: %w", err)
+			}
+			if affected, err := result.RowsAffected(); err == nil && affected > 0 {
+				updated++
+				break
+			}
+		}
+	}
+	return updated, nil
+}
+
+// ListAppointments returns the appointments with a visit date between from and
+// to inclusive, ordered by date, cancelled ones included so calendars drop them.
+// A zero from means today, a zero to means 90 days after from.
+func (s *AppointmentService) ListAppointments(ctx context.Context, from, to time.Time) ([]models.Appointment, error) {
+	if from.IsZero() {
+		from = s.timeProvider().Truncate(24 * time.Hour)
+	}
+	if to.IsZero() {
+		to = from.AddDate(0, 0, 90)
+	}
+
+	// Range scan on the visit_date index
+	query := `
+		SELECT ` + appointmentColumns + `
 		FROM appointments
-		WHERE visit_date = $1
+		WHERE visit_date >= $1 AND visit_date <= $2
+		ORDER BY visit_date, id
+	`
+	rows, err := s.db.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list appointments: %w", err)
+	}
+	defer rows.Close()
+
+	appointments := []models.Appointment{}
+	for rows.Next() {
+		appointment, err := scanAppointment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list appointments: %w", err)
+		}
+		appointments = append(appointments, *appointment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list appointments: %w", err)
+	}
+	return appointments, nil
+}
+
+// Revisions counts the recorded changes of the given appointments after they
+// were booked and returns when each last changed. Appointments without any
+// history are missing from the result.
+func (s *AppointmentService) Revisions(ctx context.Context, ids []int) (map[int]models.Revision, error) {
+	query := `
+		SELECT appointment_id, COUNT(*) FILTER (WHERE action <> $2), MAX(created_at)
+		FROM appointment_events
+		WHERE appointment_id = ANY($1)
+		GROUP BY appointment_id
 	`
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(ids), constants.EventAppointmentCreated)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := make(map[int]models.Revision, len(ids))
+	for rows.Next() {
+		var id int
+		var revision models.Revision
+		if err := rows.Scan(&id, &revision.Sequence, &revision.LastModified); err != nil {
+			return nil, fmt.Errorf("failed to read revisions: %w", err)
+		}
+		revisions[id] = revision
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read revisions: %w", err)
+	}
+	return revisions, nil
+}
+
+// CancelAppointment marks an upcoming appointment as cancelled, which frees its date
+func (s *AppointmentService) CancelAppointment(ctx context.Context, id int) (*models.Appointment, error) {
+	appointment, err := s.GetAppointment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if appointment == nil {
+		return nil, fmt.Errorf("%s", constants.ErrAppointmentNotFound)
+	}
+	if appointment.CancelledAt != nil {
+		return nil, fmt.Errorf("%s", constants.ErrAlreadyCancelled)
+	}
+	if !canTransition(appointment.Status, StatusCancelled) {
+		return nil, transitionError(appointment.Status, StatusCancelled)
+	}
+
+	now := s.timeProvider()
+	if appointment.VisitDate.Before(now.Truncate(24 * time.Hour)) {
+		return nil, fmt.Errorf("%s", constants.ErrCancelPastVisit)
+	}
+
+	// The status guard makes concurrent cancellations of the same booking safe
+	var offered *models.WaitlistEntry
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		query := `UPDATE appointments SET status = 'cancelled', cancelled_at = $2 WHERE id = $1 AND status = 'booked'`
+		result, err := tx.ExecContext(ctx, query, id, now)
+		if err != nil {
+			return fmt.Errorf("failed to cancel appointment: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to cancel appointment: %w", err)
+		}
+		if affected == 0 {
+			return fmt.Errorf("%s", constants.ErrAlreadyCancelled)
+		}
+
+		before := *appointment
+		appointment.Status = StatusCancelled
+		appointment.CancelledAt = &now
+		if err := outbox.Enqueue(ctx, tx, constants.EventAppointmentCancelled, appointment.ID, appointment); err != nil {
+			return err
+		}
+		if err := audit.Record(ctx, tx, constants.EventAppointmentCancelled, &before, appointment, now); err != nil {
+			return err
+		}
+
+		offered, err = s.offerFreedDate(ctx, tx, appointment.ServiceType, appointment.VisitDate, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.notifyOffer(ctx, offered)
+
+	return appointment, nil
+}
+
+// RescheduleAppointment moves an upcoming appointment to another free date
+func (s *AppointmentService) RescheduleAppointment(ctx context.Context, id int, visitDate string) (*models.Appointment, error) {
+	newDate, err := time.Parse(constants.DateLayout, visitDate)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", constants.ErrInvalidDateFormat, err)
+	}
+
+	now := s.timeProvider()
+	today := now.Truncate(24 * time.Hour)
+	if newDate.Before(today) {
+		return nil, fmt.Errorf("%s", constants.ErrPastDate)
+	}
+
+	appointment, err := s.GetAppointment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if appointment == nil {
+		return nil, fmt.Errorf("%s", constants.ErrAppointmentNotFound)
+	}
+	if appointment.CancelledAt != nil {
+		return nil, fmt.Errorf("%s", constants.ErrAlreadyCancelled)
+	}
+	// Only visits nobody has turned up for yet can move
+	if appointment.Status != StatusBooked {
+		return nil, transitionError(appointment.Status, StatusBooked)
+	}
+	if appointment.VisitDate.Before(today) {
+		return nil, fmt.Errorf("%s", constants.ErrReschedulePastVisit)
+	}
+	if appointment.VisitDate.Equal(newDate) {
+		return appointment, nil
+	}
+
+	oldDate := appointment.VisitDate
+	var offered *models.WaitlistEntry
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		// The booking keeps its service type, so the new date needs a slot of that type
+		serviceType, err := findServiceType(ctx, tx, appointment.ServiceType)
+		if err != nil {
+			return err
+		}
+		if err := lockSlot(ctx, tx, serviceType.Code, newDate); err != nil {
+			return err
+		}
+		if err := checkQuota(ctx, tx, serviceType, newDate, now); err != nil {
+			return err
+		}
+
+		// The clerk of the old date may not work on the new one
+		staffID, err := assignStaff(ctx, tx, serviceType.Code, newDate)
+		if err != nil {
+			return err
+		}
+
+		query := `UPDATE appointments SET visit_date = $2, staff_id = $3 WHERE id = $1 AND status = 'booked'`
+		result, err := tx.ExecContext(ctx, query, id, newDate, staffID)
+		if err != nil {
+			return fmt.Errorf("failed to reschedule appointment: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to reschedule appointment: %w", err)
+		}
+		if affected == 0 {
+			return fmt.Errorf("%s", constants.ErrAlreadyCancelled)
+		}
+
+		// Reminders sent for the old date have to go out again for the new one
+		if _, err := tx.ExecContext(ctx, `DELETE FROM reminders_sent WHERE appointment_id = $1`, id); err != nil {
+			return fmt.Errorf("failed to reset reminders: %w", err)
+		}
+
+		before := *appointment
+		appointment.VisitDate = newDate
+		appointment.StaffID = &staffID
+		if err := outbox.Enqueue(ctx, tx, constants.EventAppointmentRescheduled, appointment.ID, appointment); err != nil {
+			return err
+		}
+		if err := audit.Record(ctx, tx, constants.EventAppointmentRescheduled, &before, appointment, now); err != nil {
+			return err
+		}
+
+		offered, err = s.offerFreedDate(ctx, tx, appointment.ServiceType, oldDate, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.notifyOffer(ctx, offered)
+
+	return appointment, nil
+}
+
+// CheckIn records that the citizen has arrived for a booked visit. Citizens can
+// only check in on the day of their visit.
+func (s *AppointmentService) CheckIn(ctx context.Context, id int) (*models.Appointment, error) {
+	appointment, err := s.GetAppointment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if appointment == nil {
+		return nil, fmt.Errorf("%s", constants.ErrAppointmentNotFound)
+	}
+	if !canTransition(appointment.Status, StatusCheckedIn) {
+		return nil, transitionError(appointment.Status, StatusCheckedIn)
+	}
+
+	now := s.timeProvider()
+	if !appointment.VisitDate.Equal(now.Truncate(24 * time.Hour)) {
+		return nil, fmt.Errorf("%s", constants.ErrNotVisitDay)
+	}
+
+	if err := s.changeStatus(ctx, appointment, StatusCheckedIn, now); err != nil {
+		return nil, err
+	}
+	return appointment, nil
+}
+
+// CompleteVisit records that a checked in citizen has been served
+func (s *AppointmentService) CompleteVisit(ctx context.Context, id int) (*models.Appointment, error) {
+	appointment, err := s.GetAppointment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if appointment == nil {
+		return nil, fmt.Errorf("%s", constants.ErrAppointmentNotFound)
+	}
+	if !canTransition(appointment.Status, StatusCompleted) {
+		return nil, transitionError(appointment.Status, StatusCompleted)
+	}
+
+	if err := s.changeStatus(ctx, appointment, StatusCompleted, s.timeProvider()); err != nil {
+		return nil, err
+	}
+	return appointment, nil
+}
 
+// changeStatus moves appointment to checked_in or completed, stamping the time of
+// the change, and queues the matching event and history entry. The update only
+// applies while the row is still in the state that was read, so a concurrent
+// change wins cleanly.
+func (s *AppointmentService) changeStatus(ctx context.Context, appointment *models.Appointment, to string, now time.Time) error {
+	var query, event string
+	switch to {
+	case StatusCheckedIn:
+		query = `UPDATE appointments SET status = $3, checked_in_at = $4 WHERE id = $1 AND status = $2`
+		event = constants.EventAppointmentCheckedIn
+	case StatusCompleted:
+		query = `UPDATE appointments SET status = $3, completed_at = $4 WHERE id = $1 AND status = $2`
+		event = constants.EventAppointmentCompleted
+	default:
+		return transitionError(appointment.Status, to)
+	}
+
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, appointment.ID, appointment.Status, to, now)
+		if err != nil {
+			return fmt.Errorf("failed to update appointment status: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to update appointment status: %w", err)
+		}
+		if affected == 0 {
+			return transitionError(appointment.Status, to)
+		}
+
+		before := *appointment
+		switch to {
+		case StatusCheckedIn:
+			appointment.CheckedInAt = &now
+		case StatusCompleted:
+			appointment.CompletedAt = &now
+		}
+		appointment.Status = to
+		if err := outbox.Enqueue(ctx, tx, event, appointment.ID, appointment); err != nil {
+			return err
+		}
+		return audit.Record(ctx, tx, event, &before, appointment, now)
+	})
+}
+
+// offerFreedDate offers a slot that tx just freed to the waitlist, if there is one
+func (s *AppointmentService) offerFreedDate(ctx context.Context, tx *sql.Tx, serviceType string, date, now time.Time) (*models.WaitlistEntry, error) {
+	if s.waitlist == nil {
+		return nil, nil
+	}
+	return s.waitlist.offerNext(ctx, tx, serviceType, date, now)
+}
+
+// notifyOffer sends a waitlist offer once the transaction that made it has committed
+func (s *AppointmentService) notifyOffer(ctx context.Context, entry *models.WaitlistEntry) {
+	if s.waitlist != nil {
+		s.waitlist.notifyOffer(ctx, entry)
+	}
+}
+
+func (s *AppointmentService) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return withTx(ctx, s.db, fn)
+}
+
+// withTx runs fn in a transaction, committing only when fn succeeds
+func withTx(ctx context.Context, database *db.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := database.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// queryer is satisfied by both *db.DB and *sql.Tx
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// appointmentColumns lists the columns read by scanAppointment, in order
+const appointmentColumns = `id, first_name, last_name, visit_date, created_at, citizen_subject, cancelled_at, email, reference, service_type, staff_id, status, checked_in_at, completed_at, no_show_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAppointment(row rowScanner) (*models.Appointment, error) {
 	appointment := &models.Appointment{}
-	err := s.db.QueryRowContext(ctx, query, date).Scan(
+	var citizenSubject, email, ref sql.NullString
+	var cancelledAt, checkedInAt, completedAt, noShowAt sql.NullTime
+	var staffID sql.NullInt64
+
+	err := row.Scan(
 		&appointment.ID,
 		&appointment.FirstName,
 		&appointment.LastName,
 		&appointment.VisitDate,
 		&appointment.CreatedAt,
+		&citizenSubject,
+		&cancelledAt,
+		&email,
+		&ref,
+		&appointment.ServiceType,
+		&staffID,
+		&appointment.Status,
+		&checkedInAt,
+		&completedAt,
+		&noShowAt,
 	)
-
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		return nil, fmt.Errorf("failed to get appointment: %w", err)
+		return nil, err
+	}
+	if err := openNames(&appointment.FirstName, &appointment.LastName); err != nil {
+		return nil, err
 	}
 
+	appointment.Reference = ref.String
+	appointment.CitizenSubject = citizenSubject.String
+	appointment.Email = email.String
+	if cancelledAt.Valid {
+		appointment.CancelledAt = &cancelledAt.Time
+	}
+	if staffID.Valid {
+		id := int(staffID.Int64)
+		appointment.StaffID = &id
+	}
+	if checkedInAt.Valid {
+		appointment.CheckedInAt = &checkedInAt.Time
+	}
+	if completedAt.Valid {
+		appointment.CompletedAt = &completedAt.Time
+	}
+	if noShowAt.Valid {
+		appointment.NoShowAt = &noShowAt.Time
+	}
 	return appointment, nil
 }
+
+// maxNameLength is the longest first or last name accepted, in characters
+const maxNameLength = 100
+
+// sealNames encrypts first and last name for storage when a keyring is configured
+func sealNames(firstName, lastName string) (string, string, error) {
+	sealedFirst, err := pii.Seal(firstName)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encrypt name: %w", err)
+	}
+	sealedLast, err := pii.Seal(lastName)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encrypt name: %w", err)
+	}
+	return sealedFirst, sealedLast, nil
+}
+
+// phoneticKey returns the key a name is found by when it sounds alike, its
+// Soundex code. With a keyring the code is blinded like the names' indexes, as
+// it would otherwise give away part of the name.
+func phoneticKey(keyring *pii.Keyring, name string) sql.NullString {
+	code := phonetic.Soundex(name)
+	if code == "" {
+		return sql.NullString{}
+	}
+	if keyring != nil {
+		code = keyring.BlindIndex("soundex:" + code)
+	}
+	return sql.NullString{String: code, Valid: true}
+}
+
+// openNames decrypts first and last name read from the database
+func openNames(firstName, lastName *string) error {
+	var err error
+	if *firstName, err = pii.Open(*firstName); err != nil {
+		return fmt.Errorf("failed to decrypt name: %w", err)
+	}
+	if *lastName, err = pii.Open(*lastName); err != nil {
+		return fmt.Errorf("failed to decrypt name: %w", err)
+	}
+	return nil
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -3,18 +3,22 @@ package service
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"testing"
 	"time"
 
 	"citynext-appointments/internal/constants"
 	"citynext-appointments/internal/db"
 	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/pii"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+var appointmentRowColumns = []string{"id", "first_name", "last_name", "visit_date", "created_at", "citizen_subject", "cancelled_at", "email", "reference", "service_type", "staff_id", "status", "checked_in_at", "completed_at", "no_show_at"}
+
 func TestAppointmentService_CreateAppointment_Success(t *testing.T) {
 	sqlDB, mock, err := sqlmock.New()
 	require.NoError(t, err)
@@ -24,21 +28,25 @@ func TestAppointmentService_CreateAppointment_Success(t *testing.T) {
 	service := NewAppointmentService(mockDB)
 
 	req := &models.CreateAppointmentRequest{
-		FirstName: "John",
-		LastName:  "Doe",
-		VisitDate: "2025-08-15",
+		FirstName:   "John",
+		LastName:    "Doe",
+		VisitDate:   "2025-08-15",
+		ServiceType: "general",
 	}
 
 	expectedID := 1
 	expectedCreatedAt := time.Now()
 
-	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM appointments WHERE visit_date = \$1`).
-		WithArgs(sqlmock.AnyArg()).
-		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectBegin()
+	expectQuotaCheck(mock, "general", 1, 0, 0, 0)
 
-	mock.ExpectQuery(`INSERT INTO appointments \(first_name, last_name, visit_date\) VALUES \(\$1, \$2, \$3\) RETURNING id, created_at`).
-		WithArgs("John", "Doe", sqlmock.AnyArg()).
+	expectStaffAssignment(mock, 1)
+	mock.ExpectQuery(`INSERT INTO appointments \(first_name, last_name, visit_date, citizen_subject, email, reference, service_type, staff_id, first_name_bidx, last_name_bidx, first_name_phonetic, last_name_phonetic\) VALUES \(\$1, \$2, \$3, \$4, \$5, \$6, \$7, \$8, \$9, \$10, \$11, \$12\) ON CONFLICT \(reference\) DO NOTHING RETURNING id, created_at`).
+		WithArgs("John", "Doe", sqlmock.AnyArg(), nil, nil, sqlmock.AnyArg(), "general", 1, nil, nil, "J500", "D000").
 		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(expectedID, expectedCreatedAt))
+	expectOutboxEvent(mock, constants.EventAppointmentCreated, expectedID)
+	expectHistoryEvent(mock, constants.EventAppointmentCreated, expectedID)
+	mock.ExpectCommit()
 
 	ctx := context.Background()
 	result, err := service.CreateAppointment(ctx, req)
@@ -106,14 +114,15 @@ func TestAppointmentService_CreateAppointment_DuplicateDate(t *testing.T) {
 	service := NewAppointmentService(mockDB)
 
 	req := &models.CreateAppointmentRequest{
-		FirstName: "John",
-		LastName:  "Doe",
-		VisitDate: "2025-08-15",
+		FirstName:   "John",
+		LastName:    "Doe",
+		VisitDate:   "2025-08-15",
+		ServiceType: "general",
 	}
 
-	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM appointments WHERE visit_date = \$1`).
-		WithArgs(sqlmock.AnyArg()).
-		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectBegin()
+	expectQuotaCheck(mock, "general", 1, 1, 0, 0)
+	mock.ExpectRollback()
 
 	ctx := context.Background()
 	result, err := service.CreateAppointment(ctx, req)
@@ -133,14 +142,18 @@ func TestAppointmentService_CreateAppointment_DatabaseError(t *testing.T) {
 	service := NewAppointmentService(mockDB)
 
 	req := &models.CreateAppointmentRequest{
-		FirstName: "John",
-		LastName:  "Doe",
-		VisitDate: "2025-08-15",
+		FirstName:   "John",
+		LastName:    "Doe",
+		VisitDate:   "2025-08-15",
+		ServiceType: "general",
 	}
 
-	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM appointments WHERE visit_date = \$1`).
-		WithArgs(sqlmock.AnyArg()).
+	mock.ExpectBegin()
+	expectServiceType(mock, "general", 1)
+	expectSlotLock(mock, "general")
+	mock.ExpectQuery(`SELECT \(SELECT COUNT\(\*\) FROM appointments`).
 		WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
 
 	ctx := context.Background()
 	result, err := service.CreateAppointment(ctx, req)
@@ -162,10 +175,10 @@ func TestAppointmentService_GetAppointmentByDate_Success(t *testing.T) {
 	testDate := time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC)
 	expectedCreatedAt := time.Now()
 
-	mock.ExpectQuery(`SELECT id, first_name, last_name, visit_date, created_at FROM appointments WHERE visit_date = \$1`).
+	mock.ExpectQuery(`SELECT id, first_name, last_name, visit_date, created_at, citizen_subject, cancelled_at, email, reference, service_type, staff_id, status, checked_in_at, completed_at, no_show_at FROM appointments WHERE visit_date = \$1 AND cancelled_at IS NULL`).
 		WithArgs(testDate).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "first_name", "last_name", "visit_date", "created_at"}).
-			AddRow(1, "John", "Doe", testDate, expectedCreatedAt))
+		WillReturnRows(sqlmock.NewRows(appointmentRowColumns).
+			AddRow(1, "John", "Doe", testDate, expectedCreatedAt, nil, nil, nil, nil, "general", 1, "booked", nil, nil, nil))
 
 	ctx := context.Background()
 	result, err := service.GetAppointmentByDate(ctx, testDate)
@@ -190,7 +203,7 @@ func TestAppointmentService_GetAppointmentByDate_NotFound(t *testing.T) {
 
 	testDate := time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC)
 
-	mock.ExpectQuery(`SELECT id, first_name, last_name, visit_date, created_at FROM appointments WHERE visit_date = \$1`).
+	mock.ExpectQuery(`SELECT id, first_name, last_name, visit_date, created_at, citizen_subject, cancelled_at, email, reference, service_type, staff_id, status, checked_in_at, completed_at, no_show_at FROM appointments WHERE visit_date = \$1 AND cancelled_at IS NULL`).
 		WithArgs(testDate).
 		WillReturnError(sql.ErrNoRows)
 
@@ -202,33 +215,781 @@ func TestAppointmentService_GetAppointmentByDate_NotFound(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestAppointmentService_appointmentExistsForDate(t *testing.T) {
+func TestAppointmentService_CreateAppointment_DailyQuota(t *testing.T) {
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name        string
+		booked      int
+		offered     int
+		held        int
+		expectedErr string
+	}{
+		{"last slot", 5, 1, 1, ""},
+		{"fully booked", 8, 0, 0, constants.ErrDuplicateAppointment + " 2075-06-15"},
+		{"rest offered or held", 6, 1, 1, constants.ErrDuplicateAppointment + " 2075-06-15"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer sqlDB.Close()
+
+			service := NewAppointmentServiceWithTime(&db.DB{DB: sqlDB}, func() time.Time { return now })
+
+			mock.ExpectBegin()
+			expectQuotaCheck(mock, "passport-renewal", 8, tc.booked, tc.offered, tc.held)
+			if tc.expectedErr == "" {
+				expectStaffAssignment(mock, 1)
+				mock.ExpectQuery(`INSERT INTO appointments`).
+					WithArgs("John", "Doe", sqlmock.AnyArg(), nil, nil, sqlmock.AnyArg(), "passport-renewal", 1, nil, nil, "J500", "D000").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, now))
+				expectOutboxEvent(mock, constants.EventAppointmentCreated, 1)
+				expectHistoryEvent(mock, constants.EventAppointmentCreated, 1)
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			result, err := service.CreateAppointment(context.Background(), &models.CreateAppointmentRequest{
+				FirstName:   "John",
+				LastName:    "Doe",
+				VisitDate:   "2075-06-15",
+				ServiceType: "passport-renewal",
+			})
+
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, "passport-renewal", result.ServiceType)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestAppointmentService_CreateAppointment_UnknownServiceType(t *testing.T) {
 	sqlDB, mock, err := sqlmock.New()
 	require.NoError(t, err)
 	defer sqlDB.Close()
 
-	mockDB := &db.DB{DB: sqlDB}
-	service := NewAppointmentService(mockDB)
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	service := NewAppointmentServiceWithTime(&db.DB{DB: sqlDB}, func() time.Time { return now })
 
-	testDate := time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT .* FROM service_types WHERE code = \$1 AND active`).
+		WithArgs("dog-licence").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
 
-	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM appointments WHERE visit_date = \$1`).
-		WithArgs(testDate).
-		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	_, err = service.CreateAppointment(context.Background(), &models.CreateAppointmentRequest{
+		FirstName:   "John",
+		LastName:    "Doe",
+		VisitDate:   "2075-06-15",
+		ServiceType: "dog-licence",
+	})
 
-	ctx := context.Background()
-	exists, err := service.appointmentExistsForDate(ctx, testDate)
+	assert.EqualError(t, err, constants.ErrUnknownServiceType)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAppointmentService_CreateAppointment_NoStaffAvailable(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	service := NewAppointmentServiceWithTime(&db.DB{DB: sqlDB}, func() time.Time { return now })
+
+	mock.ExpectBegin()
+	expectQuotaCheck(mock, "passport-renewal", 8, 3, 0, 0)
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock`).
+		WithArgs(staffLockKey, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT r.staff_id FROM staff_rosters r`).
+		WillReturnRows(sqlmock.NewRows([]string{"staff_id"}))
+	mock.ExpectRollback()
+
+	_, err = service.CreateAppointment(context.Background(), &models.CreateAppointmentRequest{
+		FirstName:   "John",
+		LastName:    "Doe",
+		VisitDate:   "2075-06-15",
+		ServiceType: "passport-renewal",
+	})
+
+	assert.EqualError(t, err, constants.ErrNoStaffAvailable+" 2075-06-15")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAppointmentService_CreateAppointment_WithCitizenSubject(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	service := NewAppointmentServiceWithTime(&db.DB{DB: sqlDB}, func() time.Time { return now })
+
+	req := &models.CreateAppointmentRequest{
+		FirstName:      "John",
+		LastName:       "Doe",
+		VisitDate:      "2075-06-15",
+		ServiceType:    "general",
+		CitizenSubject: "citizen-123",
+	}
+
+	mock.ExpectBegin()
+	expectQuotaCheck(mock, "general", 1, 0, 0, 0)
+	expectStaffAssignment(mock, 1)
+	mock.ExpectQuery(`INSERT INTO appointments`).
+		WithArgs("John", "Doe", sqlmock.AnyArg(), "citizen-123", nil, sqlmock.AnyArg(), "general", 1, nil, nil, "J500", "D000").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, now))
+	expectOutboxEvent(mock, constants.EventAppointmentCreated, 1)
+	expectHistoryEvent(mock, constants.EventAppointmentCreated, 1)
+	mock.ExpectCommit()
+
+	result, err := service.CreateAppointment(context.Background(), req)
+
+	require.NoError(t, err)
+	assert.Equal(t, "citizen-123", result.CitizenSubject)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAppointmentService_GetAppointment(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
 
+	service := NewAppointmentService(&db.DB{DB: sqlDB})
+
+	visitDate := time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC)
+	cancelledAt := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT id, first_name, last_name, visit_date, created_at, citizen_subject, cancelled_at, email, reference, service_type, staff_id, status, checked_in_at, completed_at, no_show_at FROM appointments WHERE id = \$1`).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows(appointmentRowColumns).
+			AddRow(5, "John", "Doe", visitDate, cancelledAt, "citizen-123", cancelledAt, nil, nil, "general", 1, "booked", nil, nil, nil))
+	mock.ExpectQuery(`SELECT .* FROM appointments WHERE id = \$1`).
+		WithArgs(6).
+		WillReturnError(sql.ErrNoRows)
+
+	result, err := service.GetAppointment(context.Background(), 5)
+	require.NoError(t, err)
+	assert.Equal(t, "citizen-123", result.CitizenSubject)
+	require.NotNil(t, result.CancelledAt)
+	assert.Equal(t, cancelledAt, *result.CancelledAt)
+
+	result, err = service.GetAppointment(context.Background(), 6)
 	assert.NoError(t, err)
-	assert.True(t, exists)
+	assert.Nil(t, result)
 
-	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM appointments WHERE visit_date = \$1`).
-		WithArgs(testDate).
-		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAppointmentService_GetAppointmentByReference(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	service := NewAppointmentService(&db.DB{DB: sqlDB})
+	visitDate := time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC)
 
-	exists, err = service.appointmentExistsForDate(ctx, testDate)
+	// Lower case, missing prefix and confusable letters are normalised before the lookup
+	mock.ExpectQuery(`SELECT .* FROM appointments WHERE reference = \$1`).
+		WithArgs("CN-0110-000X").
+		WillReturnRows(sqlmock.NewRows(appointmentRowColumns).
+			AddRow(5, "John", "Doe", visitDate, visitDate, nil, nil, nil, "CN-0110-000X", "general", 1, "booked", nil, nil, nil))
 
+	result, err := service.GetAppointmentByReference(context.Background(), "oil0-000x")
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, 5, result.ID)
+	assert.Equal(t, "CN-0110-000X", result.Reference)
+
+	// A failed checksum never reaches the database
+	result, err = service.GetAppointmentByReference(context.Background(), "CN-0110-000Y")
 	assert.NoError(t, err)
-	assert.False(t, exists)
+	assert.Nil(t, result)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAppointmentService_BackfillReferences(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	service := NewAppointmentService(&db.DB{DB: sqlDB})
+
+	mock.ExpectQuery(`SELECT id FROM appointments WHERE reference IS NULL ORDER BY id`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	mock.ExpectExec(`UPDATE appointments SET reference = \$2`).
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// Another replica got to row 2 first
+	for i := 0; i < maxReferenceAttempts; i++ {
+		mock.ExpectExec(`UPDATE appointments SET reference = \$2`).
+			WithArgs(2, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	updated, err := service.BackfillReferences(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, updated)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAppointmentService_CancelAppointment(t *testing.T) {
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	upcoming := time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC)
+	past := time.Date(2075, 5, 15, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name        string
+		visitDate   time.Time
+		cancelledAt interface{}
+		affected    int64
+		expectedErr string
+	}{
+		{"success", upcoming, nil, 1, ""},
+		{"already cancelled", upcoming, now, 0, constants.ErrAlreadyCancelled},
+		{"past visit", past, nil, 0, constants.ErrCancelPastVisit},
+		{"lost race", upcoming, nil, 0, constants.ErrAlreadyCancelled},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer sqlDB.Close()
+
+			service := NewAppointmentServiceWithTime(&db.DB{DB: sqlDB}, func() time.Time { return now })
+
+			mock.ExpectQuery(`SELECT .* FROM appointments WHERE id = \$1`).
+				WithArgs(5).
+				WillReturnRows(sqlmock.NewRows(appointmentRowColumns).
+					AddRow(5, "John", "Doe", tc.visitDate, now, nil, tc.cancelledAt, nil, nil, "general", 1, "booked", nil, nil, nil))
+			if tc.cancelledAt == nil && !tc.visitDate.Before(now.Truncate(24*time.Hour)) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE appointments SET status = 'cancelled', cancelled_at = \$2 WHERE id = \$1 AND status = 'booked'`).
+					WithArgs(5, now).
+					WillReturnResult(sqlmock.NewResult(0, tc.affected))
+				if tc.affected > 0 {
+					expectOutboxEvent(mock, constants.EventAppointmentCancelled, 5)
+					expectHistoryEvent(mock, constants.EventAppointmentCancelled, 5)
+					mock.ExpectCommit()
+				} else {
+					mock.ExpectRollback()
+				}
+			}
+
+			result, err := service.CancelAppointment(context.Background(), 5)
+
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				assert.Nil(t, result)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, now, *result.CancelledAt)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestAppointmentService_CancelAppointment_NotFound(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	service := NewAppointmentService(&db.DB{DB: sqlDB})
+
+	mock.ExpectQuery(`SELECT .* FROM appointments WHERE id = \$1`).
+		WithArgs(99).
+		WillReturnError(sql.ErrNoRows)
+
+	result, err := service.CancelAppointment(context.Background(), 99)
+
+	assert.EqualError(t, err, constants.ErrAppointmentNotFound)
+	assert.Nil(t, result)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAppointmentService_CreateAppointment_BookingLimit(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	service := NewAppointmentServiceWithTime(&db.DB{DB: sqlDB}, func() time.Time { return now }).
+		WithBookingLimit(2)
+
+	req := &models.CreateAppointmentRequest{
+		FirstName:      "John",
+		LastName:       "Doe",
+		VisitDate:      "2075-06-15",
+		ServiceType:    "general",
+		CitizenSubject: "citizen-123",
+	}
+
+	mock.ExpectBegin()
+	expectQuotaCheck(mock, "general", 1, 0, 0, 0)
+	expectActiveBookings(mock, "citizen-123", now, 2)
+	mock.ExpectRollback()
+
+	result, err := service.CreateAppointment(context.Background(), req)
+
+	assert.EqualError(t, err, constants.ErrBookingLimitReached)
+	assert.Nil(t, result)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAppointmentService_CreateAppointment_TokenlessBookingLimit(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	service := NewAppointmentServiceWithTime(&db.DB{DB: sqlDB}, func() time.Time { return now }).
+		WithBookingLimit(2)
+
+	// Without a token the citizen is known by their email address
+	mock.ExpectBegin()
+	expectQuotaCheck(mock, "general", 1, 0, 0, 0)
+	expectTokenlessBookings(mock, "john@example.com", now, 2)
+	mock.ExpectRollback()
+
+	result, err := service.CreateAppointment(context.Background(), &models.CreateAppointmentRequest{
+		FirstName: "John", LastName: "Doe", Email: " John@Example.com", VisitDate: "2075-06-15", ServiceType: "general",
+	})
+
+	assert.EqualError(t, err, constants.ErrBookingLimitReached)
+	assert.Nil(t, result)
+
+	// With neither there is nothing to count the bookings by
+	mock.ExpectBegin()
+	expectQuotaCheck(mock, "general", 1, 0, 0, 0)
+	mock.ExpectRollback()
+
+	result, err = service.CreateAppointment(context.Background(), &models.CreateAppointmentRequest{
+		FirstName: "John", LastName: "Doe", VisitDate: "2075-06-15", ServiceType: "general",
+	})
+
+	assert.EqualError(t, err, constants.ErrIdentityRequired, "anonymous bookings are not exempt from the cap")
+	assert.Nil(t, result)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+type recordingConfirmations struct {
+	sent []*models.Appointment
+}
+
+func (r *recordingConfirmations) SendConfirmation(ctx context.Context, appointment *models.Appointment) error {
+	r.sent = append(r.sent, appointment)
+	return errors.New("smtp unavailable")
+}
+
+func TestAppointmentService_CreateAppointment_SendsConfirmation(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	confirmations := &recordingConfirmations{}
+	service := NewAppointmentServiceWithTime(&db.DB{DB: sqlDB}, func() time.Time { return now }).
+		WithConfirmations(confirmations)
+
+	req := &models.CreateAppointmentRequest{
+		FirstName:   "John",
+		LastName:    "Doe",
+		VisitDate:   "2075-06-15",
+		ServiceType: "general",
+		Email:       "john@example.com",
+	}
+
+	mock.ExpectBegin()
+	expectQuotaCheck(mock, "general", 1, 0, 0, 0)
+	expectStaffAssignment(mock, 1)
+	mock.ExpectQuery(`INSERT INTO appointments`).
+		WithArgs("John", "Doe", sqlmock.AnyArg(), nil, "john@example.com", sqlmock.AnyArg(), "general", 1, nil, nil, "J500", "D000").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, now))
+	expectOutboxEvent(mock, constants.EventAppointmentCreated, 1)
+	expectHistoryEvent(mock, constants.EventAppointmentCreated, 1)
+	mock.ExpectCommit()
+
+	result, err := service.CreateAppointment(context.Background(), req)
+
+	require.NoError(t, err, "notification failures must not fail the booking")
+	require.Len(t, confirmations.sent, 1)
+	assert.Equal(t, result, confirmations.sent[0])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// expectActiveBookings expects the citizen to be locked and their upcoming bookings counted
+func expectActiveBookings(mock sqlmock.Sqlmock, citizenSubject string, now time.Time, active int) {
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock\(` + tenantLockPattern + `\)`).
+		WithArgs(citizenSubject).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM appointments WHERE citizen_subject = \$1 AND cancelled_at IS NULL AND visit_date >= \$2`).
+		WithArgs(citizenSubject, now.Truncate(24*time.Hour)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(active))
+}
+
+// expectTokenlessBookings expects the email address to be locked and the
+// upcoming bookings made under it without a token counted
+func expectTokenlessBookings(mock sqlmock.Sqlmock, email string, now time.Time, active int) {
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock\(` + tenantLockPattern + `\)`).
+		WithArgs("email:" + email).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM appointments WHERE citizen_subject IS NULL AND lower\(trim\(email\)\) = \$1 AND cancelled_at IS NULL AND visit_date >= \$2`).
+		WithArgs(email, now.Truncate(24*time.Hour)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(active))
+}
+
+func expectOutboxEvent(mock sqlmock.Sqlmock, eventType string, appointmentID int) {
+	mock.ExpectExec(`INSERT INTO outbox_events \(event_type, aggregate_id, payload\) VALUES \(\$1, \$2, \$3\)`).
+		WithArgs(eventType, appointmentID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+// expectHistoryEvent expects the history entry of a change, written in the same transaction
+func expectHistoryEvent(mock sqlmock.Sqlmock, action string, appointmentID int) {
+	mock.ExpectExec(`INSERT INTO appointment_events \(appointment_id, action, actor, api_key_id, request_id, old_values, new_values, created_at\)`).
+		WithArgs(appointmentID, action, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+func TestAppointmentService_CreateAppointment_OutboxFailureRollsBack(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	confirmations := &recordingConfirmations{}
+	service := NewAppointmentServiceWithTime(&db.DB{DB: sqlDB}, func() time.Time { return now }).
+		WithConfirmations(confirmations)
+
+	req := &models.CreateAppointmentRequest{
+		FirstName:   "John",
+		LastName:    "Doe",
+		VisitDate:   "2075-06-15",
+		ServiceType: "general",
+	}
+
+	mock.ExpectBegin()
+	expectQuotaCheck(mock, "general", 1, 0, 0, 0)
+	expectStaffAssignment(mock, 1)
+	mock.ExpectQuery(`INSERT INTO appointments`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, now))
+	mock.ExpectExec(`INSERT INTO outbox_events`).
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	result, err := service.CreateAppointment(context.Background(), req)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to enqueue appointment.created event")
+	assert.Nil(t, result)
+	assert.Empty(t, confirmations.sent, "no confirmation for a booking that was rolled back")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAppointmentService_RescheduleAppointment(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	oldDate := time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC)
+	newDate := time.Date(2075, 6, 20, 0, 0, 0, 0, time.UTC)
+	service := NewAppointmentServiceWithTime(&db.DB{DB: sqlDB}, func() time.Time { return now })
+
+	mock.ExpectQuery(`SELECT .* FROM appointments WHERE id = \$1`).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows(appointmentRowColumns).
+			AddRow(5, "John", "Doe", oldDate, now, nil, nil, nil, nil, "general", 1, "booked", nil, nil, nil))
+	mock.ExpectBegin()
+	expectQuotaCheck(mock, "general", 1, 0, 0, 0)
+	expectStaffAssignment(mock, 2)
+	mock.ExpectExec(`UPDATE appointments SET visit_date = \$2, staff_id = \$3 WHERE id = \$1 AND status = 'booked'`).
+		WithArgs(5, newDate, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM reminders_sent WHERE appointment_id = \$1`).
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectOutboxEvent(mock, constants.EventAppointmentRescheduled, 5)
+	expectHistoryEvent(mock, constants.EventAppointmentRescheduled, 5)
+	mock.ExpectCommit()
+
+	result, err := service.RescheduleAppointment(context.Background(), 5, "2075-06-20")
+
+	require.NoError(t, err)
+	assert.Equal(t, newDate, result.VisitDate)
+	require.NotNil(t, result.StaffID)
+	assert.Equal(t, 2, *result.StaffID, "the booking moves to a clerk working on the new date")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAppointmentService_RescheduleAppointment_Rejected(t *testing.T) {
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	upcoming := time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC)
+	past := time.Date(2075, 5, 15, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name        string
+		newDate     string
+		visitDate   time.Time
+		cancelledAt interface{}
+		dateTaken   bool
+		expectedErr string
+	}{
+		{"new date in the past", "2075-05-20", upcoming, nil, false, constants.ErrPastDate},
+		{"cancelled", "2075-06-20", upcoming, now, false, constants.ErrAlreadyCancelled},
+		{"visit already happened", "2075-06-20", past, nil, false, constants.ErrReschedulePastVisit},
+		{"date taken", "2075-06-20", upcoming, nil, true, constants.ErrDuplicateAppointment + " 2075-06-20"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer sqlDB.Close()
+
+			service := NewAppointmentServiceWithTime(&db.DB{DB: sqlDB}, func() time.Time { return now })
+
+			if tc.expectedErr != constants.ErrPastDate {
+				mock.ExpectQuery(`SELECT .* FROM appointments WHERE id = \$1`).
+					WithArgs(5).
+					WillReturnRows(sqlmock.NewRows(appointmentRowColumns).
+						AddRow(5, "John", "Doe", tc.visitDate, now, nil, tc.cancelledAt, nil, nil, "general", 1, "booked", nil, nil, nil))
+			}
+			if tc.dateTaken {
+				mock.ExpectBegin()
+				expectQuotaCheck(mock, "general", 1, 1, 0, 0)
+				mock.ExpectRollback()
+			}
+
+			result, err := service.RescheduleAppointment(context.Background(), 5, tc.newDate)
+
+			assert.EqualError(t, err, tc.expectedErr)
+			assert.Nil(t, result)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestAppointmentService_RescheduleAppointment_CheckedIn(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	service := NewAppointmentServiceWithTime(&db.DB{DB: sqlDB}, func() time.Time { return now })
+
+	mock.ExpectQuery(`SELECT .* FROM appointments WHERE id = \$1`).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows(appointmentRowColumns).
+			AddRow(5, "John", "Doe", now.Truncate(24*time.Hour), now, nil, nil, nil, nil, "general", 1, "checked_in", now, nil, nil))
+
+	result, err := service.RescheduleAppointment(context.Background(), 5, "2075-06-20")
+
+	assert.EqualError(t, err, constants.ErrInvalidTransition+" from checked_in to booked")
+	assert.Nil(t, result)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAppointmentService_CheckIn(t *testing.T) {
+	now := time.Date(2075, 6, 15, 9, 30, 0, 0, time.UTC)
+	today := time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name        string
+		visitDate   time.Time
+		status      string
+		affected    int64
+		expectedErr string
+	}{
+		{"success", today, StatusBooked, 1, ""},
+		{"visit tomorrow", today.AddDate(0, 0, 1), StatusBooked, 0, constants.ErrNotVisitDay},
+		{"already checked in", today, StatusCheckedIn, 0, constants.ErrInvalidTransition + " from checked_in to checked_in"},
+		{"cancelled", today, StatusCancelled, 0, constants.ErrInvalidTransition + " from cancelled to checked_in"},
+		{"lost race", today, StatusBooked, 0, constants.ErrInvalidTransition + " from booked to checked_in"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer sqlDB.Close()
+
+			service := NewAppointmentServiceWithTime(&db.DB{DB: sqlDB}, func() time.Time { return now })
+
+			mock.ExpectQuery(`SELECT .* FROM appointments WHERE id = \$1`).
+				WithArgs(5).
+				WillReturnRows(sqlmock.NewRows(appointmentRowColumns).
+					AddRow(5, "John", "Doe", tc.visitDate, now, nil, nil, nil, nil, "general", 1, tc.status, nil, nil, nil))
+			if tc.status == StatusBooked && tc.visitDate.Equal(today) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE appointments SET status = \$3, checked_in_at = \$4 WHERE id = \$1 AND status = \$2`).
+					WithArgs(5, StatusBooked, StatusCheckedIn, now).
+					WillReturnResult(sqlmock.NewResult(0, tc.affected))
+				if tc.affected > 0 {
+					expectOutboxEvent(mock, constants.EventAppointmentCheckedIn, 5)
+					expectHistoryEvent(mock, constants.EventAppointmentCheckedIn, 5)
+					mock.ExpectCommit()
+				} else {
+					mock.ExpectRollback()
+				}
+			}
+
+			result, err := service.CheckIn(context.Background(), 5)
+
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				assert.Nil(t, result)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, StatusCheckedIn, result.Status)
+				require.NotNil(t, result.CheckedInAt)
+				assert.Equal(t, now, *result.CheckedInAt)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestAppointmentService_CompleteVisit(t *testing.T) {
+	now := time.Date(2075, 6, 15, 10, 0, 0, 0, time.UTC)
+	today := time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name        string
+		status      string
+		expectedErr string
+	}{
+		{"success", StatusCheckedIn, ""},
+		{"not checked in", StatusBooked, constants.ErrInvalidTransition + " from booked to completed"},
+		{"no-show", StatusNoShow, constants.ErrInvalidTransition + " from no_show to completed"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer sqlDB.Close()
+
+			service := NewAppointmentServiceWithTime(&db.DB{DB: sqlDB}, func() time.Time { return now })
+
+			mock.ExpectQuery(`SELECT .* FROM appointments WHERE id = \$1`).
+				WithArgs(5).
+				WillReturnRows(sqlmock.NewRows(appointmentRowColumns).
+					AddRow(5, "John", "Doe", today, now, nil, nil, nil, nil, "general", 1, tc.status, nil, nil, nil))
+			if tc.expectedErr == "" {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE appointments SET status = \$3, completed_at = \$4 WHERE id = \$1 AND status = \$2`).
+					WithArgs(5, StatusCheckedIn, StatusCompleted, now).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				expectOutboxEvent(mock, constants.EventAppointmentCompleted, 5)
+				expectHistoryEvent(mock, constants.EventAppointmentCompleted, 5)
+				mock.ExpectCommit()
+			}
+
+			result, err := service.CompleteVisit(context.Background(), 5)
+
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				assert.Nil(t, result)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, StatusCompleted, result.Status)
+				require.NotNil(t, result.CompletedAt)
+				assert.Equal(t, now, *result.CompletedAt)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestAppointmentService_CompleteVisit_NotFound(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	service := NewAppointmentService(&db.DB{DB: sqlDB})
+
+	mock.ExpectQuery(`SELECT .* FROM appointments WHERE id = \$1`).
+		WithArgs(99).
+		WillReturnError(sql.ErrNoRows)
+
+	result, err := service.CompleteVisit(context.Background(), 99)
+
+	assert.EqualError(t, err, constants.ErrAppointmentNotFound)
+	assert.Nil(t, result)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAppointmentService_ListAppointments_DefaultRange(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	today := time.Date(2075, 6, 1, 0, 0, 0, 0, time.UTC)
+	service := NewAppointmentServiceWithTime(&db.DB{DB: sqlDB}, func() time.Time { return now })
+
+	mock.ExpectQuery(`SELECT .* FROM appointments WHERE visit_date >= \$1 AND visit_date <= \$2 ORDER BY visit_date, id`).
+		WithArgs(today, today.AddDate(0, 0, 90)).
+		WillReturnRows(sqlmock.NewRows(appointmentRowColumns).
+			AddRow(1, "John", "Doe", today, now, nil, nil, nil, nil, "general", 1, "booked", nil, nil, nil))
+
+	result, err := service.ListAppointments(context.Background(), time.Time{}, time.Time{})
+
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+	assert.Equal(t, "John", result[0].FirstName)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAppointmentService_Revisions(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	changed := time.Date(2075, 6, 2, 9, 0, 0, 0, time.UTC)
+	service := NewAppointmentService(&db.DB{DB: sqlDB})
+
+	mock.ExpectQuery(`SELECT appointment_id, COUNT\(\*\) FILTER \(WHERE action <> \$2\), MAX\(created_at\) FROM appointment_events WHERE appointment_id = ANY\(\$1\) GROUP BY appointment_id`).
+		WithArgs("{1,2}", constants.EventAppointmentCreated).
+		WillReturnRows(sqlmock.NewRows([]string{"appointment_id", "count", "max"}).AddRow(2, 1, changed))
+
+	revisions, err := service.Revisions(context.Background(), []int{1, 2})
+
+	require.NoError(t, err)
+	assert.Equal(t, map[int]models.Revision{2: {Sequence: 1, LastModified: changed}}, revisions)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestScanAppointment_OpensSealedNames(t *testing.T) {
+	keyring := testKeyring(t, "2075-06")
+	pii.Use(keyring)
+	defer pii.Use(nil)
+
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	first, err := keyring.Seal("John")
+	require.NoError(t, err)
+	last, err := keyring.Seal("Doe")
+	require.NoError(t, err)
+	mock.ExpectQuery(`SELECT`).
+		WillReturnRows(sqlmock.NewRows(appointmentRowColumns).
+			AddRow(5, first, last, time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC), time.Date(2075, 6, 1, 0, 0, 0, 0, time.UTC), nil, nil, nil, "CN-7K4Q-2M9X", "general", 1, "booked", nil, nil, nil))
+
+	appointment, err := scanAppointment(sqlDB.QueryRow("SELECT"))
+
+	require.NoError(t, err)
+	assert.Equal(t, "John", appointment.FirstName)
+	assert.Equal(t, "Doe", appointment.LastName)
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/phonetic"
+	"citynext-appointments/internal/pii"
+)
+
+// Duplicate policies decide what happens to a booking that looks like another
+// upcoming booking of the same citizen
+const (
+	DuplicatePolicyOff    = "off"
+	DuplicatePolicyFlag   = "flag"
+	DuplicatePolicyReject = "reject"
+)
+
+// Reasons a booking is taken for a duplicate
+const (
+	DuplicateReasonSameName    = "same_name"
+	DuplicateReasonSimilarName = "similar_name"
+)
+
+// Actions taken on a likely duplicate
+const (
+	DuplicateActionFlagged  = "flagged"
+	DuplicateActionRejected = "rejected"
+)
+
+// maxNameDistance is how many letters two full names may differ by and still
+// be taken for the same citizen's
+const maxNameDistance = 2
+
+// maxDuplicateCandidates bounds how many bookings a new one is compared with
+const maxDuplicateCandidates = 50
+
+// duplicateMatch is an upcoming booking a new one looks like, and why
+type duplicateMatch struct {
+	appointmentID int
+	reason        string
+	// sameCitizen is set when the bookings also share an email address or
+	// citizen token subject; a name alone may belong to two different people
+	sameCitizen bool
+}
+
+// rank orders matches: a shared email or subject counts most, then the same
+// name over a similar one
+func (m *duplicateMatch) rank() int {
+	rank := 1
+	if m.sameCitizen {
+		rank += 2
+	}
+	if m.reason == DuplicateReasonSameName {
+		rank++
+	}
+	return rank
+}
+
+// rejects reports whether policy refuses a booking that made this match. Only
+// matches that share an email or subject are rejected; a name-only match is
+// flagged instead, since namesakes are common.
+func (m *duplicateMatch) rejects(policy string) bool {
+	return policy == DuplicatePolicyReject && m.sameCitizen
+}
+
+// findDuplicate looks for an upcoming booking by what is likely the same
+// citizen under the same or a slightly different spelling of their name.
+// Candidates share the phonetic keys of both names, which works with encrypted
+// names too; their normalised names then have to be equal or differ by at most
+// maxNameDistance letters. The strongest match by rank is returned.
+func findDuplicate(ctx context.Context, tx *sql.Tx, appointment *models.Appointment, now time.Time) (*duplicateMatch, error) {
+	keyring := pii.Active()
+	firstKey, lastKey := phoneticKey(keyring, appointment.FirstName), phoneticKey(keyring, appointment.LastName)
+	if !firstKey.Valid || !lastKey.Valid {
+		return nil, nil
+	}
+
+	query := `
+		SELECT id, first_name, last_name, email, citizen_subject FROM appointments
+		WHERE first_name_phonetic = $1 AND last_name_phonetic = $2
+			AND status = $3 AND visit_date >= $4 AND anonymised_at IS NULL
+		ORDER BY visit_date, id
+		LIMIT $5
+	`
+	rows, err := tx.QueryContext(ctx, query, firstKey, lastKey, StatusBooked, now.Truncate(24*time.Hour), maxDuplicateCandidates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for duplicate bookings: %w", err)
+	}
+	defer rows.Close()
+
+	name := phonetic.Normalise(appointment.FirstName + " " + appointment.LastName)
+	var best *duplicateMatch
+	for rows.Next() {
+		var id int
+		var firstName, lastName string
+		var email, subject sql.NullString
+		if err := rows.Scan(&id, &firstName, &lastName, &email, &subject); err != nil {
+			return nil, fmt.Errorf("failed to check for duplicate bookings: %w", err)
+		}
+		if err := openNames(&firstName, &lastName); err != nil {
+			return nil, err
+		}
+
+		match := &duplicateMatch{appointmentID: id, sameCitizen: sharesContact(appointment, email.String, subject.String)}
+		candidate := phonetic.Normalise(firstName + " " + lastName)
+		switch {
+		case candidate == name:
+			match.reason = DuplicateReasonSameName
+		case editDistance(candidate, name) <= maxNameDistance:
+			match.reason = DuplicateReasonSimilarName
+		default:
+			continue
+		}
+		if best == nil || match.rank() > best.rank() {
+			best = match
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to check for duplicate bookings: %w", err)
+	}
+	return best, nil
+}
+
+// sharesContact reports whether appointment has the given email address or
+// citizen subject. Empty values never match.
+func sharesContact(appointment *models.Appointment, email, subject string) bool {
+	if appointment.CitizenSubject != "" && appointment.CitizenSubject == subject {
+		return true
+	}
+	return appointment.Email != "" && strings.EqualFold(strings.TrimSpace(appointment.Email), strings.TrimSpace(email))
+}
+
+// execer is satisfied by both *db.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// recordDuplicate stores why a booking for visitDate was taken for a duplicate
+// and what was done about it. appointmentID is 0 for a rejected booking.
+func recordDuplicate(ctx context.Context, exec execer, match *duplicateMatch, appointmentID int, visitDate time.Time, action string, now time.Time) error {
+	query := `
+		INSERT INTO duplicate_matches (appointment_id, matched_appointment_id, visit_date, reason, action, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := exec.ExecContext(ctx, query, sql.NullInt64{Int64: int64(appointmentID), Valid: appointmentID != 0},
+		match.appointmentID, visitDate, match.reason, action, now)
+	if err != nil {
+		return fmt.Errorf("failed to record duplicate booking: %w", err)
+	}
+	return nil
+}
+
+// editDistance is the Levenshtein distance between a and b in characters
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+// DuplicateService lists the bookings taken for duplicates, for review
+type DuplicateService struct {
+	db *db.DB
+}
+
+func NewDuplicateService(database *db.DB) *DuplicateService {
+	return &DuplicateService{db: database}
+}
+
+// Matches returns the latest recorded duplicates, newest first, optionally
+// only those flagged or rejected
+func (s *DuplicateService) Matches(ctx context.Context, action string, limit int) ([]models.DuplicateMatch, error) {
+	query := `
+		SELECT id, appointment_id, matched_appointment_id, visit_date, reason, action, created_at
+		FROM duplicate_matches
+		WHERE $1 = '' OR action = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`
+	rows, err := s.db.QueryContext(ctx, query, action, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read duplicate bookings: %w", err)
+	}
+	defer rows.Close()
+
+	matches := []models.DuplicateMatch{}
+	for rows.Next() {
+		var match models.DuplicateMatch
+		var appointmentID sql.NullInt64
+		if err := rows.Scan(&match.ID, &appointmentID, &match.MatchedAppointmentID, &match.VisitDate,
+			&match.Reason, &match.Action, &match.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to read duplicate bookings: %w", err)
+		}
+		if appointmentID.Valid {
+			id := int(appointmentID.Int64)
+			match.AppointmentID = &id
+		}
+		matches = append(matches, match)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read duplicate bookings: %w", err)
+	}
+	return matches, nil
+}
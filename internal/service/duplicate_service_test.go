@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/tenant"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expectDuplicateCheck expects the lookup of upcoming bookings sharing the phonetic keys of a new one
+func expectDuplicateCheck(mock sqlmock.Sqlmock, firstKey, lastKey string, now time.Time, candidates *sqlmock.Rows) {
+	mock.ExpectQuery(`SELECT id, first_name, last_name, email, citizen_subject FROM appointments WHERE first_name_phonetic = \$1 AND last_name_phonetic = \$2 AND status = \$3 AND visit_date >= \$4 AND anonymised_at IS NULL ORDER BY visit_date, id LIMIT \$5`).
+		WithArgs(firstKey, lastKey, StatusBooked, now.Truncate(24*time.Hour), maxDuplicateCandidates).
+		WillReturnRows(candidates)
+}
+
+// duplicateCandidates returns the columns findDuplicate reads for each candidate
+func duplicateCandidates() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "first_name", "last_name", "email", "citizen_subject"})
+}
+
+func TestAppointmentService_CreateAppointment_FlagsDuplicate(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	visitDate := time.Date(2075, 6, 17, 0, 0, 0, 0, time.UTC)
+	service := NewAppointmentServiceWithTime(&db.DB{DB: sqlDB}, func() time.Time { return now }).
+		WithDuplicatePolicy(DuplicatePolicyFlag)
+
+	mock.ExpectBegin()
+	expectQuotaCheck(mock, "general", 1, 0, 0, 0)
+	expectDuplicateCheck(mock, "J500", "D000", now, duplicateCandidates().
+		AddRow(3, "Jim", "Dee", nil, nil).
+		AddRow(4, "Jöhn ", "Doe", nil, nil))
+	expectStaffAssignment(mock, 1)
+	mock.ExpectQuery(`INSERT INTO appointments`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(5, now))
+	expectOutboxEvent(mock, constants.EventAppointmentCreated, 5)
+	expectHistoryEvent(mock, constants.EventAppointmentCreated, 5)
+	mock.ExpectExec(`INSERT INTO duplicate_matches \(appointment_id, matched_appointment_id, visit_date, reason, action, created_at\)`).
+		WithArgs(int64(5), 4, visitDate, DuplicateReasonSimilarName, DuplicateActionFlagged, now).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	result, err := service.CreateAppointment(context.Background(), &models.CreateAppointmentRequest{
+		FirstName: "Jon", LastName: "Doe", VisitDate: "2075-06-17", ServiceType: "general",
+	})
+
+	require.NoError(t, err, "a flagged booking is still made")
+	assert.Equal(t, 5, result.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAppointmentService_CreateAppointment_RejectsDuplicate(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	visitDate := time.Date(2075, 6, 17, 0, 0, 0, 0, time.UTC)
+	service := NewAppointmentServiceWithTime(&db.DB{DB: sqlDB}, func() time.Time { return now }).
+		WithDuplicatePolicy(DuplicatePolicyReject)
+
+	mock.ExpectBegin()
+	expectQuotaCheck(mock, "general", 1, 0, 0, 0)
+	expectDuplicateCheck(mock, "J500", "D000", now, duplicateCandidates().
+		AddRow(2, "John", "Doe", "someone@example.com", nil).
+		AddRow(3, "Jon", "Doe", "john@example.com", nil).
+		AddRow(4, "John", "  DOE", " JOHN@example.com", nil))
+	mock.ExpectRollback()
+	mock.ExpectExec(`INSERT INTO duplicate_matches`).
+		WithArgs(nil, 4, visitDate, DuplicateReasonSameName, DuplicateActionRejected, now).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	result, err := service.CreateAppointment(context.Background(), &models.CreateAppointmentRequest{
+		FirstName: "John", LastName: "Doe", Email: "john@example.com", VisitDate: "2075-06-17", ServiceType: "general",
+	})
+
+	assert.EqualError(t, err, constants.ErrPossibleDuplicate)
+	assert.Nil(t, result)
+	assert.NoError(t, mock.ExpectationsWereMet(), "a shared email wins, then the same name over a similar one")
+}
+
+func TestAppointmentService_CreateAppointment_FlagsNameOnlyDuplicate(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	visitDate := time.Date(2075, 6, 17, 0, 0, 0, 0, time.UTC)
+	service := NewAppointmentServiceWithTime(&db.DB{DB: sqlDB}, func() time.Time { return now }).
+		WithDuplicatePolicy(DuplicatePolicyReject)
+
+	mock.ExpectBegin()
+	expectQuotaCheck(mock, "general", 1, 0, 0, 0)
+	expectDuplicateCheck(mock, "J500", "D000", now, duplicateCandidates().
+		AddRow(4, "John", "Doe", "other@example.com", "citizen-9"))
+	expectStaffAssignment(mock, 1)
+	mock.ExpectQuery(`INSERT INTO appointments`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(5, now))
+	expectOutboxEvent(mock, constants.EventAppointmentCreated, 5)
+	expectHistoryEvent(mock, constants.EventAppointmentCreated, 5)
+	mock.ExpectExec(`INSERT INTO duplicate_matches`).
+		WithArgs(int64(5), 4, visitDate, DuplicateReasonSameName, DuplicateActionFlagged, now).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	result, err := service.CreateAppointment(context.Background(), &models.CreateAppointmentRequest{
+		FirstName: "John", LastName: "Doe", Email: "john@example.com", VisitDate: "2075-06-17", ServiceType: "general",
+	})
+
+	require.NoError(t, err, "a namesake is flagged, not refused")
+	assert.Equal(t, 5, result.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAppointmentService_CreateAppointment_TenantDuplicatePolicy(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	visitDate := time.Date(2075, 6, 17, 0, 0, 0, 0, time.UTC)
+	service := NewAppointmentServiceWithTime(&db.DB{DB: sqlDB}, func() time.Time { return now }).
+		WithDuplicatePolicy(DuplicatePolicyOff)
+	ctx := tenant.WithTenant(context.Background(), &tenant.Tenant{ID: 2, DuplicatePolicy: DuplicatePolicyReject})
+
+	mock.ExpectBegin()
+	expectQuotaCheck(mock, "general", 1, 0, 0, 0)
+	expectDuplicateCheck(mock, "J500", "D000", now, duplicateCandidates().
+		AddRow(3, "John", "Doe", nil, "citizen-123"))
+	mock.ExpectRollback()
+	mock.ExpectExec(`INSERT INTO duplicate_matches`).
+		WithArgs(nil, 3, visitDate, DuplicateReasonSameName, DuplicateActionRejected, now).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	_, err = service.CreateAppointment(ctx, &models.CreateAppointmentRequest{
+		FirstName: "John", LastName: "Doe", VisitDate: "2075-06-17", ServiceType: "general", CitizenSubject: "citizen-123",
+	})
+
+	assert.EqualError(t, err, constants.ErrPossibleDuplicate, "the tenant's policy overrides the service-wide one")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("john doe", "john doe"))
+	assert.Equal(t, 1, editDistance("jon doe", "john doe"))
+	assert.Equal(t, 3, editDistance("jim doe", "john doe"))
+	assert.Equal(t, 1, editDistance("zoe", "zoë"))
+	assert.Equal(t, 3, editDistance("", "doe"))
+}
+
+func TestDuplicateService_Matches(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	visitDate := time.Date(2075, 6, 17, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT id, appointment_id, matched_appointment_id, visit_date, reason, action, created_at FROM duplicate_matches WHERE \$1 = '' OR action = \$1 ORDER BY id DESC LIMIT \$2`).
+		WithArgs("", 50).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "appointment_id", "matched_appointment_id", "visit_date", "reason", "action", "created_at"}).
+			AddRow(2, nil, 4, visitDate, DuplicateReasonSameName, DuplicateActionRejected, now).
+			AddRow(1, 5, 4, visitDate, DuplicateReasonSimilarName, DuplicateActionFlagged, now))
+
+	matches, err := NewDuplicateService(&db.DB{DB: sqlDB}).Matches(context.Background(), "", 50)
+
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+	assert.Nil(t, matches[0].AppointmentID)
+	require.NotNil(t, matches[1].AppointmentID)
+	assert.Equal(t, 5, *matches[1].AppointmentID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
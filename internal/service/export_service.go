@@ -0,0 +1,212 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/models"
+)
+
+// Export formats
+const (
+	ExportFormatCSV   = "csv"
+	ExportFormatJSONL = "jsonl"
+)
+
+// exportFetchSize is how many rows are pulled from the cursor at a time
+const exportFetchSize = 1000
+
+// csvHeader names the exported columns, in the order written by csvRecord
+var csvHeader = []string{"id", "reference", "first_name", "last_name", "email", "service_type", "visit_date", "created_at", "citizen_subject", "cancelled_at", "staff_id", "status"}
+
+// ExportService streams appointments for reporting
+type ExportService struct {
+	db *db.DB
+}
+
+func NewExportService(database *db.DB) *ExportService {
+	return &ExportService{db: database}
+}
+
+// ParseExportFormat validates a format name
+func ParseExportFormat(format string) (string, error) {
+	switch format {
+	case ExportFormatCSV, ExportFormatJSONL:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown export format %q, expected csv or jsonl", format)
+}
+
+// exportWriter writes appointments in one format
+type exportWriter interface {
+	write(appointment *models.Appointment) error
+	flush() error
+}
+
+// flusher is implemented by HTTP response writers that can push buffered data to the client
+type flusher interface {
+	Flush()
+}
+
+// Export writes every appointment, including cancelled ones, with a visit date between
+// from and to inclusive. Zero bounds are open. Rows are read through a server-side
+// cursor in batches, so memory use does not grow with the size of the export.
+func (s *ExportService) Export(ctx context.Context, w io.Writer, format string, from, to time.Time) (int, error) {
+	var out exportWriter
+	buffered := bufio.NewWriter(w)
+	switch format {
+	case ExportFormatCSV:
+		cw := csv.NewWriter(buffered)
+		if err := cw.Write(csvHeader); err != nil {
+			return 0, fmt.Errorf("failed to write export: %w", err)
+		}
+		out = &csvExportWriter{w: cw}
+	case ExportFormatJSONL:
+		out = &jsonlExportWriter{enc: json.NewEncoder(buffered)}
+	default:
+		return 0, fmt.Errorf("unknown export format %q, expected csv or jsonl", format)
+	}
+
+	// Cursors only live inside a transaction; read only keeps it cheap
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin export: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SET TRANSACTION READ ONLY`); err != nil {
+		return 0, fmt.Errorf("failed to begin export: %w", err)
+	}
+
+	// Parameters are not supported in DECLARE, the bounds are formatted dates only
+	query := `DECLARE export_cursor NO SCROLL CURSOR FOR
+		SELECT ` + appointmentColumns + `
+		FROM appointments` + exportRange(from, to) + `
+		ORDER BY visit_date, id`
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return 0, fmt.Errorf("failed to open export cursor: %w", err)
+	}
+
+	total := 0
+	fetch := `FETCH FORWARD ` + strconv.Itoa(exportFetchSize) + ` FROM export_cursor`
+	for {
+		rows, err := tx.QueryContext(ctx, fetch)
+		if err != nil {
+			return total, fmt.Errorf("failed to read export cursor: %w", err)
+		}
+
+		batch := 0
+		for rows.Next() {
+			appointment, err := scanAppointment(rows)
+			if err == nil {
+				err = out.write(appointment)
+			}
+			if err != nil {
+				rows.Close()
+				return total, fmt.Errorf("failed to export appointment: %w", err)
+			}
+			batch++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return total, fmt.Errorf("failed to read export cursor: %w", err)
+		}
+		total += batch
+
+		// Push every batch to the client instead of holding it in memory
+		if err := out.flush(); err != nil {
+			return total, fmt.Errorf("failed to write export: %w", err)
+		}
+		if err := buffered.Flush(); err != nil {
+			return total, fmt.Errorf("failed to write export: %w", err)
+		}
+		if f, ok := w.(flusher); ok {
+			f.Flush()
+		}
+
+		if batch < exportFetchSize {
+			break
+		}
+	}
+
+	return total, tx.Commit()
+}
+
+// exportRange builds the WHERE clause for the optional date bounds
+func exportRange(from, to time.Time) string {
+	var conditions []string
+	if !from.IsZero() {
+		conditions = append(conditions, "visit_date >= '"+from.Format(constants.DateLayout)+"'")
+	}
+	if !to.IsZero() {
+		conditions = append(conditions, "visit_date <= '"+to.Format(constants.DateLayout)+"'")
+	}
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "\n\t\tWHERE " + strings.Join(conditions, " AND ")
+}
+
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvExportWriter) write(a *models.Appointment) error {
+	cancelledAt := ""
+	if a.CancelledAt != nil {
+		cancelledAt = a.CancelledAt.Format(time.RFC3339)
+	}
+	staffID := ""
+	if a.StaffID != nil {
+		staffID = strconv.Itoa(*a.StaffID)
+	}
+	return c.w.Write([]string{
+		strconv.Itoa(a.ID),
+		a.Reference,
+		csvSafe(a.FirstName),
+		csvSafe(a.LastName),
+		csvSafe(a.Email),
+		csvSafe(a.ServiceType),
+		a.VisitDate.Format(constants.DateLayout),
+		a.CreatedAt.Format(time.RFC3339),
+		csvSafe(a.CitizenSubject),
+		cancelledAt,
+		staffID,
+		a.Status,
+	})
+}
+
+func (c *csvExportWriter) flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// csvSafe stops spreadsheet applications from evaluating user supplied text as a formula
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+type jsonlExportWriter struct {
+	enc *json.Encoder
+}
+
+func (j *jsonlExportWriter) write(a *models.Appointment) error {
+	// Encode terminates every value with a newline
+	return j.enc.Encode(a)
+}
+
+func (j *jsonlExportWriter) flush() error {
+	return nil
+}
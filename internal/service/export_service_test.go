@@ -0,0 +1,94 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/db"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func expectExportCursor(mock sqlmock.Sqlmock, where string, rows *sqlmock.Rows) {
+	mock.ExpectBegin()
+	mock.ExpectExec(`SET TRANSACTION READ ONLY`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DECLARE export_cursor NO SCROLL CURSOR FOR SELECT .* FROM appointments` + where + ` ORDER BY visit_date, id`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FETCH FORWARD 1000 FROM export_cursor`).WillReturnRows(rows)
+	mock.ExpectCommit()
+}
+
+func TestExportService_Export_CSV(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	visitDate := time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC)
+	createdAt := time.Date(2075, 6, 1, 10, 0, 0, 0, time.UTC)
+	expectExportCursor(mock, ` WHERE visit_date >= '2075-06-01' AND visit_date <= '2075-06-30'`,
+		sqlmock.NewRows(appointmentRowColumns).
+			AddRow(1, "John", "Doe, Jr.", visitDate, createdAt, "citizen-1", nil, "john@example.com", "CN-0110-000X", "general", 2, "booked", nil, nil, nil).
+			AddRow(2, "=HYPERLINK(\"x\")", "Doe", visitDate.AddDate(0, 0, 1), createdAt, nil, createdAt, nil, nil, "general", nil, "cancelled", nil, nil, nil))
+
+	var out bytes.Buffer
+	count, err := NewExportService(&db.DB{DB: sqlDB}).Export(context.Background(), &out, ExportFormatCSV,
+		time.Date(2075, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2075, 6, 30, 0, 0, 0, 0, time.UTC))
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, `id,reference,first_name,last_name,email,service_type,visit_date,created_at,citizen_subject,cancelled_at,staff_id,status
+1,CN-0110-000X,John,"Doe, Jr.",john@example.com,general,2075-06-15,2075-06-01T10:00:00Z,citizen-1,,2,booked
+2,,"'=HYPERLINK(""x"")",Doe,,general,2075-06-16,2075-06-01T10:00:00Z,,2075-06-01T10:00:00Z,,cancelled
+`, out.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExportService_Export_JSONL(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	visitDate := time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC)
+	expectExportCursor(mock, ``,
+		sqlmock.NewRows(appointmentRowColumns).
+			AddRow(1, "John", "Doe", visitDate, visitDate, nil, nil, nil, "CN-0110-000X", "general", nil, "booked", nil, nil, nil))
+
+	var out bytes.Buffer
+	count, err := NewExportService(&db.DB{DB: sqlDB}).Export(context.Background(), &out, ExportFormatJSONL, time.Time{}, time.Time{})
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.JSONEq(t, `{"id":1,"reference":"CN-0110-000X","first_name":"John","last_name":"Doe","service_type":"general","visit_date":"2075-06-15T00:00:00Z","created_at":"2075-06-15T00:00:00Z","status":"booked"}`, out.String())
+	assert.Equal(t, byte('\n'), out.Bytes()[out.Len()-1])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExportService_Export_CursorError(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SET TRANSACTION READ ONLY`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DECLARE export_cursor`).WillReturnError(errors.New("boom"))
+	mock.ExpectRollback()
+
+	_, err = NewExportService(&db.DB{DB: sqlDB}).Export(context.Background(), &bytes.Buffer{}, ExportFormatCSV, time.Time{}, time.Time{})
+
+	assert.EqualError(t, err, "failed to open export cursor: boom")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestParseExportFormat(t *testing.T) {
+	_, err := ParseExportFormat("xlsx")
+	assert.Error(t, err)
+
+	format, err := ParseExportFormat("jsonl")
+	assert.NoError(t, err)
+	assert.Equal(t, ExportFormatJSONL, format)
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/models"
+)
+
+// holdTokenBytes is the entropy of a hold token
+const holdTokenBytes = 24
+
+// HoldService reserves a visit of a service type on a date for a few minutes
+// while a citizen reviews their booking. A hold uses up one slot of the daily
+// quota for everyone else until it is used with CreateAppointment, released, or
+// expires. Expired holds are ignored by every query and deleted by a background sweeper.
+type HoldService struct {
+	db           *db.DB
+	timeProvider func() time.Time
+	defaultTTL   time.Duration
+	maxTTL       time.Duration
+	// maxPerHolder caps the unexpired holds of one citizen or API key, 0 meaning no cap
+	maxPerHolder int
+}
+
+// NewHoldService creates the hold store. Pass the same time provider as the
+// appointment service so holds expire on the simulated clock.
+func NewHoldService(database *db.DB, timeProvider func() time.Time, defaultTTL, maxTTL time.Duration) *HoldService {
+	return &HoldService{
+		db:           database,
+		timeProvider: timeProvider,
+		defaultTTL:   defaultTTL,
+		maxTTL:       maxTTL,
+	}
+}
+
+// WithHolderLimit caps how many dates one citizen may hold at once. Holds placed
+// without a citizen token are capped per API key instead.
+func (s *HoldService) WithHolderLimit(maxPerHolder int) *HoldService {
+	s.maxPerHolder = maxPerHolder
+	return s
+}
+
+// CreateHold reserves a free slot and returns the token that books it
+func (s *HoldService) CreateHold(ctx context.Context, req *models.CreateHoldRequest) (*models.SlotHold, error) {
+	visitDate, err := time.Parse(constants.DateLayout, req.VisitDate)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", constants.ErrInvalidDateFormat, err)
+	}
+
+	now := s.timeProvider()
+	if visitDate.Before(now.Truncate(24 * time.Hour)) {
+		return nil, fmt.Errorf("%s", constants.ErrPastDate)
+	}
+
+	ttl := s.defaultTTL
+	if req.Minutes > 0 {
+		ttl = time.Duration(req.Minutes) * time.Minute
+	}
+	if ttl > s.maxTTL {
+		return nil, fmt.Errorf("%s", constants.ErrHoldTooLong)
+	}
+
+	token, err := generateHoldToken()
+	if err != nil {
+		return nil, err
+	}
+	hold := &models.SlotHold{
+		Token:          token,
+		ServiceType:    req.ServiceType,
+		VisitDate:      visitDate,
+		ExpiresAt:      now.Add(ttl),
+		CitizenSubject: req.CitizenSubject,
+	}
+
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		serviceType, err := findServiceType(ctx, tx, req.ServiceType)
+		if err != nil {
+			return err
+		}
+		if err := lockSlot(ctx, tx, serviceType.Code, visitDate); err != nil {
+			return err
+		}
+
+		// Stop one caller from holding every free date
+		if err := s.checkHolderLimit(ctx, tx, req.CitizenSubject, req.APIKeyID, now); err != nil {
+			return err
+		}
+
+		usage, err := countSlotUsage(ctx, tx, serviceType.Code, visitDate, now)
+		if err != nil {
+			return fmt.Errorf("failed to check existing appointments: %w", err)
+		}
+		if usage.booked+usage.offered >= serviceType.DailyQuota {
+			return fmt.Errorf("%s %s", constants.ErrDuplicateAppointment, req.VisitDate)
+		}
+		// The rest of the quota is held by citizens who may still give it back
+		if usage.total() >= serviceType.DailyQuota {
+			return fmt.Errorf("%s", constants.ErrDateHeld)
+		}
+
+		query := `
+			INSERT INTO slot_holds (token, service_type, visit_date, citizen_subject, api_key_id, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`
+		apiKeyID := sql.NullInt64{Int64: int64(req.APIKeyID), Valid: req.APIKeyID != 0}
+		if _, err := tx.ExecContext(ctx, query, hold.Token, hold.ServiceType, hold.VisitDate, nullString(hold.CitizenSubject), apiKeyID, hold.ExpiresAt); err != nil {
+			return fmt.Errorf("failed to hold date: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+// checkHolderLimit fails when the citizen, or the API key for holds placed
+// without a citizen token, already holds as many dates as allowed. The holder is
+// locked until tx ends so parallel requests cannot each see room for one more.
+func (s *HoldService) checkHolderLimit(ctx context.Context, tx *sql.Tx, citizenSubject string, apiKeyID int, now time.Time) error {
+	if s.maxPerHolder <= 0 {
+		return nil
+	}
+
+	lockKey, query, holder := "hold:citizen:"+citizenSubject,
+		`SELECT COUNT(*) FROM slot_holds WHERE citizen_subject = $1 AND expires_at > $2`, interface{}(citizenSubject)
+	if citizenSubject == "" {
+		if apiKeyID == 0 {
+			return nil
+		}
+		lockKey, query, holder = "hold:key:"+strconv.Itoa(apiKeyID),
+			`SELECT COUNT(*) FROM slot_holds WHERE citizen_subject IS NULL AND api_key_id = $1 AND expires_at > $2`, apiKeyID
+	}
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(`+tenantLockKey+`)`, lockKey); err != nil {
+		return fmt.Errorf("failed to lock holder: %w", err)
+	}
+	var held int
+	if err := tx.QueryRowContext(ctx, query, holder, now).Scan(&held); err != nil {
+		return fmt.Errorf("failed to count holds: %w", err)
+	}
+	if held >= s.maxPerHolder {
+		return fmt.Errorf("%s", constants.ErrTooManyHolds)
+	}
+	return nil
+}
+
+// ReleaseHold gives a held date back before the hold expires
+func (s *HoldService) ReleaseHold(ctx context.Context, token, citizenSubject string) error {
+	query := `DELETE FROM slot_holds WHERE token = $1 AND (citizen_subject IS NULL OR citizen_subject = $2)`
+	result, err := s.db.ExecContext(ctx, query, token, nullString(citizenSubject))
+	if err != nil {
+		return fmt.Errorf("failed to release hold: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to release hold: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s", constants.ErrHoldNotFound)
+	}
+	return nil
+}
+
+// Run deletes expired holds every interval until ctx is cancelled
+func (s *HoldService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.SweepExpired(ctx); err != nil {
+				log.Printf("Releasing expired holds failed: %v", err)
+			}
+		}
+	}
+}
+
+// SweepExpired deletes expired holds and returns how many were removed
+func (s *HoldService) SweepExpired(ctx context.Context) (int, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM slot_holds WHERE expires_at <= $1`, s.timeProvider())
+	if err != nil {
+		return 0, fmt.Errorf("failed to release expired holds: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to release expired holds: %w", err)
+	}
+	return int(affected), nil
+}
+
+// claimHold uses up the caller's unexpired hold on the service type and date
+// inside the booking transaction
+func claimHold(ctx context.Context, tx *sql.Tx, token, serviceType string, date time.Time, citizenSubject string, now time.Time) error {
+	query := `
+		DELETE FROM slot_holds
+		WHERE token = $1 AND service_type = $2 AND visit_date = $3 AND expires_at > $4
+			AND (citizen_subject IS NULL OR citizen_subject = $5)
+	`
+	result, err := tx.ExecContext(ctx, query, token, serviceType, date, now, nullString(citizenSubject))
+	if err != nil {
+		return fmt.Errorf("failed to claim hold: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to claim hold: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s", constants.ErrHoldNotFound)
+	}
+	return nil
+}
+
+func generateHoldToken() (string, error) {
+	token := make([]byte, holdTokenBytes)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("failed to generate hold token: %w", err)
+	}
+	return hex.EncodeToString(token), nil
+}
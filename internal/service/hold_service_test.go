@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHolds(t *testing.T, now time.Time) (*HoldService, sqlmock.Sqlmock) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	return NewHoldService(&db.DB{DB: sqlDB}, func() time.Time { return now }, 10*time.Minute, 30*time.Minute), mock
+}
+
+func TestHoldService_CreateHold(t *testing.T) {
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	visitDate := time.Date(2075, 6, 10, 0, 0, 0, 0, time.UTC)
+
+	// Passport renewals take 8 visits a day
+	testCases := []struct {
+		name        string
+		minutes     int
+		booked      int
+		held        int
+		expiresAt   time.Time
+		expectedErr string
+	}{
+		{"default time", 0, 0, 0, now.Add(10 * time.Minute), ""},
+		{"requested time", 20, 0, 0, now.Add(20 * time.Minute), ""},
+		{"last slot", 0, 6, 1, now.Add(10 * time.Minute), ""},
+		{"booked", 0, 8, 0, time.Time{}, constants.ErrDuplicateAppointment + " 2075-06-10"},
+		{"held by others", 0, 6, 2, time.Time{}, constants.ErrDateHeld},
+		{"too long", 45, 0, 0, time.Time{}, constants.ErrHoldTooLong},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			holds, mock := newTestHolds(t, now)
+
+			if tc.expectedErr != constants.ErrHoldTooLong {
+				mock.ExpectBegin()
+				expectQuotaCheck(mock, "passport-renewal", 8, tc.booked, 0, tc.held)
+				if tc.expectedErr == "" {
+					mock.ExpectExec(`INSERT INTO slot_holds \(token, service_type, visit_date, citizen_subject, api_key_id, expires_at\) VALUES \(\$1, \$2, \$3, \$4, \$5, \$6\)`).
+						WithArgs(sqlmock.AnyArg(), "passport-renewal", visitDate, "citizen-123", nil, tc.expiresAt).
+						WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+				if tc.expectedErr == "" {
+					mock.ExpectCommit()
+				} else {
+					mock.ExpectRollback()
+				}
+			}
+
+			hold, err := holds.CreateHold(context.Background(), &models.CreateHoldRequest{
+				VisitDate:      "2075-06-10",
+				ServiceType:    "passport-renewal",
+				Minutes:        tc.minutes,
+				CitizenSubject: "citizen-123",
+			})
+
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+			} else {
+				require.NoError(t, err)
+				assert.Len(t, hold.Token, 2*holdTokenBytes)
+				assert.Equal(t, tc.expiresAt, hold.ExpiresAt)
+				assert.Equal(t, "passport-renewal", hold.ServiceType)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestHoldService_CreateHold_HolderLimit(t *testing.T) {
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	visitDate := time.Date(2075, 6, 10, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name           string
+		citizenSubject string
+		lockKey        string
+		count          string
+		holder         interface{}
+		held           int
+		expectedErr    string
+	}{
+		{"citizen with room", "citizen-123", "hold:citizen:citizen-123", `WHERE citizen_subject = \$1 AND expires_at > \$2`, "citizen-123", 1, ""},
+		{"citizen at the cap", "citizen-123", "hold:citizen:citizen-123", `WHERE citizen_subject = \$1 AND expires_at > \$2`, "citizen-123", 2, constants.ErrTooManyHolds},
+		{"key at the cap", "", "hold:key:4", `WHERE citizen_subject IS NULL AND api_key_id = \$1 AND expires_at > \$2`, 4, 2, constants.ErrTooManyHolds},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			holds, mock := newTestHolds(t, now)
+			holds.WithHolderLimit(2)
+
+			mock.ExpectBegin()
+			expectServiceType(mock, "passport-renewal", 8)
+			expectSlotLock(mock, "passport-renewal")
+			mock.ExpectExec(`SELECT pg_advisory_xact_lock\(` + tenantLockPattern + `\)`).
+				WithArgs(tc.lockKey).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(`SELECT COUNT\(\*\) FROM slot_holds `+tc.count).
+				WithArgs(tc.holder, now).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tc.held))
+			if tc.expectedErr == "" {
+				expectSlotUsage(mock, "passport-renewal", 0, 0, 0)
+				mock.ExpectExec(`INSERT INTO slot_holds`).
+					WithArgs(sqlmock.AnyArg(), "passport-renewal", visitDate, tc.citizenSubject, sql.NullInt64{Int64: 4, Valid: true}, now.Add(10*time.Minute)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			_, err := holds.CreateHold(context.Background(), &models.CreateHoldRequest{
+				VisitDate:      "2075-06-10",
+				ServiceType:    "passport-renewal",
+				CitizenSubject: tc.citizenSubject,
+				APIKeyID:       4,
+			})
+
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestHoldService_SweepExpired(t *testing.T) {
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	holds, mock := newTestHolds(t, now)
+
+	mock.ExpectExec(`DELETE FROM slot_holds WHERE expires_at <= \$1`).
+		WithArgs(now).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+
+	removed, err := holds.SweepExpired(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 4, removed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAppointmentService_CreateAppointment_WithHold(t *testing.T) {
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	visitDate := time.Date(2075, 6, 10, 0, 0, 0, 0, time.UTC)
+	holds, mock := newTestHolds(t, now)
+	service := NewAppointmentServiceWithTime(holds.db, func() time.Time { return now })
+
+	mock.ExpectBegin()
+	expectServiceType(mock, "general", 1)
+	expectSlotLock(mock, "general")
+	mock.ExpectExec(`DELETE FROM slot_holds WHERE token = \$1 AND service_type = \$2 AND visit_date = \$3 AND expires_at > \$4`).
+		WithArgs("abc", "general", visitDate, now, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectSlotUsage(mock, "general", 0, 0, 0)
+	expectStaffAssignment(mock, 1)
+	mock.ExpectQuery(`INSERT INTO appointments`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(3, now))
+	expectOutboxEvent(mock, constants.EventAppointmentCreated, 3)
+	expectHistoryEvent(mock, constants.EventAppointmentCreated, 3)
+	mock.ExpectCommit()
+
+	appointment, err := service.CreateAppointment(context.Background(), &models.CreateAppointmentRequest{
+		FirstName:   "John",
+		LastName:    "Doe",
+		VisitDate:   "2075-06-10",
+		ServiceType: "general",
+		HoldToken:   "abc",
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, appointment.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAppointmentService_CreateAppointment_Held(t *testing.T) {
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	holds, mock := newTestHolds(t, now)
+	service := NewAppointmentServiceWithTime(holds.db, func() time.Time { return now })
+
+	t.Run("held by someone else", func(t *testing.T) {
+		mock.ExpectBegin()
+		expectQuotaCheck(mock, "general", 1, 0, 0, 1)
+		mock.ExpectRollback()
+
+		_, err := service.CreateAppointment(context.Background(), &models.CreateAppointmentRequest{VisitDate: "2075-06-10", ServiceType: "general"})
+		assert.EqualError(t, err, constants.ErrDuplicateAppointment+" 2075-06-10")
+	})
+
+	t.Run("expired hold", func(t *testing.T) {
+		mock.ExpectBegin()
+		expectServiceType(mock, "general", 1)
+		expectSlotLock(mock, "general")
+		mock.ExpectExec(`DELETE FROM slot_holds WHERE token = \$1`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		_, err := service.CreateAppointment(context.Background(), &models.CreateAppointmentRequest{VisitDate: "2075-06-10", ServiceType: "general", HoldToken: "stale"})
+		assert.EqualError(t, err, constants.ErrHoldNotFound)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -5,54 +5,79 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"citynext-appointments/internal/constants"
 	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/tenant"
 )
 
 type HolidayService struct {
-	client *http.Client
+	client      *http.Client
+	baseURL     string
+	countryCode string
 }
 
 func NewHolidayService() *HolidayService {
+	return NewHolidayServiceWithConfig(constants.NagerDateAPIURL, constants.DefaultCountryCode, 30*time.Second)
+}
+
+// NewHolidayServiceWithConfig creates a service for the given Nager.Date endpoint and country
+func NewHolidayServiceWithConfig(baseURL, countryCode string, timeout time.Duration) *HolidayService {
 	return &HolidayService{
 		client: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout: timeout,
 		},
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		countryCode: countryCode,
 	}
 }
 
 func (s *HolidayService) IsPublicHoliday(ctx context.Context, date time.Time) (bool, error) {
-	year := date.Year()
-	url := fmt.Sprintf(constants.NagerDateAPIURL, year)
+	holidays, err := s.PublicHolidayDates(ctx, date.Year())
+	if err != nil {
+		return false, err
+	}
+	return holidays[date.Format(constants.DateLayout)], nil
+}
+
+// PublicHolidayDates returns the public holidays of a year keyed by YYYY-MM-DD date.
+// A tenant in ctx with a holiday country of its own gets that country's
+// holidays, and with a region only the nationwide ones and those of the region.
+func (s *HolidayService) PublicHolidayDates(ctx context.Context, year int) (map[string]bool, error) {
+	countryCode, region := s.countryCode, ""
+	if t, ok := tenant.From(ctx); ok && t.HolidayCountry != "" {
+		countryCode, region = t.HolidayCountry, t.HolidayRegion
+	}
+	url := fmt.Sprintf(constants.NagerDateHolidayURL, s.baseURL, year, countryCode)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return false, fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	resp, err := s.client.Do(req)
 	if err != nil {
-		return false, fmt.Errorf("failed to fetch public holidays: %w", err)
+		return nil, fmt.Errorf("failed to fetch public holidays: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return false, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
 	var holidays []models.PublicHoliday
 	if err := json.NewDecoder(resp.Body).Decode(&holidays); err != nil {
-		return false, fmt.Errorf("failed to decode response: %w", err)
+		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	dateStr := date.Format(constants.DateLayout)
+	dates := make(map[string]bool, len(holidays))
 	for _, holiday := range holidays {
-		if holiday.Date == dateStr {
-			return true, nil
+		if region == "" || holiday.Global || slices.Contains(holiday.Counties, region) {
+			dates[holiday.Date] = true
 		}
 	}
-
-	return false, nil
+	return dates, nil
 }
@@ -2,9 +2,13 @@ package service
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"citynext-appointments/internal/tenant"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -37,3 +41,37 @@ func TestHolidayService_IsPublicHoliday_InvalidYear(t *testing.T) {
 		t.Logf("Expected behavior: API returned error for year 2100: %v", err)
 	}
 }
+
+func TestHolidayService_PublicHolidayDates_TenantRegion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/PublicHolidays/2075/GB":
+			w.Write([]byte(`[
+				{"date": "2075-01-01", "global": true},
+				{"date": "2075-01-02", "global": false, "counties": ["GB-SCT"]},
+				{"date": "2075-03-17", "global": false, "counties": ["GB-NIR"]}
+			]`))
+		case "/PublicHolidays/2075/IE":
+			w.Write([]byte(`[{"date": "2075-03-17", "global": true}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	service := NewHolidayServiceWithConfig(server.URL, "GB", time.Second)
+
+	dates, err := service.PublicHolidayDates(context.Background(), 2075)
+	require.NoError(t, err)
+	assert.Len(t, dates, 3, "without a tenant region every holiday of the country counts")
+
+	glasgow := tenant.WithTenant(context.Background(), &tenant.Tenant{ID: 2, HolidayCountry: "GB", HolidayRegion: "GB-SCT"})
+	dates, err = service.PublicHolidayDates(glasgow, 2075)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"2075-01-01": true, "2075-01-02": true}, dates)
+
+	dublin := tenant.WithTenant(context.Background(), &tenant.Tenant{ID: 3, HolidayCountry: "IE"})
+	isHoliday, err := service.IsPublicHoliday(dublin, time.Date(2075, 3, 17, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.True(t, isHoliday)
+}
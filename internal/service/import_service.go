@@ -0,0 +1,332 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/models"
+)
+
+// DefaultImportBatchSize is how many rows are committed per transaction
+const DefaultImportBatchSize = 500
+
+// ErrImportHeader is returned when the CSV header lacks a required column
+var ErrImportHeader = errors.New("import file needs a header with first_name, last_name and visit_date")
+
+// importRow is one validated row waiting to be booked
+type importRow struct {
+	line           int
+	firstName      string
+	lastName       string
+	visitDate      time.Time
+	email          string
+	citizenSubject string
+	serviceType    string
+}
+
+// ImportService loads existing bookings from CSV, for example when migrating
+// from another booking system
+type ImportService struct {
+	db           *db.DB
+	timeProvider func() time.Time
+	holidays     HolidayCalendar
+	bookings     *AppointmentService
+	batchSize    int
+}
+
+// importBatch is what booking one batch of rows came to
+type importBatch struct {
+	booked int
+	errors []models.ImportRowError
+	// rejected holds the matches of rows refused as duplicates, recorded once
+	// the batch is committed
+	rejected []rejectedDuplicate
+}
+
+// rejectedDuplicate is a row refused by the duplicate policy
+type rejectedDuplicate struct {
+	match     *duplicateMatch
+	visitDate time.Time
+}
+
+// NewImportService creates an import that books every row through bookings, so
+// imported rows meet the same quota, booking limit and duplicate policy as
+// bookings made through the API
+func NewImportService(database *db.DB, timeProvider func() time.Time, holidays HolidayCalendar, bookings *AppointmentService) *ImportService {
+	return &ImportService{
+		db:           database,
+		timeProvider: timeProvider,
+		holidays:     holidays,
+		bookings:     bookings,
+		batchSize:    DefaultImportBatchSize,
+	}
+}
+
+// WithBatchSize sets how many rows are committed per transaction. Larger
+// batches import faster but hold the dates and citizens they book locked for
+// longer, delaying bookings made through the API meanwhile.
+func (s *ImportService) WithBatchSize(n int) *ImportService {
+	if n > 0 {
+		s.batchSize = n
+	}
+	return s
+}
+
+// Import validates every row with the same rules as CreateAppointment and books
+// the valid ones the way CreateAppointment does. Rows are committed in batches
+// of batchSize, each row behind a savepoint so a rejected row leaves the others
+// of its batch in place. Invalid and rejected rows are reported and skipped. A
+// dry run books every row in one transaction that is rolled back, so each row
+// still counts against the quotas of the rows after it.
+// The file needs first_name, last_name and visit_date columns; email,
+// citizen_subject and service_type are optional and other columns, such as those
+// of an export, are ignored. Rows without a service type get DefaultServiceType.
+//
+// Imported bookings get a clerk, a history entry and a created event, but no
+// confirmation email.
+func (s *ImportService) Import(ctx context.Context, r io.Reader, dryRun bool) (*models.ImportResult, error) {
+	rows, result, err := s.readRows(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	result.DryRun = dryRun
+
+	now := s.timeProvider()
+	if dryRun {
+		if result.Valid, err = s.rehearse(ctx, rows, result, now); err != nil {
+			return nil, err
+		}
+	} else {
+		result.Imported = s.bookRows(ctx, rows, result, now)
+		result.Valid = result.Imported
+	}
+
+	sortImportErrors(result.Errors)
+	return result, nil
+}
+
+// bookRows books the rows in transactions of batchSize rows and returns how
+// many were booked. A batch that fails to commit is reported row by row and
+// does not stop the others.
+func (s *ImportService) bookRows(ctx context.Context, rows []importRow, result *models.ImportResult, now time.Time) int {
+	booked := 0
+	for start := 0; start < len(rows); start += s.batchSize {
+		batch := rows[start:min(start+s.batchSize, len(rows))]
+
+		var outcome *importBatch
+		err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+			var err error
+			outcome, err = s.bookBatch(ctx, tx, batch, now)
+			return err
+		})
+		if err != nil {
+			for _, row := range batch {
+				result.Errors = append(result.Errors, models.ImportRowError{Row: row.line, Message: "batch not imported: " + err.Error()})
+			}
+			continue
+		}
+
+		for _, rejected := range outcome.rejected {
+			s.bookings.recordRejected(ctx, rejected.match, rejected.visitDate, now)
+		}
+		result.Errors = append(result.Errors, outcome.errors...)
+		booked += outcome.booked
+	}
+	return booked
+}
+
+// rehearse books the rows in one transaction that is always rolled back and
+// returns how many would have been booked
+func (s *ImportService) rehearse(ctx context.Context, rows []importRow, result *models.ImportResult, now time.Time) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	outcome, err := s.bookBatch(ctx, tx, rows, now)
+	if err != nil {
+		return 0, err
+	}
+	result.Errors = append(result.Errors, outcome.errors...)
+	return outcome.booked, nil
+}
+
+// bookBatch books each row in tx behind a savepoint, so a rejected row does not
+// undo the ones before it
+func (s *ImportService) bookBatch(ctx context.Context, tx *sql.Tx, rows []importRow, now time.Time) (*importBatch, error) {
+	outcome := &importBatch{}
+	for _, row := range rows {
+		if _, err := tx.ExecContext(ctx, `SAVEPOINT import_row`); err != nil {
+			return nil, fmt.Errorf("failed to import row %d: %w", row.line, err)
+		}
+		duplicate, err := s.bookRow(ctx, tx, row, now)
+		if err != nil {
+			if _, rollbackErr := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT import_row`); rollbackErr != nil {
+				return nil, fmt.Errorf("failed to import row %d: %w", row.line, rollbackErr)
+			}
+			if err.Error() == constants.ErrPossibleDuplicate {
+				outcome.rejected = append(outcome.rejected, rejectedDuplicate{match: duplicate, visitDate: row.visitDate})
+			}
+			outcome.errors = append(outcome.errors, importRowError(row, err))
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `RELEASE SAVEPOINT import_row`); err != nil {
+			return nil, fmt.Errorf("failed to import row %d: %w", row.line, err)
+		}
+		outcome.booked++
+	}
+	return outcome, nil
+}
+
+// bookRow books one row in tx without a hold, like a booking made at the counter
+func (s *ImportService) bookRow(ctx context.Context, tx *sql.Tx, row importRow, now time.Time) (*duplicateMatch, error) {
+	appointment := &models.Appointment{
+		FirstName:      row.firstName,
+		LastName:       row.lastName,
+		Email:          row.email,
+		ServiceType:    row.serviceType,
+		VisitDate:      row.visitDate,
+		CitizenSubject: row.citizenSubject,
+	}
+	return s.bookings.book(ctx, tx, appointment, "", now)
+}
+
+// importRowError reports why a row was not booked
+func importRowError(row importRow, err error) models.ImportRowError {
+	message := err.Error()
+	if message == constants.ErrUnknownServiceType {
+		message = fmt.Sprintf("%s %q", constants.ErrUnknownServiceType, row.serviceType)
+	}
+	return models.ImportRowError{Row: row.line, Message: message}
+}
+
+// readRows parses and validates every row that can be checked without the database
+func (s *ImportService) readRows(ctx context.Context, r io.Reader) ([]importRow, *models.ImportResult, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, nil, ErrImportHeader
+		}
+		return nil, nil, fmt.Errorf("failed to read import header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"first_name", "last_name", "visit_date"} {
+		if _, ok := columns[required]; !ok {
+			return nil, nil, ErrImportHeader
+		}
+	}
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	result := &models.ImportResult{Errors: []models.ImportRowError{}}
+	today := s.timeProvider().Truncate(24 * time.Hour)
+	holidaysByYear := map[int]map[string]bool{}
+	var rows []importRow
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			// Malformed quoting only affects its own record
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				result.Rows++
+				result.Errors = append(result.Errors, models.ImportRowError{Row: parseErr.StartLine, Message: parseErr.Err.Error()})
+				continue
+			}
+			return nil, nil, fmt.Errorf("failed to read import file: %w", err)
+		}
+		result.Rows++
+
+		row := importRow{
+			line:           line,
+			firstName:      field(record, "first_name"),
+			lastName:       field(record, "last_name"),
+			email:          field(record, "email"),
+			citizenSubject: field(record, "citizen_subject"),
+			serviceType:    field(record, "service_type"),
+		}
+		if row.serviceType == "" {
+			row.serviceType = constants.DefaultServiceType
+		}
+		reject := func(message string) {
+			result.Errors = append(result.Errors, models.ImportRowError{Row: line, Message: message})
+		}
+
+		if row.firstName == "" || row.lastName == "" {
+			reject("first_name and last_name are required")
+			continue
+		}
+		if utf8.RuneCountInString(row.firstName) > maxNameLength || utf8.RuneCountInString(row.lastName) > maxNameLength {
+			reject(fmt.Sprintf("first_name and last_name must be at most %d characters", maxNameLength))
+			continue
+		}
+		if row.email != "" {
+			if _, err := mail.ParseAddress(row.email); err != nil || len(row.email) > 254 {
+				reject("invalid email address")
+				continue
+			}
+		}
+
+		rawDate := field(record, "visit_date")
+		visitDate, err := time.Parse(constants.DateLayout, rawDate)
+		if err != nil {
+			reject(constants.ErrInvalidDateFormat)
+			continue
+		}
+		if visitDate.Before(today) {
+			reject(constants.ErrPastDate)
+			continue
+		}
+
+		holidays, ok := holidaysByYear[visitDate.Year()]
+		if !ok {
+			holidays, err = s.holidays.PublicHolidayDates(ctx, visitDate.Year())
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to check public holidays: %w", err)
+			}
+			holidaysByYear[visitDate.Year()] = holidays
+		}
+		if holidays[rawDate] {
+			reject(constants.ErrPublicHoliday)
+			continue
+		}
+
+		row.visitDate = visitDate
+		rows = append(rows, row)
+	}
+
+	return rows, result, nil
+}
+
+// sortImportErrors orders errors by row, keeping the order of errors on the same row
+func sortImportErrors(errs []models.ImportRowError) {
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Row < errs[j].Row })
+}
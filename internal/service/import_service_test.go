@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeHolidayCalendar map[string]bool
+
+func (f fakeHolidayCalendar) PublicHolidayDates(ctx context.Context, year int) (map[string]bool, error) {
+	return f, nil
+}
+
+func newTestImportService(t *testing.T, bookingLimit int) (*ImportService, sqlmock.Sqlmock) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	database := &db.DB{DB: sqlDB}
+	bookings := NewAppointmentServiceWithTime(database, importNow).WithBookingLimit(bookingLimit)
+	return NewImportService(database, importNow, fakeHolidayCalendar{"2075-12-25": true}, bookings), mock
+}
+
+func importNow() time.Time { return time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC) }
+
+// expectImportedBooking expects the insert of a row that passed every check,
+// with its clerk, created event and history entry
+func expectImportedBooking(mock sqlmock.Sqlmock, firstName, lastName string, id int) *sqlmock.ExpectedQuery {
+	expectStaffAssignment(mock, 1)
+	insert := mock.ExpectQuery(`INSERT INTO appointments`).
+		WithArgs(firstName, lastName, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), 1,
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg())
+	if id == 0 {
+		return insert
+	}
+	insert.WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(id, importNow()))
+	expectOutboxEvent(mock, constants.EventAppointmentCreated, id)
+	expectHistoryEvent(mock, constants.EventAppointmentCreated, id)
+	return insert
+}
+
+const importFixture = `first_name,last_name,visit_date,email
+John,Doe,2075-06-10,john@example.com
+Jane,Doe,2075-06-11,
+,Nobody,2075-06-12,
+Past,Visit,2075-05-01,
+Bad,Date,10/06/2075,
+Christmas,Visit,2075-12-25,
+Twice,Booked,2075-06-10,
+Bad,Email,2075-06-13,not-an-address
+Already,Booked,2075-06-14,
+`
+
+func TestImportService_Import_DryRun(t *testing.T) {
+	svc, mock := newTestImportService(t, 0)
+
+	// Every row is booked behind a savepoint and the whole run is rolled back
+	mock.ExpectBegin()
+	mock.ExpectExec(`SAVEPOINT import_row`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectQuotaCheck(mock, "general", 1, 0, 0, 0)
+	expectImportedBooking(mock, "John", "Doe", 1)
+	mock.ExpectExec(`RELEASE SAVEPOINT import_row`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`SAVEPOINT import_row`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectQuotaCheck(mock, "general", 1, 0, 0, 0)
+	expectImportedBooking(mock, "Jane", "Doe", 2)
+	mock.ExpectExec(`RELEASE SAVEPOINT import_row`).WillReturnResult(sqlmock.NewResult(0, 0))
+	// The first row of the file already took the slot
+	mock.ExpectExec(`SAVEPOINT import_row`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectQuotaCheck(mock, "general", 1, 1, 0, 0)
+	mock.ExpectExec(`ROLLBACK TO SAVEPOINT import_row`).WillReturnResult(sqlmock.NewResult(0, 0))
+	// A hold counts against the quota like a booking
+	mock.ExpectExec(`SAVEPOINT import_row`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectQuotaCheck(mock, "general", 1, 0, 0, 1)
+	mock.ExpectExec(`ROLLBACK TO SAVEPOINT import_row`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	result, err := svc.Import(context.Background(), strings.NewReader(importFixture), true)
+
+	require.NoError(t, err)
+	assert.True(t, result.DryRun)
+	assert.Equal(t, 9, result.Rows)
+	assert.Equal(t, 2, result.Valid)
+	assert.Equal(t, 0, result.Imported)
+	assert.Equal(t, []models.ImportRowError{
+		{Row: 4, Message: "first_name and last_name are required"},
+		{Row: 5, Message: constants.ErrPastDate},
+		{Row: 6, Message: constants.ErrInvalidDateFormat},
+		{Row: 7, Message: constants.ErrPublicHoliday},
+		{Row: 8, Message: constants.ErrDuplicateAppointment + " 2075-06-10"},
+		{Row: 9, Message: "invalid email address"},
+		{Row: 10, Message: constants.ErrDuplicateAppointment + " 2075-06-14"},
+	}, result.Errors)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestImportService_Import_BooksInBatches(t *testing.T) {
+	svc, mock := newTestImportService(t, 1)
+	svc.WithBatchSize(2)
+
+	savepoint := func() { mock.ExpectExec(`SAVEPOINT import_row`).WillReturnResult(sqlmock.NewResult(0, 0)) }
+	release := func() { mock.ExpectExec(`RELEASE SAVEPOINT import_row`).WillReturnResult(sqlmock.NewResult(0, 0)) }
+	undo := func() { mock.ExpectExec(`ROLLBACK TO SAVEPOINT import_row`).WillReturnResult(sqlmock.NewResult(0, 0)) }
+
+	// Two rows are committed at a time
+	mock.ExpectBegin()
+	savepoint()
+	expectQuotaCheck(mock, "general", 1, 0, 0, 0)
+	expectActiveBookings(mock, "citizen-1", importNow(), 0)
+	expectImportedBooking(mock, "John", "Doe", 1)
+	release()
+	// The citizen's limit of one booking is used up by the row before
+	savepoint()
+	expectQuotaCheck(mock, "general", 1, 0, 0, 0)
+	expectActiveBookings(mock, "citizen-1", importNow(), 1)
+	undo()
+	mock.ExpectCommit()
+
+	// A failed row is reported without undoing the others
+	mock.ExpectBegin()
+	savepoint()
+	expectQuotaCheck(mock, "general", 1, 0, 0, 0)
+	expectTokenlessBookings(mock, "jim@example.com", importNow(), 0)
+	expectImportedBooking(mock, "Jim", "Doe", 0).WillReturnError(errors.New("connection reset"))
+	undo()
+	// Without a token or an email address the row cannot be held to the limit
+	savepoint()
+	expectQuotaCheck(mock, "general", 1, 0, 0, 0)
+	undo()
+	mock.ExpectCommit()
+
+	// A batch that cannot be committed is reported row by row
+	mock.ExpectBegin()
+	savepoint()
+	expectQuotaCheck(mock, "general", 1, 0, 0, 0)
+	expectTokenlessBookings(mock, "joe@example.com", importNow(), 0)
+	expectImportedBooking(mock, "Joe", "Doe", 4)
+	release()
+	mock.ExpectCommit().WillReturnError(errors.New("connection reset"))
+
+	input := `id,first_name,last_name,email,visit_date,created_at,citizen_subject,cancelled_at
+1,John,Doe,john@example.com,2075-06-10,2075-05-01T10:00:00Z,citizen-1,
+2,Jack,Doe,,2075-06-11,2075-05-01T10:00:00Z,citizen-1,
+3,Jim,Doe,jim@example.com,2075-06-12,2075-05-01T10:00:00Z,,
+4,Jay,Doe,,2075-06-13,2075-05-01T10:00:00Z,,
+5,Joe,Doe,joe@example.com,2075-06-13,2075-05-01T10:00:00Z,,
+`
+	result, err := svc.Import(context.Background(), strings.NewReader(input), false)
+
+	require.NoError(t, err)
+	assert.Equal(t, 5, result.Rows)
+	assert.Equal(t, 1, result.Valid)
+	assert.Equal(t, 1, result.Imported)
+	assert.Equal(t, []models.ImportRowError{
+		{Row: 3, Message: constants.ErrBookingLimitReached},
+		{Row: 4, Message: "failed to create appointment: connection reset"},
+		{Row: 5, Message: constants.ErrIdentityRequired},
+		{Row: 6, Message: "batch not imported: failed to commit transaction: connection reset"},
+	}, result.Errors)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestImportService_Import_ServiceTypeQuotas(t *testing.T) {
+	svc, mock := newTestImportService(t, 0)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SAVEPOINT import_row`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectQuotaCheck(mock, "passport-renewal", 2, 1, 0, 0)
+	expectImportedBooking(mock, "Ann", "Doe", 1)
+	mock.ExpectExec(`RELEASE SAVEPOINT import_row`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`SAVEPOINT import_row`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectQuotaCheck(mock, "passport-renewal", 2, 2, 0, 0)
+	mock.ExpectExec(`ROLLBACK TO SAVEPOINT import_row`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`SAVEPOINT import_row`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectQuotaCheck(mock, "general", 1, 0, 0, 0)
+	expectImportedBooking(mock, "Cid", "Doe", 2)
+	mock.ExpectExec(`RELEASE SAVEPOINT import_row`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`SAVEPOINT import_row`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FROM service_types WHERE code = \$1 AND active`).
+		WithArgs("dog-licence").
+		WillReturnRows(sqlmock.NewRows(serviceTypeRowColumns))
+	mock.ExpectExec(`ROLLBACK TO SAVEPOINT import_row`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	input := `first_name,last_name,visit_date,service_type
+Ann,Doe,2075-06-10,passport-renewal
+Bob,Doe,2075-06-10,passport-renewal
+Cid,Doe,2075-06-10,
+Dan,Doe,2075-06-10,dog-licence
+`
+	result, err := svc.Import(context.Background(), strings.NewReader(input), true)
+
+	require.NoError(t, err)
+	assert.Equal(t, 4, result.Rows)
+	assert.Equal(t, 2, result.Valid)
+	assert.Equal(t, []models.ImportRowError{
+		{Row: 3, Message: constants.ErrDuplicateAppointment + " 2075-06-10"},
+		{Row: 5, Message: constants.ErrUnknownServiceType + ` "dog-licence"`},
+	}, result.Errors)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestImportService_Import_MissingColumns(t *testing.T) {
+	svc, mock := newTestImportService(t, 0)
+
+	for _, input := range []string{"", "first_name,last_name\nJohn,Doe\n"} {
+		_, err := svc.Import(context.Background(), strings.NewReader(input), true)
+		assert.ErrorIs(t, err, ErrImportHeader)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
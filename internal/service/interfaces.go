@@ -10,9 +10,37 @@ import (
 // AppointmentServiceInterface defines the interface for appointment operations
 type AppointmentServiceInterface interface {
 	CreateAppointment(ctx context.Context, req *models.CreateAppointmentRequest) (*models.Appointment, error)
+	GetAppointment(ctx context.Context, id int) (*models.Appointment, error)
+	GetAppointmentByReference(ctx context.Context, reference string) (*models.Appointment, error)
+	CancelAppointment(ctx context.Context, id int) (*models.Appointment, error)
+	RescheduleAppointment(ctx context.Context, id int, visitDate string) (*models.Appointment, error)
+	CheckIn(ctx context.Context, id int) (*models.Appointment, error)
+	CompleteVisit(ctx context.Context, id int) (*models.Appointment, error)
+	ListAppointments(ctx context.Context, from, to time.Time) ([]models.Appointment, error)
+	Revisions(ctx context.Context, ids []int) (map[int]models.Revision, error)
 }
 
 // HolidayServiceInterface defines the interface for holiday operations
 type HolidayServiceInterface interface {
 	IsPublicHoliday(ctx context.Context, date time.Time) (bool, error)
 }
+
+// HolidayCalendar returns a whole year of public holidays, keyed by YYYY-MM-DD, for bulk checks
+type HolidayCalendar interface {
+	PublicHolidayDates(ctx context.Context, year int) (map[string]bool, error)
+}
+
+// ConfirmationSender notifies a citizen that their booking succeeded
+type ConfirmationSender interface {
+	SendConfirmation(ctx context.Context, appointment *models.Appointment) error
+}
+
+// ReminderSender reminds a citizen of an upcoming visit, before is how far ahead of the visit the reminder is due
+type ReminderSender interface {
+	SendReminder(ctx context.Context, appointment *models.Appointment, before time.Duration) error
+}
+
+// WaitlistOfferSender tells a waiting citizen that their date is now offered to them
+type WaitlistOfferSender interface {
+	SendWaitlistOffer(ctx context.Context, entry *models.WaitlistEntry) error
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"citynext-appointments/internal/audit"
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/outbox"
+	"citynext-appointments/internal/pii"
+	"citynext-appointments/internal/webhook"
+)
+
+// RotationReport counts the rows whose names a key rotation rewrote
+type RotationReport struct {
+	Appointments    int `json:"appointments"`
+	WaitlistEntries int `json:"waitlist_entries"`
+	HistoryEntries  int `json:"history_entries"`
+	// Names in the payloads of booking events and webhook deliveries
+	OutboxEvents      int `json:"outbox_events"`
+	WebhookDeliveries int `json:"webhook_deliveries"`
+}
+
+// KeyRotationService brings every stored name onto the primary key of a
+// keyring: names sealed with an older key are rewrapped and names stored before
+// encryption was turned on are sealed and get their blind indexes and blinded
+// phonetic keys. Rows are
+// walked in id order in batches, each in its own transaction, so the rotation
+// can be interrupted and run again.
+type KeyRotationService struct {
+	db        *db.DB
+	batchSize int
+}
+
+func NewKeyRotationService(database *db.DB, batchSize int) *KeyRotationService {
+	return &KeyRotationService{db: database, batchSize: batchSize}
+}
+
+// Rotate rewrites every name not yet sealed with the primary key of keyring.
+// Once it has finished, older keys can be removed from the keyring.
+func (s *KeyRotationService) Rotate(ctx context.Context, keyring *pii.Keyring) (*RotationReport, error) {
+	report := &RotationReport{}
+
+	var err error
+	if report.Appointments, err = s.rotateTable(ctx, keyring, "appointments", true); err != nil {
+		return nil, err
+	}
+	if report.WaitlistEntries, err = s.rotateTable(ctx, keyring, "waitlist_entries", false); err != nil {
+		return nil, err
+	}
+
+	if report.HistoryEntries, err = s.rewrapBatches(ctx, keyring, audit.RewrapNames); err != nil {
+		return nil, err
+	}
+	if report.OutboxEvents, err = s.rewrapBatches(ctx, keyring, outbox.RewrapNames); err != nil {
+		return nil, err
+	}
+	if report.WebhookDeliveries, err = s.rewrapBatches(ctx, keyring, webhook.RewrapNames); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// rewrapFunc rewraps the names of one batch of rows after afterID and returns
+// how many it rewrote and the last id it looked at
+type rewrapFunc func(ctx context.Context, tx *sql.Tx, keyring *pii.Keyring, afterID int64, limit int) (int, int64, error)
+
+// rewrapBatches runs rewrap batch after batch, each in its own transaction,
+// until it reports no further rows
+func (s *KeyRotationService) rewrapBatches(ctx context.Context, keyring *pii.Keyring, rewrap rewrapFunc) (int, error) {
+	total := 0
+	var afterID int64
+	for {
+		var rewritten int
+		var lastID int64
+		err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+			var err error
+			rewritten, lastID, err = rewrap(ctx, tx, keyring, afterID, s.batchSize)
+			return err
+		})
+		if err != nil {
+			return 0, err
+		}
+		total += rewritten
+		if lastID == afterID {
+			return total, nil
+		}
+		afterID = lastID
+	}
+}
+
+// rotateTable rewrites the names of one table. Anonymised rows only hold the
+// placeholder name and are skipped.
+func (s *KeyRotationService) rotateTable(ctx context.Context, keyring *pii.Keyring, table string, blindIndex bool) (int, error) {
+	type row struct {
+		id                  int
+		firstName, lastName string
+		indexed             bool
+	}
+
+	rotated := 0
+	afterID := 0
+	for {
+		var batch []row
+		err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+			indexColumn := "NULL"
+			if blindIndex {
+				indexColumn = "first_name_bidx IS NOT NULL AND first_name_phonetic"
+			}
+			query := `
+				SELECT id, first_name, last_name, ` + indexColumn + ` IS NOT NULL FROM ` + table + `
+				WHERE id > $1 AND anonymised_at IS NULL
+				ORDER BY id
+				LIMIT $2
+				FOR UPDATE
+			`
+			rows, err := tx.QueryContext(ctx, query, afterID, s.batchSize)
+			if err != nil {
+				return fmt.Errorf("failed to read names from %s: %w", table, err)
+			}
+			for rows.Next() {
+				var r row
+				if err := rows.Scan(&r.id, &r.firstName, &r.lastName, &r.indexed); err != nil {
+					rows.Close()
+					return fmt.Errorf("failed to read names from %s: %w", table, err)
+				}
+				batch = append(batch, r)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return fmt.Errorf("failed to read names from %s: %w", table, err)
+			}
+
+			for _, r := range batch {
+				current := keyring.Current(r.firstName) && keyring.Current(r.lastName)
+				if current && (r.indexed || !blindIndex) {
+					continue
+				}
+				if err := s.rewrapRow(ctx, tx, keyring, table, blindIndex, r.id, r.firstName, r.lastName); err != nil {
+					return err
+				}
+				rotated++
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+		if len(batch) == 0 {
+			return rotated, nil
+		}
+		afterID = batch[len(batch)-1].id
+	}
+}
+
+func (s *KeyRotationService) rewrapRow(ctx context.Context, tx *sql.Tx, keyring *pii.Keyring, table string, blindIndex bool, id int, firstName, lastName string) error {
+	plainFirst, err := keyring.Open(firstName)
+	if err != nil {
+		return fmt.Errorf("failed to rotate %s %d: %w", table, id, err)
+	}
+	plainLast, err := keyring.Open(lastName)
+	if err != nil {
+		return fmt.Errorf("failed to rotate %s %d: %w", table, id, err)
+	}
+	if !keyring.Current(firstName) {
+		if firstName, err = keyring.Rewrap(firstName); err != nil {
+			return fmt.Errorf("failed to rotate %s %d: %w", table, id, err)
+		}
+	}
+	if !keyring.Current(lastName) {
+		if lastName, err = keyring.Rewrap(lastName); err != nil {
+			return fmt.Errorf("failed to rotate %s %d: %w", table, id, err)
+		}
+	}
+
+	if blindIndex {
+		query := `
+			UPDATE ` + table + ` SET first_name = $2, last_name = $3, first_name_bidx = $4, last_name_bidx = $5,
+				first_name_phonetic = $6, last_name_phonetic = $7
+			WHERE id = $1
+		`
+		_, err = tx.ExecContext(ctx, query, id, firstName, lastName, keyring.BlindIndex(plainFirst), keyring.BlindIndex(plainLast),
+			phoneticKey(keyring, plainFirst), phoneticKey(keyring, plainLast))
+	} else {
+		query := `UPDATE ` + table + ` SET first_name = $2, last_name = $3 WHERE id = $1`
+		_, err = tx.ExecContext(ctx, query, id, firstName, lastName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to rotate %s %d: %w", table, id, err)
+	}
+	return nil
+}
+
+// RefreshPhoneticKeys recomputes the phonetic key of every appointment name and
+// rewrites the keys that differ, such as those the init scripts computed with
+// PostgreSQL's soundex(), which codes accented letters and apostrophes
+// differently. keyring is nil when encryption is off; encrypted names cannot be
+// read then and fail the refresh.
+func (s *KeyRotationService) RefreshPhoneticKeys(ctx context.Context, keyring *pii.Keyring) (int, error) {
+	type row struct {
+		id                  int
+		firstName, lastName string
+		firstKey, lastKey   sql.NullString
+	}
+
+	refreshed := 0
+	afterID := 0
+	for {
+		var batch []row
+		err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+			query := `
+				SELECT id, first_name, last_name, first_name_phonetic, last_name_phonetic FROM appointments
+				WHERE id > $1 AND anonymised_at IS NULL
+				ORDER BY id
+				LIMIT $2
+				FOR UPDATE
+			`
+			rows, err := tx.QueryContext(ctx, query, afterID, s.batchSize)
+			if err != nil {
+				return fmt.Errorf("failed to read phonetic keys: %w", err)
+			}
+			for rows.Next() {
+				var r row
+				if err := rows.Scan(&r.id, &r.firstName, &r.lastName, &r.firstKey, &r.lastKey); err != nil {
+					rows.Close()
+					return fmt.Errorf("failed to read phonetic keys: %w", err)
+				}
+				batch = append(batch, r)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return fmt.Errorf("failed to read phonetic keys: %w", err)
+			}
+
+			for _, r := range batch {
+				plainFirst, err := openWith(keyring, r.firstName)
+				if err != nil {
+					return fmt.Errorf("failed to refresh phonetic keys of appointment %d: %w", r.id, err)
+				}
+				plainLast, err := openWith(keyring, r.lastName)
+				if err != nil {
+					return fmt.Errorf("failed to refresh phonetic keys of appointment %d: %w", r.id, err)
+				}
+				firstKey, lastKey := phoneticKey(keyring, plainFirst), phoneticKey(keyring, plainLast)
+				if firstKey == r.firstKey && lastKey == r.lastKey {
+					continue
+				}
+				query := `UPDATE appointments SET first_name_phonetic = $2, last_name_phonetic = $3 WHERE id = $1`
+				if _, err := tx.ExecContext(ctx, query, r.id, firstKey, lastKey); err != nil {
+					return fmt.Errorf("failed to refresh phonetic keys of appointment %d: %w", r.id, err)
+				}
+				refreshed++
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+		if len(batch) == 0 {
+			return refreshed, nil
+		}
+		afterID = batch[len(batch)-1].id
+	}
+}
+
+// openWith decrypts stored with keyring, or passes plaintext through when there is no keyring
+func openWith(keyring *pii.Keyring, stored string) (string, error) {
+	if keyring != nil {
+		return keyring.Open(stored)
+	}
+	if pii.IsSealed(stored) {
+		return "", fmt.Errorf("name is encrypted but encryption is not enabled")
+	}
+	return stored, nil
+}
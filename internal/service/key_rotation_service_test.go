@@ -0,0 +1,210 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/pii"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKeyring(t *testing.T, primary string) *pii.Keyring {
+	t.Helper()
+	keyring, err := pii.NewKeyring(map[string][]byte{
+		"2075-01": bytes.Repeat([]byte{1}, pii.KeySize),
+		"2075-06": bytes.Repeat([]byte{2}, pii.KeySize),
+		"index":   bytes.Repeat([]byte{3}, pii.KeySize),
+	}, primary, "index")
+	require.NoError(t, err)
+	return keyring
+}
+
+// rewrappedName matches a name sealed with the 2075-06 key that opens to want
+type rewrappedName struct {
+	keyring *pii.Keyring
+	want    string
+}
+
+func (m rewrappedName) Match(v driver.Value) bool {
+	stored, ok := v.(string)
+	if !ok || !m.keyring.Current(stored) {
+		return false
+	}
+	opened, err := m.keyring.Open(stored)
+	return err == nil && opened == m.want
+}
+
+func TestKeyRotationService_Rotate(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	oldKeyring := testKeyring(t, "2075-01")
+	keyring := testKeyring(t, "2075-06")
+	oldFirst, err := oldKeyring.Seal("John")
+	require.NoError(t, err)
+	oldLast, err := oldKeyring.Seal("Doe")
+	require.NoError(t, err)
+	currentFirst, err := keyring.Seal("Jane")
+	require.NoError(t, err)
+	currentLast, err := keyring.Seal("Roe")
+	require.NoError(t, err)
+
+	// Appointments: 5 has an old key, 6 is current, 7 predates encryption
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, first_name, last_name, first_name_bidx IS NOT NULL AND first_name_phonetic IS NOT NULL FROM appointments WHERE id > \$1 AND anonymised_at IS NULL ORDER BY id LIMIT \$2 FOR UPDATE`).
+		WithArgs(0, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "first_name", "last_name", "indexed"}).
+			AddRow(5, oldFirst, oldLast, true).
+			AddRow(6, currentFirst, currentLast, true).
+			AddRow(7, "Jim", "Poe", false))
+	mock.ExpectExec(`UPDATE appointments SET first_name = \$2, last_name = \$3, first_name_bidx = \$4, last_name_bidx = \$5, first_name_phonetic = \$6, last_name_phonetic = \$7 WHERE id = \$1`).
+		WithArgs(5, rewrappedName{keyring, "John"}, rewrappedName{keyring, "Doe"}, keyring.BlindIndex("John"), keyring.BlindIndex("Doe"),
+			keyring.BlindIndex("soundex:J500"), keyring.BlindIndex("soundex:D000")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE appointments SET first_name = \$2`).
+		WithArgs(7, rewrappedName{keyring, "Jim"}, rewrappedName{keyring, "Poe"}, keyring.BlindIndex("Jim"), keyring.BlindIndex("Poe"),
+			keyring.BlindIndex("soundex:J500"), keyring.BlindIndex("soundex:P000")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM appointments WHERE id > \$1`).
+		WithArgs(7, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "first_name", "last_name", "indexed"}))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, first_name, last_name, NULL IS NOT NULL FROM waitlist_entries WHERE id > \$1`).
+		WithArgs(0, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "first_name", "last_name", "indexed"}).
+			AddRow(2, oldFirst, oldLast, false))
+	mock.ExpectExec(`UPDATE waitlist_entries SET first_name = \$2, last_name = \$3 WHERE id = \$1`).
+		WithArgs(2, rewrappedName{keyring, "John"}, rewrappedName{keyring, "Doe"}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM waitlist_entries WHERE id > \$1`).
+		WithArgs(2, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "first_name", "last_name", "indexed"}))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SET LOCAL citynext.redact_history = 'on'`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT id, actor, old_values, new_values FROM appointment_events WHERE id > \$1 ORDER BY id LIMIT \$2 FOR UPDATE`).
+		WithArgs(int64(0), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "actor", "old_values", "new_values"}).
+			AddRow(1, "key:3", nil, []byte(`{"first_name":"John","id":5}`)).
+			AddRow(2, "key:3", []byte(`{"status":"booked"}`), []byte(`{"status":"cancelled"}`)))
+	mock.ExpectExec(`UPDATE appointment_events SET actor = \$2, old_values = \$3, new_values = \$4 WHERE id = \$1`).
+		WithArgs(int64(1), "key:3", nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`SET LOCAL citynext.redact_history = 'off'`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(`SET LOCAL citynext.redact_history = 'on'`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FROM appointment_events WHERE id > \$1`).
+		WithArgs(int64(2), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "actor", "old_values", "new_values"}))
+	mock.ExpectExec(`SET LOCAL citynext.redact_history = 'off'`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	// Event payloads and webhook deliveries hold the names sealed too
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, payload FROM outbox_events WHERE id > \$1 ORDER BY id LIMIT \$2 FOR UPDATE`).
+		WithArgs(int64(0), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "payload"}).
+			AddRow(3, []byte(`{"first_name":"`+oldFirst+`","id":5}`)).
+			AddRow(4, []byte(`{"first_name":"`+currentFirst+`","id":6}`)))
+	mock.ExpectExec(`UPDATE outbox_events SET payload = \$2 WHERE id = \$1`).
+		WithArgs(int64(3), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM outbox_events WHERE id > \$1`).
+		WithArgs(int64(4), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "payload"}))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, payload FROM webhook_deliveries WHERE id > \$1 ORDER BY id LIMIT \$2 FOR UPDATE`).
+		WithArgs(int64(0), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "payload"}).
+			AddRow(8, `{"id":3,"type":"appointment.created","created_at":"2075-06-01T10:00:00Z","data":{"last_name":"`+oldLast+`"}}`))
+	mock.ExpectExec(`UPDATE webhook_deliveries SET payload = \$2 WHERE id = \$1`).
+		WithArgs(int64(8), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM webhook_deliveries WHERE id > \$1`).
+		WithArgs(int64(8), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "payload"}))
+	mock.ExpectCommit()
+
+	report, err := NewKeyRotationService(&db.DB{DB: sqlDB}, 10).Rotate(context.Background(), keyring)
+
+	require.NoError(t, err)
+	assert.Equal(t, &RotationReport{Appointments: 2, WaitlistEntries: 1, HistoryEntries: 1, OutboxEvents: 1, WebhookDeliveries: 1}, report)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestKeyRotationService_Rotate_UnknownKey(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	retired, err := pii.NewKeyring(map[string][]byte{
+		"2074-01": bytes.Repeat([]byte{9}, pii.KeySize),
+		"index":   bytes.Repeat([]byte{3}, pii.KeySize),
+	}, "2074-01", "index")
+	require.NoError(t, err)
+	sealed, err := retired.Seal("John")
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM appointments WHERE id > \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "first_name", "last_name", "indexed"}).
+			AddRow(5, sealed, sealed, true))
+	mock.ExpectRollback()
+
+	report, err := NewKeyRotationService(&db.DB{DB: sqlDB}, 10).Rotate(context.Background(), testKeyring(t, "2075-06"))
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown key "2074-01"`)
+	assert.Nil(t, report)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestKeyRotationService_RefreshPhoneticKeys(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	// Appointment 4 was keyed by PostgreSQL's soundex(), which codes the apostrophe differently
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, first_name, last_name, first_name_phonetic, last_name_phonetic FROM appointments WHERE id > \$1 AND anonymised_at IS NULL ORDER BY id LIMIT \$2 FOR UPDATE`).
+		WithArgs(0, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "first_name", "last_name", "first_name_phonetic", "last_name_phonetic"}).
+			AddRow(3, "John", "Doe", "J500", "D000").
+			AddRow(4, "Ann", "Pat'Tee", "A500", "P330"))
+	mock.ExpectExec(`UPDATE appointments SET first_name_phonetic = \$2, last_name_phonetic = \$3 WHERE id = \$1`).
+		WithArgs(4, "A500", "P300").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM appointments WHERE id > \$1`).
+		WithArgs(4, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "first_name", "last_name", "first_name_phonetic", "last_name_phonetic"}))
+	mock.ExpectCommit()
+
+	refreshed, err := NewKeyRotationService(&db.DB{DB: sqlDB}, 10).RefreshPhoneticKeys(context.Background(), nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, refreshed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"citynext-appointments/internal/audit"
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/outbox"
+)
+
+// noShowLookback is how many days that have ended the job still looks at, so a
+// few days of downtime are caught up without reaching back into old history
+const noShowLookback = 3
+
+// NoShowService closes bookings nobody turned up for. Once dayEnd has passed on
+// a visit date, every booking of that date that was never checked in becomes a
+// no-show.
+type NoShowService struct {
+	db           *db.DB
+	timeProvider func() time.Time
+	dayEnd       time.Duration
+}
+
+// NewNoShowService creates a no-show job. Pass the same time provider as the
+// appointment service so the day ends on the simulated clock.
+func NewNoShowService(database *db.DB, timeProvider func() time.Time, dayEnd time.Duration) *NoShowService {
+	return &NoShowService{
+		db:           database,
+		timeProvider: timeProvider,
+		dayEnd:       dayEnd,
+	}
+}
+
+// Run marks no-shows every interval until ctx is cancelled
+func (s *NoShowService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.MarkNoShows(ctx); err != nil {
+				log.Printf("Marking no-shows failed: %v", err)
+			}
+		}
+	}
+}
+
+// MarkNoShows turns the bookings of the days that have just ended into
+// no-shows, with their events and history entries, and returns how many were
+// marked. Bookings older than noShowLookback days are left alone.
+func (s *NoShowService) MarkNoShows(ctx context.Context) (int, error) {
+	now := s.timeProvider()
+	today := now.Truncate(24 * time.Hour)
+	cutoff := today.AddDate(0, 0, -1)
+	if !now.Before(today.Add(s.dayEnd)) {
+		cutoff = today
+	}
+	earliest := cutoff.AddDate(0, 0, -noShowLookback)
+
+	var marked []*models.Appointment
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		// Uses idx_appointments_booked_visit_date
+		query := `
+			UPDATE appointments SET status = 'no_show', no_show_at = $2
+			WHERE status = 'booked' AND visit_date <= $1 AND visit_date > $3
+			RETURNING ` + appointmentColumns
+		rows, err := tx.QueryContext(ctx, query, cutoff, now, earliest)
+		if err != nil {
+			return fmt.Errorf("failed to mark no-shows: %w", err)
+		}
+		for rows.Next() {
+			appointment, err := scanAppointment(rows)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to mark no-shows: %w", err)
+			}
+			marked = append(marked, appointment)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to mark no-shows: %w", err)
+		}
+
+		for _, appointment := range marked {
+			if err := outbox.Enqueue(ctx, tx, constants.EventAppointmentNoShow, appointment.ID, appointment); err != nil {
+				return err
+			}
+			before := *appointment
+			before.Status = StatusBooked
+			before.NoShowAt = nil
+			if err := audit.Record(ctx, tx, constants.EventAppointmentNoShow, &before, appointment, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(marked), nil
+}
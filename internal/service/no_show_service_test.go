@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/db"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNoShowService_MarkNoShows_Cutoff(t *testing.T) {
+	today := time.Date(2075, 6, 10, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name   string
+		now    time.Time
+		cutoff time.Time
+	}{
+		{"before the office closes", today.Add(17 * time.Hour), today.AddDate(0, 0, -1)},
+		{"when the office closes", today.Add(18 * time.Hour), today},
+		{"after the office closes", today.Add(23 * time.Hour), today},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer sqlDB.Close()
+
+			service := NewNoShowService(&db.DB{DB: sqlDB}, func() time.Time { return tc.now }, 18*time.Hour)
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`UPDATE appointments SET status = 'no_show', no_show_at = \$2 WHERE status = 'booked' AND visit_date <= \$1 AND visit_date > \$3 RETURNING id, first_name`).
+				WithArgs(tc.cutoff, tc.now, tc.cutoff.AddDate(0, 0, -3)).
+				WillReturnRows(sqlmock.NewRows(appointmentRowColumns))
+			mock.ExpectCommit()
+
+			marked, err := service.MarkNoShows(context.Background())
+
+			require.NoError(t, err)
+			assert.Equal(t, 0, marked)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestNoShowService_MarkNoShows_QueuesEvents(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	today := time.Date(2075, 6, 10, 0, 0, 0, 0, time.UTC)
+	now := today.Add(19 * time.Hour)
+	service := NewNoShowService(&db.DB{DB: sqlDB}, func() time.Time { return now }, 18*time.Hour)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE appointments SET status = 'no_show'`).
+		WithArgs(today, now, today.AddDate(0, 0, -3)).
+		WillReturnRows(sqlmock.NewRows(appointmentRowColumns).
+			AddRow(5, "John", "Doe", today, today, nil, nil, nil, nil, "general", 1, "no_show", nil, nil, now).
+			AddRow(6, "Jane", "Roe", today.AddDate(0, 0, -1), today, nil, nil, nil, nil, "general", 2, "no_show", nil, nil, now))
+	expectOutboxEvent(mock, constants.EventAppointmentNoShow, 5)
+	expectHistoryEvent(mock, constants.EventAppointmentNoShow, 5)
+	expectOutboxEvent(mock, constants.EventAppointmentNoShow, 6)
+	expectHistoryEvent(mock, constants.EventAppointmentNoShow, 6)
+	mock.ExpectCommit()
+
+	marked, err := service.MarkNoShows(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, marked)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNoShowService_MarkNoShows_RollsBackOnOutboxFailure(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	today := time.Date(2075, 6, 10, 0, 0, 0, 0, time.UTC)
+	now := today.Add(19 * time.Hour)
+	service := NewNoShowService(&db.DB{DB: sqlDB}, func() time.Time { return now }, 18*time.Hour)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE appointments SET status = 'no_show'`).
+		WillReturnRows(sqlmock.NewRows(appointmentRowColumns).
+			AddRow(5, "John", "Doe", today, today, nil, nil, nil, nil, "general", 1, "no_show", nil, nil, now))
+	mock.ExpectExec(`INSERT INTO outbox_events`).
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	marked, err := service.MarkNoShows(context.Background())
+
+	require.Error(t, err)
+	assert.Equal(t, 0, marked)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
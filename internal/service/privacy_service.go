@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"citynext-appointments/internal/audit"
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// ErasedName replaces the first and last name of an erased citizen
+const ErasedName = "Erased"
+
+// CitizenData is everything stored about one citizen, for subject access requests
+type CitizenData struct {
+	Appointments    []models.Appointment   `json:"appointments"`
+	WaitlistEntries []models.WaitlistEntry `json:"waitlist_entries"`
+	History         []audit.Event          `json:"history"`
+}
+
+// ErasureReport counts what an erasure request anonymised
+type ErasureReport struct {
+	Appointments    int `json:"appointments"`
+	WaitlistEntries int `json:"waitlist_entries"`
+	HistoryEntries  int `json:"history_entries"`
+}
+
+// PrivacyService answers subject access and erasure requests. A citizen is
+// found by the subject of their citizen token, by email, or both.
+type PrivacyService struct {
+	db           *db.DB
+	timeProvider func() time.Time
+	history      *audit.Store
+}
+
+func NewPrivacyService(database *db.DB, timeProvider func() time.Time) *PrivacyService {
+	return &PrivacyService{
+		db:           database,
+		timeProvider: timeProvider,
+		history:      audit.NewStore(database),
+	}
+}
+
+// citizenMatch selects the rows of one citizen; $1 is the subject and $2 the email
+const citizenMatch = `(citizen_subject = $1 OR lower(email) = lower($2))`
+
+// CitizenData returns every appointment and waitlist entry of the citizen and
+// the history of those appointments
+func (s *PrivacyService) CitizenData(ctx context.Context, subject, email string) (*CitizenData, error) {
+	if subject == "" && email == "" {
+		return nil, fmt.Errorf("%s", constants.ErrCitizenRequired)
+	}
+
+	query := `SELECT ` + appointmentColumns + ` FROM appointments WHERE ` + citizenMatch + ` ORDER BY id`
+	rows, err := s.db.QueryContext(ctx, query, nullString(subject), nullString(email))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read citizen appointments: %w", err)
+	}
+	data := &CitizenData{Appointments: []models.Appointment{}, WaitlistEntries: []models.WaitlistEntry{}}
+	var ids []int
+	for rows.Next() {
+		appointment, err := scanAppointment(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read citizen appointments: %w", err)
+		}
+		data.Appointments = append(data.Appointments, *appointment)
+		ids = append(ids, appointment.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read citizen appointments: %w", err)
+	}
+
+	query = `SELECT ` + waitlistColumns + ` FROM waitlist_entries WHERE ` + citizenMatch + ` ORDER BY id`
+	rows, err = s.db.QueryContext(ctx, query, nullString(subject), nullString(email))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read citizen waitlist entries: %w", err)
+	}
+	for rows.Next() {
+		entry, err := scanWaitlistEntry(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read citizen waitlist entries: %w", err)
+		}
+		data.WaitlistEntries = append(data.WaitlistEntries, *entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read citizen waitlist entries: %w", err)
+	}
+
+	data.History = []audit.Event{}
+	if len(ids) > 0 {
+		data.History, err = s.history.HistoryOf(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// Erase anonymises the citizen: names are replaced with ErasedName and email
+// and citizen subject are removed from their appointments, waitlist entries,
+// appointment history and the events sent about their appointments. Rows are
+// kept, so dates, service types, statuses and counts stay intact for statistics
+// and nothing that refers to them breaks.
+func (s *PrivacyService) Erase(ctx context.Context, subject, email string) (*ErasureReport, error) {
+	if subject == "" && email == "" {
+		return nil, fmt.Errorf("%s", constants.ErrCitizenRequired)
+	}
+
+	now := s.timeProvider()
+	report := &ErasureReport{}
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		query := `
+			UPDATE appointments SET first_name = $3, last_name = $3, first_name_bidx = NULL, last_name_bidx = NULL,
+				first_name_phonetic = NULL, last_name_phonetic = NULL,
+				email = NULL, citizen_subject = NULL, anonymised_at = $4
+			WHERE ` + citizenMatch + `
+			RETURNING ` + appointmentColumns
+		rows, err := tx.QueryContext(ctx, query, nullString(subject), nullString(email), ErasedName, now)
+		if err != nil {
+			return fmt.Errorf("failed to erase appointments: %w", err)
+		}
+		var erased []*models.Appointment
+		for rows.Next() {
+			appointment, err := scanAppointment(rows)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to erase appointments: %w", err)
+			}
+			erased = append(erased, appointment)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to erase appointments: %w", err)
+		}
+		report.Appointments = len(erased)
+
+		query = `
+			UPDATE waitlist_entries SET first_name = $3, last_name = $3, email = NULL, citizen_subject = NULL, anonymised_at = $4
+			WHERE ` + citizenMatch
+		result, err := tx.ExecContext(ctx, query, nullString(subject), nullString(email), ErasedName, now)
+		if err != nil {
+			return fmt.Errorf("failed to erase waitlist entries: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to erase waitlist entries: %w", err)
+		}
+		report.WaitlistEntries = int(affected)
+
+		report.HistoryEntries, err = eraseAppointmentTraces(ctx, tx, erased, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// eraseAppointmentTraces removes the personal data of appointments that were just
+// anonymised from the events and webhook deliveries about them and from their
+// history, then records the erasure. It returns the number of history entries
+// rewritten.
+func eraseAppointmentTraces(ctx context.Context, tx *sql.Tx, erased []*models.Appointment, now time.Time) (int, error) {
+	if len(erased) == 0 {
+		return 0, nil
+	}
+	ids := make([]int, len(erased))
+	for i, appointment := range erased {
+		ids[i] = appointment.ID
+	}
+
+	// Event payloads are appointment JSON, webhook deliveries wrap it in data
+	query := `
+		UPDATE outbox_events
+		SET payload = payload || jsonb_build_object('first_name', $2::text, 'last_name', $2::text) - 'email' - 'citizen_subject'
+		WHERE aggregate_id = ANY($1)
+	`
+	if _, err := tx.ExecContext(ctx, query, pq.Array(ids), ErasedName); err != nil {
+		return 0, fmt.Errorf("failed to erase events: %w", err)
+	}
+	query = `
+		UPDATE webhook_deliveries
+		SET payload = jsonb_set(payload::jsonb, '{data}',
+			(payload::jsonb -> 'data') || jsonb_build_object('first_name', $2::text, 'last_name', $2::text) - 'email' - 'citizen_subject')::text
+		WHERE event_id IN (SELECT id FROM outbox_events WHERE aggregate_id = ANY($1))
+	`
+	if _, err := tx.ExecContext(ctx, query, pq.Array(ids), ErasedName); err != nil {
+		return 0, fmt.Errorf("failed to erase webhook deliveries: %w", err)
+	}
+
+	redacted, err := audit.Redact(ctx, tx, ids, map[string]interface{}{
+		"first_name":      ErasedName,
+		"last_name":       ErasedName,
+		"email":           nil,
+		"citizen_subject": nil,
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, appointment := range erased {
+		if err := audit.Record(ctx, tx, audit.ActionErased, nil, appointment, now); err != nil {
+			return 0, err
+		}
+	}
+	return redacted, nil
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/audit"
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/db"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPrivacy(t *testing.T, now time.Time) (*PrivacyService, sqlmock.Sqlmock) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	return NewPrivacyService(&db.DB{DB: sqlDB}, func() time.Time { return now }), mock
+}
+
+func TestPrivacyService_RequiresCitizen(t *testing.T) {
+	privacy, mock := newTestPrivacy(t, time.Now())
+
+	_, err := privacy.CitizenData(context.Background(), "", "")
+	require.Error(t, err)
+	assert.Equal(t, constants.ErrCitizenRequired, err.Error())
+
+	_, err = privacy.Erase(context.Background(), "", "")
+	require.Error(t, err)
+	assert.Equal(t, constants.ErrCitizenRequired, err.Error())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPrivacyService_CitizenData(t *testing.T) {
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	visitDate := time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC)
+	privacy, mock := newTestPrivacy(t, now)
+
+	mock.ExpectQuery(`SELECT id, first_name, .* FROM appointments WHERE \(citizen_subject = \$1 OR lower\(email\) = lower\(\$2\)\) ORDER BY id`).
+		WithArgs("citizen-123", "john@example.com").
+		WillReturnRows(sqlmock.NewRows(appointmentRowColumns).
+			AddRow(5, "John", "Doe", visitDate, now, "citizen-123", nil, "john@example.com", "CN-7K4Q-2M9X", "general", 1, "booked", nil, nil, nil))
+	mock.ExpectQuery(`SELECT id, first_name, .* FROM waitlist_entries WHERE \(citizen_subject = \$1 OR lower\(email\) = lower\(\$2\)\) ORDER BY id`).
+		WithArgs("citizen-123", "john@example.com").
+		WillReturnRows(sqlmock.NewRows(waitlistRowColumns).
+			AddRow(2, "John", "Doe", "john@example.com", "general", visitDate, "citizen-123", WaitlistWaiting, nil, nil, nil, now))
+	mock.ExpectQuery(`FROM appointment_events WHERE appointment_id = ANY\(\$1\)`).
+		WithArgs("{5}").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "appointment_id", "action", "actor", "api_key_id", "request_id", "old_values", "new_values", "created_at"}).
+			AddRow(1, 5, "appointment.created", "citizen:citizen-123", 2, nil, nil, []byte(`{"id":5}`), now))
+
+	data, err := privacy.CitizenData(context.Background(), "citizen-123", "john@example.com")
+
+	require.NoError(t, err)
+	require.Len(t, data.Appointments, 1)
+	assert.Equal(t, "CN-7K4Q-2M9X", data.Appointments[0].Reference)
+	require.Len(t, data.WaitlistEntries, 1)
+	assert.Equal(t, 2, data.WaitlistEntries[0].ID)
+	require.Len(t, data.History, 1)
+	assert.Equal(t, "appointment.created", data.History[0].Action)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPrivacyService_CitizenData_ByEmailOnly(t *testing.T) {
+	privacy, mock := newTestPrivacy(t, time.Now())
+
+	mock.ExpectQuery(`FROM appointments WHERE`).
+		WithArgs(nil, "john@example.com").
+		WillReturnRows(sqlmock.NewRows(appointmentRowColumns))
+	mock.ExpectQuery(`FROM waitlist_entries WHERE`).
+		WithArgs(nil, "john@example.com").
+		WillReturnRows(sqlmock.NewRows(waitlistRowColumns))
+
+	data, err := privacy.CitizenData(context.Background(), "", "john@example.com")
+
+	require.NoError(t, err)
+	assert.Empty(t, data.Appointments)
+	assert.Empty(t, data.WaitlistEntries)
+	assert.NotNil(t, data.History, "an empty history is listed as []")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPrivacyService_Erase(t *testing.T) {
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	visitDate := time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC)
+	privacy, mock := newTestPrivacy(t, now)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE appointments SET first_name = \$3, last_name = \$3, first_name_bidx = NULL, last_name_bidx = NULL, first_name_phonetic = NULL, last_name_phonetic = NULL, email = NULL, citizen_subject = NULL, anonymised_at = \$4 WHERE \(citizen_subject = \$1 OR lower\(email\) = lower\(\$2\)\) RETURNING id, first_name`).
+		WithArgs("citizen-123", nil, ErasedName, now).
+		WillReturnRows(sqlmock.NewRows(appointmentRowColumns).
+			AddRow(5, ErasedName, ErasedName, visitDate, now, nil, nil, nil, "CN-7K4Q-2M9X", "general", 1, "completed", nil, nil, nil))
+	mock.ExpectExec(`UPDATE waitlist_entries SET first_name = \$3, last_name = \$3, email = NULL, citizen_subject = NULL, anonymised_at = \$4 WHERE \(citizen_subject = \$1 OR lower\(email\) = lower\(\$2\)\)`).
+		WithArgs("citizen-123", nil, ErasedName, now).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`UPDATE outbox_events SET payload = .* WHERE aggregate_id = ANY\(\$1\)`).
+		WithArgs("{5}", ErasedName).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`UPDATE webhook_deliveries SET payload = .* WHERE event_id IN \(SELECT id FROM outbox_events WHERE aggregate_id = ANY\(\$1\)\)`).
+		WithArgs("{5}", ErasedName).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`SET LOCAL citynext.redact_history = 'on'`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT id, actor, old_values, new_values FROM appointment_events`).
+		WithArgs("{5}").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "actor", "old_values", "new_values"}).
+			AddRow(1, "citizen:citizen-123", nil, []byte(`{"citizen_subject":"citizen-123","first_name":"John","id":5}`)))
+	mock.ExpectExec(`UPDATE appointment_events SET actor = \$2`).
+		WithArgs(int64(1), audit.ActorErasedCitizen, nil, []byte(`{"first_name":"Erased","id":5}`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`SET LOCAL citynext.redact_history = 'off'`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectHistoryEvent(mock, audit.ActionErased, 5)
+	mock.ExpectCommit()
+
+	report, err := privacy.Erase(context.Background(), "citizen-123", "")
+
+	require.NoError(t, err)
+	assert.Equal(t, &ErasureReport{Appointments: 1, WaitlistEntries: 2, HistoryEntries: 1}, report)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPrivacyService_Erase_WaitlistOnly(t *testing.T) {
+	privacy, mock := newTestPrivacy(t, time.Now())
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE appointments SET first_name`).
+		WithArgs(nil, "john@example.com", ErasedName, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(appointmentRowColumns))
+	mock.ExpectExec(`UPDATE waitlist_entries SET first_name`).
+		WithArgs(nil, "john@example.com", ErasedName, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	report, err := privacy.Erase(context.Background(), "", "john@example.com")
+
+	require.NoError(t, err)
+	assert.Equal(t, &ErasureReport{WaitlistEntries: 1}, report)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPrivacyService_Erase_RollsBackOnFailure(t *testing.T) {
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	privacy, mock := newTestPrivacy(t, now)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE appointments SET first_name`).
+		WillReturnRows(sqlmock.NewRows(appointmentRowColumns).
+			AddRow(5, ErasedName, ErasedName, now, now, nil, nil, nil, "CN-7K4Q-2M9X", "general", 1, "booked", nil, nil, nil))
+	mock.ExpectExec(`UPDATE waitlist_entries SET first_name`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE outbox_events SET payload`).
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	report, err := privacy.Erase(context.Background(), "citizen-123", "")
+
+	require.Error(t, err)
+	assert.Nil(t, report)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/notify"
+)
+
+// reminderBatchSize caps how many reminders of one kind are sent per run
+const reminderBatchSize = 100
+
+// ReminderService sends reminders a configured time before each visit. Visits
+// are assumed to start at visitStart on their visit_date.
+type ReminderService struct {
+	db           *db.DB
+	timeProvider func() time.Time
+	sender       ReminderSender
+	before       []time.Duration
+	visitStart   time.Duration
+}
+
+// NewReminderService creates a reminder job. Pass the same time provider as the
+// appointment service so reminders follow the simulated clock.
+func NewReminderService(database *db.DB, timeProvider func() time.Time, sender ReminderSender, before []time.Duration, visitStart time.Duration) *ReminderService {
+	return &ReminderService{
+		db:           database,
+		timeProvider: timeProvider,
+		sender:       sender,
+		before:       before,
+		visitStart:   visitStart,
+	}
+}
+
+// Run sends due reminders every interval until ctx is cancelled
+func (s *ReminderService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.SendDueReminders(ctx); err != nil {
+				log.Printf("Sending reminders failed: %v", err)
+			}
+		}
+	}
+}
+
+// SendDueReminders sends every reminder that is due and returns how many were sent
+func (s *ReminderService) SendDueReminders(ctx context.Context) (int, error) {
+	now := s.timeProvider()
+	sent := 0
+	for _, before := range s.before {
+		n, err := s.sendReminders(ctx, now, before)
+		sent += n
+		if err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+// sendReminders handles one kind of reminder. Each reminder is claimed in
+// reminders_sent before it is sent, so no two runs ever send the same one; a
+// claim is released again when sending fails so the next run retries it,
+// including when a queued email fails after the run has moved on.
+func (s *ReminderService) sendReminders(ctx context.Context, now time.Time, before time.Duration) (int, error) {
+	kind := before.String()
+
+	// A reminder is due from visit start minus before until the visit starts
+	query := `
+		WITH claimed AS (
+			INSERT INTO reminders_sent (appointment_id, kind, sent_at)
+			SELECT a.id, $1, $2 FROM appointments a
+			WHERE a.cancelled_at IS NULL AND a.email IS NOT NULL
+				AND a.visit_date > $3 AND a.visit_date <= $4
+				AND NOT EXISTS (SELECT 1 FROM reminders_sent r WHERE r.appointment_id = a.id AND r.kind = $1)
+			ORDER BY a.visit_date, a.id
+			LIMIT $5
+			ON CONFLICT (appointment_id, kind) DO NOTHING
+			RETURNING appointment_id
+		)
+		SELECT ` + appointmentColumns + `
+		FROM appointments
+		WHERE id IN (SELECT appointment_id FROM claimed)
+		ORDER BY visit_date, id
+	`
+	rows, err := s.db.QueryContext(ctx, query, kind, now,
+		now.Add(-s.visitStart), now.Add(before-s.visitStart), reminderBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim %s reminders: %w", kind, err)
+	}
+
+	var claimed []int
+	sent := 0
+	for rows.Next() {
+		appointment, err := scanAppointment(rows)
+		if err != nil {
+			rows.Close()
+			return sent, fmt.Errorf("failed to scan appointment: %w", err)
+		}
+
+		id := appointment.ID
+		sendCtx := notify.OnFailure(ctx, func(err error) {
+			log.Printf("Failed to deliver %s reminder for appointment %d: %v", kind, id, err)
+			// The run may have finished by now, but the tenant of ctx still applies
+			if err := s.release(context.WithoutCancel(ctx), id, kind); err != nil {
+				log.Printf("Reminder for appointment %d will not be retried: %v", id, err)
+			}
+		})
+		if err := s.sender.SendReminder(sendCtx, appointment, before); err != nil {
+			log.Printf("Failed to send %s reminder for appointment %d: %v", kind, appointment.ID, err)
+			claimed = append(claimed, appointment.ID)
+			continue
+		}
+		sent++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return sent, fmt.Errorf("failed to claim %s reminders: %w", kind, err)
+	}
+
+	for _, id := range claimed {
+		if err := s.release(ctx, id, kind); err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+// release gives up the claim on a reminder so the next run sends it again
+func (s *ReminderService) release(ctx context.Context, appointmentID int, kind string) error {
+	query := `DELETE FROM reminders_sent WHERE appointment_id = $1 AND kind = $2`
+	if _, err := s.db.ExecContext(ctx, query, appointmentID, kind); err != nil {
+		return fmt.Errorf("failed to release %s reminder for appointment %d: %w", kind, appointmentID, err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/notify"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingReminders struct {
+	sent    []int
+	before  []time.Duration
+	failFor map[int]bool
+	// queue, when set, takes the reminders like the asynchronous mailer does
+	queue *notify.Async
+}
+
+func (r *recordingReminders) SendReminder(ctx context.Context, appointment *models.Appointment, before time.Duration) error {
+	if r.failFor[appointment.ID] {
+		return errors.New("queue full")
+	}
+	if r.queue != nil {
+		return r.queue.Send(ctx, notify.Message{To: appointment.Email})
+	}
+	r.sent = append(r.sent, appointment.ID)
+	r.before = append(r.before, before)
+	return nil
+}
+
+func TestReminderService_SendDueReminders(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	now := time.Date(2075, 6, 12, 10, 0, 0, 0, time.UTC)
+	visitDate := time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC)
+	sender := &recordingReminders{failFor: map[int]bool{8: true}}
+	reminders := NewReminderService(&db.DB{DB: sqlDB}, func() time.Time { return now }, sender,
+		[]time.Duration{72 * time.Hour, 2 * time.Hour}, 9*time.Hour)
+
+	// 72h reminders cover visits starting at 09:00 up to 3 days from now
+	mock.ExpectQuery(`WITH claimed AS \( INSERT INTO reminders_sent`).
+		WithArgs("72h0m0s", now, now.Add(-9*time.Hour), now.Add(63*time.Hour), reminderBatchSize).
+		WillReturnRows(sqlmock.NewRows(appointmentRowColumns).
+			AddRow(7, "John", "Doe", visitDate, now, nil, nil, "john@example.com", nil, "general", nil, "booked", nil, nil, nil).
+			AddRow(8, "Jane", "Doe", visitDate, now, nil, nil, "jane@example.com", nil, "general", nil, "booked", nil, nil, nil))
+	mock.ExpectExec(`DELETE FROM reminders_sent WHERE appointment_id = \$1 AND kind = \$2`).
+		WithArgs(8, "72h0m0s").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`WITH claimed AS \( INSERT INTO reminders_sent`).
+		WithArgs("2h0m0s", now, now.Add(-9*time.Hour), now.Add(-7*time.Hour), reminderBatchSize).
+		WillReturnRows(sqlmock.NewRows(appointmentRowColumns))
+
+	sent, err := reminders.SendDueReminders(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, []int{7}, sender.sent)
+	assert.Equal(t, []time.Duration{72 * time.Hour}, sender.before)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+type failingNotifier struct{}
+
+func (failingNotifier) Send(ctx context.Context, msg notify.Message) error {
+	return errors.New("mailbox unavailable")
+}
+
+func TestReminderService_SendDueReminders_ReleasesUndelivered(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	now := time.Date(2075, 6, 12, 10, 0, 0, 0, time.UTC)
+	visitDate := time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC)
+	queue := notify.NewAsync(failingNotifier{}, 10, time.Second)
+	reminders := NewReminderService(&db.DB{DB: sqlDB}, func() time.Time { return now }, &recordingReminders{queue: queue},
+		[]time.Duration{72 * time.Hour}, 9*time.Hour)
+
+	mock.ExpectQuery(`WITH claimed AS \( INSERT INTO reminders_sent`).
+		WillReturnRows(sqlmock.NewRows(appointmentRowColumns).
+			AddRow(7, "John", "Doe", visitDate, now, nil, nil, "john@example.com", nil, "general", nil, "booked", nil, nil, nil))
+
+	sent, err := reminders.SendDueReminders(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent, "a queued reminder counts as sent")
+
+	// The mail server refuses it after the run, which gives up the claim
+	mock.ExpectExec(`DELETE FROM reminders_sent WHERE appointment_id = \$1 AND kind = \$2`).
+		WithArgs(7, "72h0m0s").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	queue.Run(ctx)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReminderService_SendDueReminders_ClaimError(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	reminders := NewReminderService(&db.DB{DB: sqlDB}, time.Now, &recordingReminders{},
+		[]time.Duration{24 * time.Hour}, 9*time.Hour)
+
+	mock.ExpectQuery(`WITH claimed AS`).WillReturnError(errors.New("boom"))
+
+	_, err = reminders.SendDueReminders(context.Background())
+
+	assert.EqualError(t, err, "failed to claim 24h0m0s reminders: boom")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
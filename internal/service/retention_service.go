@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/models"
+)
+
+// RetentionRun is what one run of the retention job anonymised, or would have in a dry run
+type RetentionRun struct {
+	RanAt time.Time `json:"ran_at"`
+	// Cutoff is the first visit date still kept; earlier visits were due
+	Cutoff          time.Time `json:"cutoff"`
+	DryRun          bool      `json:"dry_run"`
+	Appointments    int       `json:"appointments"`
+	WaitlistEntries int       `json:"waitlist_entries"`
+	HistoryEntries  int       `json:"history_entries"`
+}
+
+// String summarises the run for logs
+func (r *RetentionRun) String() string {
+	verb := "Anonymised"
+	if r.DryRun {
+		verb = "Dry run: would anonymise"
+	}
+	return fmt.Sprintf("%s %d appointments, %d waitlist entries and %d history entries of visits before %s",
+		verb, r.Appointments, r.WaitlistEntries, r.HistoryEntries, r.Cutoff.Format("2006-01-02"))
+}
+
+// RetentionService anonymises appointments and waitlist entries once their
+// visit date is longer ago than the retention period, the same way an erasure
+// request does. Rows are handled in batches, each in its own transaction, so a
+// large backlog never holds locks for long.
+type RetentionService struct {
+	db           *db.DB
+	timeProvider func() time.Time
+	days         int
+	batchSize    int
+	dryRun       bool
+}
+
+// NewRetentionService creates a retention job keeping personal data for the
+// given number of days after the visit. Pass the same time provider as the
+// appointment service so the period runs on the simulated clock.
+func NewRetentionService(database *db.DB, timeProvider func() time.Time, days, batchSize int) *RetentionService {
+	return &RetentionService{
+		db:           database,
+		timeProvider: timeProvider,
+		days:         days,
+		batchSize:    batchSize,
+	}
+}
+
+// WithDryRun makes Run only count what is due instead of anonymising it
+func (s *RetentionService) WithDryRun(dryRun bool) *RetentionService {
+	s.dryRun = dryRun
+	return s
+}
+
+// Run purges expired personal data every interval until ctx is cancelled
+func (s *RetentionService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			run, err := s.Purge(ctx, s.dryRun)
+			if err != nil {
+				log.Printf("Retention purge failed: %v", err)
+				continue
+			}
+			log.Printf("%s", run)
+		}
+	}
+}
+
+// Purge anonymises every appointment and waitlist entry whose visit date is
+// before the cutoff and logs the run in retention_runs. A dry run only counts
+// them. Batches committed before a failure stay anonymised.
+func (s *RetentionService) Purge(ctx context.Context, dryRun bool) (*RetentionRun, error) {
+	now := s.timeProvider()
+	run := &RetentionRun{
+		RanAt:  now,
+		Cutoff: now.Truncate(24*time.Hour).AddDate(0, 0, -s.days),
+		DryRun: dryRun,
+	}
+
+	var err error
+	if dryRun {
+		err = s.count(ctx, run)
+	} else {
+		err = s.purge(ctx, run)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO retention_runs (ran_at, cutoff, dry_run, appointments, waitlist_entries, history_entries)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	if _, err := s.db.ExecContext(ctx, query, run.RanAt, run.Cutoff, run.DryRun, run.Appointments, run.WaitlistEntries, run.HistoryEntries); err != nil {
+		return nil, fmt.Errorf("failed to log retention run: %w", err)
+	}
+	return run, nil
+}
+
+func (s *RetentionService) count(ctx context.Context, run *RetentionRun) error {
+	// Uses idx_appointments_retained_visit_date and idx_waitlist_entries_retained_visit_date
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM appointments WHERE visit_date < $1 AND anonymised_at IS NULL),
+			(SELECT COUNT(*) FROM waitlist_entries WHERE visit_date < $1 AND anonymised_at IS NULL),
+			(SELECT COUNT(*) FROM appointment_events WHERE appointment_id IN (
+				SELECT id FROM appointments WHERE visit_date < $1 AND anonymised_at IS NULL))
+	`
+	err := s.db.QueryRowContext(ctx, query, run.Cutoff).Scan(&run.Appointments, &run.WaitlistEntries, &run.HistoryEntries)
+	if err != nil {
+		return fmt.Errorf("failed to count expired data: %w", err)
+	}
+	return nil
+}
+
+func (s *RetentionService) purge(ctx context.Context, run *RetentionRun) error {
+	for {
+		var batch []*models.Appointment
+		var redacted int
+		err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+			// Replicas running the job at the same time take different batches
+			query := `
+				UPDATE appointments SET first_name = $3, last_name = $3, first_name_bidx = NULL, last_name_bidx = NULL,
+					first_name_phonetic = NULL, last_name_phonetic = NULL,
+					email = NULL, citizen_subject = NULL, anonymised_at = $4
+				WHERE id IN (
+					SELECT id FROM appointments
+					WHERE visit_date < $1 AND anonymised_at IS NULL
+					ORDER BY visit_date, id
+					LIMIT $2
+					FOR UPDATE SKIP LOCKED
+				)
+				RETURNING ` + appointmentColumns
+			rows, err := tx.QueryContext(ctx, query, run.Cutoff, s.batchSize, ErasedName, run.RanAt)
+			if err != nil {
+				return fmt.Errorf("failed to anonymise appointments: %w", err)
+			}
+			for rows.Next() {
+				appointment, err := scanAppointment(rows)
+				if err != nil {
+					rows.Close()
+					return fmt.Errorf("failed to anonymise appointments: %w", err)
+				}
+				batch = append(batch, appointment)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return fmt.Errorf("failed to anonymise appointments: %w", err)
+			}
+
+			redacted, err = eraseAppointmentTraces(ctx, tx, batch, run.RanAt)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		run.Appointments += len(batch)
+		run.HistoryEntries += redacted
+		if len(batch) < s.batchSize {
+			break
+		}
+	}
+
+	for {
+		query := `
+			UPDATE waitlist_entries SET first_name = $3, last_name = $3, email = NULL, citizen_subject = NULL, anonymised_at = $4
+			WHERE id IN (
+				SELECT id FROM waitlist_entries
+				WHERE visit_date < $1 AND anonymised_at IS NULL
+				ORDER BY visit_date, id
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED
+			)
+		`
+		result, err := s.db.ExecContext(ctx, query, run.Cutoff, s.batchSize, ErasedName, run.RanAt)
+		if err != nil {
+			return fmt.Errorf("failed to anonymise waitlist entries: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to anonymise waitlist entries: %w", err)
+		}
+		run.WaitlistEntries += int(affected)
+		if int(affected) < s.batchSize {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/audit"
+	"citynext-appointments/internal/db"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRetention(t *testing.T, now time.Time, batchSize int) (*RetentionService, sqlmock.Sqlmock) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	return NewRetentionService(&db.DB{DB: sqlDB}, func() time.Time { return now }, 730, batchSize), mock
+}
+
+// expectAnonymiseBatch expects one batch of appointments to be anonymised, with
+// no events or history about them
+func expectAnonymiseBatch(mock sqlmock.Sqlmock, cutoff, now time.Time, batchSize int, ids ...int) {
+	rows := sqlmock.NewRows(appointmentRowColumns)
+	for _, id := range ids {
+		rows.AddRow(id, ErasedName, ErasedName, cutoff.AddDate(0, 0, -1), cutoff, nil, nil, nil, "CN-7K4Q-2M9X", "general", 1, "completed", nil, nil, nil)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE appointments SET first_name = \$3, last_name = \$3, first_name_bidx = NULL, last_name_bidx = NULL, first_name_phonetic = NULL, last_name_phonetic = NULL, email = NULL, citizen_subject = NULL, anonymised_at = \$4 WHERE id IN \( SELECT id FROM appointments WHERE visit_date < \$1 AND anonymised_at IS NULL ORDER BY visit_date, id LIMIT \$2 FOR UPDATE SKIP LOCKED \)`).
+		WithArgs(cutoff, batchSize, ErasedName, now).
+		WillReturnRows(rows)
+	if len(ids) > 0 {
+		mock.ExpectExec(`UPDATE outbox_events`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`UPDATE webhook_deliveries`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`SET LOCAL citynext.redact_history = 'on'`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT id, actor, old_values, new_values FROM appointment_events`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "actor", "old_values", "new_values"}))
+		mock.ExpectExec(`SET LOCAL citynext.redact_history = 'off'`).WillReturnResult(sqlmock.NewResult(0, 0))
+		for _, id := range ids {
+			expectHistoryEvent(mock, audit.ActionErased, id)
+		}
+	}
+	mock.ExpectCommit()
+}
+
+func TestRetentionService_Purge_InBatches(t *testing.T) {
+	now := time.Date(2077, 6, 10, 15, 0, 0, 0, time.UTC)
+	cutoff := time.Date(2075, 6, 11, 0, 0, 0, 0, time.UTC)
+	retention, mock := newTestRetention(t, now, 2)
+
+	expectAnonymiseBatch(mock, cutoff, now, 2, 5, 6)
+	expectAnonymiseBatch(mock, cutoff, now, 2, 7)
+	mock.ExpectExec(`UPDATE waitlist_entries SET first_name = \$3, last_name = \$3, email = NULL, citizen_subject = NULL, anonymised_at = \$4 WHERE id IN \( SELECT id FROM waitlist_entries WHERE visit_date < \$1 AND anonymised_at IS NULL`).
+		WithArgs(cutoff, 2, ErasedName, now).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`UPDATE waitlist_entries`).
+		WithArgs(cutoff, 2, ErasedName, now).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO retention_runs \(ran_at, cutoff, dry_run, appointments, waitlist_entries, history_entries\)`).
+		WithArgs(now, cutoff, false, 3, 2, 0).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	run, err := retention.Purge(context.Background(), false)
+
+	require.NoError(t, err)
+	assert.Equal(t, &RetentionRun{RanAt: now, Cutoff: cutoff, Appointments: 3, WaitlistEntries: 2}, run)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRetentionService_Purge_DryRun(t *testing.T) {
+	now := time.Date(2077, 6, 10, 15, 0, 0, 0, time.UTC)
+	cutoff := time.Date(2075, 6, 11, 0, 0, 0, 0, time.UTC)
+	retention, mock := newTestRetention(t, now, 500)
+
+	mock.ExpectQuery(`SELECT \(SELECT COUNT\(\*\) FROM appointments WHERE visit_date < \$1 AND anonymised_at IS NULL\)`).
+		WithArgs(cutoff).
+		WillReturnRows(sqlmock.NewRows([]string{"appointments", "waitlist_entries", "history_entries"}).AddRow(120, 4, 360))
+	mock.ExpectExec(`INSERT INTO retention_runs`).
+		WithArgs(now, cutoff, true, 120, 4, 360).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	run, err := retention.Purge(context.Background(), true)
+
+	require.NoError(t, err)
+	assert.True(t, run.DryRun)
+	assert.Equal(t, 120, run.Appointments)
+	assert.Equal(t, "Dry run: would anonymise 120 appointments, 4 waitlist entries and 360 history entries of visits before 2075-06-11", run.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRetentionService_Purge_StopsOnFailure(t *testing.T) {
+	now := time.Date(2077, 6, 10, 15, 0, 0, 0, time.UTC)
+	retention, mock := newTestRetention(t, now, 500)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE appointments SET first_name`).
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	run, err := retention.Purge(context.Background(), false)
+
+	require.Error(t, err)
+	assert.Nil(t, run)
+	assert.NoError(t, mock.ExpectationsWereMet(), "a failed run is not logged as done")
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/models"
+	"citynext-appointments/internal/pii"
+
+	"github.com/lib/pq"
+)
+
+// maxSearchQueryLength is the longest name searched for, in characters
+const maxSearchQueryLength = 100
+
+// SearchService finds appointments by a name that may be misspelt or only
+// heard over the phone
+type SearchService struct {
+	db *db.DB
+}
+
+func NewSearchService(database *db.DB) *SearchService {
+	return &SearchService{db: database}
+}
+
+// Search returns the appointments whose names match query, best match first.
+// Names stored in plaintext are ranked by trigram similarity to the whole
+// query, so "Jon Oneil" finds John O'Neill. Encrypted names cannot be compared,
+// so they are matched word by word through their blind indexes, exact matches
+// ranking first. Either way a name that sounds like one of the words matches
+// through its phonetic key. Anonymised appointments have no names to find.
+func (s *SearchService) Search(ctx context.Context, query string, limit, offset int) (*models.AppointmentSearchPage, error) {
+	query = strings.TrimSpace(query)
+	if n := utf8.RuneCountInString(query); n < 2 || n > maxSearchQueryLength {
+		return nil, fmt.Errorf("%s", constants.ErrInvalidSearchQuery)
+	}
+
+	keyring := pii.Active()
+	var soundsLike []string
+	var exact []string
+	for _, word := range strings.Fields(query) {
+		if key := phoneticKey(keyring, word); key.Valid {
+			soundsLike = append(soundsLike, key.String)
+		}
+		if keyring != nil {
+			exact = append(exact, keyring.BlindIndex(word))
+		}
+	}
+	if len(soundsLike) == 0 {
+		return nil, fmt.Errorf("%s", constants.ErrInvalidSearchQuery)
+	}
+
+	match := `(first_name NOT LIKE 'pii:v1:%' AND $1 <% (first_name || ' ' || last_name))`
+	rank := `word_similarity($1, first_name || ' ' || last_name)`
+	var names interface{} = query
+	if keyring != nil {
+		match = `first_name_bidx = ANY($1) OR last_name_bidx = ANY($1)`
+		rank = `(CASE WHEN first_name_bidx = ANY($1) THEN 1 ELSE 0 END) + (CASE WHEN last_name_bidx = ANY($1) THEN 1 ELSE 0 END)`
+		names = pq.Array(exact)
+	}
+
+	// One row more than asked for tells whether there is a next page
+	sqlQuery := `
+		SELECT ` + appointmentColumns + `
+		FROM appointments
+		WHERE anonymised_at IS NULL
+			AND (` + match + ` OR first_name_phonetic = ANY($2) OR last_name_phonetic = ANY($2))
+		ORDER BY ` + rank + `
+			+ (CASE WHEN first_name_phonetic = ANY($2) THEN 0.5 ELSE 0 END)
+			+ (CASE WHEN last_name_phonetic = ANY($2) THEN 0.5 ELSE 0 END) DESC,
+			visit_date DESC, id DESC
+		LIMIT $3 OFFSET $4
+	`
+	rows, err := s.db.QueryContext(ctx, sqlQuery, names, pq.Array(soundsLike), limit+1, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search appointments: %w", err)
+	}
+	defer rows.Close()
+
+	page := &models.AppointmentSearchPage{Appointments: []models.Appointment{}, Limit: limit, Offset: offset}
+	for rows.Next() {
+		if len(page.Appointments) == limit {
+			page.HasMore = true
+			break
+		}
+		appointment, err := scanAppointment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search appointments: %w", err)
+		}
+		page.Appointments = append(page.Appointments, *appointment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search appointments: %w", err)
+	}
+	return page, nil
+}
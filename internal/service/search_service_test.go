@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/pii"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchService_Search(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	visitDate := time.Date(2075, 6, 15, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT id, first_name, .* FROM appointments WHERE anonymised_at IS NULL AND \(\(first_name NOT LIKE 'pii:v1:%' AND \$1 <% \(first_name \|\| ' ' \|\| last_name\)\) OR first_name_phonetic = ANY\(\$2\) OR last_name_phonetic = ANY\(\$2\)\) ORDER BY word_similarity\(\$1, first_name \|\| ' ' \|\| last_name\) .* DESC, visit_date DESC, id DESC LIMIT \$3 OFFSET \$4`).
+		WithArgs("Jon Oneil", `{"J500","O540"}`, 3, 0).
+		WillReturnRows(sqlmock.NewRows(appointmentRowColumns).
+			AddRow(5, "John", "O'Neill", visitDate, visitDate, nil, nil, nil, "CN-7K4Q-2M9X", "general", 1, "booked", nil, nil, nil).
+			AddRow(6, "Joan", "O'Neil", visitDate, visitDate, nil, nil, nil, "CN-7K4Q-2M9Y", "general", 1, "cancelled", nil, nil, nil).
+			AddRow(7, "Jane", "Doe", visitDate, visitDate, nil, nil, nil, "CN-7K4Q-2M9Z", "general", 1, "booked", nil, nil, nil))
+
+	page, err := NewSearchService(&db.DB{DB: sqlDB}).Search(context.Background(), " Jon Oneil ", 2, 0)
+
+	require.NoError(t, err)
+	require.Len(t, page.Appointments, 2)
+	assert.Equal(t, "O'Neill", page.Appointments[0].LastName)
+	assert.True(t, page.HasMore, "the row past the limit shows there is a next page")
+	assert.Equal(t, 2, page.Limit)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearchService_Search_EncryptedNames(t *testing.T) {
+	keyring := testKeyring(t, "2075-06")
+	pii.Use(keyring)
+	defer pii.Use(nil)
+
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	mock.ExpectQuery(`WHERE anonymised_at IS NULL AND \(first_name_bidx = ANY\(\$1\) OR last_name_bidx = ANY\(\$1\) OR first_name_phonetic = ANY\(\$2\)`).
+		WithArgs(`{"`+keyring.BlindIndex("oneil")+`"}`, `{"`+keyring.BlindIndex("soundex:O540")+`"}`, 21, 20).
+		WillReturnRows(sqlmock.NewRows(appointmentRowColumns))
+
+	page, err := NewSearchService(&db.DB{DB: sqlDB}).Search(context.Background(), "Oneil", 20, 20)
+
+	require.NoError(t, err)
+	assert.Empty(t, page.Appointments)
+	assert.False(t, page.HasMore)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearchService_Search_InvalidQuery(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	search := NewSearchService(&db.DB{DB: sqlDB})
+	for _, query := range []string{"", " J ", "42 17"} {
+		_, err := search.Search(context.Background(), query, 20, 0)
+		assert.EqualError(t, err, constants.ErrInvalidSearchQuery, query)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// MaxAvailabilityDays bounds the date range of one availability request
+const MaxAvailabilityDays = 62
+
+// DefaultAvailabilityDays is how many days are returned when no end date is given
+const DefaultAvailabilityDays = 14
+
+// serviceTypeColumns lists the columns read by scanServiceType, in order
+const serviceTypeColumns = `code, name, duration_minutes, required_documents, daily_quota`
+
+// ServiceTypeService reads the catalogue of service types and how many visits
+// of each are still free per date
+type ServiceTypeService struct {
+	db           *db.DB
+	timeProvider func() time.Time
+}
+
+// NewServiceTypeService creates the catalogue reader. Pass the same time provider
+// as the appointment service so holds and offers expire on the simulated clock.
+func NewServiceTypeService(database *db.DB, timeProvider func() time.Time) *ServiceTypeService {
+	return &ServiceTypeService{
+		db:           database,
+		timeProvider: timeProvider,
+	}
+}
+
+// ListServiceTypes returns every bookable service type, ordered by name
+func (s *ServiceTypeService) ListServiceTypes(ctx context.Context) ([]models.ServiceType, error) {
+	query := `SELECT ` + serviceTypeColumns + ` FROM service_types WHERE active ORDER BY name`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list service types: %w", err)
+	}
+	defer rows.Close()
+
+	serviceTypes := []models.ServiceType{}
+	for rows.Next() {
+		serviceType, err := scanServiceType(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list service types: %w", err)
+		}
+		serviceTypes = append(serviceTypes, *serviceType)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list service types: %w", err)
+	}
+	return serviceTypes, nil
+}
+
+// Availability returns how many visits of the service type are left on each date
+// from from to to inclusive. A zero from means today and a zero to means
+// DefaultAvailabilityDays from the start. Active bookings, open waitlist offers
+// and unexpired holds all use up the daily quota.
+func (s *ServiceTypeService) Availability(ctx context.Context, code string, from, to time.Time) ([]models.ServiceAvailability, error) {
+	serviceType, err := findServiceType(ctx, s.db, code)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.timeProvider()
+	if from.IsZero() {
+		from = now.Truncate(24 * time.Hour)
+	}
+	if to.IsZero() {
+		to = from.AddDate(0, 0, DefaultAvailabilityDays-1)
+	}
+
+	query := `
+		SELECT d::date,
+			(SELECT COUNT(*) FROM appointments
+				WHERE visit_date = d::date AND service_type = $3 AND cancelled_at IS NULL)
+			+ (SELECT COUNT(*) FROM waitlist_entries
+				WHERE visit_date = d::date AND service_type = $3 AND status = 'offered' AND offer_expires_at > $4)
+			+ (SELECT COUNT(*) FROM slot_holds
+				WHERE visit_date = d::date AND service_type = $3 AND expires_at > $4)
+		FROM generate_series($1::date, $2::date, INTERVAL '1 day') AS d
+		ORDER BY d
+	`
+	rows, err := s.db.QueryContext(ctx, query, from, to, serviceType.Code, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get availability: %w", err)
+	}
+	defer rows.Close()
+
+	availability := []models.ServiceAvailability{}
+	for rows.Next() {
+		var date time.Time
+		var used int
+		if err := rows.Scan(&date, &used); err != nil {
+			return nil, fmt.Errorf("failed to get availability: %w", err)
+		}
+		remaining := serviceType.DailyQuota - used
+		if remaining < 0 {
+			remaining = 0
+		}
+		availability = append(availability, models.ServiceAvailability{
+			Date:      date.Format(constants.DateLayout),
+			Remaining: remaining,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get availability: %w", err)
+	}
+	return availability, nil
+}
+
+// findServiceType returns the active service type with the given code
+func findServiceType(ctx context.Context, q queryer, code string) (*models.ServiceType, error) {
+	query := `SELECT ` + serviceTypeColumns + ` FROM service_types WHERE code = $1 AND active`
+	serviceType, err := scanServiceType(q.QueryRowContext(ctx, query, code))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%s", constants.ErrUnknownServiceType)
+		}
+		return nil, fmt.Errorf("failed to get service type: %w", err)
+	}
+	return serviceType, nil
+}
+
+// tenantLockKey hashes the lock key in $1 together with the tenant of the
+// session, so tenants never wait on each other's advisory locks. Sessions
+// without a tenant share the empty prefix.
+const tenantLockKey = `hashtext(coalesce(current_setting('` + db.TenantSetting + `', true), '') || ':' || $1)`
+
+// lockSlot serialises everything that books, holds, offers or frees visits of one
+// service type on one date until tx ends, so the quota check and the write that
+// follows it cannot interleave with another transaction's
+func lockSlot(ctx context.Context, tx *sql.Tx, serviceType string, date time.Time) error {
+	query := `SELECT pg_advisory_xact_lock(` + tenantLockKey + `, $2::date - DATE '2000-01-01')`
+	if _, err := tx.ExecContext(ctx, query, serviceType, date); err != nil {
+		return fmt.Errorf("failed to lock date: %w", err)
+	}
+	return nil
+}
+
+// slotUsage counts what uses up the quota of one service type on one date
+type slotUsage struct {
+	booked  int
+	offered int
+	held    int
+}
+
+func (u slotUsage) total() int {
+	return u.booked + u.offered + u.held
+}
+
+// countSlotUsage reads the slot usage. Call it after lockSlot when the result decides a write.
+func countSlotUsage(ctx context.Context, q queryer, serviceType string, date, now time.Time) (slotUsage, error) {
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM appointments
+				WHERE visit_date = $1 AND service_type = $2 AND cancelled_at IS NULL),
+			(SELECT COUNT(*) FROM waitlist_entries
+				WHERE visit_date = $1 AND service_type = $2 AND status = 'offered' AND offer_expires_at > $3),
+			(SELECT COUNT(*) FROM slot_holds
+				WHERE visit_date = $1 AND service_type = $2 AND expires_at > $3)
+	`
+	var usage slotUsage
+	err := q.QueryRowContext(ctx, query, date, serviceType, now).Scan(&usage.booked, &usage.offered, &usage.held)
+	return usage, err
+}
+
+func scanServiceType(row rowScanner) (*models.ServiceType, error) {
+	serviceType := &models.ServiceType{}
+	var documents []string
+	err := row.Scan(
+		&serviceType.Code,
+		&serviceType.Name,
+		&serviceType.DurationMinutes,
+		pq.Array(&documents),
+		&serviceType.DailyQuota,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if documents == nil {
+		documents = []string{}
+	}
+	serviceType.RequiredDocuments = documents
+	return serviceType, nil
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/db"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var serviceTypeRowColumns = []string{"code", "name", "duration_minutes", "required_documents", "daily_quota"}
+
+// expectServiceType expects the lookup of an active service type with the given quota
+func expectServiceType(mock sqlmock.Sqlmock, code string, quota int) {
+	mock.ExpectQuery(`SELECT code, name, duration_minutes, required_documents, daily_quota FROM service_types WHERE code = \$1 AND active`).
+		WithArgs(code).
+		WillReturnRows(sqlmock.NewRows(serviceTypeRowColumns).AddRow(code, "Service "+code, 30, "{}", quota))
+}
+
+// tenantLockPattern matches the advisory lock key hashed with the session's tenant
+const tenantLockPattern = `hashtext\(coalesce\(current_setting\('citynext.tenant_id', true\), ''\) \|\| ':' \|\| \$1\)`
+
+// expectSlotLock expects the advisory lock on a service type and date
+func expectSlotLock(mock sqlmock.Sqlmock, code string) {
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock\(`+tenantLockPattern+`, \$2::date - DATE '2000-01-01'\)`).
+		WithArgs(code, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+// expectSlotUsage expects the count of bookings, open offers and holds of a service type on a date
+func expectSlotUsage(mock sqlmock.Sqlmock, code string, booked, offered, held int) {
+	mock.ExpectQuery(`SELECT \(SELECT COUNT\(\*\) FROM appointments WHERE visit_date = \$1 AND service_type = \$2 AND cancelled_at IS NULL\)`).
+		WithArgs(sqlmock.AnyArg(), code, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"booked", "offered", "held"}).AddRow(booked, offered, held))
+}
+
+// expectQuotaCheck expects a full quota check: lookup, lock and usage count
+func expectQuotaCheck(mock sqlmock.Sqlmock, code string, quota, booked, offered, held int) {
+	expectServiceType(mock, code, quota)
+	expectSlotLock(mock, code)
+	expectSlotUsage(mock, code, booked, offered, held)
+}
+
+func TestServiceTypeService_ListServiceTypes(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	mock.ExpectQuery(`SELECT code, name, duration_minutes, required_documents, daily_quota FROM service_types WHERE active ORDER BY name`).
+		WillReturnRows(sqlmock.NewRows(serviceTypeRowColumns).
+			AddRow("general", "General enquiry", 30, "{}", 1).
+			AddRow("passport-renewal", "Passport renewal", 45, `{"Current passport","Two passport photos"}`, 8))
+
+	serviceTypes, err := NewServiceTypeService(&db.DB{DB: sqlDB}, time.Now).ListServiceTypes(context.Background())
+	require.NoError(t, err)
+	require.Len(t, serviceTypes, 2)
+
+	assert.Equal(t, "general", serviceTypes[0].Code)
+	assert.Equal(t, []string{}, serviceTypes[0].RequiredDocuments, "no documents must serialise as an empty list")
+	assert.Equal(t, "Passport renewal", serviceTypes[1].Name)
+	assert.Equal(t, 45, serviceTypes[1].DurationMinutes)
+	assert.Equal(t, []string{"Current passport", "Two passport photos"}, serviceTypes[1].RequiredDocuments)
+	assert.Equal(t, 8, serviceTypes[1].DailyQuota)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestServiceTypeService_Availability(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	from := time.Date(2075, 6, 10, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 2)
+
+	expectServiceType(mock, "passport-renewal", 8)
+	mock.ExpectQuery(`SELECT d::date, .* FROM generate_series\(\$1::date, \$2::date, INTERVAL '1 day'\) AS d ORDER BY d`).
+		WithArgs(from, to, "passport-renewal", now).
+		WillReturnRows(sqlmock.NewRows([]string{"d", "used"}).
+			AddRow(from, 0).
+			AddRow(from.AddDate(0, 0, 1), 8).
+			AddRow(from.AddDate(0, 0, 2), 3))
+
+	availability, err := NewServiceTypeService(&db.DB{DB: sqlDB}, func() time.Time { return now }).
+		Availability(context.Background(), "passport-renewal", from, to)
+	require.NoError(t, err)
+	require.Len(t, availability, 3)
+	assert.Equal(t, "2075-06-10", availability[0].Date)
+	assert.Equal(t, 8, availability[0].Remaining)
+	assert.Equal(t, 0, availability[1].Remaining)
+	assert.Equal(t, 5, availability[2].Remaining)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestServiceTypeService_Availability_DefaultRange(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	today := time.Date(2075, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	expectServiceType(mock, "general", 1)
+	mock.ExpectQuery(`FROM generate_series`).
+		WithArgs(today, today.AddDate(0, 0, DefaultAvailabilityDays-1), "general", now).
+		WillReturnRows(sqlmock.NewRows([]string{"d", "used"}))
+
+	_, err = NewServiceTypeService(&db.DB{DB: sqlDB}, func() time.Time { return now }).
+		Availability(context.Background(), "general", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestServiceTypeService_Availability_UnknownType(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	mock.ExpectQuery(`SELECT .* FROM service_types WHERE code = \$1 AND active`).
+		WithArgs("retired").
+		WillReturnError(sql.ErrNoRows)
+
+	day := time.Date(2075, 6, 10, 0, 0, 0, 0, time.UTC)
+	_, err = NewServiceTypeService(&db.DB{DB: sqlDB}, time.Now).Availability(context.Background(), "retired", day, day)
+	require.Error(t, err)
+	assert.Equal(t, constants.ErrUnknownServiceType, err.Error())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/models"
+)
+
+// staffLockKey namespaces the advisory locks that serialise staff assignment per date
+const staffLockKey = "staff-roster"
+
+// StaffService manages the clerks and counters that handle visits and their
+// weekly rosters. Bookings are assigned to staff by assignStaff, inside the
+// booking transaction.
+type StaffService struct {
+	db           *db.DB
+	timeProvider func() time.Time
+}
+
+// NewStaffService creates the staff store. Pass the same time provider as the
+// appointment service so agendas default to today on the simulated clock.
+func NewStaffService(database *db.DB, timeProvider func() time.Time) *StaffService {
+	return &StaffService{
+		db:           database,
+		timeProvider: timeProvider,
+	}
+}
+
+// CreateStaff adds an active staff member with their weekly roster
+func (s *StaffService) CreateStaff(ctx context.Context, req *models.CreateStaffRequest) (*models.Staff, error) {
+	if err := checkRoster(req.Roster); err != nil {
+		return nil, err
+	}
+
+	staff := &models.Staff{
+		Name:    req.Name,
+		Counter: req.Counter,
+		Active:  true,
+		Roster:  sortedRoster(req.Roster),
+	}
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		query := `INSERT INTO staff (name, counter) VALUES ($1, $2) RETURNING id`
+		if err := tx.QueryRowContext(ctx, query, staff.Name, nullString(staff.Counter)).Scan(&staff.ID); err != nil {
+			return fmt.Errorf("failed to create staff member: %w", err)
+		}
+		return insertRoster(ctx, tx, staff.ID, staff.Roster)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return staff, nil
+}
+
+// ListStaff returns every staff member with their roster, ordered by id
+func (s *StaffService) ListStaff(ctx context.Context) ([]models.Staff, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, name, counter, active FROM staff ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list staff: %w", err)
+	}
+	defer rows.Close()
+
+	staff := []models.Staff{}
+	byID := map[int]int{}
+	for rows.Next() {
+		member, err := scanStaff(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list staff: %w", err)
+		}
+		byID[member.ID] = len(staff)
+		staff = append(staff, *member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list staff: %w", err)
+	}
+	rows.Close()
+
+	shifts, err := s.db.QueryContext(ctx, `SELECT staff_id, weekday, minutes FROM staff_rosters ORDER BY staff_id, weekday`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rosters: %w", err)
+	}
+	defer shifts.Close()
+	for shifts.Next() {
+		var staffID int
+		var shift models.RosterShift
+		if err := shifts.Scan(&staffID, &shift.Weekday, &shift.Minutes); err != nil {
+			return nil, fmt.Errorf("failed to list rosters: %w", err)
+		}
+		if i, ok := byID[staffID]; ok {
+			staff[i].Roster = append(staff[i].Roster, shift)
+		}
+	}
+	if err := shifts.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list rosters: %w", err)
+	}
+	return staff, nil
+}
+
+// UpdateRoster replaces the weekly roster of a staff member. Bookings already
+// assigned to them are kept, even on days they no longer work.
+func (s *StaffService) UpdateRoster(ctx context.Context, staffID int, roster []models.RosterShift) (*models.Staff, error) {
+	if err := checkRoster(roster); err != nil {
+		return nil, err
+	}
+
+	var staff *models.Staff
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		// Locking the staff row keeps concurrent roster updates from interleaving
+		query := `SELECT id, name, counter, active FROM staff WHERE id = $1 FOR UPDATE`
+		member, err := scanStaff(tx.QueryRowContext(ctx, query, staffID))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("%s", constants.ErrStaffNotFound)
+			}
+			return fmt.Errorf("failed to get staff member: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM staff_rosters WHERE staff_id = $1`, staffID); err != nil {
+			return fmt.Errorf("failed to update roster: %w", err)
+		}
+		member.Roster = sortedRoster(roster)
+		if err := insertRoster(ctx, tx, staffID, member.Roster); err != nil {
+			return err
+		}
+		staff = member
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return staff, nil
+}
+
+// Agenda returns the active bookings of a staff member on a date, ordered by
+// booking. A zero date means today.
+func (s *StaffService) Agenda(ctx context.Context, staffID int, date time.Time) (*models.StaffAgenda, error) {
+	if date.IsZero() {
+		date = s.timeProvider().Truncate(24 * time.Hour)
+	}
+
+	member, err := scanStaff(s.db.QueryRowContext(ctx, `SELECT id, name, counter, active FROM staff WHERE id = $1`, staffID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%s", constants.ErrStaffNotFound)
+		}
+		return nil, fmt.Errorf("failed to get staff member: %w", err)
+	}
+
+	agenda := &models.StaffAgenda{
+		Date:         date.Format(constants.DateLayout),
+		Appointments: []models.Appointment{},
+	}
+	query := `SELECT minutes FROM staff_rosters WHERE staff_id = $1 AND weekday = $2`
+	err = s.db.QueryRowContext(ctx, query, staffID, int(date.Weekday())).Scan(&agenda.RosteredMinutes)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get roster: %w", err)
+	}
+	if agenda.RosteredMinutes > 0 {
+		member.Roster = []models.RosterShift{{Weekday: int(date.Weekday()), Minutes: agenda.RosteredMinutes}}
+	}
+	agenda.Staff = *member
+
+	// Uses idx_appointments_staff_visit_date
+	query = `
+		SELECT ` + appointmentColumns + `
+		FROM appointments
+		WHERE staff_id = $1 AND visit_date = $2 AND cancelled_at IS NULL
+		ORDER BY id
+	`
+	rows, err := s.db.QueryContext(ctx, query, staffID, date)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agenda: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		appointment, err := scanAppointment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get agenda: %w", err)
+		}
+		agenda.Appointments = append(agenda.Appointments, *appointment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get agenda: %w", err)
+	}
+
+	query = `
+		SELECT COALESCE(SUM(t.duration_minutes), 0)
+		FROM appointments a JOIN service_types t ON t.code = a.service_type
+		WHERE a.staff_id = $1 AND a.visit_date = $2 AND a.cancelled_at IS NULL
+	`
+	if err := s.db.QueryRowContext(ctx, query, staffID, date).Scan(&agenda.BookedMinutes); err != nil {
+		return nil, fmt.Errorf("failed to get agenda: %w", err)
+	}
+	return agenda, nil
+}
+
+// assignStaff picks the active staff member rostered on date who has the most
+// minutes left and enough of them for a visit of the service type. The advisory
+// lock serialises assignments on the date across service types until tx ends;
+// callers hold their lockSlot lock first, so the two are always taken in the
+// same order.
+func assignStaff(ctx context.Context, tx *sql.Tx, serviceType string, date time.Time) (int, error) {
+	lock := `SELECT pg_advisory_xact_lock(` + tenantLockKey + `, $2::date - DATE '2000-01-01')`
+	if _, err := tx.ExecContext(ctx, lock, staffLockKey, date); err != nil {
+		return 0, fmt.Errorf("failed to lock staff roster: %w", err)
+	}
+
+	query := `
+		SELECT r.staff_id
+		FROM staff_rosters r
+		JOIN staff s ON s.id = r.staff_id AND s.active
+		LEFT JOIN appointments a ON a.staff_id = r.staff_id AND a.visit_date = $1 AND a.cancelled_at IS NULL
+		LEFT JOIN service_types t ON t.code = a.service_type
+		WHERE r.weekday = EXTRACT(DOW FROM $1::date)
+		GROUP BY r.staff_id, r.minutes
+		HAVING r.minutes - COALESCE(SUM(t.duration_minutes), 0) >= (SELECT duration_minutes FROM service_types WHERE code = $2)
+		ORDER BY r.minutes - COALESCE(SUM(t.duration_minutes), 0) DESC, r.staff_id
+		LIMIT 1
+	`
+	var staffID int
+	if err := tx.QueryRowContext(ctx, query, date, serviceType).Scan(&staffID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("%s %s", constants.ErrNoStaffAvailable, date.Format(constants.DateLayout))
+		}
+		return 0, fmt.Errorf("failed to assign staff: %w", err)
+	}
+	return staffID, nil
+}
+
+// checkRoster rejects rosters that list a weekday twice
+func checkRoster(roster []models.RosterShift) error {
+	seen := map[int]bool{}
+	for _, shift := range roster {
+		if seen[shift.Weekday] {
+			return fmt.Errorf("%s", constants.ErrInvalidRoster)
+		}
+		seen[shift.Weekday] = true
+	}
+	return nil
+}
+
+// sortedRoster returns the shifts ordered by weekday, never nil
+func sortedRoster(roster []models.RosterShift) []models.RosterShift {
+	sorted := make([]models.RosterShift, 0, len(roster))
+	for weekday := 0; weekday < 7; weekday++ {
+		for _, shift := range roster {
+			if shift.Weekday == weekday {
+				sorted = append(sorted, shift)
+			}
+		}
+	}
+	return sorted
+}
+
+func insertRoster(ctx context.Context, tx *sql.Tx, staffID int, roster []models.RosterShift) error {
+	for _, shift := range roster {
+		query := `INSERT INTO staff_rosters (staff_id, weekday, minutes) VALUES ($1, $2, $3)`
+		if _, err := tx.ExecContext(ctx, query, staffID, shift.Weekday, shift.Minutes); err != nil {
+			return fmt.Errorf("failed to save roster: %w", err)
+		}
+	}
+	return nil
+}
+
+func scanStaff(row rowScanner) (*models.Staff, error) {
+	member := &models.Staff{Roster: []models.RosterShift{}}
+	var counter sql.NullString
+	if err := row.Scan(&member.ID, &member.Name, &counter, &member.Active); err != nil {
+		return nil, err
+	}
+	member.Counter = counter.String
+	return member, nil
+}
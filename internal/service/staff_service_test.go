@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expectStaffAssignment expects the roster lock and the pick of a free staff member
+func expectStaffAssignment(mock sqlmock.Sqlmock, staffID int) {
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock\(`+tenantLockPattern+`, \$2::date - DATE '2000-01-01'\)`).
+		WithArgs(staffLockKey, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT r.staff_id FROM staff_rosters r`).
+		WillReturnRows(sqlmock.NewRows([]string{"staff_id"}).AddRow(staffID))
+}
+
+func newTestStaffService(t *testing.T, now time.Time) (*StaffService, sqlmock.Sqlmock) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+	return NewStaffService(&db.DB{DB: sqlDB}, func() time.Time { return now }), mock
+}
+
+func TestAssignStaff(t *testing.T) {
+	visitDate := time.Date(2075, 6, 10, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name        string
+		rows        *sqlmock.Rows
+		expectedID  int
+		expectedErr string
+	}{
+		{"least loaded clerk", sqlmock.NewRows([]string{"staff_id"}).AddRow(2), 2, ""},
+		{"nobody free", sqlmock.NewRows([]string{"staff_id"}), 0, constants.ErrNoStaffAvailable + " 2075-06-10"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer sqlDB.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectExec(`SELECT pg_advisory_xact_lock`).
+				WithArgs(staffLockKey, visitDate).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(`SELECT r.staff_id FROM staff_rosters r JOIN staff s ON s.id = r.staff_id AND s.active .* WHERE r.weekday = EXTRACT\(DOW FROM \$1::date\) .* ORDER BY .* DESC, r.staff_id LIMIT 1`).
+				WithArgs(visitDate, "passport-renewal").
+				WillReturnRows(tc.rows)
+			mock.ExpectRollback()
+
+			tx, err := sqlDB.Begin()
+			require.NoError(t, err)
+			staffID, err := assignStaff(context.Background(), tx, "passport-renewal", visitDate)
+			tx.Rollback()
+
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, tc.expectedErr, err.Error())
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expectedID, staffID)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestStaffService_CreateStaff(t *testing.T) {
+	svc, mock := newTestStaffService(t, time.Now())
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO staff \(name, counter\) VALUES \(\$1, \$2\) RETURNING id`).
+		WithArgs("Clerk C", "Counter 3").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectExec(`INSERT INTO staff_rosters \(staff_id, weekday, minutes\) VALUES \(\$1, \$2, \$3\)`).
+		WithArgs(3, 1, 480).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO staff_rosters`).
+		WithArgs(3, 5, 240).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	staff, err := svc.CreateStaff(context.Background(), &models.CreateStaffRequest{
+		Name:    "Clerk C",
+		Counter: "Counter 3",
+		Roster:  []models.RosterShift{{Weekday: 5, Minutes: 240}, {Weekday: 1, Minutes: 480}},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, staff.ID)
+	assert.True(t, staff.Active)
+	assert.Equal(t, []models.RosterShift{{Weekday: 1, Minutes: 480}, {Weekday: 5, Minutes: 240}}, staff.Roster)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStaffService_CreateStaff_DuplicateWeekday(t *testing.T) {
+	svc, mock := newTestStaffService(t, time.Now())
+
+	_, err := svc.CreateStaff(context.Background(), &models.CreateStaffRequest{
+		Name:   "Clerk C",
+		Roster: []models.RosterShift{{Weekday: 1, Minutes: 480}, {Weekday: 1, Minutes: 240}},
+	})
+
+	require.Error(t, err)
+	assert.Equal(t, constants.ErrInvalidRoster, err.Error())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStaffService_ListStaff(t *testing.T) {
+	svc, mock := newTestStaffService(t, time.Now())
+
+	mock.ExpectQuery(`SELECT id, name, counter, active FROM staff ORDER BY id`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "counter", "active"}).
+			AddRow(1, "Clerk A", "Counter 1", true).
+			AddRow(2, "Clerk B", nil, false))
+	mock.ExpectQuery(`SELECT staff_id, weekday, minutes FROM staff_rosters ORDER BY staff_id, weekday`).
+		WillReturnRows(sqlmock.NewRows([]string{"staff_id", "weekday", "minutes"}).
+			AddRow(1, 1, 480).
+			AddRow(1, 2, 480))
+
+	staff, err := svc.ListStaff(context.Background())
+
+	require.NoError(t, err)
+	require.Len(t, staff, 2)
+	assert.Equal(t, []models.RosterShift{{Weekday: 1, Minutes: 480}, {Weekday: 2, Minutes: 480}}, staff[0].Roster)
+	assert.Equal(t, []models.RosterShift{}, staff[1].Roster, "staff without shifts must serialise an empty roster")
+	assert.Equal(t, "", staff[1].Counter)
+	assert.False(t, staff[1].Active)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStaffService_UpdateRoster(t *testing.T) {
+	svc, mock := newTestStaffService(t, time.Now())
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, name, counter, active FROM staff WHERE id = \$1 FOR UPDATE`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "counter", "active"}).AddRow(1, "Clerk A", "Counter 1", true))
+	mock.ExpectExec(`DELETE FROM staff_rosters WHERE staff_id = \$1`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 7))
+	mock.ExpectExec(`INSERT INTO staff_rosters`).
+		WithArgs(1, 3, 360).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	staff, err := svc.UpdateRoster(context.Background(), 1, []models.RosterShift{{Weekday: 3, Minutes: 360}})
+
+	require.NoError(t, err)
+	assert.Equal(t, "Clerk A", staff.Name)
+	assert.Equal(t, []models.RosterShift{{Weekday: 3, Minutes: 360}}, staff.Roster)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStaffService_UpdateRoster_NotFound(t *testing.T) {
+	svc, mock := newTestStaffService(t, time.Now())
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, name, counter, active FROM staff WHERE id = \$1 FOR UPDATE`).
+		WithArgs(9).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	_, err := svc.UpdateRoster(context.Background(), 9, nil)
+
+	require.Error(t, err)
+	assert.Equal(t, constants.ErrStaffNotFound, err.Error())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStaffService_Agenda(t *testing.T) {
+	now := time.Date(2075, 6, 10, 8, 0, 0, 0, time.UTC) // a Monday
+	today := time.Date(2075, 6, 10, 0, 0, 0, 0, time.UTC)
+	svc, mock := newTestStaffService(t, now)
+
+	mock.ExpectQuery(`SELECT id, name, counter, active FROM staff WHERE id = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "counter", "active"}).AddRow(1, "Clerk A", "Counter 1", true))
+	mock.ExpectQuery(`SELECT minutes FROM staff_rosters WHERE staff_id = \$1 AND weekday = \$2`).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"minutes"}).AddRow(480))
+	mock.ExpectQuery(`SELECT (.+) FROM appointments WHERE staff_id = \$1 AND visit_date = \$2 AND cancelled_at IS NULL ORDER BY id`).
+		WithArgs(1, today).
+		WillReturnRows(sqlmock.NewRows(appointmentRowColumns).
+			AddRow(4, "John", "Doe", today, now, nil, nil, nil, "CN-0110-000X", "passport-renewal", 1, "booked", nil, nil, nil).
+			AddRow(9, "Jane", "Doe", today, now, nil, nil, nil, "CN-0110-001X", "general", 1, "booked", nil, nil, nil))
+	mock.ExpectQuery(`SELECT COALESCE\(SUM\(t.duration_minutes\), 0\) FROM appointments a JOIN service_types t`).
+		WithArgs(1, today).
+		WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(75))
+
+	agenda, err := svc.Agenda(context.Background(), 1, time.Time{})
+
+	require.NoError(t, err)
+	assert.Equal(t, "2075-06-10", agenda.Date)
+	assert.Equal(t, "Clerk A", agenda.Staff.Name)
+	assert.Equal(t, 480, agenda.RosteredMinutes)
+	assert.Equal(t, 75, agenda.BookedMinutes)
+	require.Len(t, agenda.Appointments, 2)
+	assert.Equal(t, 4, agenda.Appointments[0].ID)
+	require.NotNil(t, agenda.Appointments[0].StaffID)
+	assert.Equal(t, 1, *agenda.Appointments[0].StaffID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStaffService_Agenda_DayOff(t *testing.T) {
+	day := time.Date(2075, 6, 9, 0, 0, 0, 0, time.UTC) // a Sunday
+	svc, mock := newTestStaffService(t, day)
+
+	mock.ExpectQuery(`SELECT id, name, counter, active FROM staff WHERE id = \$1`).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "counter", "active"}).AddRow(2, "Clerk B", nil, true))
+	mock.ExpectQuery(`SELECT minutes FROM staff_rosters`).
+		WithArgs(2, 0).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT (.+) FROM appointments WHERE staff_id = \$1`).
+		WillReturnRows(sqlmock.NewRows(appointmentRowColumns))
+	mock.ExpectQuery(`SELECT COALESCE`).
+		WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(0))
+
+	agenda, err := svc.Agenda(context.Background(), 2, day)
+
+	require.NoError(t, err)
+	assert.Equal(t, 0, agenda.RosteredMinutes)
+	assert.Equal(t, []models.RosterShift{}, agenda.Staff.Roster)
+	assert.Equal(t, []models.Appointment{}, agenda.Appointments)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStaffService_Agenda_NotFound(t *testing.T) {
+	svc, mock := newTestStaffService(t, time.Now())
+
+	mock.ExpectQuery(`SELECT id, name, counter, active FROM staff WHERE id = \$1`).
+		WithArgs(9).
+		WillReturnError(sql.ErrNoRows)
+
+	_, err := svc.Agenda(context.Background(), 9, time.Time{})
+
+	require.Error(t, err)
+	assert.Equal(t, constants.ErrStaffNotFound, err.Error())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
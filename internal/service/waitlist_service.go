@@ -0,0 +1,453 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/models"
+)
+
+// Waitlist entry states
+const (
+	WaitlistWaiting  = "waiting"
+	WaitlistOffered  = "offered"
+	WaitlistAccepted = "accepted"
+	WaitlistExpired  = "expired"
+	WaitlistDeclined = "declined"
+)
+
+// offerTokenBytes is the entropy of a waitlist offer token
+const offerTokenBytes = 24
+
+// waitlistColumns lists the columns read by scanWaitlistEntry, in order
+const waitlistColumns = `id, first_name, last_name, email, service_type, visit_date, citizen_subject, status, offer_token, offer_expires_at, appointment_id, created_at`
+
+// WaitlistService queues citizens for dates with no visits of a service type
+// left. When a slot frees up it is offered to the first citizen in line for that
+// type and date and held for them until the offer expires, after which it goes
+// to the next one.
+type WaitlistService struct {
+	db            *db.DB
+	timeProvider  func() time.Time
+	offerTTL      time.Duration
+	offers        WaitlistOfferSender
+	confirmations ConfirmationSender
+	// bookings applies the booking limit and duplicate policy, set by WithWaitlist
+	bookings *AppointmentService
+}
+
+// NewWaitlistService creates the waitlist. Pass the same time provider as the
+// appointment service so offers expire on the simulated clock.
+func NewWaitlistService(database *db.DB, timeProvider func() time.Time, offerTTL time.Duration) *WaitlistService {
+	return &WaitlistService{
+		db:           database,
+		timeProvider: timeProvider,
+		offerTTL:     offerTTL,
+	}
+}
+
+// WithNotifications emails offers to waiting citizens and confirms accepted ones
+func (s *WaitlistService) WithNotifications(offers WaitlistOfferSender, confirmations ConfirmationSender) *WaitlistService {
+	s.offers = offers
+	s.confirmations = confirmations
+	return s
+}
+
+// Join puts a citizen in the queue for a service type on a date that is fully booked
+func (s *WaitlistService) Join(ctx context.Context, req *models.JoinWaitlistRequest) (*models.WaitlistEntry, error) {
+	visitDate, err := time.Parse(constants.DateLayout, req.VisitDate)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", constants.ErrInvalidDateFormat, err)
+	}
+
+	now := s.timeProvider()
+	if visitDate.Before(now.Truncate(24 * time.Hour)) {
+		return nil, fmt.Errorf("%s", constants.ErrPastDate)
+	}
+
+	entry := &models.WaitlistEntry{
+		FirstName:      req.FirstName,
+		LastName:       req.LastName,
+		Email:          req.Email,
+		ServiceType:    req.ServiceType,
+		VisitDate:      visitDate,
+		CitizenSubject: req.CitizenSubject,
+		Status:         WaitlistWaiting,
+	}
+
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		serviceType, err := findServiceType(ctx, tx, req.ServiceType)
+		if err != nil {
+			return err
+		}
+		// Locking the slot orders this join against a concurrent cancellation or
+		// expiry, so the entry is never queued for a slot that has just become
+		// free without being offered
+		if err := lockSlot(ctx, tx, serviceType.Code, visitDate); err != nil {
+			return err
+		}
+		usage, err := countSlotUsage(ctx, tx, serviceType.Code, visitDate, now)
+		if err != nil {
+			return fmt.Errorf("failed to check date: %w", err)
+		}
+		if usage.total() < serviceType.DailyQuota {
+			return fmt.Errorf("%s", constants.ErrDateAvailable)
+		}
+
+		if req.CitizenSubject != "" {
+			query := `
+				SELECT COUNT(*) FROM waitlist_entries
+				WHERE visit_date = $1 AND service_type = $2 AND citizen_subject = $3 AND status IN ('waiting', 'offered')
+			`
+			var count int
+			if err := tx.QueryRowContext(ctx, query, visitDate, entry.ServiceType, req.CitizenSubject).Scan(&count); err != nil {
+				return fmt.Errorf("failed to check waitlist: %w", err)
+			}
+			if count > 0 {
+				return fmt.Errorf("%s", constants.ErrAlreadyWaitlisted)
+			}
+		}
+
+		firstName, lastName, err := sealNames(entry.FirstName, entry.LastName)
+		if err != nil {
+			return err
+		}
+		query := `
+			INSERT INTO waitlist_entries (first_name, last_name, email, service_type, visit_date, citizen_subject)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id, created_at
+		`
+		err = tx.QueryRowContext(ctx, query, firstName, lastName, nullString(entry.Email),
+			entry.ServiceType, entry.VisitDate, nullString(entry.CitizenSubject)).Scan(&entry.ID, &entry.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to join waitlist: %w", err)
+		}
+
+		entry.Position, err = queuePosition(ctx, tx, entry)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// GetEntry returns a waitlist entry, with its queue position while it is waiting
+func (s *WaitlistService) GetEntry(ctx context.Context, id int) (*models.WaitlistEntry, error) {
+	query := `SELECT ` + waitlistColumns + ` FROM waitlist_entries WHERE id = $1`
+	entry, err := scanWaitlistEntry(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get waitlist entry: %w", err)
+	}
+
+	if entry.Status == WaitlistWaiting {
+		if entry.Position, err = queuePosition(ctx, s.db, entry); err != nil {
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+func queuePosition(ctx context.Context, q queryer, entry *models.WaitlistEntry) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM waitlist_entries
+		WHERE visit_date = $1 AND service_type = $2 AND status = 'waiting' AND id <= $3
+	`
+	var position int
+	if err := q.QueryRowContext(ctx, query, entry.VisitDate, entry.ServiceType, entry.ID).Scan(&position); err != nil {
+		return 0, fmt.Errorf("failed to get waitlist position: %w", err)
+	}
+	return position, nil
+}
+
+// AcceptOffer books the offered date for the citizen holding the offer token.
+// When the booking limit or the duplicate policy refuses the booking, accepting
+// again cannot succeed, so the entry is declined and the date offered to the
+// next citizen in line before the refusal is returned.
+func (s *WaitlistService) AcceptOffer(ctx context.Context, token string) (*models.Appointment, error) {
+	now := s.timeProvider()
+	var appointment *models.Appointment
+	var duplicate *duplicateMatch
+	var refused error
+	var next *models.WaitlistEntry
+
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		query := `
+			UPDATE waitlist_entries SET status = 'accepted'
+			WHERE offer_token = $1 AND status = 'offered' AND offer_expires_at > $2
+			RETURNING ` + waitlistColumns
+		entry, err := scanWaitlistEntry(tx.QueryRowContext(ctx, query, token, now))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("%s", constants.ErrOfferNotFound)
+			}
+			return fmt.Errorf("failed to accept offer: %w", err)
+		}
+		if entry.VisitDate.Before(now.Truncate(24 * time.Hour)) {
+			return fmt.Errorf("%s", constants.ErrOfferNotFound)
+		}
+
+		appointment = &models.Appointment{
+			FirstName:      entry.FirstName,
+			LastName:       entry.LastName,
+			Email:          entry.Email,
+			ServiceType:    entry.ServiceType,
+			VisitDate:      entry.VisitDate,
+			CitizenSubject: entry.CitizenSubject,
+		}
+		// The open offer kept its slot free, so the booking simply takes it over
+		if s.bookings != nil {
+			if duplicate, err = s.bookings.bookReserved(ctx, tx, appointment, now); err != nil {
+				if !refusesCitizen(err) {
+					return err
+				}
+				refused = err
+				next, err = s.decline(ctx, tx, entry, now)
+				return err
+			}
+		} else if err := insertAppointment(ctx, tx, appointment, now); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE waitlist_entries SET appointment_id = $2 WHERE id = $1`, entry.ID, appointment.ID); err != nil {
+			return fmt.Errorf("failed to accept offer: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if refused != nil {
+		if refused.Error() == constants.ErrPossibleDuplicate {
+			s.bookings.recordRejected(ctx, duplicate, appointment.VisitDate, now)
+		}
+		s.notifyOffer(ctx, next)
+		return nil, refused
+	}
+	if duplicate != nil {
+		log.Printf("Flagged appointment %d as a duplicate of appointment %d: %s",
+			appointment.ID, duplicate.appointmentID, duplicate.reason)
+	}
+
+	if s.confirmations != nil {
+		if err := s.confirmations.SendConfirmation(ctx, appointment); err != nil {
+			log.Printf("Failed to queue confirmation for appointment %d: %v", appointment.ID, err)
+		}
+	}
+	return appointment, nil
+}
+
+// refusesCitizen reports whether a booking error is about the citizen rather
+// than the date, so trying again would fail the same way
+func refusesCitizen(err error) bool {
+	switch err.Error() {
+	case constants.ErrBookingLimitReached, constants.ErrPossibleDuplicate, constants.ErrIdentityRequired:
+		return true
+	}
+	return false
+}
+
+// decline closes an entry whose offer cannot be turned into a booking and
+// offers its date to the next citizen in line, in the same transaction
+func (s *WaitlistService) decline(ctx context.Context, tx *sql.Tx, entry *models.WaitlistEntry, now time.Time) (*models.WaitlistEntry, error) {
+	if _, err := tx.ExecContext(ctx, `UPDATE waitlist_entries SET status = 'declined' WHERE id = $1`, entry.ID); err != nil {
+		return nil, fmt.Errorf("failed to decline offer: %w", err)
+	}
+	return s.offerNext(ctx, tx, entry.ServiceType, entry.VisitDate, now)
+}
+
+// offerNext offers a free slot of the service type to the first citizen waiting
+// for it. It runs in the transaction that freed the slot and returns nil when
+// nobody is waiting or the date has no slot of the type left.
+func (s *WaitlistService) offerNext(ctx context.Context, tx *sql.Tx, serviceTypeCode string, date, now time.Time) (*models.WaitlistEntry, error) {
+	if date.Before(now.Truncate(24 * time.Hour)) {
+		return nil, nil
+	}
+
+	// Retired service types still free slots, so the lookup ignores whether it is active
+	var quota int
+	if err := tx.QueryRowContext(ctx, `SELECT daily_quota FROM service_types WHERE code = $1`, serviceTypeCode).Scan(&quota); err != nil {
+		return nil, fmt.Errorf("failed to get service type: %w", err)
+	}
+	if err := lockSlot(ctx, tx, serviceTypeCode, date); err != nil {
+		return nil, err
+	}
+	usage, err := countSlotUsage(ctx, tx, serviceTypeCode, date, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check date: %w", err)
+	}
+	if usage.total() >= quota {
+		return nil, nil
+	}
+
+	token, err := generateOfferToken()
+	if err != nil {
+		return nil, err
+	}
+	query := `
+		UPDATE waitlist_entries SET status = 'offered', offer_token = $3, offer_expires_at = $4
+		WHERE id = (
+			SELECT id FROM waitlist_entries
+			WHERE visit_date = $1 AND service_type = $2 AND status = 'waiting'
+			ORDER BY id LIMIT 1
+			FOR UPDATE
+		)
+		RETURNING ` + waitlistColumns
+	entry, err := scanWaitlistEntry(tx.QueryRowContext(ctx, query, date, serviceTypeCode, token, now.Add(s.offerTTL)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to offer date: %w", err)
+	}
+	return entry, nil
+}
+
+// notifyOffer tells the citizen about an offer after the transaction that made it has committed
+func (s *WaitlistService) notifyOffer(ctx context.Context, entry *models.WaitlistEntry) {
+	if entry == nil || s.offers == nil {
+		return
+	}
+	if err := s.offers.SendWaitlistOffer(ctx, entry); err != nil {
+		log.Printf("Failed to queue waitlist offer %d: %v", entry.ID, err)
+	}
+}
+
+// Run passes expired offers on every interval until ctx is cancelled
+func (s *WaitlistService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.ExpireOffers(ctx); err != nil {
+				log.Printf("Expiring waitlist offers failed: %v", err)
+			}
+		}
+	}
+}
+
+// ExpireOffers expires lapsed offers, offers their slots to the next citizen in
+// line and drops entries for dates that have passed. It returns the number of
+// offers that expired.
+func (s *WaitlistService) ExpireOffers(ctx context.Context) (int, error) {
+	now := s.timeProvider()
+	var offered []*models.WaitlistEntry
+	expired := 0
+
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		query := `
+			UPDATE waitlist_entries SET status = 'expired'
+			WHERE status = 'offered' AND offer_expires_at <= $1
+			RETURNING service_type, visit_date
+		`
+		rows, err := tx.QueryContext(ctx, query, now)
+		if err != nil {
+			return fmt.Errorf("failed to expire offers: %w", err)
+		}
+		type slot struct {
+			serviceType string
+			date        time.Time
+		}
+		var slots []slot
+		for rows.Next() {
+			var freed slot
+			if err := rows.Scan(&freed.serviceType, &freed.date); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to expire offers: %w", err)
+			}
+			slots = append(slots, freed)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to expire offers: %w", err)
+		}
+		expired = len(slots)
+
+		for _, freed := range slots {
+			entry, err := s.offerNext(ctx, tx, freed.serviceType, freed.date, now)
+			if err != nil {
+				return err
+			}
+			if entry != nil {
+				offered = append(offered, entry)
+			}
+		}
+
+		query = `UPDATE waitlist_entries SET status = 'expired' WHERE status = 'waiting' AND visit_date < $1`
+		if _, err := tx.ExecContext(ctx, query, now.Truncate(24*time.Hour)); err != nil {
+			return fmt.Errorf("failed to expire past waitlist entries: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range offered {
+		s.notifyOffer(ctx, entry)
+	}
+	return expired, nil
+}
+
+func generateOfferToken() (string, error) {
+	token := make([]byte, offerTokenBytes)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("failed to generate offer token: %w", err)
+	}
+	return hex.EncodeToString(token), nil
+}
+
+func scanWaitlistEntry(row rowScanner) (*models.WaitlistEntry, error) {
+	entry := &models.WaitlistEntry{}
+	var email, citizenSubject, offerToken sql.NullString
+	var offerExpiresAt sql.NullTime
+	var appointmentID sql.NullInt64
+
+	err := row.Scan(
+		&entry.ID,
+		&entry.FirstName,
+		&entry.LastName,
+		&email,
+		&entry.ServiceType,
+		&entry.VisitDate,
+		&citizenSubject,
+		&entry.Status,
+		&offerToken,
+		&offerExpiresAt,
+		&appointmentID,
+		&entry.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := openNames(&entry.FirstName, &entry.LastName); err != nil {
+		return nil, err
+	}
+
+	entry.Email = email.String
+	entry.CitizenSubject = citizenSubject.String
+	entry.OfferToken = offerToken.String
+	if offerExpiresAt.Valid {
+		entry.OfferExpiresAt = &offerExpiresAt.Time
+	}
+	if appointmentID.Valid {
+		id := int(appointmentID.Int64)
+		entry.AppointmentID = &id
+	}
+	return entry, nil
+}
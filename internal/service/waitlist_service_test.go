@@ -0,0 +1,302 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var waitlistRowColumns = []string{"id", "first_name", "last_name", "email", "service_type", "visit_date", "citizen_subject", "status", "offer_token", "offer_expires_at", "appointment_id", "created_at"}
+
+type recordingOffers struct {
+	sent []*models.WaitlistEntry
+}
+
+func (r *recordingOffers) SendWaitlistOffer(ctx context.Context, entry *models.WaitlistEntry) error {
+	r.sent = append(r.sent, entry)
+	return nil
+}
+
+func newTestWaitlist(t *testing.T, now time.Time) (*WaitlistService, sqlmock.Sqlmock, *recordingOffers) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	offers := &recordingOffers{}
+	waitlist := NewWaitlistService(&db.DB{DB: sqlDB}, func() time.Time { return now }, 24*time.Hour).
+		WithNotifications(offers, &recordingConfirmations{})
+	return waitlist, mock, offers
+}
+
+// expectOfferNext expects offerNext to find a general slot free on the date and
+// offer it to entry id 7, or to nobody when id is 0
+func expectOfferNext(mock sqlmock.Sqlmock, date, now time.Time, id int) {
+	mock.ExpectQuery(`SELECT daily_quota FROM service_types WHERE code = \$1`).
+		WithArgs("general").
+		WillReturnRows(sqlmock.NewRows([]string{"daily_quota"}).AddRow(1))
+	expectSlotLock(mock, "general")
+	expectSlotUsage(mock, "general", 0, 0, 0)
+
+	offer := mock.ExpectQuery(`UPDATE waitlist_entries SET status = 'offered', offer_token = \$3, offer_expires_at = \$4 WHERE id = \( SELECT id FROM waitlist_entries WHERE visit_date = \$1 AND service_type = \$2 AND status = 'waiting' ORDER BY id LIMIT 1 FOR UPDATE \)`).
+		WithArgs(date, "general", sqlmock.AnyArg(), now.Add(24*time.Hour))
+	if id == 0 {
+		offer.WillReturnError(sql.ErrNoRows)
+		return
+	}
+	offer.WillReturnRows(sqlmock.NewRows(waitlistRowColumns).
+		AddRow(id, "Jane", "Doe", "jane@example.com", "general", date, nil, WaitlistOffered, "token", now.Add(24*time.Hour), nil, now))
+}
+
+func TestWaitlistService_Join(t *testing.T) {
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	visitDate := time.Date(2075, 6, 10, 0, 0, 0, 0, time.UTC)
+	waitlist, mock, _ := newTestWaitlist(t, now)
+
+	mock.ExpectBegin()
+	// Eight passport renewals are booked or offered, so the date is full
+	expectQuotaCheck(mock, "passport-renewal", 8, 7, 1, 0)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM waitlist_entries WHERE visit_date = \$1 AND service_type = \$2 AND citizen_subject = \$3`).
+		WithArgs(visitDate, "passport-renewal", "citizen-123").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`INSERT INTO waitlist_entries`).
+		WithArgs("Jane", "Doe", nil, "passport-renewal", visitDate, "citizen-123").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(4, now))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM waitlist_entries WHERE visit_date = \$1 AND service_type = \$2 AND status = 'waiting' AND id <= \$3`).
+		WithArgs(visitDate, "passport-renewal", 4).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectCommit()
+
+	entry, err := waitlist.Join(context.Background(), &models.JoinWaitlistRequest{
+		FirstName:      "Jane",
+		LastName:       "Doe",
+		VisitDate:      "2075-06-10",
+		ServiceType:    "passport-renewal",
+		CitizenSubject: "citizen-123",
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 4, entry.ID)
+	assert.Equal(t, "passport-renewal", entry.ServiceType)
+	assert.Equal(t, WaitlistWaiting, entry.Status)
+	assert.Equal(t, 2, entry.Position)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWaitlistService_Join_Rejected(t *testing.T) {
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	visitDate := time.Date(2075, 6, 10, 0, 0, 0, 0, time.UTC)
+
+	t.Run("past date", func(t *testing.T) {
+		waitlist, mock, _ := newTestWaitlist(t, now)
+		_, err := waitlist.Join(context.Background(), &models.JoinWaitlistRequest{VisitDate: "2075-05-01"})
+		assert.EqualError(t, err, constants.ErrPastDate)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("date is free", func(t *testing.T) {
+		waitlist, mock, _ := newTestWaitlist(t, now)
+		mock.ExpectBegin()
+		expectQuotaCheck(mock, "passport-renewal", 8, 6, 1, 0)
+		mock.ExpectRollback()
+
+		_, err := waitlist.Join(context.Background(), &models.JoinWaitlistRequest{VisitDate: "2075-06-10", ServiceType: "passport-renewal"})
+		assert.EqualError(t, err, constants.ErrDateAvailable)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("already waiting", func(t *testing.T) {
+		waitlist, mock, _ := newTestWaitlist(t, now)
+		mock.ExpectBegin()
+		expectQuotaCheck(mock, "general", 1, 0, 1, 0)
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM waitlist_entries`).
+			WithArgs(visitDate, "general", "citizen-123").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectRollback()
+
+		_, err := waitlist.Join(context.Background(), &models.JoinWaitlistRequest{VisitDate: "2075-06-10", ServiceType: "general", CitizenSubject: "citizen-123"})
+		assert.EqualError(t, err, constants.ErrAlreadyWaitlisted)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestWaitlistService_AcceptOffer(t *testing.T) {
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	visitDate := time.Date(2075, 6, 10, 0, 0, 0, 0, time.UTC)
+	waitlist, mock, _ := newTestWaitlist(t, now)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE waitlist_entries SET status = 'accepted' WHERE offer_token = \$1 AND status = 'offered' AND offer_expires_at > \$2`).
+		WithArgs("token", now).
+		WillReturnRows(sqlmock.NewRows(waitlistRowColumns).
+			AddRow(7, "Jane", "Doe", "jane@example.com", "general", visitDate, "citizen-123", WaitlistAccepted, "token", now.Add(time.Hour), nil, now))
+	expectStaffAssignment(mock, 1)
+	mock.ExpectQuery(`INSERT INTO appointments`).
+		WithArgs("Jane", "Doe", visitDate, "citizen-123", "jane@example.com", sqlmock.AnyArg(), "general", 1, nil, nil, "J500", "D000").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(12, now))
+	expectOutboxEvent(mock, constants.EventAppointmentCreated, 12)
+	expectHistoryEvent(mock, constants.EventAppointmentCreated, 12)
+	mock.ExpectExec(`UPDATE waitlist_entries SET appointment_id = \$2 WHERE id = \$1`).
+		WithArgs(7, 12).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	appointment, err := waitlist.AcceptOffer(context.Background(), "token")
+
+	require.NoError(t, err)
+	assert.Equal(t, 12, appointment.ID)
+	assert.Equal(t, "citizen-123", appointment.CitizenSubject)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWaitlistService_AcceptOffer_BookingRules(t *testing.T) {
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	visitDate := time.Date(2075, 6, 10, 0, 0, 0, 0, time.UTC)
+
+	expectAccept := func(mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`UPDATE waitlist_entries SET status = 'accepted'`).
+			WithArgs("token", now).
+			WillReturnRows(sqlmock.NewRows(waitlistRowColumns).
+				AddRow(7, "Jane", "Doe", "jane@example.com", "general", visitDate, "citizen-123", WaitlistAccepted, "token", now.Add(time.Hour), nil, now))
+	}
+
+	// A refused acceptance cannot succeed later, so the date goes to the next citizen
+	expectDecline := func(mock sqlmock.Sqlmock) {
+		mock.ExpectExec(`UPDATE waitlist_entries SET status = 'declined' WHERE id = \$1`).
+			WithArgs(7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectOfferNext(mock, visitDate, now, 8)
+		mock.ExpectCommit()
+	}
+
+	t.Run("booking limit", func(t *testing.T) {
+		waitlist, mock, offers := newTestWaitlist(t, now)
+		NewAppointmentServiceWithTime(waitlist.db, waitlist.timeProvider).WithBookingLimit(1).WithWaitlist(waitlist)
+
+		expectAccept(mock)
+		expectActiveBookings(mock, "citizen-123", now, 1)
+		expectDecline(mock)
+
+		_, err := waitlist.AcceptOffer(context.Background(), "token")
+
+		assert.EqualError(t, err, constants.ErrBookingLimitReached)
+		require.Len(t, offers.sent, 1)
+		assert.Equal(t, 8, offers.sent[0].ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("duplicate", func(t *testing.T) {
+		waitlist, mock, offers := newTestWaitlist(t, now)
+		NewAppointmentServiceWithTime(waitlist.db, waitlist.timeProvider).WithDuplicatePolicy(DuplicatePolicyReject).WithWaitlist(waitlist)
+
+		expectAccept(mock)
+		expectDuplicateCheck(mock, "J500", "D000", now, duplicateCandidates().
+			AddRow(4, "Jane", "Doe", nil, "citizen-123"))
+		expectDecline(mock)
+		mock.ExpectExec(`INSERT INTO duplicate_matches`).
+			WithArgs(nil, 4, visitDate, DuplicateReasonSameName, DuplicateActionRejected, now).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		_, err := waitlist.AcceptOffer(context.Background(), "token")
+
+		assert.EqualError(t, err, constants.ErrPossibleDuplicate)
+		require.Len(t, offers.sent, 1)
+		assert.Equal(t, 8, offers.sent[0].ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestWaitlistService_AcceptOffer_Expired(t *testing.T) {
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	waitlist, mock, _ := newTestWaitlist(t, now)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE waitlist_entries SET status = 'accepted'`).
+		WithArgs("stale", now).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	_, err := waitlist.AcceptOffer(context.Background(), "stale")
+
+	assert.EqualError(t, err, constants.ErrOfferNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWaitlistService_ExpireOffers(t *testing.T) {
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	visitDate := time.Date(2075, 6, 10, 0, 0, 0, 0, time.UTC)
+	waitlist, mock, offers := newTestWaitlist(t, now)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE waitlist_entries SET status = 'expired' WHERE status = 'offered' AND offer_expires_at <= \$1 RETURNING service_type, visit_date`).
+		WithArgs(now).
+		WillReturnRows(sqlmock.NewRows([]string{"service_type", "visit_date"}).AddRow("general", visitDate))
+	expectOfferNext(mock, visitDate, now, 7)
+	mock.ExpectExec(`UPDATE waitlist_entries SET status = 'expired' WHERE status = 'waiting' AND visit_date < \$1`).
+		WithArgs(now.Truncate(24 * time.Hour)).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	expired, err := waitlist.ExpireOffers(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, expired)
+	require.Len(t, offers.sent, 1, "the next citizen in line is told after commit")
+	assert.Equal(t, 7, offers.sent[0].ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAppointmentService_CancelAppointment_OffersToWaitlist(t *testing.T) {
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	visitDate := time.Date(2075, 6, 10, 0, 0, 0, 0, time.UTC)
+	waitlist, mock, offers := newTestWaitlist(t, now)
+	service := NewAppointmentServiceWithTime(waitlist.db, func() time.Time { return now }).WithWaitlist(waitlist)
+
+	mock.ExpectQuery(`SELECT .* FROM appointments WHERE id = \$1`).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows(appointmentRowColumns).AddRow(5, "John", "Doe", visitDate, now, nil, nil, nil, nil, "general", nil, "booked", nil, nil, nil))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE appointments SET status = 'cancelled', cancelled_at = \$2 WHERE id = \$1 AND status = 'booked'`).
+		WithArgs(5, now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectOutboxEvent(mock, constants.EventAppointmentCancelled, 5)
+	expectHistoryEvent(mock, constants.EventAppointmentCancelled, 5)
+	expectOfferNext(mock, visitDate, now, 7)
+	mock.ExpectCommit()
+
+	_, err := service.CancelAppointment(context.Background(), 5)
+
+	require.NoError(t, err)
+	require.Len(t, offers.sent, 1)
+	assert.Equal(t, "token", offers.sent[0].OfferToken)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAppointmentService_CreateAppointment_BlockedByOffer(t *testing.T) {
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	waitlist, mock, _ := newTestWaitlist(t, now)
+	service := NewAppointmentServiceWithTime(waitlist.db, func() time.Time { return now }).WithWaitlist(waitlist)
+
+	mock.ExpectBegin()
+	expectQuotaCheck(mock, "general", 1, 0, 1, 0)
+	mock.ExpectRollback()
+
+	_, err := service.CreateAppointment(context.Background(), &models.CreateAppointmentRequest{
+		FirstName:   "John",
+		LastName:    "Doe",
+		VisitDate:   "2075-06-10",
+		ServiceType: "general",
+	})
+
+	assert.EqualError(t, err, constants.ErrDuplicateAppointment+" 2075-06-10")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,164 @@
+// Package tenant describes the councils sharing one deployment of the service.
+// Every request and background job runs on behalf of exactly one tenant, carried
+// in its context, and the database only shows it that tenant's rows.
+package tenant
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Tenant is a council using the service, with its own data, holidays,
+// branding and policies
+type Tenant struct {
+	ID       int    `json:"id"`
+	Slug     string `json:"slug"`
+	Name     string `json:"name"`
+	Hostname string `json:"hostname,omitempty"`
+	// HolidayCountry is the Nager.Date country code, empty for the service default.
+	// HolidayRegion narrows it to a subdivision such as GB-SCT.
+	HolidayCountry string   `json:"holiday_country,omitempty"`
+	HolidayRegion  string   `json:"holiday_region,omitempty"`
+	Branding       Branding `json:"branding"`
+	// MaxActivePerCitizen overrides the service-wide booking limit when set, 0 meaning unlimited
+	MaxActivePerCitizen *int `json:"max_active_per_citizen,omitempty"`
+	// DuplicatePolicy overrides the service-wide duplicate booking policy when set
+	DuplicatePolicy string `json:"duplicate_policy,omitempty"`
+}
+
+// Branding is how a tenant presents itself in emails. Empty fields fall back
+// to the service-wide notification settings.
+type Branding struct {
+	// Name signs emails and names the office, e.g. "CityNext"
+	Name        string `json:"name,omitempty"`
+	EmailFrom   string `json:"email_from,omitempty"`
+	CancelURL   string `json:"cancel_url,omitempty"`
+	WaitlistURL string `json:"waitlist_url,omitempty"`
+}
+
+type tenantKey struct{}
+
+// WithTenant attaches the tenant a request or job runs for to the context
+func WithTenant(ctx context.Context, t *Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey{}, t)
+}
+
+// From returns the tenant attached to the context, if any
+func From(ctx context.Context) (*Tenant, bool) {
+	t, ok := ctx.Value(tenantKey{}).(*Tenant)
+	return t, ok && t != nil
+}
+
+// IDFrom returns the id of the tenant attached to the context, 0 when there is none
+func IDFrom(ctx context.Context) int {
+	if t, ok := From(ctx); ok {
+		return t.ID
+	}
+	return 0
+}
+
+// Registry holds the known tenants, looked up by id, slug or hostname
+type Registry struct {
+	byID   map[int]*Tenant
+	bySlug map[string]*Tenant
+	byHost map[string]*Tenant
+}
+
+// NewRegistry indexes the given tenants
+func NewRegistry(tenants []*Tenant) *Registry {
+	r := &Registry{
+		byID:   make(map[int]*Tenant, len(tenants)),
+		bySlug: make(map[string]*Tenant, len(tenants)),
+		byHost: make(map[string]*Tenant, len(tenants)),
+	}
+	for _, t := range tenants {
+		r.byID[t.ID] = t
+		r.bySlug[t.Slug] = t
+		if t.Hostname != "" {
+			r.byHost[normaliseHost(t.Hostname)] = t
+		}
+	}
+	return r
+}
+
+// queryer is satisfied by *db.DB
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Load reads every tenant from the tenants table. The table is not tenant
+// scoped, so the query has to run without a tenant in ctx.
+func Load(ctx context.Context, database queryer) (*Registry, error) {
+	query := `
+		SELECT id, slug, name, COALESCE(hostname, ''), COALESCE(holiday_country, ''), COALESCE(holiday_region, ''),
+			COALESCE(brand_name, ''), COALESCE(email_from, ''), COALESCE(cancel_url, ''), COALESCE(waitlist_url, ''),
+			max_active_per_citizen, COALESCE(duplicate_policy, '')
+		FROM tenants
+		ORDER BY id
+	`
+	rows, err := database.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tenants: %w", err)
+	}
+	defer rows.Close()
+
+	var tenants []*Tenant
+	for rows.Next() {
+		t := &Tenant{}
+		var maxActive sql.NullInt64
+		if err := rows.Scan(&t.ID, &t.Slug, &t.Name, &t.Hostname, &t.HolidayCountry, &t.HolidayRegion,
+			&t.Branding.Name, &t.Branding.EmailFrom, &t.Branding.CancelURL, &t.Branding.WaitlistURL,
+			&maxActive, &t.DuplicatePolicy); err != nil {
+			return nil, fmt.Errorf("failed to load tenants: %w", err)
+		}
+		if maxActive.Valid {
+			limit := int(maxActive.Int64)
+			t.MaxActivePerCitizen = &limit
+		}
+		tenants = append(tenants, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load tenants: %w", err)
+	}
+	return NewRegistry(tenants), nil
+}
+
+// ByID returns the tenant with the given id
+func (r *Registry) ByID(id int) (*Tenant, bool) {
+	t, ok := r.byID[id]
+	return t, ok
+}
+
+// BySlug returns the tenant with the given slug
+func (r *Registry) BySlug(slug string) (*Tenant, bool) {
+	t, ok := r.bySlug[strings.ToLower(strings.TrimSpace(slug))]
+	return t, ok
+}
+
+// ByHost returns the tenant served on the given Host header value, port and case ignored
+func (r *Registry) ByHost(host string) (*Tenant, bool) {
+	t, ok := r.byHost[normaliseHost(host)]
+	return t, ok
+}
+
+// All returns every tenant ordered by id
+func (r *Registry) All() []*Tenant {
+	tenants := make([]*Tenant, 0, len(r.byID))
+	for _, t := range r.byID {
+		tenants = append(tenants, t)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].ID < tenants[j].ID })
+	return tenants
+}
+
+func normaliseHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(host, ".")
+}
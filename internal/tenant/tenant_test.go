@@ -0,0 +1,55 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	mock.ExpectQuery(`SELECT id, slug, name, .* FROM tenants ORDER BY id`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "slug", "name", "hostname", "holiday_country", "holiday_region",
+			"brand_name", "email_from", "cancel_url", "waitlist_url", "max_active_per_citizen", "duplicate_policy"}).
+			AddRow(1, "default", "CityNext", "", "", "", "", "", "", "", nil, "").
+			AddRow(2, "glasgow", "Glasgow City Council", "appointments.glasgow.example", "GB", "GB-SCT",
+				"Glasgow City Council", "bookings@glasgow.example", "https://glasgow.example/cancel/{reference}", "", 1, "reject"))
+
+	registry, err := Load(context.Background(), sqlDB)
+
+	require.NoError(t, err)
+	glasgow, ok := registry.BySlug("Glasgow")
+	require.True(t, ok)
+	assert.Equal(t, "GB-SCT", glasgow.HolidayRegion)
+	assert.Equal(t, "bookings@glasgow.example", glasgow.Branding.EmailFrom)
+	require.NotNil(t, glasgow.MaxActivePerCitizen)
+	assert.Equal(t, 1, *glasgow.MaxActivePerCitizen)
+
+	byHost, ok := registry.ByHost("Appointments.Glasgow.example:443")
+	require.True(t, ok, "the port and case of the Host header are ignored")
+	assert.Same(t, glasgow, byHost)
+
+	fallback, ok := registry.ByID(1)
+	require.True(t, ok)
+	assert.Nil(t, fallback.MaxActivePerCitizen, "no override keeps the service-wide limit")
+	_, ok = registry.ByHost("")
+	assert.False(t, ok, "tenants without a hostname are not matched by an empty host")
+	assert.Len(t, registry.All(), 2)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	_, ok := From(ctx)
+	assert.False(t, ok)
+	assert.Equal(t, 0, IDFrom(ctx))
+
+	ctx = WithTenant(ctx, &Tenant{ID: 7, Slug: "leeds"})
+	assert.Equal(t, 7, IDFrom(ctx))
+}
@@ -0,0 +1,225 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/pii"
+)
+
+const (
+	// minBackoff is the delay before the first retry, doubled on every further failure
+	minBackoff = 5 * time.Second
+	batchSize  = 50
+	userAgent  = "CityNext-Webhooks/1.0"
+)
+
+// Sign returns the signature header value for a payload sent at timestamp.
+// Receivers recompute HMAC-SHA256 over "<timestamp>.<body>" with their secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// pendingDelivery is a claimed delivery together with its target
+type pendingDelivery struct {
+	id        int64
+	eventType string
+	payload   string
+	attempts  int
+	url       string
+	secret    string
+}
+
+// Dispatcher posts pending deliveries to subscribers. Failed deliveries are
+// retried with exponential backoff and marked dead after maxAttempts.
+type Dispatcher struct {
+	db          *db.DB
+	client      *http.Client
+	maxAttempts int
+	maxBackoff  time.Duration
+	// Retry timing is about real delivery attempts, never the simulated clock
+	now func() time.Time
+}
+
+func NewDispatcher(database *db.DB, timeout time.Duration, maxAttempts int, maxBackoff time.Duration) *Dispatcher {
+	return &Dispatcher{
+		db: database,
+		client: &http.Client{
+			Timeout: timeout,
+			// A redirect would send the signed payload somewhere the subscriber did not register
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		maxAttempts: maxAttempts,
+		maxBackoff:  maxBackoff,
+		now:         time.Now,
+	}
+}
+
+// Run delivers due webhooks every interval until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := d.DispatchOnce(ctx); err != nil {
+				log.Printf("Webhook dispatch failed: %v", err)
+			}
+		}
+	}
+}
+
+// DispatchOnce sends one batch of due deliveries and returns how many succeeded
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	pending, err := d.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, p := range pending {
+		statusCode, sendErr := d.send(ctx, p)
+		if err := d.record(ctx, p, statusCode, sendErr); err != nil {
+			return delivered, err
+		}
+		if sendErr == nil {
+			delivered++
+		}
+	}
+	return delivered, nil
+}
+
+// claim leases due deliveries by pushing their next attempt past the request timeout,
+// so a second instance skips them and a crash mid-send only delays the retry
+func (d *Dispatcher) claim(ctx context.Context) ([]pendingDelivery, error) {
+	now := d.now()
+	query := `
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = $2
+		FROM webhook_subscriptions s
+		WHERE s.id = d.subscription_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at, id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.event_type, d.payload, d.attempts, s.url, s.secret
+	`
+	rows, err := d.db.QueryContext(ctx, query, now, now.Add(2*d.client.Timeout), batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var pending []pendingDelivery
+	for rows.Next() {
+		var p pendingDelivery
+		if err := rows.Scan(&p.id, &p.eventType, &p.payload, &p.attempts, &p.url, &p.secret); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		pending = append(pending, p)
+	}
+	return pending, rows.Err()
+}
+
+// send posts the signed payload with its names opened, treating anything but a
+// 2xx response as a failure
+func (d *Dispatcher) send(ctx context.Context, p pendingDelivery) (int, error) {
+	body, err := mapNames([]byte(p.payload), pii.Open)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open webhook payload: %w", err)
+	}
+	timestamp := d.now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("invalid webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(constants.HeaderWebhookEvent, p.eventType)
+	req.Header.Set(constants.HeaderWebhookDelivery, strconv.FormatInt(p.id, 10))
+	req.Header.Set(constants.HeaderWebhookTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(constants.HeaderWebhookSignature, Sign(p.secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// record stores the outcome of an attempt in the delivery log
+func (d *Dispatcher) record(ctx context.Context, p pendingDelivery, statusCode int, sendErr error) error {
+	now := d.now()
+	attempts := p.attempts + 1
+
+	var code interface{}
+	if statusCode != 0 {
+		code = statusCode
+	}
+
+	var err error
+	switch {
+	case sendErr == nil:
+		_, err = d.db.ExecContext(ctx, `
+			UPDATE webhook_deliveries
+			SET status = 'delivered', attempts = $2, last_status_code = $3, last_error = NULL, delivered_at = $4
+			WHERE id = $1`,
+			p.id, attempts, code, now)
+	case attempts >= d.maxAttempts:
+		log.Printf("Webhook delivery %d to %s is dead after %d attempts: %v", p.id, p.url, attempts, sendErr)
+		_, err = d.db.ExecContext(ctx, `
+			UPDATE webhook_deliveries
+			SET status = 'dead', attempts = $2, last_status_code = $3, last_error = $4
+			WHERE id = $1`,
+			p.id, attempts, code, sendErr.Error())
+	default:
+		_, err = d.db.ExecContext(ctx, `
+			UPDATE webhook_deliveries
+			SET attempts = $2, last_status_code = $3, last_error = $4, next_attempt_at = $5
+			WHERE id = $1`,
+			p.id, attempts, code, sendErr.Error(), now.Add(d.backoff(attempts)))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record webhook delivery %d: %w", p.id, err)
+	}
+	return nil
+}
+
+// backoff returns the delay before the given attempt is retried
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := minBackoff
+	for i := 1; i < attempts && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.maxBackoff {
+		delay = d.maxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,132 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/pii"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var claimColumns = []string{"id", "event_type", "payload", "attempts", "url", "secret"}
+
+func TestSign(t *testing.T) {
+	// Reference value computed with: printf '1700000000.{}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t,
+		"sha256=b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163",
+		Sign("secret", 1700000000, []byte("{}")))
+}
+
+func TestDispatcher_DispatchOnce(t *testing.T) {
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	payload := `{"id":3,"type":"appointment.created","data":{"id":5}}`
+
+	var received *http.Request
+	var receivedBody []byte
+	partner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		receivedBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer partner.Close()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	dispatcher := NewDispatcher(&db.DB{DB: sqlDB}, 10*time.Second, 3, time.Hour)
+	dispatcher.now = func() time.Time { return now }
+
+	mock.ExpectQuery(`UPDATE webhook_deliveries d SET next_attempt_at = \$2 FROM webhook_subscriptions s`).
+		WithArgs(now, now.Add(20*time.Second), batchSize).
+		WillReturnRows(sqlmock.NewRows(claimColumns).
+			AddRow(21, "appointment.created", payload, 0, partner.URL, "partner-secret").
+			AddRow(22, "appointment.created", payload, 1, failing.URL, "other-secret").
+			AddRow(23, "appointment.created", payload, 2, failing.URL, "other-secret"))
+	mock.ExpectExec(`UPDATE webhook_deliveries SET status = 'delivered', attempts = \$2, last_status_code = \$3, last_error = NULL, delivered_at = \$4 WHERE id = \$1`).
+		WithArgs(int64(21), 1, http.StatusAccepted, now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// Second failure waits 5s * 2
+	mock.ExpectExec(`UPDATE webhook_deliveries SET attempts = \$2, last_status_code = \$3, last_error = \$4, next_attempt_at = \$5 WHERE id = \$1`).
+		WithArgs(int64(22), 2, http.StatusServiceUnavailable, "unexpected status 503", now.Add(10*time.Second)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE webhook_deliveries SET status = 'dead', attempts = \$2, last_status_code = \$3, last_error = \$4 WHERE id = \$1`).
+		WithArgs(int64(23), 3, http.StatusServiceUnavailable, "unexpected status 503").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	delivered, err := dispatcher.DispatchOnce(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	require.NotNil(t, received)
+	assert.Equal(t, payload, string(receivedBody))
+	assert.Equal(t, "appointment.created", received.Header.Get("X-CityNext-Event"))
+	assert.Equal(t, "21", received.Header.Get("X-CityNext-Delivery"))
+	assert.Equal(t, strconv.FormatInt(now.Unix(), 10), received.Header.Get("X-CityNext-Timestamp"))
+	assert.Equal(t, Sign("partner-secret", now.Unix(), []byte(payload)), received.Header.Get("X-CityNext-Signature"))
+}
+
+func TestDispatcher_DoesNotFollowRedirects(t *testing.T) {
+	elsewhere := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("signed payload must not follow redirects")
+	}))
+	defer elsewhere.Close()
+
+	redirecting := httptest.NewServer(http.RedirectHandler(elsewhere.URL, http.StatusTemporaryRedirect))
+	defer redirecting.Close()
+
+	dispatcher := NewDispatcher(nil, time.Second, 3, time.Hour)
+	status, err := dispatcher.send(context.Background(), pendingDelivery{id: 1, payload: "{}", url: redirecting.URL, secret: "s"})
+
+	assert.Equal(t, http.StatusTemporaryRedirect, status)
+	assert.Error(t, err)
+}
+
+func TestDispatcher_SendOpensNames(t *testing.T) {
+	keyring, err := pii.NewKeyring(map[string][]byte{
+		"2075-06": bytes.Repeat([]byte{2}, pii.KeySize),
+		"index":   bytes.Repeat([]byte{3}, pii.KeySize),
+	}, "2075-06", "index")
+	require.NoError(t, err)
+	pii.Use(keyring)
+	defer pii.Use(nil)
+	sealed, err := keyring.Seal("John")
+	require.NoError(t, err)
+
+	var receivedBody []byte
+	var signature string
+	partner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedBody, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get("X-CityNext-Signature")
+	}))
+	defer partner.Close()
+
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+	dispatcher := NewDispatcher(nil, time.Second, 3, time.Hour)
+	dispatcher.now = func() time.Time { return now }
+	stored := `{"id":3,"type":"appointment.created","created_at":"2075-06-01T10:00:00Z","data":{"first_name":"` + sealed + `","id":5}}`
+
+	_, err = dispatcher.send(context.Background(), pendingDelivery{id: 1, payload: stored, url: partner.URL, secret: "s"})
+
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":3,"type":"appointment.created","created_at":"2075-06-01T10:00:00Z","data":{"first_name":"John","id":5}}`,
+		string(receivedBody), "partners get the names in plaintext")
+	assert.Equal(t, Sign("s", now.Unix(), receivedBody), signature, "the signature covers the bytes sent")
+}
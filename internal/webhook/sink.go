@@ -0,0 +1,122 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/outbox"
+	"citynext-appointments/internal/pii"
+)
+
+// Envelope is the JSON body posted to subscribers
+type Envelope struct {
+	// ID is the outbox event id, identical across retries and subscriptions
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Sink is the outbox sink that queues a delivery for every subscription to the event.
+// The unique (subscription_id, event_id) constraint makes redelivered events harmless.
+// Names stay sealed as in the event until the delivery is sent.
+type Sink struct {
+	db *db.DB
+}
+
+func NewSink(database *db.DB) *Sink {
+	return &Sink{db: database}
+}
+
+func (s *Sink) Name() string { return "webhooks" }
+
+func (s *Sink) Deliver(ctx context.Context, event outbox.Event) error {
+	body, err := json.Marshal(Envelope{
+		ID:        event.ID,
+		Type:      event.Type,
+		CreatedAt: event.CreatedAt,
+		Data:      event.Payload,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	query := `
+		INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload)
+		SELECT id, $1, $2, $3 FROM webhook_subscriptions WHERE $2 = ANY(events)
+		ON CONFLICT (subscription_id, event_id) DO NOTHING
+	`
+	if _, err := s.db.ExecContext(ctx, query, event.ID, event.Type, string(body)); err != nil {
+		return fmt.Errorf("failed to queue webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// mapNames applies fn to the names in the data of a stored delivery payload
+func mapNames(payload []byte, fn func(string) (string, error)) ([]byte, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return nil, err
+	}
+	data, err := pii.MapNames(envelope.Data, fn)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(data, envelope.Data) {
+		return payload, nil
+	}
+	envelope.Data = data
+	return json.Marshal(envelope)
+}
+
+// RewrapNames seals the names in up to limit delivery payloads after afterID
+// with the primary key of keyring, for key rotation. It returns the number of
+// deliveries rewritten and the last id looked at, which is afterID once every
+// delivery is done.
+func RewrapNames(ctx context.Context, tx *sql.Tx, keyring *pii.Keyring, afterID int64, limit int) (int, int64, error) {
+	query := `SELECT id, payload FROM webhook_deliveries WHERE id > $1 ORDER BY id LIMIT $2 FOR UPDATE`
+	rows, err := tx.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to rewrap names in webhook deliveries: %w", err)
+	}
+	type stored struct {
+		id      int64
+		payload string
+	}
+	var deliveries []stored
+	for rows.Next() {
+		var d stored
+		if err := rows.Scan(&d.id, &d.payload); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("failed to rewrap names in webhook deliveries: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("failed to rewrap names in webhook deliveries: %w", err)
+	}
+
+	rewritten := 0
+	lastID := afterID
+	for _, d := range deliveries {
+		lastID = d.id
+		payload, err := mapNames([]byte(d.payload), keyring.Refresh)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to rewrap names in webhook delivery %d: %w", d.id, err)
+		}
+		if string(payload) == d.payload {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE webhook_deliveries SET payload = $2 WHERE id = $1`, d.id, string(payload)); err != nil {
+			return 0, 0, fmt.Errorf("failed to rewrap names in webhook delivery %d: %w", d.id, err)
+		}
+		rewritten++
+	}
+	return rewritten, lastID, nil
+}
@@ -0,0 +1,54 @@
+package webhook
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/outbox"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// envelopeArg checks that the queued payload wraps the appointment JSON
+type envelopeArg struct {
+	t *testing.T
+}
+
+func (a envelopeArg) Match(v driver.Value) bool {
+	var envelope Envelope
+	if err := json.Unmarshal([]byte(v.(string)), &envelope); err != nil {
+		return false
+	}
+	return assert.Equal(a.t, int64(12), envelope.ID) &&
+		assert.Equal(a.t, "appointment.cancelled", envelope.Type) &&
+		assert.JSONEq(a.t, `{"id":5,"first_name":"John"}`, string(envelope.Data))
+}
+
+func TestSink_Deliver(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	sink := NewSink(&db.DB{DB: sqlDB})
+
+	mock.ExpectExec(`INSERT INTO webhook_deliveries \(subscription_id, event_id, event_type, payload\) SELECT id, \$1, \$2, \$3 FROM webhook_subscriptions WHERE \$2 = ANY\(events\) ON CONFLICT \(subscription_id, event_id\) DO NOTHING`).
+		WithArgs(int64(12), "appointment.cancelled", envelopeArg{t}).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	err = sink.Deliver(context.Background(), outbox.Event{
+		ID:          12,
+		Type:        "appointment.cancelled",
+		AggregateID: 5,
+		Payload:     json.RawMessage(`{"id":5,"first_name":"John"}`),
+		CreatedAt:   time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC),
+	})
+
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
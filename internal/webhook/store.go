@@ -0,0 +1,195 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/pii"
+
+	"github.com/lib/pq"
+)
+
+const (
+	secretPrefix = "whsec_"
+	secretBytes  = 32
+)
+
+// Delivery states
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	// StatusDead marks deliveries that ran out of attempts
+	StatusDead = "dead"
+)
+
+// Subscription is a partner endpoint that receives appointment events
+type Subscription struct {
+	ID     int      `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Secret is only returned when the subscription is created
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Delivery is one event sent, or being sent, to one subscription
+type Delivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int             `json:"subscription_id"`
+	EventID        int64           `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// GenerateSecret returns a new random signing secret
+func GenerateSecret() (string, error) {
+	secret := make([]byte, secretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return secretPrefix + hex.EncodeToString(secret), nil
+}
+
+// Store manages subscriptions and the delivery log
+type Store struct {
+	db *db.DB
+}
+
+func NewStore(database *db.DB) *Store {
+	return &Store{db: database}
+}
+
+// Create registers a subscription. An empty secret is replaced with a generated one.
+func (s *Store) Create(ctx context.Context, url string, events []string, secret string) (*Subscription, error) {
+	if secret == "" {
+		generated, err := GenerateSecret()
+		if err != nil {
+			return nil, err
+		}
+		secret = generated
+	}
+
+	sub := &Subscription{URL: url, Events: events, Secret: secret}
+	query := `
+		INSERT INTO webhook_subscriptions (url, secret, events)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+	err := s.db.QueryRowContext(ctx, query, sub.URL, sub.Secret, pq.Array(sub.Events)).
+		Scan(&sub.ID, &sub.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook subscription: %w", err)
+	}
+	return sub, nil
+}
+
+// List returns every subscription without its secret, newest first
+func (s *Store) List(ctx context.Context) ([]Subscription, error) {
+	query := `SELECT id, url, events, created_at FROM webhook_subscriptions ORDER BY id DESC`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	subs := []Subscription{}
+	for rows.Next() {
+		var sub Subscription
+		if err := rows.Scan(&sub.ID, &sub.URL, pq.Array(&sub.Events), &sub.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook subscription: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// Delete removes a subscription together with its delivery log
+func (s *Store) Delete(ctx context.Context, id int) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s", constants.ErrWebhookNotFound)
+	}
+	return nil
+}
+
+// Deliveries returns the newest deliveries of a subscription, optionally only those in one status
+func (s *Store) Deliveries(ctx context.Context, subscriptionID int, status string, limit int) ([]Delivery, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM webhook_subscriptions WHERE id = $1)`, subscriptionID).
+		Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up webhook subscription: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%s", constants.ErrWebhookNotFound)
+	}
+
+	query := `
+		SELECT id, subscription_id, event_id, event_type, payload, status, attempts,
+			next_attempt_at, last_status_code, last_error, created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE subscription_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`
+	rows, err := s.db.QueryContext(ctx, query, subscriptionID, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []Delivery{}
+	for rows.Next() {
+		var d Delivery
+		var payload string
+		var nextAttemptAt, deliveredAt sql.NullTime
+		var statusCode sql.NullInt64
+		var lastError sql.NullString
+		err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts,
+			&nextAttemptAt, &statusCode, &lastError, &d.CreatedAt, &deliveredAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+
+		opened, err := mapNames([]byte(payload), pii.Open)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read webhook delivery %d: %w", d.ID, err)
+		}
+		d.Payload = json.RawMessage(opened)
+		d.LastError = lastError.String
+		// The retry time only means something while the delivery is still pending
+		if nextAttemptAt.Valid && d.Status == StatusPending {
+			d.NextAttemptAt = &nextAttemptAt.Time
+		}
+		if statusCode.Valid {
+			code := int(statusCode.Int64)
+			d.LastStatusCode = &code
+		}
+		if deliveredAt.Valid {
+			d.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/constants"
+	"citynext-appointments/internal/db"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Create_GeneratesSecret(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	store := NewStore(&db.DB{DB: sqlDB})
+	createdAt := time.Now()
+
+	mock.ExpectQuery(`INSERT INTO webhook_subscriptions \(url, secret, events\) VALUES \(\$1, \$2, \$3\) RETURNING id, created_at`).
+		WithArgs("https://partner.example/hooks", sqlmock.AnyArg(), `{"appointment.created"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(4, createdAt))
+
+	sub, err := store.Create(context.Background(), "https://partner.example/hooks", []string{"appointment.created"}, "")
+
+	require.NoError(t, err)
+	assert.Equal(t, 4, sub.ID)
+	assert.True(t, strings.HasPrefix(sub.Secret, "whsec_"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_Delete_NotFound(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	store := NewStore(&db.DB{DB: sqlDB})
+
+	mock.ExpectExec(`DELETE FROM webhook_subscriptions WHERE id = \$1`).
+		WithArgs(9).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = store.Delete(context.Background(), 9)
+
+	assert.EqualError(t, err, constants.ErrWebhookNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_Deliveries(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	store := NewStore(&db.DB{DB: sqlDB})
+	now := time.Date(2075, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM webhook_subscriptions WHERE id = \$1\)`).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`SELECT .* FROM webhook_deliveries WHERE subscription_id = \$1 AND \(\$2 = '' OR status = \$2\) ORDER BY id DESC LIMIT \$3`).
+		WithArgs(4, "dead", 20).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "subscription_id", "event_id", "event_type", "payload", "status", "attempts",
+			"next_attempt_at", "last_status_code", "last_error", "created_at", "delivered_at"}).
+			AddRow(11, 4, 3, "appointment.created", `{"id":3}`, "dead", 8, now, 503, "unexpected status 503", now, nil))
+
+	deliveries, err := store.Deliveries(context.Background(), 4, "dead", 20)
+
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	d := deliveries[0]
+	assert.Equal(t, StatusDead, d.Status)
+	assert.Nil(t, d.NextAttemptAt, "dead deliveries are not retried")
+	require.NotNil(t, d.LastStatusCode)
+	assert.Equal(t, 503, *d.LastStatusCode)
+	assert.JSONEq(t, `{"id":3}`, string(d.Payload))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStore_Deliveries_UnknownSubscription(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	store := NewStore(&db.DB{DB: sqlDB})
+
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	_, err = store.Deliveries(context.Background(), 4, "", 20)
+
+	assert.EqualError(t, err, constants.ErrWebhookNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"citynext-appointments/internal/auth"
+	"citynext-appointments/internal/config"
+	"citynext-appointments/internal/constants"
+)
+
+const keysUsage = `usage: citynext-appointments keys <command>
+
+commands:
+  create -name NAME -role ROLE [-staff ID] [-tenant SLUG]
+                                 create a key; roles: citizen-portal, front-desk, admin;
+                                 -staff ties the key to a staff member
+  revoke -id ID [-tenant SLUG]   revoke a key
+  list [-tenant SLUG]            list all keys
+
+Keys belong to the tenant given by -tenant, "default" unless set, and only
+work for it. The database is taken from CONFIG_FILE and the usual environment
+variables.`
+
+// runKeysCommand implements the "keys" subcommand for managing API keys
+func runKeysCommand(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", keysUsage)
+	}
+
+	cfg, _, err := config.Load(nil)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	database, tenants, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	store := auth.NewKeyStore(database)
+
+	fs := flag.NewFlagSet("keys "+args[0], flag.ContinueOnError)
+	fs.SetOutput(out)
+	tenantSlug := fs.String("tenant", "default", "slug of the tenant the key belongs to")
+
+	switch args[0] {
+	case "create":
+		name := fs.String("name", "", "human readable owner of the key")
+		role := fs.String("role", "", "role granted to the key")
+		staffID := fs.Int("staff", 0, "id of the staff member the key belongs to")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *name == "" {
+			return fmt.Errorf("-name is required")
+		}
+		parsedRole, err := auth.ParseRole(*role)
+		if err != nil {
+			return err
+		}
+		ctx, err := tenantContext(tenants, *tenantSlug)
+		if err != nil {
+			return err
+		}
+
+		key, plaintext, err := store.Create(ctx, *name, parsedRole, *staffID)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Created key %d (%s, %s)\n", key.ID, key.Name, key.Role)
+		fmt.Fprintf(out, "%s\n", plaintext)
+		fmt.Fprintln(out, "Store this key now, it cannot be shown again.")
+		return nil
+
+	case "revoke":
+		id := fs.String("id", "", "id of the key to revoke")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		keyID, err := strconv.Atoi(*id)
+		if err != nil {
+			return fmt.Errorf("-id must be a number")
+		}
+		ctx, err := tenantContext(tenants, *tenantSlug)
+		if err != nil {
+			return err
+		}
+		if err := store.Revoke(ctx, keyID); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Revoked key %d\n", keyID)
+		return nil
+
+	case "list":
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		ctx, err := tenantContext(tenants, *tenantSlug)
+		if err != nil {
+			return err
+		}
+		keys, err := store.List(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tROLE\tPREFIX\tCREATED\tSTATUS")
+		for _, key := range keys {
+			status := "active"
+			if key.RevokedAt != nil {
+				status = "revoked " + key.RevokedAt.Format(constants.DateLayout)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", key.ID, key.Name, key.Role, key.Prefix,
+				key.CreatedAt.Format(constants.DateLayout), status)
+		}
+		return w.Flush()
+	}
+
+	return fmt.Errorf("unknown keys command %q\n%s", args[0], keysUsage)
+}
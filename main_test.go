@@ -19,9 +19,10 @@ func TestIntegration_CreateAppointment(t *testing.T) {
 	}
 
 	req := models.CreateAppointmentRequest{
-		FirstName: "John",
-		LastName:  "Doe",
-		VisitDate: "2075-06-15",
+		FirstName:   "John",
+		LastName:    "Doe",
+		VisitDate:   "2075-06-15",
+		ServiceType: "general",
 	}
 
 	reqBytes, err := json.Marshal(req)
@@ -241,9 +242,10 @@ func BenchmarkDateParse(b *testing.B) {
 // Example test for HTTP request construction
 func TestHTTPRequestConstruction(t *testing.T) {
 	req := models.CreateAppointmentRequest{
-		FirstName: "John",
-		LastName:  "Doe",
-		VisitDate: "2075-06-15",
+		FirstName:   "John",
+		LastName:    "Doe",
+		VisitDate:   "2075-06-15",
+		ServiceType: "general",
 	}
 
 	// Marshal request
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"citynext-appointments/internal/config"
+	"citynext-appointments/internal/service"
+)
+
+const purgeUsage = `usage: citynext-appointments purge [-dry-run] [-tenant SLUG]
+
+Anonymises appointments and waitlist entries of the tenant, "default" unless
+set, of visits older than the retention period once, like the retention job. The period and batch size are taken from
+CONFIG_FILE and the usual environment variables.`
+
+// runPurgeCommand implements the "purge" subcommand for running the retention job by hand
+func runPurgeCommand(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("purge", flag.ContinueOnError)
+	fs.SetOutput(out)
+	fs.Usage = func() { fmt.Fprintln(out, purgeUsage) }
+
+	dryRun := fs.Bool("dry-run", false, "only count what is due")
+	tenantSlug := fs.String("tenant", "default", "slug of the tenant to purge")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, _, err := config.Load(nil)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if _, err := useEncryption(cfg.Encryption); err != nil {
+		return err
+	}
+
+	database, tenants, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	tenantCtx, err := tenantContext(tenants, *tenantSlug)
+	if err != nil {
+		return err
+	}
+
+	// The retention period runs on the same clock the server uses, simulated or not
+	ctx := context.Background()
+	appClock, err := newClock(ctx, cfg.Time, database)
+	if err != nil {
+		return fmt.Errorf("failed to set up clock: %w", err)
+	}
+
+	run, err := service.NewRetentionService(database, appClock.Now, cfg.Retention.Days, cfg.Retention.BatchSize).Purge(tenantCtx, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, run)
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"citynext-appointments/internal/config"
+	"citynext-appointments/internal/service"
+	"citynext-appointments/internal/tenant"
+)
+
+const rotateKeysUsage = `usage: citynext-appointments rotate-keys [-batch-size N]
+
+Brings every stored citizen name onto the primary encryption key: names sealed
+with an older key are rewrapped and names stored before encryption was turned on
+are encrypted, for every tenant. Run it after adding a new primary key; once it has finished the
+old key can be removed. It also recomputes phonetic name keys stored under
+older matching rules, which is all it does when encryption is off. Keys are
+taken from CONFIG_FILE and the usual environment variables.`
+
+// runRotateKeysCommand implements the "rotate-keys" subcommand for key rotation
+func runRotateKeysCommand(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("rotate-keys", flag.ContinueOnError)
+	fs.SetOutput(out)
+	fs.Usage = func() { fmt.Fprintln(out, rotateKeysUsage) }
+
+	batchSize := fs.Int("batch-size", 500, "rows rewritten per transaction")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *batchSize < 1 {
+		return fmt.Errorf("%s", rotateKeysUsage)
+	}
+
+	cfg, _, err := config.Load(nil)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	keyring, err := useEncryption(cfg.Encryption)
+	if err != nil {
+		return err
+	}
+
+	database, tenants, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	rotation := service.NewKeyRotationService(database, *batchSize)
+	for _, t := range tenants.All() {
+		ctx := tenant.WithTenant(context.Background(), t)
+		if keyring != nil {
+			report, err := rotation.Rotate(ctx, keyring)
+			if err != nil {
+				return fmt.Errorf("tenant %s: %w", t.Slug, err)
+			}
+			fmt.Fprintf(out, "%s: rewrote the names of %d appointments, %d waitlist entries, %d history entries, %d events and %d webhook deliveries\n",
+				t.Slug, report.Appointments, report.WaitlistEntries, report.HistoryEntries, report.OutboxEvents, report.WebhookDeliveries)
+		}
+
+		refreshed, err := rotation.RefreshPhoneticKeys(ctx, keyring)
+		if err != nil {
+			return fmt.Errorf("tenant %s: %w", t.Slug, err)
+		}
+		fmt.Fprintf(out, "%s: refreshed the phonetic keys of %d appointments\n", t.Slug, refreshed)
+	}
+	return nil
+}
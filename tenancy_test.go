@@ -0,0 +1,100 @@
+// Integration tests for tenant isolation by row-level security
+// Requires the database from docker-compose, or the one DATABASE_URL points to
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"citynext-appointments/internal/config"
+	"citynext-appointments/internal/db"
+	"citynext-appointments/internal/tenant"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantIsolation(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping tenant isolation test in short mode")
+	}
+
+	cfg, _, err := config.Load(nil)
+	require.NoError(t, err)
+	database, err := db.NewDB(cfg.Database.URL)
+	if err != nil {
+		t.Skipf("Database not available: %v", err)
+	}
+	defer database.Close()
+	database.WithTenantPools(cfg.Tenancy.DatabaseRole)
+	require.NoError(t, database.CheckRowSecurity(context.Background()))
+
+	// Two throwaway tenants, created and removed outside any tenant session
+	suffix := time.Now().UnixNano()
+	var first, second tenant.Tenant
+	for i, created := range []*tenant.Tenant{&first, &second} {
+		created.Slug = fmt.Sprintf("isolation-%d-%d", suffix, i)
+		err := database.QueryRowContext(context.Background(),
+			`INSERT INTO tenants (slug, name) VALUES ($1, $1) RETURNING id`, created.Slug).Scan(&created.ID)
+		require.NoError(t, err)
+	}
+	defer database.ExecContext(context.Background(), `DELETE FROM tenants WHERE id IN ($1, $2)`, first.ID, second.ID)
+
+	firstCtx := tenant.WithTenant(context.Background(), &first)
+	secondCtx := tenant.WithTenant(context.Background(), &second)
+	defer database.ExecContext(firstCtx, `DELETE FROM service_types`)
+	defer database.ExecContext(secondCtx, `DELETE FROM service_types`)
+
+	// The same code can exist once per tenant
+	for _, ctx := range []context.Context{firstCtx, secondCtx} {
+		_, err := database.ExecContext(ctx,
+			`INSERT INTO service_types (code, name, duration_minutes, daily_quota) VALUES ('general', $1, 30, 1)`,
+			fmt.Sprintf("General enquiry of tenant %d", tenant.IDFrom(ctx)))
+		require.NoError(t, err)
+	}
+
+	var names []string
+	rows, err := database.QueryContext(firstCtx, `SELECT name FROM service_types`)
+	require.NoError(t, err)
+	for rows.Next() {
+		var name string
+		require.NoError(t, rows.Scan(&name))
+		names = append(names, name)
+	}
+	require.NoError(t, rows.Err())
+	rows.Close()
+	assert.Equal(t, []string{fmt.Sprintf("General enquiry of tenant %d", first.ID)}, names,
+		"a query without a tenant condition only sees the tenant's own rows")
+
+	result, err := database.ExecContext(secondCtx, `UPDATE service_types SET name = 'taken over' WHERE tenant_id = $1`, first.ID)
+	require.NoError(t, err)
+	affected, err := result.RowsAffected()
+	require.NoError(t, err)
+	assert.Zero(t, affected, "another tenant's rows cannot be changed")
+
+	_, err = database.ExecContext(secondCtx,
+		`INSERT INTO service_types (tenant_id, code, name, duration_minutes, daily_quota) VALUES ($1, 'smuggled', 'Smuggled', 30, 1)`, first.ID)
+	assert.Error(t, err, "rows cannot be written into another tenant")
+
+	var count int
+	require.NoError(t, database.QueryRowContext(secondCtx, `SELECT COUNT(*) FROM appointments a JOIN service_types s
+		ON s.tenant_id = a.tenant_id AND s.code = a.service_type`).Scan(&count))
+	assert.Zero(t, count, "a new tenant sees none of the existing appointments")
+
+	// Statements without a tenant run on the main pool, which row-level security applies to as well
+	require.NoError(t, database.QueryRowContext(context.Background(),
+		`SELECT COUNT(*) FROM service_types WHERE tenant_id IN ($1, $2)`, first.ID, second.ID).Scan(&count))
+	assert.Zero(t, count, "a session without a tenant sees no tenant rows")
+
+	result, err = database.ExecContext(context.Background(), `UPDATE service_types SET name = 'taken over' WHERE tenant_id = $1`, first.ID)
+	require.NoError(t, err)
+	affected, err = result.RowsAffected()
+	require.NoError(t, err)
+	assert.Zero(t, affected, "a session without a tenant cannot change tenant rows")
+
+	_, err = database.ExecContext(context.Background(),
+		`INSERT INTO service_types (tenant_id, code, name, duration_minutes, daily_quota) VALUES ($1, 'untenanted', 'Untenanted', 30, 1)`, first.ID)
+	assert.Error(t, err, "a session without a tenant cannot write tenant rows")
+}